@@ -0,0 +1,70 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"github.com/Masterminds/semver"
+)
+
+// BuildpackAPIFeatures are the capabilities of the lifecycle that a buildpack, or extension, can use, depending on the
+// Buildpack API version it declares.
+type BuildpackAPIFeatures struct {
+
+	// SupportsSBOM indicates support for SBOM files in the layers directory, from Buildpack API 0.7.
+	SupportsSBOM bool
+
+	// SupportsProcessWorkingDir indicates support for setting the working directory of a process, from Buildpack API
+	// 0.8.
+	SupportsProcessWorkingDir bool
+
+	// SupportsExtensions indicates support for image extensions, from Buildpack API 0.9.
+	SupportsExtensions bool
+
+	// ExecutesProcessesDirectly indicates that the lifecycle executes every process directly, without wrapping its
+	// command in a shell, and no longer accepts the direct key for processes, from Buildpack API 0.9.
+	ExecutesProcessesDirectly bool
+
+	// SupportsTargets indicates support for [[targets]] in buildpack.toml and for target information in the
+	// CNB_TARGET_* variables, from Buildpack API 0.10.
+	SupportsTargets bool
+
+	// DeprecatesStacks indicates that [[stacks]] in buildpack.toml are deprecated in favor of [[targets]], from
+	// Buildpack API 0.10.
+	DeprecatesStacks bool
+}
+
+// APIFeatures returns the features available to a buildpack, or extension, declaring the given Buildpack API version.
+// No features are available if the version cannot be parsed.
+func APIFeatures(version string) BuildpackAPIFeatures {
+	api, err := semver.NewVersion(version)
+	if err != nil {
+		return BuildpackAPIFeatures{}
+	}
+
+	atLeast := func(minimum string) bool {
+		return !api.LessThan(semver.MustParse(minimum))
+	}
+
+	return BuildpackAPIFeatures{
+		SupportsSBOM:              atLeast("0.7"),
+		SupportsProcessWorkingDir: atLeast("0.8"),
+		SupportsExtensions:        atLeast("0.9"),
+		ExecutesProcessesDirectly: atLeast("0.9"),
+		SupportsTargets:           atLeast("0.10"),
+		DeprecatesStacks:          atLeast("0.10"),
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func testAPIFeatures(t *testing.T, _ spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("returns no features for an unparseable version", func() {
+		Expect(libcnb.APIFeatures("")).To(Equal(libcnb.BuildpackAPIFeatures{}))
+		Expect(libcnb.APIFeatures("test-version")).To(Equal(libcnb.BuildpackAPIFeatures{}))
+	})
+
+	it("returns features for Buildpack API 0.6", func() {
+		Expect(libcnb.APIFeatures("0.6")).To(Equal(libcnb.BuildpackAPIFeatures{}))
+	})
+
+	it("returns features for Buildpack API 0.8", func() {
+		Expect(libcnb.APIFeatures("0.8")).To(Equal(libcnb.BuildpackAPIFeatures{
+			SupportsSBOM:              true,
+			SupportsProcessWorkingDir: true,
+		}))
+	})
+
+	it("returns features for Buildpack API 0.9", func() {
+		Expect(libcnb.APIFeatures("0.9")).To(Equal(libcnb.BuildpackAPIFeatures{
+			SupportsSBOM:              true,
+			SupportsProcessWorkingDir: true,
+			SupportsExtensions:        true,
+			ExecutesProcessesDirectly: true,
+		}))
+	})
+
+	it("returns features for Buildpack API 0.10", func() {
+		Expect(libcnb.APIFeatures("0.10")).To(Equal(libcnb.BuildpackAPIFeatures{
+			SupportsSBOM:              true,
+			SupportsProcessWorkingDir: true,
+			SupportsExtensions:        true,
+			ExecutesProcessesDirectly: true,
+			SupportsTargets:           true,
+			DeprecatesStacks:          true,
+		}))
+	})
+}
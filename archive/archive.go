@@ -0,0 +1,354 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package archive contains streaming helpers for storing directories as gzip or zstd compressed archives, such as large
+// build artifacts stashed in cache layers, without depending on tar or compression binaries in the build image.
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/buildpacks/libcnb/v2/reproducible"
+)
+
+// Format is the compression format of an archive.
+type Format string
+
+const (
+	// FormatGzip compresses archives with gzip.
+	FormatGzip Format = "gzip"
+
+	// FormatZstd compresses archives with zstd, which is faster than gzip and compresses better.
+	FormatZstd Format = "zstd"
+)
+
+// zstdMagic is the magic number that starts a zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// ChecksumSuffix is appended to the path of an archive written by WriteFile to name the file holding its SHA256
+// checksum.
+const ChecksumSuffix = ".sha256"
+
+// ErrChecksumMismatch is returned by ReadFile when an archive does not match its recorded checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Compress writes the contents of the source directory to w as a gzip compressed tar archive. Regular files,
+// directories and symlinks are archived with their permissions. If $SOURCE_DATE_EPOCH is set, it is used as the
+// modification time of every entry.
+func Compress(w io.Writer, source string) error {
+	return CompressWithFormat(w, source, FormatGzip)
+}
+
+// CompressWithFormat writes the contents of the source directory to w as a tar archive compressed with the given
+// format, as Compress does.
+func CompressWithFormat(w io.Writer, source string, format Format) error {
+	epoch, ok, err := reproducible.SourceDateEpoch(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	cw, err := newCompressor(w, format)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+
+	err = filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if ok {
+			header.ModTime, header.AccessTime, header.ChangeTime = epoch, time.Time{}, time.Time{}
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to archive %s\n%w", source, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("unable to close archive\n%w", err)
+	}
+
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("unable to close archive\n%w", err)
+	}
+
+	return nil
+}
+
+// Decompress extracts the gzip or zstd compressed tar archive read from r into the destination directory, creating it if
+// necessary. The format is detected from the contents of the archive. Entries that would be written outside of destination are rejected, including entries that would be
+// written through a symlink, such as one extracted earlier from the same archive.
+func Decompress(r io.Reader, destination string) error {
+	cr, err := newDecompressor(r)
+	if err != nil {
+		return fmt.Errorf("unable to read archive\n%w", err)
+	}
+	defer cr.Close()
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s\n%w", destination, err)
+	}
+
+	tr := tar.NewReader(cr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("unable to read archive\n%w", err)
+		}
+
+		path := filepath.Join(destination, filepath.FromSlash(header.Name))
+		if path == filepath.Clean(destination) && header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if !strings.HasPrefix(path, filepath.Clean(destination)+string(filepath.Separator)) {
+			return fmt.Errorf("illegal path in archive %s", header.Name)
+		}
+		if err := checkNoSymlinks(destination, path); err != nil {
+			return fmt.Errorf("illegal path in archive %s\n%w", header.Name, err)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("unable to create directory %s\n%w", filepath.Dir(path), err)
+		}
+
+		mode := header.FileInfo().Mode()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, mode.Perm()); err != nil {
+				return fmt.Errorf("unable to create directory %s\n%w", path, err)
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, path); err != nil {
+				return fmt.Errorf("unable to create symlink %s\n%w", path, err)
+			}
+		case tar.TypeReg:
+			if err := writeFile(path, tr, mode.Perm()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WriteFile writes the contents of the source directory to path as a gzip compressed tar archive, along with its
+// SHA256 checksum at path + ChecksumSuffix.
+func WriteFile(path string, source string) error {
+	return WriteFileWithFormat(path, source, FormatGzip)
+}
+
+// WriteFileWithFormat writes the contents of the source directory to path as a tar archive compressed with the given
+// format, along with its SHA256 checksum, as WriteFile does.
+func WriteFileWithFormat(path string, source string, format Format) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s\n%w", filepath.Dir(path), err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create %s\n%w", path, err)
+	}
+
+	hash := sha256.New()
+	if err := CompressWithFormat(io.MultiWriter(f, hash), source, format); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to close %s\n%w", path, err)
+	}
+
+	if err := os.WriteFile(path+ChecksumSuffix, []byte(hex.EncodeToString(hash.Sum(nil))), 0644); err != nil {
+		return fmt.Errorf("unable to write %s%s\n%w", path, ChecksumSuffix, err)
+	}
+
+	return nil
+}
+
+// ReadFile verifies the archive at path against the checksum written by WriteFile or WriteFileWithFormat and extracts it
+// into the destination directory. ErrChecksumMismatch is returned if the archive has been modified or truncated, in which case nothing is
+// extracted.
+func ReadFile(path string, destination string) error {
+	expected, err := os.ReadFile(path + ChecksumSuffix)
+	if err != nil {
+		return fmt.Errorf("unable to read %s%s\n%w", path, ChecksumSuffix, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open %s\n%w", path, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return fmt.Errorf("unable to read %s\n%w", path, err)
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != strings.TrimSpace(string(expected)) {
+		return fmt.Errorf("unable to verify %s: %w", path, ErrChecksumMismatch)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to read %s\n%w", path, err)
+	}
+
+	return Decompress(f, destination)
+}
+
+// newCompressor returns a writer that compresses to w with the given format.
+func newCompressor(w io.Writer, format Format) (io.WriteCloser, error) {
+	switch format {
+	case FormatGzip:
+		return gzip.NewWriter(w), nil
+	case FormatZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create zstd writer\n%w", err)
+		}
+		return zw, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// newDecompressor returns a reader that decompresses r, detecting whether it is gzip or zstd compressed.
+func newDecompressor(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if bytes.Equal(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+
+	return gzip.NewReader(br)
+}
+
+// checkNoSymlinks returns an error if path, or any of its parent directories below destination, is an existing symlink,
+// so that extracting to path cannot follow a symlink outside of destination.
+func checkNoSymlinks(destination string, path string) error {
+	rel, err := filepath.Rel(destination, path)
+	if err != nil {
+		return err
+	}
+
+	current := filepath.Clean(destination)
+	for _, element := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, element)
+
+		info, err := os.Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink", current)
+		}
+	}
+
+	return nil
+}
+
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return fmt.Errorf("unable to create %s\n%w", path, err)
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write %s\n%w", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to close %s\n%w", path, err)
+	}
+
+	return nil
+}
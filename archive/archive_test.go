@@ -0,0 +1,195 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2/archive"
+)
+
+func testArchive(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		source      string
+		destination string
+	)
+
+	it.Before(func() {
+		source = t.TempDir()
+		destination = filepath.Join(t.TempDir(), "destination")
+
+		Expect(os.MkdirAll(filepath.Join(source, "alpha", "bravo"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(source, "alpha", "bravo", "test-file"), []byte("test-content"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(source, "test-executable"), []byte("test-content"), 0755)).To(Succeed())
+		Expect(os.Symlink(filepath.Join("alpha", "bravo", "test-file"), filepath.Join(source, "test-link"))).To(Succeed())
+	})
+
+	it("round-trips a directory", func() {
+		b := &bytes.Buffer{}
+		Expect(archive.Compress(b, source)).To(Succeed())
+		Expect(archive.Decompress(b, destination)).To(Succeed())
+
+		Expect(os.ReadFile(filepath.Join(destination, "alpha", "bravo", "test-file"))).To(Equal([]byte("test-content")))
+
+		info, err := os.Stat(filepath.Join(destination, "test-executable"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+
+		Expect(os.Readlink(filepath.Join(destination, "test-link"))).To(Equal(filepath.Join("alpha", "bravo", "test-file")))
+	})
+
+	it("round-trips a directory with zstd", func() {
+		b := &bytes.Buffer{}
+		Expect(archive.CompressWithFormat(b, source, archive.FormatZstd)).To(Succeed())
+		Expect(b.Bytes()[:4]).To(Equal([]byte{0x28, 0xb5, 0x2f, 0xfd}))
+
+		Expect(archive.Decompress(b, destination)).To(Succeed())
+
+		Expect(os.ReadFile(filepath.Join(destination, "alpha", "bravo", "test-file"))).To(Equal([]byte("test-content")))
+		Expect(os.Readlink(filepath.Join(destination, "test-link"))).To(Equal(filepath.Join("alpha", "bravo", "test-file")))
+	})
+
+	it("fails on unsupported formats", func() {
+		Expect(archive.CompressWithFormat(&bytes.Buffer{}, source, "test-format")).
+			To(MatchError(`unsupported archive format "test-format"`))
+	})
+
+	it("uses SOURCE_DATE_EPOCH as the modification time", func() {
+		t.Setenv("SOURCE_DATE_EPOCH", "1000000000")
+
+		b := &bytes.Buffer{}
+		Expect(archive.Compress(b, source)).To(Succeed())
+
+		gz, err := gzip.NewReader(b)
+		Expect(err).NotTo(HaveOccurred())
+		header, err := tar.NewReader(gz).Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.ModTime).To(BeTemporally("==", time.Unix(1000000000, 0)))
+	})
+
+	it("rejects entries outside of the destination", func() {
+		b := &bytes.Buffer{}
+		gz := gzip.NewWriter(b)
+		tw := tar.NewWriter(gz)
+		Expect(tw.WriteHeader(&tar.Header{Name: "../test-file", Mode: 0644, Typeflag: tar.TypeReg})).To(Succeed())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gz.Close()).To(Succeed())
+
+		Expect(archive.Decompress(b, destination)).To(MatchError("illegal path in archive ../test-file"))
+	})
+
+	it("extracts archives with an entry for the root directory", func() {
+		b := &bytes.Buffer{}
+		gz := gzip.NewWriter(b)
+		tw := tar.NewWriter(gz)
+		Expect(tw.WriteHeader(&tar.Header{Name: "./", Mode: 0755, Typeflag: tar.TypeDir})).To(Succeed())
+		Expect(tw.WriteHeader(&tar.Header{Name: "./test-file", Mode: 0644, Size: 12, Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write([]byte("test-content"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gz.Close()).To(Succeed())
+
+		Expect(archive.Decompress(b, destination)).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(destination, "test-file"))).To(Equal([]byte("test-content")))
+	})
+
+	it("rejects entries written through a symlink", func() {
+		outside := t.TempDir()
+
+		b := &bytes.Buffer{}
+		gz := gzip.NewWriter(b)
+		tw := tar.NewWriter(gz)
+		Expect(tw.WriteHeader(&tar.Header{Name: "test-link", Linkname: outside, Typeflag: tar.TypeSymlink})).To(Succeed())
+		Expect(tw.WriteHeader(&tar.Header{Name: "test-link/test-file", Mode: 0644, Size: 12, Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write([]byte("test-content"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gz.Close()).To(Succeed())
+
+		Expect(archive.Decompress(b, destination)).To(MatchError(
+			fmt.Sprintf("illegal path in archive test-link/test-file\n%s is a symlink", filepath.Join(destination, "test-link"))))
+		Expect(filepath.Join(outside, "test-file")).NotTo(BeAnExistingFile())
+	})
+
+	it("rejects entries that replace a symlink", func() {
+		outside := filepath.Join(t.TempDir(), "test-file")
+		Expect(os.WriteFile(outside, []byte("test-content"), 0644)).To(Succeed())
+
+		b := &bytes.Buffer{}
+		gz := gzip.NewWriter(b)
+		tw := tar.NewWriter(gz)
+		Expect(tw.WriteHeader(&tar.Header{Name: "test-link", Linkname: outside, Typeflag: tar.TypeSymlink})).To(Succeed())
+		Expect(tw.WriteHeader(&tar.Header{Name: "test-link", Mode: 0644, Size: 8, Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write([]byte("modified"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gz.Close()).To(Succeed())
+
+		Expect(archive.Decompress(b, destination)).To(MatchError(ContainSubstring("is a symlink")))
+		Expect(os.ReadFile(outside)).To(Equal([]byte("test-content")))
+	})
+
+	context("files", func() {
+		var path string
+
+		it.Before(func() {
+			path = filepath.Join(t.TempDir(), "cache", "test.tgz")
+		})
+
+		it("writes and verifies the checksum", func() {
+			Expect(archive.WriteFile(path, source)).To(Succeed())
+			Expect(path + archive.ChecksumSuffix).To(BeARegularFile())
+
+			Expect(archive.ReadFile(path, destination)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(destination, "alpha", "bravo", "test-file"))).To(Equal([]byte("test-content")))
+		})
+
+		it("writes and verifies a zstd archive", func() {
+			Expect(archive.WriteFileWithFormat(path, source, archive.FormatZstd)).To(Succeed())
+
+			Expect(archive.ReadFile(path, destination)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(destination, "alpha", "bravo", "test-file"))).To(Equal([]byte("test-content")))
+		})
+
+		it("does not extract a modified archive", func() {
+			Expect(archive.WriteFile(path, source)).To(Succeed())
+
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.WriteString("test-corruption")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+
+			err = archive.ReadFile(path, destination)
+			Expect(errors.Is(err, archive.ErrChecksumMismatch)).To(BeTrue())
+			Expect(destination).NotTo(BeADirectory())
+		})
+	})
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package attest generates in-toto statements with SLSA provenance predicates describing the layers a buildpack
+// contributes.
+package attest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/reproducible"
+)
+
+const (
+	// StatementType is the in-toto statement type.
+	StatementType = "https://in-toto.io/Statement/v1"
+
+	// PredicateType is the SLSA provenance predicate type.
+	PredicateType = "https://slsa.dev/provenance/v1"
+
+	// BuildType identifies provenance produced by a Cloud Native Buildpack.
+	BuildType = "https://buildpacks.io/provenance/build/v1"
+)
+
+// Statement is an in-toto statement.
+type Statement struct {
+	// Type is the statement type.
+	Type string `json:"_type"`
+
+	// Subject is the collection of artifacts the statement is about.
+	Subject []ResourceDescriptor `json:"subject"`
+
+	// PredicateType is the type of the predicate.
+	PredicateType string `json:"predicateType"`
+
+	// Predicate is the SLSA provenance of the subject.
+	Predicate Provenance `json:"predicate"`
+}
+
+// Provenance is a SLSA provenance predicate.
+type Provenance struct {
+	// BuildDefinition describes the inputs to the build.
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+
+	// RunDetails describes the build that was run.
+	RunDetails RunDetails `json:"runDetails"`
+}
+
+// BuildDefinition describes the inputs to a build.
+type BuildDefinition struct {
+	// BuildType identifies the template for the build.
+	BuildType string `json:"buildType"`
+
+	// ExternalParameters are the parameters of the build, here the target it was run for.
+	ExternalParameters map[string]interface{} `json:"externalParameters"`
+
+	// ResolvedDependencies are the artifacts fetched during the build.
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+// RunDetails describes a build that was run.
+type RunDetails struct {
+	// Builder is the entity that ran the build.
+	Builder Builder `json:"builder"`
+}
+
+// Builder identifies the entity that ran a build.
+type Builder struct {
+	// ID is the ID of the builder.
+	ID string `json:"id"`
+
+	// Version is the version of the builder and its components.
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// ResourceDescriptor describes an artifact.
+type ResourceDescriptor struct {
+	// Name is the name of the artifact.
+	Name string `json:"name,omitempty"`
+
+	// URI is the location of the artifact.
+	URI string `json:"uri,omitempty"`
+
+	// Digest is the collection of digests of the artifact, keyed by algorithm.
+	Digest map[string]string `json:"digest"`
+}
+
+// NewStatement creates a statement recording that the buildpack, running in the given build context, contributed the
+// dependencies. The subjects and resolved dependencies of the statement are the dependencies, and the version of the
+// builder records the versions of both the buildpack and libcnb.
+func NewStatement(context libcnb.BuildContext, dependencies ...libcnb.BuildpackDependency) Statement {
+	info := context.Buildpack.Info
+
+	statement := Statement{
+		Type:          StatementType,
+		PredicateType: PredicateType,
+		Subject:       []ResourceDescriptor{},
+		Predicate: Provenance{
+			BuildDefinition: BuildDefinition{
+				BuildType: BuildType,
+				ExternalParameters: map[string]interface{}{
+					"target": map[string]string{
+						"os":             context.TargetInfo.OS,
+						"arch":           context.TargetInfo.Arch,
+						"variant":        context.TargetInfo.Variant,
+						"distro-name":    context.TargetDistro.Name,
+						"distro-version": context.TargetDistro.Version,
+					},
+				},
+			},
+			RunDetails: RunDetails{
+				Builder: Builder{
+					ID:      info.ID,
+					Version: map[string]string{info.ID: info.Version, "libcnb": libcnb.Version()},
+				},
+			},
+		},
+	}
+
+	for _, d := range dependencies {
+		digest := map[string]string{"sha256": d.SHA256}
+
+		statement.Subject = append(statement.Subject, ResourceDescriptor{Name: d.ArtifactName(), Digest: digest})
+		statement.Predicate.BuildDefinition.ResolvedDependencies = append(statement.Predicate.BuildDefinition.ResolvedDependencies,
+			ResourceDescriptor{Name: d.ID, URI: d.URI, Digest: digest})
+	}
+
+	return statement
+}
+
+// Path returns the location of the provenance document for a layer, alongside the layer's SBOM files.
+func Path(layer libcnb.Layer) string {
+	return filepath.Join(filepath.Dir(layer.Path), fmt.Sprintf("%s.provenance.json", layer.Name))
+}
+
+// Write writes the statement to the provenance document for the layer.
+func Write(layer libcnb.Layer, statement Statement) error {
+	b, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode provenance for %s\n%w", layer.Name, err)
+	}
+
+	file := Path(layer)
+	//nolint:gosec
+	if err := os.WriteFile(file, b, 0644); err != nil {
+		return fmt.Errorf("unable to write provenance %s\n%w", file, err)
+	}
+
+	return reproducible.Touch(file, os.LookupEnv)
+}
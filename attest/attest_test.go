@@ -0,0 +1,91 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package attest_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/attest"
+)
+
+func testAttest(t *testing.T, _ spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		context    libcnb.BuildContext
+		dependency libcnb.BuildpackDependency
+	)
+
+	it.Before(func() {
+		context = libcnb.BuildContext{
+			Buildpack: libcnb.Buildpack{
+				Info: libcnb.BuildpackInfo{ID: "test-id", Version: "1.1.1"},
+			},
+			TargetInfo:   libcnb.TargetInfo{OS: "linux", Arch: "amd64"},
+			TargetDistro: libcnb.TargetDistro{Name: "ubuntu", Version: "22.04"},
+		}
+
+		dependency = libcnb.BuildpackDependency{
+			ID:     "test-dependency",
+			URI:    "https://localhost/test-artifact.tgz",
+			SHA256: "test-sha256",
+		}
+	})
+
+	it("records the buildpack, target, and dependencies", func() {
+		statement := attest.NewStatement(context, dependency)
+
+		Expect(statement.Type).To(Equal(attest.StatementType))
+		Expect(statement.PredicateType).To(Equal(attest.PredicateType))
+		Expect(statement.Subject).To(Equal([]attest.ResourceDescriptor{
+			{Name: "test-artifact.tgz", Digest: map[string]string{"sha256": "test-sha256"}},
+		}))
+		Expect(statement.Predicate.BuildDefinition.ResolvedDependencies).To(Equal([]attest.ResourceDescriptor{
+			{Name: "test-dependency", URI: "https://localhost/test-artifact.tgz", Digest: map[string]string{"sha256": "test-sha256"}},
+		}))
+		Expect(statement.Predicate.BuildDefinition.ExternalParameters).To(HaveKeyWithValue("target", map[string]string{
+			"os":             "linux",
+			"arch":           "amd64",
+			"variant":        "",
+			"distro-name":    "ubuntu",
+			"distro-version": "22.04",
+		}))
+		Expect(statement.Predicate.RunDetails.Builder).To(Equal(attest.Builder{
+			ID:      "test-id",
+			Version: map[string]string{"test-id": "1.1.1", "libcnb": libcnb.Version()},
+		}))
+	})
+
+	it("writes the statement alongside the layer SBOMs", func() {
+		path := t.TempDir()
+		layer := libcnb.Layer{Name: "test-layer", Path: filepath.Join(path, "test-layer")}
+
+		Expect(attest.Path(layer)).To(Equal(filepath.Join(path, "test-layer.provenance.json")))
+		Expect(attest.Write(layer, attest.NewStatement(context, dependency))).To(Succeed())
+
+		b, err := os.ReadFile(attest.Path(layer))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring(`"_type": "https://in-toto.io/Statement/v1"`))
+		Expect(string(b)).To(ContainSubstring(`"uri": "https://localhost/test-artifact.tgz"`))
+	})
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package bindings helps exec.d executables and other launch-time processes resolve the service bindings available to
+// the application and project them into its environment.
+//
+// At launch the lifecycle does not provide the build-time platform directory, so bindings are resolved from the
+// process environment: $SERVICE_BINDING_ROOT, then $CNB_PLATFORM_DIR/bindings, then $VCAP_SERVICES, and finally
+// libcnb.DefaultPlatformBindingsLocation.
+package bindings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+// EnvPrefix is the prefix of the names of the environment variables a binding's secrets are projected into.
+const EnvPrefix = "SERVICE_BINDING"
+
+type resolution struct {
+	bindings libcnb.Bindings
+	err      error
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[string]resolution{}
+)
+
+// ResolveAtLaunch returns the bindings available to the application at launch. The bindings are resolved once per
+// distinct value of the launch-time environment variables that locate them, and the result is reused by subsequent
+// calls so that an exec.d executable projecting several bindings reads the bindings directory only once.
+func ResolveAtLaunch() (libcnb.Bindings, error) {
+	key := strings.Join([]string{
+		os.Getenv(libcnb.EnvServiceBindings),
+		os.Getenv(libcnb.EnvPlatformDirectory),
+		os.Getenv(libcnb.EnvVcapServices),
+	}, "\x00")
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if r, ok := cache[key]; ok {
+		return r.bindings, r.err
+	}
+
+	b, err := libcnb.NewBindings(filepath.Dir(libcnb.DefaultPlatformBindingsLocation))
+	if err != nil {
+		err = fmt.Errorf("unable to resolve bindings at launch\n%w", err)
+	}
+
+	cache[key] = resolution{bindings: b, err: err}
+	return b, err
+}
+
+// EnvironmentVariableName returns the name of the environment variable a binding's secret is projected into. Following
+// the Kubernetes service binding convention, the name is SERVICE_BINDING_<NAME>_<KEY> upper-cased, with every
+// character that is not a letter, digit or underscore replaced by an underscore.
+func EnvironmentVariableName(binding libcnb.Binding, key string) string {
+	return sanitize(strings.Join([]string{EnvPrefix, binding.Name, key}, "_"))
+}
+
+// Environment returns the secrets of the bindings as environment variables, named by EnvironmentVariableName. When
+// the names of two secrets collide, the secret of the later binding wins.
+func Environment(bindings libcnb.Bindings) map[string]string {
+	env := map[string]string{}
+	for _, b := range bindings {
+		for k, v := range b.Secret {
+			env[EnvironmentVariableName(b, k)] = v
+		}
+	}
+	return env
+}
+
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, name)
+}
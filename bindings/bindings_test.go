@@ -0,0 +1,111 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bindings_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/bindings"
+)
+
+func testBindings(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("ResolveAtLaunch", func() {
+		var root string
+
+		it.Before(func() {
+			root = t.TempDir()
+			Expect(os.MkdirAll(filepath.Join(root, "alpha"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(root, "alpha", "type"), []byte("test-type"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(root, "alpha", "password"), []byte("test-password"), 0600)).To(Succeed())
+
+			t.Setenv(libcnb.EnvServiceBindings, root)
+		})
+
+		it("resolves bindings from SERVICE_BINDING_ROOT", func() {
+			b, err := bindings.ResolveAtLaunch()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(HaveLen(1))
+			Expect(b[0].Name).To(Equal("alpha"))
+			Expect(b[0].Secret).To(HaveKeyWithValue("password", "test-password"))
+		})
+
+		it("caches the resolved bindings", func() {
+			_, err := bindings.ResolveAtLaunch()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.RemoveAll(filepath.Join(root, "alpha"))).To(Succeed())
+
+			b, err := bindings.ResolveAtLaunch()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(HaveLen(1))
+		})
+	})
+
+	context("Environment", func() {
+		it("projects secrets following the service binding naming convention", func() {
+			Expect(bindings.Environment(libcnb.Bindings{
+				{Name: "my-db", Secret: map[string]string{"password": "test-password", "host.name": "test-host"}},
+				{Name: "cache", Secret: map[string]string{"URL": "test-url"}},
+			})).To(Equal(map[string]string{
+				"SERVICE_BINDING_MY_DB_PASSWORD":  "test-password",
+				"SERVICE_BINDING_MY_DB_HOST_NAME": "test-host",
+				"SERVICE_BINDING_CACHE_URL":       "test-url",
+			}))
+		})
+	})
+
+	context("types", func() {
+		it("looks up well-known types", func() {
+			t, ok := bindings.LookupType("PostgreSQL")
+			Expect(ok).To(BeTrue())
+			Expect(t).To(Equal(bindings.Type{Name: bindings.TypePostgres, Description: "PostgreSQL database"}))
+		})
+
+		it("registers types", func() {
+			if _, ok := bindings.LookupType("test-type"); !ok {
+				bindings.Register(bindings.Type{Name: "test-type", Description: "test-description"})
+			}
+
+			t, ok := bindings.LookupType("test-type")
+			Expect(ok).To(BeTrue())
+			Expect(t.Description).To(Equal("test-description"))
+			Expect(bindings.Types()).To(ContainElement(t))
+		})
+
+		it("panics on duplicate types", func() {
+			Expect(func() { bindings.Register(bindings.Type{Name: "REDIS"}) }).To(Panic())
+		})
+
+		it("lists types sorted by name", func() {
+			types := bindings.Types()
+			Expect(types[0].Name).To(Equal(bindings.TypeCACertificates))
+			for i := 1; i < len(types); i++ {
+				Expect(types[i-1].Name < types[i].Name).To(BeTrue())
+			}
+		})
+	})
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bindings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+// Well-known binding types, for use with libcnb.Bindings.OfType so that buildpacks look bindings up consistently.
+const (
+	TypeCACertificates      = libcnb.CACertificatesBindingType
+	TypeDependencySignature = libcnb.SignatureBindingType
+	TypeElasticsearch       = "elasticsearch"
+	TypeKafka               = "kafka"
+	TypeMongoDB             = "mongodb"
+	TypeMySQL               = "mysql"
+	TypePostgres            = "postgresql"
+	TypeRabbitMQ            = "rabbitmq"
+	TypeRedis               = "redis"
+)
+
+// Type describes a binding type.
+type Type struct {
+	// Name is the value of the type of bindings of this type.
+	Name string
+
+	// Description is a short description of the bindings of this type, for documentation.
+	Description string
+}
+
+var (
+	typesMu sync.RWMutex
+	types   = map[string]Type{}
+)
+
+func init() {
+	for _, t := range []Type{
+		{Name: TypeCACertificates, Description: "CA certificates added to the system truststore"},
+		{Name: TypeDependencySignature, Description: "Public keys verifying the signatures of downloaded dependencies"},
+		{Name: TypeElasticsearch, Description: "Elasticsearch cluster"},
+		{Name: TypeKafka, Description: "Apache Kafka cluster"},
+		{Name: TypeMongoDB, Description: "MongoDB database"},
+		{Name: TypeMySQL, Description: "MySQL database"},
+		{Name: TypePostgres, Description: "PostgreSQL database"},
+		{Name: TypeRabbitMQ, Description: "RabbitMQ broker"},
+		{Name: TypeRedis, Description: "Redis server"},
+	} {
+		Register(t)
+	}
+}
+
+// Register adds a binding type to the registry, so that ecosystems can document the binding types their buildpacks
+// consume alongside the well-known types. Names are compared case-insensitively. It is intended to be called from an
+// init function and, like database/sql.Register, panics if a type with the same name is already registered.
+func Register(t Type) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+
+	key := strings.ToLower(t.Name)
+	if _, ok := types[key]; ok {
+		panic(fmt.Sprintf("binding type %s is already registered", t.Name))
+	}
+	types[key] = t
+}
+
+// LookupType returns the registered binding type with the given name, compared case-insensitively.
+func LookupType(name string) (Type, bool) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+
+	t, ok := types[strings.ToLower(name)]
+	return t, ok
+}
+
+// Types returns the registered binding types, sorted by name.
+func Types() []Type {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+
+	var s []Type
+	for _, t := range types {
+		s = append(s, t)
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Name < s[j].Name })
+	return s
+}
@@ -17,18 +17,26 @@
 package libcnb
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/Masterminds/semver"
 
-	"github.com/buildpacks/libcnb/v2/internal"
 	"github.com/buildpacks/libcnb/v2/log"
+	"github.com/buildpacks/libcnb/v2/reproducible"
 )
 
 // BuildContext contains the inputs to build.
@@ -40,6 +48,10 @@ type BuildContext struct {
 	// Buildpack is metadata about the buildpack, from buildpack.toml.
 	Buildpack Buildpack
 
+	// BuildpackFS is the buildpack's files. It is the file system set with WithBuildpackFS, or the buildpack directory
+	// if none is set.
+	BuildpackFS fs.FS
+
 	// Layers is the layers available to the buildpack.
 	Layers Layers
 
@@ -63,6 +75,164 @@ type BuildContext struct {
 
 	// TargetDistro is the target distribution (name, version).
 	TargetDistro TargetDistro
+
+	// Phase is the lifecycle phase that invoked the buildpack, PhaseBuild.
+	Phase Phase
+
+	// InvokedAt is the time the phase was invoked.
+	InvokedAt time.Time
+
+	// Arguments are the arguments the buildpack was invoked with.
+	Arguments []string
+
+	// Context is canceled when the phase times out, as set with WithTimeout. Long-running work should observe it.
+	Context context.Context
+
+	lazy         *lazyBuildContext
+	checkpoint   *checkpoint
+	secretStores SecretStores
+}
+
+// checkpoint records the layers that have been completed during a build, so they can be persisted if the build is
+// terminated.
+type checkpoint struct {
+	mu         sync.Mutex
+	layers     []Layer
+	terminated bool
+	finished   bool
+}
+
+// complete records layer as complete, replacing any layer previously recorded with the same name.
+func (c *checkpoint) complete(layer Layer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, l := range c.layers {
+		if l.Name == layer.Name {
+			c.layers[i] = layer
+			return
+		}
+	}
+	c.layers = append(c.layers, layer)
+}
+
+// finish marks the build as finished and returns whether it was terminated first.
+func (c *checkpoint) finish() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.finished = true
+	return c.terminated
+}
+
+// terminate marks the build as terminated, unless it has already finished, and returns whether it was.
+func (c *checkpoint) terminate() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.finished {
+		return false
+	}
+	c.terminated = true
+	return true
+}
+
+// persist writes the completed layers and removes the metadata of all other layers with remove, returning the error
+// the terminated build exits with.
+func (c *checkpoint) persist(config Config, layersPath string, remove func(string) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	log.Warn(config.logger, "Build terminated, persisting completed layers")
+
+	completed := map[string]bool{}
+	for _, layer := range c.layers {
+		if _, err := writeLayer(config, layersPath, layer, remove); err != nil {
+			return fmt.Errorf("build terminated\n%w", err)
+		}
+		completed[LayerTOMLName(layer.Name)] = true
+	}
+
+	files, err := filepath.Glob(filepath.Join(layersPath, "*.toml"))
+	if err != nil {
+		return fmt.Errorf("build terminated\nunable to list files in layers path %s\n%w", layersPath, err)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		if name == StoreTOMLName || completed[name] {
+			continue
+		}
+		config.logger.Debugf("Removing incomplete layer metadata: %s", file)
+		if err := remove(file); err != nil {
+			return fmt.Errorf("build terminated\nunable to remove file %s\n%w", file, err)
+		}
+	}
+
+	return fmt.Errorf("build terminated, persisted %d completed layer(s)", len(c.layers))
+}
+
+// CompleteLayer marks layer as complete. If partial results are enabled with WithPartialResultsOnTerminate and the build
+// is terminated, the metadata and environment of completed layers are persisted. Otherwise, it does nothing.
+func (b BuildContext) CompleteLayer(layer Layer) {
+	if b.checkpoint == nil {
+		return
+	}
+
+	b.checkpoint.complete(layer)
+}
+
+// lazyBuildContext holds the values of a BuildContext that are read on first access when lazy loading is enabled.
+type lazyBuildContext struct {
+	storeOnce sync.Once
+	store     Store
+	storeErr  error
+	readStore func() (Store, error)
+
+	planOnce sync.Once
+	plan     BuildpackPlan
+	planErr  error
+	readPlan func() (BuildpackPlan, error)
+
+	namespace   string
+	namespacing bool
+}
+
+func (l *lazyBuildContext) loadStore() (Store, error) {
+	l.storeOnce.Do(func() { l.store, l.storeErr = l.readStore() })
+	return l.store, l.storeErr
+}
+
+func (l *lazyBuildContext) loadPlan() (BuildpackPlan, error) {
+	l.planOnce.Do(func() { l.plan, l.planErr = l.readPlan() })
+	return l.plan, l.planErr
+}
+
+// LoadPersistentMetadata returns the persistent metadata. If lazy loading is enabled with WithLazyLoading, store.toml
+// is read on the first call. Otherwise, PersistentMetadata is returned.
+func (b BuildContext) LoadPersistentMetadata() (map[string]interface{}, error) {
+	if b.lazy == nil {
+		return b.PersistentMetadata, nil
+	}
+
+	store, err := b.lazy.loadStore()
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.lazy.namespacing {
+		return store.Metadata, nil
+	}
+	return store.namespace(b.lazy.namespace), nil
+}
+
+// LoadPlan returns the buildpack plan. If lazy loading is enabled with WithLazyLoading, the buildpack plan is read on
+// the first call. Otherwise, Plan is returned.
+func (b BuildContext) LoadPlan() (BuildpackPlan, error) {
+	if b.lazy == nil {
+		return b.Plan, nil
+	}
+
+	return b.lazy.loadPlan()
 }
 
 // BuildResult contains the results of detection.
@@ -85,6 +255,31 @@ type BuildResult struct {
 	// Unmet contains buildpack plan entries that were not satisfied by the buildpack and therefore should be
 	// passed to subsequent providers.
 	Unmet []UnmetPlanEntry
+
+	// Warnings are non-fatal issues found by the buildpack, printed together at the end of the build.
+	Warnings []Warning
+}
+
+// Warning is a non-fatal issue found by a buildpack, such as deprecated configuration or a fallback version being
+// used.
+type Warning struct {
+	// Message describes the issue.
+	Message string `toml:"message"`
+
+	// Remedy describes how to resolve the issue. Optional.
+	Remedy string `toml:"remedy,omitempty"`
+}
+
+// WarningReport is the contents of the warning report written when WithWarningReport is used.
+type WarningReport struct {
+	// Buildpack is the ID of the buildpack that reported the warnings.
+	Buildpack string `toml:"buildpack"`
+
+	// LibcnbVersion is the version of libcnb the buildpack was built with.
+	LibcnbVersion string `toml:"libcnb-version"`
+
+	// Warnings are the warnings reported by the buildpack, including those for the use of deprecated features.
+	Warnings []Warning `toml:"warnings"`
 }
 
 // Constants to track minimum and maximum supported Buildpack API versions
@@ -96,6 +291,21 @@ const (
 	MaxSupportedBPVersion = "0.10"
 )
 
+// stacksDeprecation is reported when a buildpack declares stacks but its API version supports targets.
+func stacksDeprecation(api string) Deprecation {
+	return Deprecation{
+		Feature:     "[[stacks]]",
+		API:         api,
+		Replacement: "[[targets]]",
+		Guidance: `Declare the supported operating systems and architectures in buildpack.toml using [[targets]], for example:
+
+  [[targets]]
+  os = "linux"
+  arch = "amd64"`,
+		Reference: "https://github.com/buildpacks/spec/blob/main/buildpack.md#buildpacktoml-toml",
+	}
+}
+
 // NewBuildResult creates a new BuildResult instance, initializing empty fields.
 func NewBuildResult() BuildResult {
 	return BuildResult{
@@ -115,6 +325,60 @@ func (b BuildResult) String() string {
 	)
 }
 
+// AddStandardLabels adds image labels describing the buildpack, derived from buildpack.toml, so that provenance
+// metadata ends up on the image. Labels are keyed by io.buildpacks.buildpack.<id>.<field> and are only added for
+// fields that are set. Existing labels with the same key are replaced.
+func (b *BuildResult) AddStandardLabels(buildpack Buildpack) {
+	prefix := fmt.Sprintf("io.buildpacks.buildpack.%s", buildpack.Info.ID)
+	licenses := licenseIDs(buildpack.Info.Licenses)
+
+	for _, l := range []Label{
+		{Key: prefix + ".name", Value: buildpack.Info.Name},
+		{Key: prefix + ".version", Value: buildpack.Info.Version},
+		{Key: prefix + ".homepage", Value: buildpack.Info.Homepage},
+		{Key: prefix + ".licenses", Value: strings.Join(licenses, ",")},
+	} {
+		if l.Value != "" {
+			b.setLabel(l)
+		}
+	}
+}
+
+// AddDependencyLicensesLabel adds an image label listing the licenses of the dependencies contributed to the result's
+// layers by DependencyLayer, keyed by io.buildpacks.buildpack.<id>.dependency-licenses. Each license is listed once,
+// and the label is only added if there are any. An existing label with the same key is replaced.
+func (b *BuildResult) AddDependencyLicensesLabel(buildpack Buildpack) {
+	seen := map[string]bool{}
+	var licenses []string
+	for _, layer := range b.Layers {
+		for _, l := range dependencyLayerLicenses(layer) {
+			if !seen[l] {
+				seen[l] = true
+				licenses = append(licenses, l)
+			}
+		}
+	}
+	sort.Strings(licenses)
+
+	if len(licenses) > 0 {
+		b.setLabel(Label{
+			Key:   fmt.Sprintf("io.buildpacks.buildpack.%s.dependency-licenses", buildpack.Info.ID),
+			Value: strings.Join(licenses, ","),
+		})
+	}
+}
+
+func (b *BuildResult) setLabel(label Label) {
+	for i, l := range b.Labels {
+		if l.Key == label.Key {
+			b.Labels[i] = label
+			return
+		}
+	}
+
+	b.Labels = append(b.Labels, label)
+}
+
 // BuildFunc takes a context and returns a result, performing buildpack build behaviors.
 type BuildFunc func(context BuildContext) (BuildResult, error)
 
@@ -125,9 +389,18 @@ func Build(build BuildFunc, config Config) {
 		file string
 		ok   bool
 	)
-	ctx := BuildContext{Logger: config.logger}
+	ctx := BuildContext{Logger: config.contextLogger, Phase: PhaseBuild, InvokedAt: time.Now(), Arguments: config.arguments, secretStores: config.secretStores}
+	env := config.environmentOrProcess()
+
+	if config.observer != nil {
+		config.exitHandler = observingExitHandler{ExitHandler: config.exitHandler, observer: config.observer}
+	}
 
-	ctx.ApplicationPath, err = os.Getwd()
+	if !checkRootUser(config, env) {
+		return
+	}
+
+	ctx.ApplicationPath, err = config.applicationPathOrWd()
 	if err != nil {
 		config.exitHandler.Error(fmt.Errorf("unable to get working directory\n%w", err))
 		return
@@ -139,12 +412,13 @@ func Build(build BuildFunc, config Config) {
 		}
 	}
 
-	if s, ok := os.LookupEnv(EnvBuildpackDirectory); ok {
+	if s, ok := env[EnvBuildpackDirectory]; ok {
 		ctx.Buildpack.Path = filepath.Clean(s)
 	} else {
 		config.exitHandler.Error(fmt.Errorf("unable to get CNB_BUILDPACK_DIR, not found"))
 		return
 	}
+	ctx.BuildpackFS = config.buildpackFSOrDir(ctx.Buildpack.Path)
 
 	if config.logger.IsDebugEnabled() {
 		if err := config.contentWriter.Write("Buildpack contents", ctx.Buildpack.Path); err != nil {
@@ -153,11 +427,13 @@ func Build(build BuildFunc, config Config) {
 	}
 
 	file = filepath.Join(ctx.Buildpack.Path, "buildpack.toml")
-	if _, err = toml.DecodeFile(file, &ctx.Buildpack); err != nil && !os.IsNotExist(err) {
+	if err = decodeTOMLFile(file, &ctx.Buildpack); err != nil && !os.IsNotExist(err) {
 		config.exitHandler.Error(fmt.Errorf("unable to decode buildpack %s\n%w", file, err))
 		return
 	}
-	config.logger.Debugf("Buildpack: %+v", ctx.Buildpack)
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debug(config.contextFormatter.Buildpack(ctx.Buildpack))
+	}
 
 	API, err := semver.NewVersion(ctx.Buildpack.API)
 	if err != nil {
@@ -176,86 +452,199 @@ func Build(build BuildFunc, config Config) {
 		return
 	}
 
-	layersDir, ok := os.LookupEnv(EnvLayersDirectory)
+	features := APIFeatures(ctx.Buildpack.API)
+
+	deprecations, err := newDeprecations(env, config.logger)
+	if err != nil {
+		config.exitHandler.Error(err)
+		return
+	}
+
+	if len(ctx.Buildpack.Stacks) > 0 && features.DeprecatesStacks {
+		if err := deprecations.report(stacksDeprecation(ctx.Buildpack.API)); err != nil {
+			config.exitHandler.Error(err)
+			return
+		}
+	}
+
+	layersDir, ok := env[EnvLayersDirectory]
 	if !ok {
 		config.exitHandler.Error(fmt.Errorf("expected CNB_LAYERS_DIR to be set"))
 		return
 	}
-	ctx.Layers = Layers{layersDir}
+	ctx.Layers = Layers{Path: layersDir, environment: env, tomlWriter: config.tomlWriter, buildpackFS: ctx.BuildpackFS}
 
-	ctx.Platform.Path, ok = os.LookupEnv(EnvPlatformDirectory)
+	ctx.Platform.Path, ok = env[EnvPlatformDirectory]
 	if !ok {
 		config.exitHandler.Error(fmt.Errorf("expected CNB_PLATFORM_DIR to be set"))
 		return
 	}
 
-	buildpackPlanPath, ok := os.LookupEnv(EnvBuildPlanPath)
-	if !ok {
+	ctx.Platform.API = env[EnvPlatformAPI]
+
+	buildpackPlanPath, ok := env[EnvBuildPlanPath]
+	if !ok && !config.hasBuildpackPlan() {
 		config.exitHandler.Error(fmt.Errorf("expected CNB_BP_PLAN_PATH to be set"))
 		return
 	}
 
-	config.logger.Debugf("Layers: %+v", ctx.Layers)
-
 	if config.logger.IsDebugEnabled() {
+		config.logger.Debugf("Layers: %s", ctx.Layers.Path)
+
 		if err := config.contentWriter.Write("Platform contents", ctx.Platform.Path); err != nil {
 			config.logger.Debugf("unable to write platform contents\n%w", err)
 		}
 	}
 
-	if ctx.Platform.Bindings, err = NewBindings(ctx.Platform.Path); err != nil {
+	if ctx.Platform.Bindings, err = newBindings(env, ctx.Platform.Path, config.platformBindingOptions()...); err != nil {
 		config.exitHandler.Error(fmt.Errorf("unable to read platform bindings %s\n%w", ctx.Platform.Path, err))
 		return
 	}
-	config.logger.Debugf("Platform Bindings: %+v", ctx.Platform.Bindings)
+
+	if config.signatureVerifier != nil {
+		ctx.Layers.verifier = config.signatureVerifier
+	} else if verifier, ok, err := NewSignatureVerifier(ctx.Buildpack, ctx.Platform.Bindings); err != nil {
+		config.exitHandler.Error(fmt.Errorf("unable to create dependency signature verifier\n%w", err))
+		return
+	} else if ok {
+		ctx.Layers.verifier = verifier
+	}
 
 	file = filepath.Join(ctx.Platform.Path, "env")
-	if ctx.Platform.Environment, err = internal.NewConfigMapFromPath(file); err != nil {
+	if ctx.Platform.Environment, err = config.readPlatformEnvironment(file); err != nil {
 		config.exitHandler.Error(fmt.Errorf("unable to read platform environment %s\n%w", file, err))
 		return
 	}
-	config.logger.Debugf("Platform Environment: %s", ctx.Platform.Environment)
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debug(config.contextFormatter.Platform(ctx.Platform))
+	}
 
-	var store Store
-	file = filepath.Join(ctx.Layers.Path, "store.toml")
-	if _, err = toml.DecodeFile(file, &store); err != nil && !os.IsNotExist(err) {
-		config.exitHandler.Error(fmt.Errorf("unable to decode persistent metadata %s\n%w", file, err))
+	if ctx.Layers.policy, err = ctx.Platform.NetworkPolicy(); err != nil {
+		config.exitHandler.Error(fmt.Errorf("unable to read network policy\n%w", err))
 		return
 	}
-	ctx.PersistentMetadata = store.Metadata
-	config.logger.Debugf("Persistent Metadata: %+v", ctx.PersistentMetadata)
 
-	if _, err = toml.DecodeFile(buildpackPlanPath, &ctx.Plan); err != nil && !os.IsNotExist(err) {
-		config.exitHandler.Error(fmt.Errorf("unable to decode buildpack plan %s\n%w", buildpackPlanPath, err))
-		return
+	storeFile := ctx.Layers.StoreTOMLPath()
+	readStore := func() (Store, error) {
+		var store Store
+		if err := decodeTOMLFile(storeFile, &store); err != nil && !os.IsNotExist(err) {
+			return Store{}, fmt.Errorf("unable to decode persistent metadata %s\n%w", storeFile, err)
+		}
+		return store, nil
+	}
+
+	readPlan := func() (BuildpackPlan, error) {
+		return config.readBuildpackPlan(buildpackPlanPath)
+	}
+
+	var store Store
+	if config.lazyLoading {
+		ctx.lazy = &lazyBuildContext{
+			readStore:   readStore,
+			readPlan:    readPlan,
+			namespace:   ctx.Buildpack.Info.ID,
+			namespacing: config.storeNamespacing,
+		}
+	} else {
+		if store, err = readStore(); err != nil {
+			config.exitHandler.Error(err)
+			return
+		}
+		if config.storeNamespacing {
+			ctx.PersistentMetadata = store.namespace(ctx.Buildpack.Info.ID)
+		} else {
+			ctx.PersistentMetadata = store.Metadata
+		}
+		config.logger.Debugf("Persistent Metadata: %+v", ctx.PersistentMetadata)
+
+		if ctx.Plan, err = readPlan(); err != nil {
+			config.exitHandler.Error(err)
+			return
+		}
+		config.logger.Debugf("Buildpack Plan: %+v", ctx.Plan)
 	}
-	config.logger.Debugf("Buildpack Plan: %+v", ctx.Plan)
 
-	if ctx.StackID, ok = os.LookupEnv(EnvStackID); !ok {
+	if ctx.StackID, ok = env[EnvStackID]; !ok {
 		config.logger.Debug("CNB_STACK_ID not set")
 	} else {
 		config.logger.Debugf("Stack: %s", ctx.StackID)
 	}
 
-	if API.GreaterThan(semver.MustParse("0.9")) {
+	if features.SupportsTargets {
 		ctx.TargetInfo = TargetInfo{}
-		ctx.TargetInfo.OS, _ = os.LookupEnv(EnvTargetOS)
-		ctx.TargetInfo.Arch, _ = os.LookupEnv(EnvTargetArch)
-		ctx.TargetInfo.Variant, _ = os.LookupEnv(EnvTargetArchVariant)
+		ctx.TargetInfo.OS, _ = env[EnvTargetOS]
+		ctx.TargetInfo.Arch, _ = env[EnvTargetArch]
+		ctx.TargetInfo.Variant, _ = env[EnvTargetArchVariant]
 		config.logger.Debugf("System: %+v", ctx.TargetInfo)
 
 		ctx.TargetDistro = TargetDistro{}
-		ctx.TargetDistro.Name, _ = os.LookupEnv(EnvTargetDistroName)
-		ctx.TargetDistro.Version, _ = os.LookupEnv(EnvTargetDistroVersion)
+		ctx.TargetDistro.Name, _ = env[EnvTargetDistroName]
+		ctx.TargetDistro.Version, _ = env[EnvTargetDistroVersion]
 		config.logger.Debugf("Distro: %+v", ctx.TargetDistro)
 	}
 
-	result, err := build(ctx)
+	explanation := config.buildExplanation
+	if s, ok := env[EnvExplain]; ok && explanation == nil {
+		if explain, err := strconv.ParseBool(s); err == nil && explain {
+			explanation = os.Stdout
+		}
+	}
+	if explanation != nil {
+		if err := explainBuildContext(explanation, ctx); err != nil {
+			config.exitHandler.Error(err)
+			return
+		}
+	}
+
+	config.observe(Event{Type: EventContextResolved})
+
+	var cancel context.CancelFunc
+	ctx.Context, cancel = config.phaseContext()
+	defer cancel()
+
+	if config.partialResultsOnTerminate {
+		checkpoint := &checkpoint{}
+		ctx.checkpoint = checkpoint
+
+		terminate := make(chan os.Signal, 1)
+		signal.Notify(terminate, syscall.SIGTERM)
+		go func() {
+			if _, ok := <-terminate; ok && checkpoint.terminate() {
+				cancel()
+			}
+		}()
+		defer func() {
+			signal.Stop(terminate)
+			close(terminate)
+		}()
+	}
+
+	result, err := callWithTimeout(ctx.Context, config, PhaseBuild, func() (BuildResult, error) { return build(ctx) })
+
+	remove := os.RemoveAll
+	var recorder *dryRunRecorder
+	if config.dryRun {
+		recorder = &dryRunRecorder{}
+		config.environmentWriter = dryRunEnvironmentWriter{recorder}
+		config.tomlWriter = dryRunTOMLWriter{recorder}
+		remove = recorder.remove
+	}
+
+	if ctx.checkpoint != nil && ctx.checkpoint.finish() && err != nil {
+		err = ctx.checkpoint.persist(config, ctx.Layers.Path, remove)
+	}
+
+	if rerr := remove(filepath.Join(ctx.Layers.Path, scratchDirectory)); rerr != nil && err == nil {
+		err = fmt.Errorf("unable to remove scratch directories\n%w", rerr)
+	}
 	if err != nil {
 		config.exitHandler.Error(err)
 		return
 	}
-	config.logger.Debugf("Result: %+v", result)
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debugf("Result: %+v", result)
+	}
+	config.observe(Event{Type: EventBuildFuncReturned})
 
 	file = filepath.Join(ctx.Layers.Path, "*.toml")
 	existing, err := filepath.Glob(file)
@@ -265,48 +654,66 @@ func Build(build BuildFunc, config Config) {
 	}
 	var contributed []string
 
+	if err := validateLayers(result.Layers); err != nil {
+		config.exitHandler.Error(err)
+		return
+	}
+
 	for _, layer := range result.Layers {
-		file = filepath.Join(layer.Path, "env.build")
-		config.logger.Debugf("Writing layer env.build: %s <= %+v", file, layer.BuildEnvironment)
-		if err = config.environmentWriter.Write(file, layer.BuildEnvironment); err != nil {
-			config.exitHandler.Error(fmt.Errorf("unable to write layer env.build %s\n%w", file, err))
+		if file, err = writeLayer(config, ctx.Layers.Path, layer, remove); err != nil {
+			config.exitHandler.Error(err)
 			return
 		}
+		contributed = append(contributed, file)
 
-		file = filepath.Join(layer.Path, "env.launch")
-		config.logger.Debugf("Writing layer env.launch: %s <= %+v", file, layer.LaunchEnvironment)
-		if err = config.environmentWriter.Write(file, layer.LaunchEnvironment); err != nil {
-			config.exitHandler.Error(fmt.Errorf("unable to write layer env.launch %s\n%w", file, err))
-			return
+		if config.dryRun {
+			continue
 		}
 
-		file = filepath.Join(layer.Path, "env")
-		config.logger.Debugf("Writing layer env: %s <= %+v", file, layer.SharedEnvironment)
-		if err = config.environmentWriter.Write(file, layer.SharedEnvironment); err != nil {
-			config.exitHandler.Error(fmt.Errorf("unable to write layer env %s\n%w", file, err))
-			return
+		for _, hook := range config.layerPersistenceHooks {
+			if err = hook(layer); err != nil {
+				config.exitHandler.Error(fmt.Errorf("unable to run layer persistence hook for %s\n%w", layer.Name, err))
+				return
+			}
 		}
 
-		file = filepath.Join(ctx.Layers.Path, fmt.Sprintf("%s.toml", layer.Name))
-		config.logger.Debugf("Writing layer metadata: %s <= %+v", file, layer)
-		if err = config.tomlWriter.Write(file, layer); err != nil {
-			config.exitHandler.Error(fmt.Errorf("unable to write layer metadata %s\n%w", file, err))
+		config.observe(Event{Type: EventLayerWritten, Layer: layer.Name, Path: file})
+	}
+
+	for _, e := range existing {
+		if strings.HasSuffix(e, StoreTOMLName) || contains(contributed, e) {
+			continue
+		}
+
+		config.logger.Debugf("Removing %s", e)
+
+		if err := remove(e); err != nil {
+			config.exitHandler.Error(fmt.Errorf("unable to remove %s\n%w", e, err))
 			return
 		}
-		contributed = append(contributed, file)
+		config.observe(Event{Type: EventFileRemoved, Path: e})
+	}
+
+	file = filepath.Join(ctx.Layers.Path, "*.sbom.*")
+	existing, err = filepath.Glob(file)
+	if err != nil {
+		config.exitHandler.Error(fmt.Errorf("unable to list files in %s\n%w", file, err))
+		return
 	}
 
 	for _, e := range existing {
-		if strings.HasSuffix(e, "store.toml") || contains(contributed, e) {
+		name, _, _ := strings.Cut(filepath.Base(e), ".sbom.")
+		if name == "launch" || name == "build" || contains(contributed, ctx.Layers.LayerTOMLPath(name)) {
 			continue
 		}
 
-		config.logger.Debugf("Removing %s", e)
+		config.logger.Debugf("Removing stale SBOM %s", e)
 
-		if err := os.RemoveAll(e); err != nil {
+		if err := remove(e); err != nil {
 			config.exitHandler.Error(fmt.Errorf("unable to remove %s\n%w", e, err))
 			return
 		}
+		config.observe(Event{Type: EventFileRemoved, Path: e})
 	}
 
 	if err := validateSBOMFormats(ctx.Layers.Path, ctx.Buildpack.Info.SBOMFormats); err != nil {
@@ -314,47 +721,271 @@ func Build(build BuildFunc, config Config) {
 		return
 	}
 
+	if !config.dryRun {
+		sbomFiles, err := filepath.Glob(filepath.Join(ctx.Layers.Path, "*.sbom.*"))
+		if err != nil {
+			config.exitHandler.Error(fmt.Errorf("unable find SBOM files\n%w", err))
+			return
+		}
+		for _, f := range sbomFiles {
+			if err := reproducible.Touch(f, config.lookupEnv); err != nil {
+				config.exitHandler.Error(err)
+				return
+			}
+		}
+	}
+
+	for _, w := range processWarnings(result.Processes, config.expectedDefaultProcessType) {
+		log.Warn(config.logger, w)
+	}
+	for _, w := range processScopedWarnings(result.Layers, result.Processes) {
+		log.Warn(config.logger, w)
+	}
+	for _, w := range layerTypeWarnings(result.Layers) {
+		log.Warn(config.logger, w)
+	}
+	if config.logger.IsDebugEnabled() {
+		if err := result.WriteLaunchEnvironments(config.logger.DebugWriter(), nil); err != nil {
+			config.logger.Debugf("unable to write launch environments\n%w", err)
+		}
+	}
+
 	launch := LaunchTOML{
 		Labels:    result.Labels,
 		Processes: result.Processes,
 		Slices:    result.Slices,
 	}
 
-	if !launch.isEmpty() {
-		file = filepath.Join(ctx.Layers.Path, "launch.toml")
-		config.logger.Debugf("Writing application metadata: %s <= %+v", file, launch)
+	if !launch.isEmpty() || config.alwaysWritePhaseOutputs {
+		file = ctx.Layers.LaunchTOMLPath()
+		if config.logger.IsDebugEnabled() {
+			config.logger.Debugf("Writing application metadata: %s <= %+v", file, launch)
+		}
 
 		if err = config.tomlWriter.Write(file, launch); err != nil {
 			config.exitHandler.Error(fmt.Errorf("unable to write application metadata %s\n%w", file, err))
 			return
 		}
+		config.observe(Event{Type: EventLaunchMetadataWritten, Path: file})
 	}
 
 	buildTOML := BuildTOML{
 		Unmet: result.Unmet,
 	}
 
-	if !buildTOML.isEmpty() {
-		file = filepath.Join(ctx.Layers.Path, "build.toml")
-		config.logger.Debugf("Writing build metadata: %s <= %+v", file, build)
+	if !buildTOML.isEmpty() || config.alwaysWritePhaseOutputs {
+		file = ctx.Layers.BuildTOMLPath()
+		config.logger.Debugf("Writing build metadata: %s <= %+v", file, buildTOML)
 
 		if err = config.tomlWriter.Write(file, buildTOML); err != nil {
 			config.exitHandler.Error(fmt.Errorf("unable to write build metadata %s\n%w", file, err))
 			return
 		}
+		config.observe(Event{Type: EventBuildMetadataWritten, Path: file})
 	}
 
-	if len(result.PersistentMetadata) > 0 {
-		store = Store{
-			Metadata: result.PersistentMetadata,
+	if len(result.PersistentMetadata) > 0 && !config.storeWritesDisabled {
+		if result.PersistentMetadata, err = NormalizeMetadata(result.PersistentMetadata); err != nil {
+			config.exitHandler.Error(fmt.Errorf("unable to normalize persistent metadata\n%w", err))
+			return
+		}
+
+		if ctx.lazy != nil && config.storeNamespacing {
+			if store, err = ctx.lazy.loadStore(); err != nil {
+				config.exitHandler.Error(err)
+				return
+			}
+		}
+
+		if config.storeNamespacing {
+			store = store.withNamespace(ctx.Buildpack.Info.ID, result.PersistentMetadata)
+		} else {
+			store = Store{
+				Metadata: result.PersistentMetadata,
+			}
 		}
-		file = filepath.Join(ctx.Layers.Path, "store.toml")
+		file = ctx.Layers.StoreTOMLPath()
 		config.logger.Debugf("Writing persistent metadata: %s <= %+v", file, store)
 		if err = config.tomlWriter.Write(file, store); err != nil {
 			config.exitHandler.Error(fmt.Errorf("unable to write persistent metadata %s\n%w", file, err))
 			return
 		}
+		config.observe(Event{Type: EventPersistentMetadataWritten, Path: file})
+	}
+
+	if config.unexpectedFileWarnings && !config.dryRun {
+		unexpected, err := unexpectedLayerFiles(ctx.Layers.Path, result.Layers)
+		if err != nil {
+			config.exitHandler.Error(err)
+			return
+		}
+		if len(unexpected) > 0 {
+			log.Warnf(config.logger, "Warning: the following files in the layers directory %s are not part of a contributed layer "+
+				"and will not be exported:\n  %s", ctx.Layers.Path, strings.Join(unexpected, "\n  "))
+		}
+	}
+
+	if len(result.Warnings) > 0 {
+		log.Warn(config.logger, formatWarnings(result.Warnings))
+	}
+
+	if warnings := append(deprecations.warnings(), result.Warnings...); len(warnings) > 0 {
+		if config.warningReportPath != "" {
+			report := WarningReport{Buildpack: ctx.Buildpack.Info.ID, LibcnbVersion: Version(), Warnings: warnings}
+			config.logger.Debugf("Writing warning report: %s <= %+v", config.warningReportPath, report)
+			if err = config.tomlWriter.Write(config.warningReportPath, report); err != nil {
+				config.exitHandler.Error(fmt.Errorf("unable to write warning report %s\n%w", config.warningReportPath, err))
+				return
+			}
+		}
+	}
+
+	if recorder != nil {
+		log.Warn(config.logger, recorder.summary())
+	}
+
+	config.observe(Event{Type: EventFinished})
+}
+
+// formatWarnings formats warnings as a section listing each warning and its remedy.
+func formatWarnings(warnings []Warning) string {
+	var b strings.Builder
+	b.WriteString("Warnings:")
+	for _, w := range warnings {
+		_, _ = fmt.Fprintf(&b, "\n  - %s", w.Message)
+		if w.Remedy != "" {
+			_, _ = fmt.Fprintf(&b, "\n    %s", w.Remedy)
+		}
+	}
+	return b.String()
+}
+
+// explainBuildContext writes a summary of ctx to w, without the values of bindings or environment variables.
+func explainBuildContext(w io.Writer, ctx BuildContext) error {
+	plan, err := ctx.LoadPlan()
+	if err != nil {
+		return err
+	}
+
+	var entries []string
+	for _, e := range plan.Entries {
+		entries = append(entries, e.Name)
+	}
+
+	var bindings []string
+	for _, b := range ctx.Platform.Bindings {
+		if b.Type == "" {
+			bindings = append(bindings, b.Name)
+		} else {
+			bindings = append(bindings, fmt.Sprintf("%s (%s)", b.Name, b.Type))
+		}
+	}
+
+	var keys []string
+	for k := range ctx.Platform.Environment {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	none := func(s []string) string {
+		if len(s) == 0 {
+			return "none"
+		}
+		return strings.Join(s, ", ")
+	}
+
+	target := "unknown"
+	if ctx.TargetInfo.OS != "" || ctx.TargetInfo.Arch != "" {
+		target = ctx.TargetInfo.String()
+		if ctx.TargetDistro.Name != "" {
+			target = fmt.Sprintf("%s (%s %s)", target, ctx.TargetDistro.Name, ctx.TargetDistro.Version)
+		}
+	}
+
+	stack := ctx.StackID
+	if stack == "" {
+		stack = "none"
+	}
+
+	_, err = fmt.Fprintf(w, `Build context:
+  Buildpack:            %s %s (Buildpack API %s)
+  Plan entries:         %s
+  Bindings:             %s
+  Platform environment: %s
+  Stack:                %s
+  Target:               %s
+`, ctx.Buildpack.Info.ID, ctx.Buildpack.Info.Version, ctx.Buildpack.API, none(entries), none(bindings), none(keys), stack, target)
+	return err
+}
+
+// validateEnvironment returns an error if the environment to be written to dir contains delimiter conflicts, or invalid
+// names if $CNB_STRICT_ENV_NAMES is true. Otherwise invalid names are reported as a warning.
+func validateEnvironment(config Config, dir string, environment Environment) error {
+	if err := errors.Join(delimiterConflicts.errors(environment)...); err != nil {
+		return err
+	}
+
+	if err := environment.validateNames(); err != nil {
+		if config.strictEnvironmentNames {
+			return err
+		}
+		log.Warnf(config.logger, "Warning: %s, in layer environment %s", err, dir)
+	}
+
+	return nil
+}
+
+// writeLayer writes the environment and metadata of layer and returns the path of its metadata file. Ignored files are
+// removed from the layer with remove.
+func writeLayer(config Config, layersPath string, layer Layer, remove func(string) error) (string, error) {
+	removed, err := layer.prune(remove)
+	if err != nil {
+		return "", err
 	}
+
+	if layer.Metadata, err = NormalizeMetadata(layer.Metadata); err != nil {
+		return "", fmt.Errorf("unable to normalize metadata of layer %s\n%w", layer.Name, err)
+	}
+	if len(removed) > 0 {
+		config.logger.Debugf("Removed ignored files from layer %s: %s", layer.Name, strings.Join(removed, ", "))
+	}
+
+	file := filepath.Join(layer.Path, "env.build")
+	config.logger.Debugf("Writing layer env.build: %s <= %+v", file, layer.BuildEnvironment)
+	if err := validateEnvironment(config, file, layer.BuildEnvironment); err != nil {
+		return "", fmt.Errorf("unable to write layer env.build %s\n%w", file, err)
+	}
+	if err := config.environmentWriter.Write(file, layer.BuildEnvironment); err != nil {
+		return "", fmt.Errorf("unable to write layer env.build %s\n%w", file, err)
+	}
+
+	file = filepath.Join(layer.Path, "env.launch")
+	config.logger.Debugf("Writing layer env.launch: %s <= %+v", file, layer.LaunchEnvironment)
+	if err := validateEnvironment(config, file, layer.LaunchEnvironment); err != nil {
+		return "", fmt.Errorf("unable to write layer env.launch %s\n%w", file, err)
+	}
+	if err := config.environmentWriter.Write(file, layer.LaunchEnvironment); err != nil {
+		return "", fmt.Errorf("unable to write layer env.launch %s\n%w", file, err)
+	}
+
+	file = filepath.Join(layer.Path, "env")
+	config.logger.Debugf("Writing layer env: %s <= %+v", file, layer.SharedEnvironment)
+	if err := validateEnvironment(config, file, layer.SharedEnvironment); err != nil {
+		return "", fmt.Errorf("unable to write layer env %s\n%w", file, err)
+	}
+	if err := config.environmentWriter.Write(file, layer.SharedEnvironment); err != nil {
+		return "", fmt.Errorf("unable to write layer env %s\n%w", file, err)
+	}
+
+	file = filepath.Join(layersPath, LayerTOMLName(layer.Name))
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debugf("Writing layer metadata: %s <= %+v", file, layer)
+	}
+	if err := config.tomlWriter.Write(file, layer); err != nil {
+		return "", fmt.Errorf("unable to write layer metadata %s\n%w", file, err)
+	}
+
+	return file, nil
 }
 
 func contains(candidates []string, s string) bool {
@@ -367,6 +998,41 @@ func contains(candidates []string, s string) bool {
 	return false
 }
 
+// unexpectedLayerFiles returns the names of the entries in the layers directory that are neither part of a
+// contributed layer, as its directory, metadata or SBOM, nor files the lifecycle reads.
+func unexpectedLayerFiles(layersPath string, layers []Layer) ([]string, error) {
+	entries, err := os.ReadDir(layersPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read layers directory %s\n%w", layersPath, err)
+	}
+
+	contributed := map[string]bool{}
+	for _, l := range layers {
+		contributed[l.Name] = true
+	}
+
+	var unexpected []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			if !contributed[name] {
+				unexpected = append(unexpected, name+"/")
+			}
+			continue
+		}
+
+		if n, ok := strings.CutSuffix(name, ".toml"); ok && (contributed[n] || reservedLayerNames[n]) {
+			continue
+		}
+		if n, _, ok := strings.Cut(name, ".sbom."); ok && (contributed[n] || n == "build" || n == "launch") {
+			continue
+		}
+		unexpected = append(unexpected, name)
+	}
+
+	return unexpected, nil
+}
+
 func validateSBOMFormats(layersPath string, acceptedSBOMFormats []string) error {
 	sbomFiles, err := filepath.Glob(filepath.Join(layersPath, "*.sbom.*"))
 	if err != nil {
@@ -16,6 +16,20 @@
 
 package libcnb
 
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultMaxPlanMetadataSize is the default maximum size, in bytes, of the TOML encoding of a single build plan
+// requirement metadata value.
+const DefaultMaxPlanMetadataSize = 1024 * 1024
+
 // BuildPlanProvide represents a dependency provided by a buildpack.
 type BuildPlanProvide struct {
 	// Name is the name of the dependency.
@@ -48,3 +62,143 @@ type BuildPlans struct {
 	// Or is the collection of other build plans.
 	Or []BuildPlan `toml:"or,omitempty"`
 }
+
+// plans returns the build plans, the first followed by the others.
+func (p BuildPlans) plans() []BuildPlan {
+	return append([]BuildPlan{p.BuildPlan}, p.Or...)
+}
+
+// MergeBuildPlans merges the build plans of two detectors into one, so that tools running several detectors can write a
+// single build plan. Every combination of a plan of a with a plan of b becomes a plan of the result, providing and
+// requiring what both do, with the combination of the first plans first. Provisions provided by both are listed once.
+func MergeBuildPlans(a BuildPlans, b BuildPlans) BuildPlans {
+	var merged []BuildPlan
+	for _, pa := range a.plans() {
+		for _, pb := range b.plans() {
+			var plan BuildPlan
+
+			seen := map[string]bool{}
+			for _, p := range append(append([]BuildPlanProvide{}, pa.Provides...), pb.Provides...) {
+				if !seen[p.Name] {
+					seen[p.Name] = true
+					plan.Provides = append(plan.Provides, p)
+				}
+			}
+			plan.Requires = append(append([]BuildPlanRequire{}, pa.Requires...), pb.Requires...)
+
+			merged = append(merged, plan)
+		}
+	}
+
+	return buildPlans(merged)
+}
+
+// Validate returns an error if any of the build plans has a provision or requirement without a name, or provides the
+// same dependency more than once.
+func (p BuildPlans) Validate() error {
+	for i, plan := range p.plans() {
+		seen := map[string]bool{}
+		for _, provide := range plan.Provides {
+			if provide.Name == "" {
+				return fmt.Errorf("build plan %d has a provision without a name", i)
+			}
+			if seen[provide.Name] {
+				return fmt.Errorf("build plan %d provides %s more than once", i, provide.Name)
+			}
+			seen[provide.Name] = true
+		}
+		for _, require := range plan.Requires {
+			if require.Name == "" {
+				return fmt.Errorf("build plan %d has a requirement without a name", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validatePlanMetadata returns an error naming the first requirement metadata value that cannot be encoded as TOML,
+// contains a NaN or infinite number or a reference cycle, or whose encoding exceeds maxSize bytes. A negative maxSize disables the size check.
+func validatePlanMetadata(plans []BuildPlan, maxSize int) error {
+	for _, plan := range plans {
+		for _, r := range plan.Requires {
+			keys := make([]string, 0, len(r.Metadata))
+			for k := range r.Metadata {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				if err := checkFinite(reflect.ValueOf(r.Metadata[k]), k, map[uintptr]bool{}); err != nil {
+					return fmt.Errorf("build plan requirement %s metadata %w", r.Name, err)
+				}
+
+				buf := &bytes.Buffer{}
+				if err := toml.NewEncoder(buf).Encode(map[string]interface{}{k: r.Metadata[k]}); err != nil {
+					return fmt.Errorf("build plan requirement %s metadata %s cannot be encoded as TOML\n%w", r.Name, k, err)
+				}
+
+				if maxSize >= 0 && buf.Len() > maxSize {
+					return fmt.Errorf("build plan requirement %s metadata %s is %d bytes, exceeding the maximum of %d", r.Name, k, buf.Len(), maxSize)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkFinite returns an error naming the path of the first NaN or infinite number in v, or of the first reference
+// back to a value that contains it. active holds the pointers, maps and slices on the path to v, so that a cyclic value
+// is reported rather than followed forever, while a value referenced more than once without a cycle is still accepted.
+func checkFinite(v reflect.Value, path string, active map[uintptr]bool) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if v.IsNil() || (v.Kind() == reflect.Slice && v.Len() == 0) {
+			return nil
+		}
+
+		p := v.Pointer()
+		if active[p] {
+			return fmt.Errorf("%s contains a reference cycle", path)
+		}
+		active[p] = true
+		defer delete(active, p)
+	}
+
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(v.Float()) || math.IsInf(v.Float(), 0) {
+			return fmt.Errorf("%s contains a NaN or infinite number", path)
+		}
+	case reflect.Interface, reflect.Pointer:
+		if !v.IsNil() {
+			return checkFinite(v.Elem(), path, active)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := checkFinite(v.Index(i), fmt.Sprintf("%s[%d]", path, i), active); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+
+		for _, k := range keys {
+			if err := checkFinite(v.MapIndex(k), fmt.Sprintf("%s.%v", path, k.Interface()), active); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := checkFinite(v.Field(i), fmt.Sprintf("%s.%s", path, v.Type().Field(i).Name), active); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
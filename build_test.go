@@ -18,12 +18,21 @@ package libcnb_test
 
 import (
 	"bytes"
+	gocontext "context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"testing/fstest"
 	"text/template"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
@@ -34,6 +43,20 @@ import (
 	"github.com/buildpacks/libcnb/v2/mocks"
 )
 
+type contextFormatter struct{}
+
+func (contextFormatter) Buildpack(buildpack libcnb.Buildpack) string {
+	return "== buildpack " + buildpack.Info.ID + " =="
+}
+
+func (contextFormatter) Extension(extension libcnb.Extension) string {
+	return "== extension " + extension.Info.ID + " =="
+}
+
+func (contextFormatter) Platform(platform libcnb.Platform) string {
+	return "== platform " + platform.Path + " =="
+}
+
 func testBuild(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
@@ -286,6 +309,76 @@ version = "1.1.1"
 			}
 		})
 
+		it("uses application path option", func() {
+			path := t.TempDir()
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithApplicationPath(path)),
+			)
+
+			Expect(ctx.ApplicationPath).To(Equal(path))
+		})
+
+		it("uses environment option", func() {
+			state := filepath.Join(t.TempDir(), "state.toml")
+			Expect(os.WriteFile(state, []byte(`value = "test-value"`), 0600)).To(Succeed())
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithEnvironment(append(os.Environ(),
+						"CNB_STACK_ID=other-stack-id",
+						libcnb.SharedStateEnv("test")+"="+state,
+					))),
+			)
+
+			Expect(ctx.StackID).To(Equal("other-stack-id"))
+
+			var s struct{ Value string }
+			Expect(ctx.Layers.ReadSharedState("test", &s)).To(BeTrue())
+			Expect(s.Value).To(Equal("test-value"))
+
+			_, ok := os.LookupEnv(libcnb.SharedStateEnv("test"))
+			Expect(ok).To(BeFalse())
+		})
+
+		it("does not log the captured environment", func() {
+			t.Setenv("BP_LOG_LEVEL", "DEBUG")
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				layer, err := context.Layers.Layer("test-layer")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(layer).To(Equal(libcnb.Layer{
+					Name:              "test-layer",
+					Path:              filepath.Join(context.Layers.Path, "test-layer"),
+					BuildEnvironment:  libcnb.Environment{},
+					LaunchEnvironment: libcnb.Environment{},
+					SharedEnvironment: libcnb.Environment{},
+					Exec:              libcnb.Exec{Path: filepath.Join(context.Layers.Path, "test-layer", "exec.d")},
+				}))
+
+				Expect(context.Layers.RenderTemplateString(layer, `{{ env "SUPER_SECRET_TOKEN" }}`, nil, "token")).To(Succeed())
+				Expect(os.ReadFile(filepath.Join(layer.Path, "token"))).To(Equal([]byte("test-secret-value")))
+
+				context.Logger.Debugf("Context: %+v", context)
+				return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
+			}
+
+			out := &bytes.Buffer{}
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out)),
+					libcnb.WithEnvironment(append(os.Environ(), "SUPER_SECRET_TOKEN=test-secret-value"))),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			Expect(out.String()).To(ContainSubstring("Writing layer metadata"))
+			Expect(out.String()).NotTo(ContainSubstring("test-secret-value"))
+		})
+
 		it("creates context", func() {
 			libcnb.Build(buildFunc,
 				libcnb.NewConfig(
@@ -293,6 +386,9 @@ version = "1.1.1"
 			)
 
 			Expect(ctx.ApplicationPath).To(Equal(applicationPath))
+			Expect(ctx.Phase).To(Equal(libcnb.PhaseBuild))
+			Expect(ctx.InvokedAt).To(BeTemporally("~", time.Now(), time.Minute))
+			Expect(ctx.Arguments).To(Equal([]string{commandPath}))
 			Expect(ctx.Buildpack).To(Equal(libcnb.Buildpack{
 				API: "0.8",
 				Info: libcnb.BuildpackInfo{
@@ -302,7 +398,7 @@ version = "1.1.1"
 				},
 				Path: buildpackPath,
 			}))
-			Expect(ctx.Layers).To(Equal(libcnb.Layers{Path: layersPath}))
+			Expect(ctx.Layers.Path).To(Equal(layersPath))
 			Expect(ctx.PersistentMetadata).To(Equal(map[string]interface{}{"test-key": "test-value"}))
 			Expect(ctx.Plan).To(Equal(libcnb.BuildpackPlan{
 				Entries: []libcnb.BuildpackPlanEntry{
@@ -394,6 +490,211 @@ version = "1.1.1"
 		})
 	})
 
+	context("buildpack declares stacks", func() {
+		it("warns about deprecated stacks when the API supports targets", func() {
+			var b bytes.Buffer
+			Expect(buildpackTOML.Execute(&b, map[string]string{"APIVersion": "0.10"})).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"), b.Bytes(), 0600)).To(Succeed())
+
+			out := &bytes.Buffer{}
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(out.String()).To(ContainSubstring(`Warning: [[stacks]] is deprecated for Buildpack API 0.10, use [[targets]] instead
+  Declare the supported operating systems and architectures in buildpack.toml using [[targets]], for example:
+
+    [[targets]]
+    os = "linux"
+    arch = "amd64"
+  See https://github.com/buildpacks/spec/blob/main/buildpack.md#buildpacktoml-toml for details.
+`))
+		})
+
+		it("includes deprecated stacks in the warning report", func() {
+			var b bytes.Buffer
+			Expect(buildpackTOML.Execute(&b, map[string]string{"APIVersion": "0.10"})).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"), b.Bytes(), 0600)).To(Succeed())
+
+			path := filepath.Join(t.TempDir(), "warnings.toml")
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithWarningReport(path)),
+			)
+
+			report := tomlWriter.Calls[len(tomlWriter.Calls)-1]
+			Expect(report.Arguments[0]).To(Equal(path))
+			Expect(report.Arguments[1].(libcnb.WarningReport).Warnings).To(ConsistOf(libcnb.Warning{
+				Message: "[[stacks]] is deprecated for Buildpack API 0.10, use [[targets]] instead",
+				Remedy: `Declare the supported operating systems and architectures in buildpack.toml using [[targets]], for example:
+
+  [[targets]]
+  os = "linux"
+  arch = "amd64"
+See https://github.com/buildpacks/spec/blob/main/buildpack.md#buildpacktoml-toml for details.`,
+			}))
+		})
+
+		it("does not warn when the API does not support targets", func() {
+			out := &bytes.Buffer{}
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(out.String()).NotTo(ContainSubstring("Warning"))
+		})
+
+		context("CNB_DEPRECATION_MODE", func() {
+			it.Before(func() {
+				var b bytes.Buffer
+				Expect(buildpackTOML.Execute(&b, map[string]string{"APIVersion": "0.10"})).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"), b.Bytes(), 0600)).To(Succeed())
+			})
+
+			it("fails when set to error", func() {
+				t.Setenv("CNB_DEPRECATION_MODE", "error")
+
+				libcnb.Build(buildFunc,
+					libcnb.NewConfig(
+						libcnb.WithArguments([]string{commandPath}),
+						libcnb.WithExitHandler(exitHandler),
+						libcnb.WithLogger(log.NewDiscard())),
+				)
+
+				var deprecation *libcnb.DeprecationError
+				Expect(errors.As(exitHandler.Calls[0].Arguments.Error(0), &deprecation)).To(BeTrue())
+				Expect(deprecation.Feature).To(Equal("[[stacks]]"))
+				Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(HavePrefix("[[stacks]] is deprecated and CNB_DEPRECATION_MODE is error\n" +
+					"[[stacks]] is deprecated for Buildpack API 0.10, use [[targets]] instead")))
+			})
+
+			it("does not warn when set to quiet", func() {
+				t.Setenv("CNB_DEPRECATION_MODE", "quiet")
+
+				out := &bytes.Buffer{}
+				libcnb.Build(buildFunc,
+					libcnb.NewConfig(
+						libcnb.WithArguments([]string{commandPath}),
+						libcnb.WithExitHandler(exitHandler),
+						libcnb.WithLogger(log.New(out))),
+				)
+
+				Expect(out.String()).NotTo(ContainSubstring("Warning"))
+				Expect(exitHandler.Calls).To(BeEmpty())
+			})
+
+			it("fails when set to an unknown mode", func() {
+				t.Setenv("CNB_DEPRECATION_MODE", "test-value")
+
+				libcnb.Build(buildFunc,
+					libcnb.NewConfig(
+						libcnb.WithArguments([]string{commandPath}),
+						libcnb.WithExitHandler(exitHandler),
+						libcnb.WithLogger(log.NewDiscard())),
+				)
+
+				Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(
+					`unable to parse CNB_DEPRECATION_MODE "test-value", expected one of warn, error or quiet`))
+			})
+		})
+	})
+
+	context("context formatter", func() {
+		it.Before(func() {
+			t.Setenv("BP_LOG_LEVEL", "DEBUG")
+		})
+
+		it("renders the platform with the default formatter", func() {
+			out := &bytes.Buffer{}
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(out.String()).To(ContainSubstring("Buildpack: {"))
+			Expect(out.String()).To(ContainSubstring("Platform Environment: map["))
+		})
+
+		it("renders the buildpack and platform with the configured formatter", func() {
+			out := &bytes.Buffer{}
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out)),
+					libcnb.WithContextFormatter(contextFormatter{})),
+			)
+
+			Expect(out.String()).To(ContainSubstring("== buildpack test-id ==\n"))
+			Expect(out.String()).To(ContainSubstring("== platform " + platformPath + " ==\n"))
+			Expect(out.String()).NotTo(ContainSubstring("Buildpack: {"))
+			Expect(out.String()).NotTo(ContainSubstring("Platform Environment:"))
+		})
+	})
+
+	context("quiet mode", func() {
+		var out *bytes.Buffer
+
+		it.Before(func() {
+			t.Setenv("BP_LOG_LEVEL", "DEBUG")
+			out = &bytes.Buffer{}
+
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				context.Logger.Debug("test-buildpack-message")
+				return libcnb.NewBuildResult(), nil
+			}
+		})
+
+		it("writes libcnb debug output by default", func() {
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(out.String()).To(ContainSubstring("Application contents"))
+			Expect(out.String()).To(ContainSubstring("test-buildpack-message"))
+		})
+
+		it("suppresses libcnb debug output with WithQuiet", func() {
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out)),
+					libcnb.WithQuiet()),
+			)
+
+			Expect(out.String()).To(Equal("test-buildpack-message\n"))
+		})
+
+		it("suppresses libcnb debug output with BP_QUIET", func() {
+			t.Setenv("BP_QUIET", "true")
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(out.String()).To(Equal("test-buildpack-message\n"))
+		})
+	})
+
 	it("fails if CNB_BUILDPACK_DIR is not set", func() {
 		Expect(os.Unsetenv("CNB_BUILDPACK_DIR")).To(Succeed())
 
@@ -422,10 +723,224 @@ version = "1.1.1"
 		Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("test-error"))
 	})
 
+	it("handles error from BuildFunc with a build config", func() {
+		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+			return libcnb.NewBuildResult(), errors.New("test-error")
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewBuildConfig(
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("test-error"))
+	})
+
+	it("defaults the arguments of a build config to the process arguments", func() {
+		var ctx libcnb.BuildContext
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			ctx = context
+			return libcnb.NewBuildResult(), nil
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewBuildConfig(
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(ctx.Arguments).To(Equal(os.Args))
+	})
+
+	context("options given nil values", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(platformPath, "bindings", "alpha", "test-secret-key"),
+				[]byte("test-secret-value\n"), 0600)).To(Succeed())
+		})
+
+		store := libcnb.SecretStoreFunc(func(gocontext.Context, libcnb.Binding, *url.URL) (map[string]string, error) {
+			return map[string]string{"password": "test-password"}, nil
+		})
+
+		for _, tc := range []struct {
+			name    string
+			options []libcnb.Option
+			check   func(libcnb.BuildContext)
+		}{
+			{
+				name:    "WithArguments",
+				options: []libcnb.Option{libcnb.WithArguments(nil)},
+				check: func(ctx libcnb.BuildContext) {
+					Expect(ctx.Arguments).To(Equal([]string{commandPath, layersPath, platformPath, buildpackPlanPath}))
+				},
+			},
+			{
+				name:    "WithBindingOptions",
+				options: []libcnb.Option{libcnb.WithBindingOptions(libcnb.PreserveWhitespace()), libcnb.WithBindingOptions(nil)},
+				check: func(ctx libcnb.BuildContext) {
+					Expect(ctx.Platform.Bindings[0].Secret).To(HaveKeyWithValue("test-secret-key", "test-secret-value\n"))
+				},
+			},
+			{
+				name:    "WithSecretStore",
+				options: []libcnb.Option{libcnb.WithSecretStore("test", store), libcnb.WithSecretStore("test", nil)},
+				check: func(ctx libcnb.BuildContext) {
+					binding, err := ctx.ResolveBinding(libcnb.Binding{
+						Name:   "test-binding",
+						Secret: map[string]string{libcnb.BindingSecretReference: "test://store/test-binding"},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.Secret).To(HaveKeyWithValue("password", "test-password"))
+				},
+			},
+			{
+				name:    "WithSignatureVerifier",
+				options: []libcnb.Option{libcnb.WithSignatureVerifier(&mocks.SignatureVerifier{}), libcnb.WithSignatureVerifier(nil)},
+				check: func(ctx libcnb.BuildContext) {
+					_, err := ctx.Layers.DependencyLayer(libcnb.BuildpackDependency{
+						ID:     "test-id",
+						URI:    "https://localhost/test-artifact.tgz",
+						SHA256: strings.Repeat("0", 64),
+					})
+					Expect(err).To(MatchError("unable to verify signature of dependency test-id: no signature-uri declared"))
+				},
+			},
+		} {
+			tc := tc
+
+			it(fmt.Sprintf("ignores %s given nil", tc.name), func() {
+				buildFunc = func(ctx libcnb.BuildContext) (libcnb.BuildResult, error) {
+					tc.check(ctx)
+					return libcnb.NewBuildResult(), nil
+				}
+
+				libcnb.Build(buildFunc,
+					libcnb.NewConfig(append([]libcnb.Option{
+						libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+						libcnb.WithExitHandler(exitHandler),
+						libcnb.WithLogger(log.NewDiscard()),
+					}, tc.options...)...),
+				)
+
+				Expect(exitHandler.Calls).To(BeEmpty())
+			})
+		}
+	})
+
+	it("resolves binding secret references with registered secret stores", func() {
+		var binding libcnb.Binding
+		buildFunc = func(ctx libcnb.BuildContext) (libcnb.BuildResult, error) {
+			var err error
+			binding, err = ctx.ResolveBinding(libcnb.Binding{
+				Name:   "test-binding",
+				Secret: map[string]string{libcnb.BindingSecretReference: "test://store/test-binding"},
+			})
+			return libcnb.NewBuildResult(), err
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+				libcnb.WithSecretStore("test", libcnb.SecretStoreFunc(func(gocontext.Context, libcnb.Binding, *url.URL) (map[string]string, error) {
+					return map[string]string{"password": "test-password"}, nil
+				}))),
+		)
+
+		Expect(exitHandler.Calls).To(BeEmpty())
+		Expect(binding.Secret).To(Equal(map[string]string{"password": "test-password"}))
+	})
+
+	context("timeout", func() {
+		it("cancels the context and fails when BuildFunc does not complete in time", func() {
+			buildFunc = func(ctx libcnb.BuildContext) (libcnb.BuildResult, error) {
+				<-ctx.Context.Done()
+				return libcnb.NewBuildResult(), nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithTimeout(10*time.Millisecond)),
+			)
+
+			err := exitHandler.Calls[0].Arguments.Error(0)
+			Expect(err).To(MatchError(ContainSubstring("build did not complete within 10ms")))
+			Expect(errors.Is(err, gocontext.DeadlineExceeded)).To(BeTrue())
+		})
+
+		it("returns the result of BuildFunc that completes in time", func() {
+			buildFunc = func(ctx libcnb.BuildContext) (libcnb.BuildResult, error) {
+				Expect(ctx.Context.Err()).NotTo(HaveOccurred())
+				return libcnb.NewBuildResult(), errors.New("test-error")
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithTimeout(time.Minute)),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("test-error"))
+		})
+
+		for _, tc := range []struct {
+			name    string
+			options []libcnb.Option
+		}{
+			{name: "without a timeout"},
+			{name: "with a timeout", options: []libcnb.Option{libcnb.WithTimeout(time.Minute)}},
+		} {
+			tc := tc
+
+			it(fmt.Sprintf("fails when BuildFunc panics %s", tc.name), func() {
+				buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+					panic("test-panic")
+				}
+
+				libcnb.Build(buildFunc,
+					libcnb.NewConfig(append([]libcnb.Option{
+						libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+						libcnb.WithExitHandler(exitHandler),
+						libcnb.WithLogger(log.NewDiscard()),
+					}, tc.options...)...),
+				)
+
+				Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(HavePrefix("build panicked: test-panic")))
+			})
+		}
+	})
+
+	it("exposes the platform API", func() {
+		t.Setenv("CNB_PLATFORM_API", "0.12")
+
+		var ctx libcnb.BuildContext
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			ctx = context
+			return libcnb.NewBuildResult(), nil
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(ctx.Platform.API).To(Equal("0.12"))
+		Expect(ctx.Platform.SupportsFeature(libcnb.PlatformFeatureTargets)).To(BeTrue())
+	})
+
 	it("writes env.build", func() {
 		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
-			layer := libcnb.Layer{Path: filepath.Join(layersPath, "test-name"), BuildEnvironment: libcnb.Environment{}}
-			layer.BuildEnvironment.Defaultf("test-build", "test-%s", "value")
+			layer := libcnb.Layer{Name: "test-name", Path: filepath.Join(layersPath, "test-name"), BuildEnvironment: libcnb.Environment{}}
+			layer.BuildEnvironment.Defaultf("TEST_BUILD", "test-%s", "value")
 			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
 		}
 
@@ -437,13 +952,13 @@ version = "1.1.1"
 		)
 
 		Expect(environmentWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "test-name", "env.build")))
-		Expect(environmentWriter.Calls[0].Arguments[1]).To(Equal(map[string]string{"test-build.default": "test-value"}))
+		Expect(environmentWriter.Calls[0].Arguments[1]).To(Equal(map[string]string{"TEST_BUILD.default": "test-value"}))
 	})
 
 	it("writes env.launch", func() {
 		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
-			layer := libcnb.Layer{Path: filepath.Join(layersPath, "test-name"), LaunchEnvironment: libcnb.Environment{}}
-			layer.LaunchEnvironment.Defaultf("test-launch", "test-%s", "value")
+			layer := libcnb.Layer{Name: "test-name", Path: filepath.Join(layersPath, "test-name"), LaunchEnvironment: libcnb.Environment{}}
+			layer.LaunchEnvironment.Defaultf("TEST_LAUNCH", "test-%s", "value")
 			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
 		}
 
@@ -455,13 +970,13 @@ version = "1.1.1"
 		)
 
 		Expect(environmentWriter.Calls[1].Arguments[0]).To(Equal(filepath.Join(layersPath, "test-name", "env.launch")))
-		Expect(environmentWriter.Calls[1].Arguments[1]).To(Equal(map[string]string{"test-launch.default": "test-value"}))
+		Expect(environmentWriter.Calls[1].Arguments[1]).To(Equal(map[string]string{"TEST_LAUNCH.default": "test-value"}))
 	})
 
 	it("writes env", func() {
 		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
-			layer := libcnb.Layer{Path: filepath.Join(layersPath, "test-name"), SharedEnvironment: libcnb.Environment{}}
-			layer.SharedEnvironment.Defaultf("test-shared", "test-%s", "value")
+			layer := libcnb.Layer{Name: "test-name", Path: filepath.Join(layersPath, "test-name"), SharedEnvironment: libcnb.Environment{}}
+			layer.SharedEnvironment.Defaultf("TEST_SHARED", "test-%s", "value")
 			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
 		}
 
@@ -473,51 +988,559 @@ version = "1.1.1"
 		)
 
 		Expect(environmentWriter.Calls[2].Arguments[0]).To(Equal(filepath.Join(layersPath, "test-name", "env")))
-		Expect(environmentWriter.Calls[2].Arguments[1]).To(Equal(map[string]string{"test-shared.default": "test-value"}))
+		Expect(environmentWriter.Calls[2].Arguments[1]).To(Equal(map[string]string{"TEST_SHARED.default": "test-value"}))
 	})
 
-	it("writes layer metadata", func() {
+	it("warns about invalid environment variable names", func() {
 		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
-			layer := libcnb.Layer{
-				Name: "test-name",
-				Path: filepath.Join(layersPath, "test-name"),
-				LayerTypes: libcnb.LayerTypes{
-					Build:  true,
-					Cache:  true,
-					Launch: true,
-				},
-				Metadata: map[string]interface{}{"test-key": "test-value"},
-			}
+			layer := libcnb.Layer{Name: "test-name", Path: filepath.Join(layersPath, "test-name"), LaunchEnvironment: libcnb.Environment{}}
+			layer.LaunchEnvironment.Default("TEST NAME", "test-value")
 			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
 		}
 
+		out := &bytes.Buffer{}
 		libcnb.Build(buildFunc,
 			libcnb.NewConfig(
 				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
-				libcnb.WithTOMLWriter(tomlWriter),
-				libcnb.WithLogger(log.NewDiscard())),
+				libcnb.WithEnvironmentWriter(environmentWriter),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.New(out))),
 		)
 
-		Expect(tomlWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "test-name.toml")))
-
-		layer, ok := tomlWriter.Calls[0].Arguments[1].(libcnb.Layer)
-		Expect(ok).To(BeTrue())
-		Expect(layer.LayerTypes.Build).To(BeTrue())
-		Expect(layer.LayerTypes.Cache).To(BeTrue())
-		Expect(layer.LayerTypes.Launch).To(BeTrue())
-		Expect(layer.Metadata).To(Equal(map[string]interface{}{"test-key": "test-value"}))
+		Expect(exitHandler.Calls).To(BeEmpty())
+		Expect(out.String()).To(ContainSubstring(fmt.Sprintf(`Warning: invalid environment variable names "TEST NAME", names must `+
+			"consist of letters, digits and underscores and not start with a digit, in layer environment %s",
+			filepath.Join(layersPath, "test-name", "env.launch"))))
 	})
 
-	it("writes launch.toml with working-directory setting", func() {
-		var b bytes.Buffer
-		err := buildpackTOML.Execute(&b, map[string]string{"APIVersion": "0.8"})
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"), b.Bytes(), 0600)).To(Succeed())
-
+	it("fails on invalid environment variable names in strict mode", func() {
 		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
-			return libcnb.BuildResult{
-				Layers: []libcnb.Layer{},
+			layer := libcnb.Layer{Name: "test-name", Path: filepath.Join(layersPath, "test-name"), LaunchEnvironment: libcnb.Environment{}}
+			layer.LaunchEnvironment.Default("TEST NAME", "test-value")
+			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithEnvironment(append(os.Environ(), libcnb.EnvStrictEnvironmentNames+"=true")),
+				libcnb.WithEnvironmentWriter(environmentWriter),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(ContainSubstring(`invalid environment variable names "TEST NAME"`)))
+	})
+
+	it("fails on conflicting environment variable delimiters", func() {
+		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+			layer := libcnb.Layer{Name: "test-name", Path: filepath.Join(layersPath, "test-name"), BuildEnvironment: libcnb.Environment{}}
+			layer.BuildEnvironment.Append("TEST_NAME", ":", "test-append")
+			layer.BuildEnvironment.Prepend("TEST_NAME", " ", "test-prepend")
+			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithEnvironmentWriter(environmentWriter),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(ContainSubstring(`conflicting delimiters ":" and " " for environment variable TEST_NAME`)))
+		Expect(environmentWriter.Calls).To(BeEmpty())
+	})
+
+	it("writes layer metadata", func() {
+		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+			layer := libcnb.Layer{
+				Name: "test-name",
+				Path: filepath.Join(layersPath, "test-name"),
+				LayerTypes: libcnb.LayerTypes{
+					Build:  true,
+					Cache:  true,
+					Launch: true,
+				},
+				Metadata: map[string]interface{}{"test-key": "test-value"},
+			}
+			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(tomlWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "test-name.toml")))
+
+		layer, ok := tomlWriter.Calls[0].Arguments[1].(libcnb.Layer)
+		Expect(ok).To(BeTrue())
+		Expect(layer.LayerTypes.Build).To(BeTrue())
+		Expect(layer.LayerTypes.Cache).To(BeTrue())
+		Expect(layer.LayerTypes.Launch).To(BeTrue())
+		Expect(layer.Metadata).To(Equal(map[string]interface{}{"test-key": "test-value"}))
+	})
+
+	context("ignored files", func() {
+		it("removes ignored files before writing the layer", func() {
+			buildFunc = func(ctx libcnb.BuildContext) (libcnb.BuildResult, error) {
+				layer, err := ctx.Layers.Layer("test-name")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(os.MkdirAll(filepath.Join(layer.Path, "lib", "test"), 0755)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(layer.Path, "docs"), 0755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layer.Path, "lib", "main.js"), []byte{}, 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layer.Path, "lib", "README.md"), []byte{}, 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layer.Path, "lib", "test", "fixture.json"), []byte{}, 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layer.Path, "docs", "index.html"), []byte{}, 0600)).To(Succeed())
+
+				layer.Ignore("*.md", "lib/test", "docs")
+				return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			Expect(filepath.Join(layersPath, "test-name", "lib", "main.js")).To(BeARegularFile())
+			Expect(filepath.Join(layersPath, "test-name", "lib", "README.md")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(layersPath, "test-name", "lib", "test")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(layersPath, "test-name", "docs")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(layersPath, "test-name.toml")).To(BeARegularFile())
+		})
+
+		it("fails on an invalid pattern", func() {
+			buildFunc = func(ctx libcnb.BuildContext) (libcnb.BuildResult, error) {
+				layer, err := ctx.Layers.Layer("test-name")
+				Expect(err).NotTo(HaveOccurred())
+
+				layer.Ignore("[")
+				return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(ContainSubstring(`invalid ignore pattern "["`)))
+		})
+	})
+
+	context("observer", func() {
+		var (
+			events   []libcnb.Event
+			observer *mocks.Observer
+		)
+
+		it.Before(func() {
+			events = nil
+			observer = &mocks.Observer{}
+			observer.On("Observe", mock.Anything).Run(func(args mock.Arguments) {
+				events = append(events, args.Get(0).(libcnb.Event))
+			})
+
+			Expect(os.WriteFile(filepath.Join(layersPath, "stale.toml"), []byte{}, 0600)).To(Succeed())
+		})
+
+		it("sends the steps of the build in order", func() {
+			buildFunc = func(ctx libcnb.BuildContext) (libcnb.BuildResult, error) {
+				layer, err := ctx.Layers.Layer("test-name")
+				Expect(err).NotTo(HaveOccurred())
+
+				return libcnb.BuildResult{
+					Layers:             []libcnb.Layer{layer},
+					Processes:          []libcnb.Process{{Type: "web", Command: []string{"test-command"}, Default: true}},
+					PersistentMetadata: map[string]interface{}{"test-key": "test-value"},
+				}, nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithObserver(observer),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			Expect(events).To(Equal([]libcnb.Event{
+				{Type: libcnb.EventContextResolved},
+				{Type: libcnb.EventBuildFuncReturned},
+				{Type: libcnb.EventLayerWritten, Layer: "test-name", Path: filepath.Join(layersPath, "test-name.toml")},
+				{Type: libcnb.EventFileRemoved, Path: filepath.Join(layersPath, "stale.toml")},
+				{Type: libcnb.EventLaunchMetadataWritten, Path: filepath.Join(layersPath, "launch.toml")},
+				{Type: libcnb.EventPersistentMetadataWritten, Path: filepath.Join(layersPath, "store.toml")},
+				{Type: libcnb.EventFinished},
+			}))
+		})
+
+		it("sends the failure", func() {
+			buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+				return libcnb.BuildResult{}, errors.New("test-error")
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithObserver(observer),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError("test-error"))
+			Expect(events).To(HaveLen(2))
+			Expect(events[0].Type).To(Equal(libcnb.EventContextResolved))
+			Expect(events[1].Type).To(Equal(libcnb.EventFailed))
+			Expect(events[1].Err).To(MatchError("test-error"))
+		})
+	})
+
+	context("process types", func() {
+		build := func(processes []libcnb.Process, options ...libcnb.Option) string {
+			buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+				return libcnb.BuildResult{Processes: processes}, nil
+			}
+
+			out := &bytes.Buffer{}
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(append([]libcnb.Option{
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out)),
+				}, options...)...),
+			)
+
+			return out.String()
+		}
+
+		it("warns about invalid process types", func() {
+			Expect(build([]libcnb.Process{{Type: "test type", Command: []string{"test-command"}}})).
+				To(ContainSubstring(`Warning: process type "test type" is invalid`))
+		})
+
+		it("does not warn about the default process type unless configured to", func() {
+			Expect(build([]libcnb.Process{{Type: libcnb.ProcessTypeWorker, Command: []string{"test-command"}, Default: true}})).
+				NotTo(ContainSubstring("Warning"))
+		})
+
+		it("warns when the default process is not of the expected type", func() {
+			Expect(build(
+				[]libcnb.Process{{Type: libcnb.ProcessTypeWorker, Command: []string{"test-command"}, Default: true}},
+				libcnb.WithExpectedDefaultProcessType(libcnb.ProcessTypeWeb),
+			)).To(ContainSubstring(`Warning: default process is of type "worker"; this platform expects the default process to be of type "web"`))
+		})
+
+		it("warns when there is no default process", func() {
+			Expect(build(
+				[]libcnb.Process{{Type: libcnb.ProcessTypeWeb, Command: []string{"test-command"}}},
+				libcnb.WithExpectedDefaultProcessType(libcnb.ProcessTypeWeb),
+			)).To(ContainSubstring("Warning: no default process is set"))
+		})
+
+		it("warns about process-specific contributions for undeclared process types", func() {
+			layer := libcnb.Layer{
+				Name:              "test-layer",
+				Path:              filepath.Join(layersPath, "test-layer"),
+				LaunchEnvironment: libcnb.Environment{},
+				LayerTypes:        libcnb.LayerTypes{Launch: true},
+				Exec:              libcnb.Exec{Path: filepath.Join(layersPath, "test-layer", "exec.d")},
+			}
+			layer.LaunchEnvironment.ProcessOverride("web", "TEST_NAME", "test-value")
+			layer.LaunchEnvironment.ProcessOverride("wbe", "TEST_NAME", "test-value")
+			Expect(os.MkdirAll(layer.Exec.ProcessFilePath("task", ""), 0755)).To(Succeed())
+
+			buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+				return libcnb.BuildResult{
+					Layers:    []libcnb.Layer{layer},
+					Processes: []libcnb.Process{{Type: "web", Command: []string{"test-command"}}},
+				}, nil
+			}
+
+			out := &bytes.Buffer{}
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(out.String()).To(Equal(`Warning: layer "test-layer" contributes launch environment or exec.d executables for process type "task", which is not declared; they have no effect unless another buildpack declares it
+Warning: layer "test-layer" contributes launch environment or exec.d executables for process type "wbe", which is not declared; they have no effect unless another buildpack declares it
+`))
+		})
+
+		it("does not warn when the default process is of the expected type", func() {
+			Expect(build(
+				[]libcnb.Process{{Type: libcnb.ProcessTypeWeb, Command: []string{"test-command"}, Default: true}},
+				libcnb.WithExpectedDefaultProcessType(libcnb.ProcessTypeWeb),
+			)).NotTo(ContainSubstring("Warning"))
+		})
+	})
+
+	context("buildpack file system", func() {
+		var ctx libcnb.BuildContext
+
+		it.Before(func() {
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				ctx = context
+				return libcnb.NewBuildResult(), nil
+			}
+		})
+
+		it("exposes the buildpack directory by default", func() {
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(fs.ReadFile(ctx.BuildpackFS, "buildpack.toml")).NotTo(BeEmpty())
+		})
+
+		it("exposes the configured file system", func() {
+			fsys := fstest.MapFS{"templates/test-template": {Data: []byte("test-content")}}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithBuildpackFS(fsys),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(ctx.BuildpackFS).To(Equal(fsys))
+		})
+	})
+
+	context("lazy loading", func() {
+		var ctx libcnb.BuildContext
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(layersPath, "store.toml"),
+				[]byte(`
+[metadata]
+test-key = "test-value"
+`),
+				0600),
+			).To(Succeed())
+		})
+
+		it("defers reading persistent metadata and the buildpack plan", func() {
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				ctx = context
+				return libcnb.NewBuildResult(), nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLazyLoading(),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(ctx.PersistentMetadata).To(BeNil())
+			Expect(ctx.Plan).To(Equal(libcnb.BuildpackPlan{}))
+
+			Expect(ctx.LoadPersistentMetadata()).To(Equal(map[string]interface{}{"test-key": "test-value"}))
+			Expect(ctx.LoadPlan()).To(Equal(libcnb.BuildpackPlan{
+				Entries: []libcnb.BuildpackPlanEntry{
+					{
+						Name:     "test-name",
+						Metadata: map[string]interface{}{"test-key": "test-value"},
+					},
+				},
+			}))
+		})
+
+		it("returns populated fields when lazy loading is disabled", func() {
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				ctx = context
+				return libcnb.NewBuildResult(), nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(ctx.LoadPersistentMetadata()).To(Equal(ctx.PersistentMetadata))
+			Expect(ctx.LoadPlan()).To(Equal(ctx.Plan))
+		})
+	})
+
+	context("layer types", func() {
+		build := func(layers ...libcnb.Layer) string {
+			buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+				return libcnb.BuildResult{Layers: layers}, nil
+			}
+
+			out := &bytes.Buffer{}
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+			return out.String()
+		}
+
+		it("warns about launch content in a layer that is not a launch layer", func() {
+			layer := libcnb.Layer{
+				Name:              "test-layer",
+				Path:              filepath.Join(layersPath, "test-layer"),
+				LaunchEnvironment: libcnb.Environment{},
+				LayerTypes:        libcnb.LayerTypes{Build: true},
+			}
+			layer.LaunchEnvironment.Override("TEST_NAME", "test-value")
+			Expect(os.MkdirAll(filepath.Join(layer.Path, "profile.d"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layer.Path, "profile.d", "test.sh"), []byte(""), 0644)).To(Succeed())
+
+			Expect(build(layer)).To(Equal(`Warning: layer "test-layer" contributes launch environment and profile.d scripts ` +
+				"but is not a launch layer, so the lifecycle ignores them\n"))
+		})
+
+		it("warns about a cache layer without content", func() {
+			Expect(build(libcnb.Layer{
+				Name:       "test-layer",
+				Path:       filepath.Join(layersPath, "test-layer"),
+				LayerTypes: libcnb.LayerTypes{Cache: true},
+			})).To(Equal("Warning: layer \"test-layer\" is a cache layer but contains no files or metadata, so nothing is cached\n"))
+		})
+
+		it("does not warn about consistent layers", func() {
+			launch := libcnb.Layer{
+				Name:              "launch-layer",
+				Path:              filepath.Join(layersPath, "launch-layer"),
+				LaunchEnvironment: libcnb.Environment{},
+				LayerTypes:        libcnb.LayerTypes{Launch: true},
+			}
+			launch.LaunchEnvironment.Override("TEST_NAME", "test-value")
+
+			cache := libcnb.Layer{
+				Name:       "cache-layer",
+				Path:       filepath.Join(layersPath, "cache-layer"),
+				Metadata:   map[string]interface{}{"version": "1.0"},
+				LayerTypes: libcnb.LayerTypes{Cache: true},
+			}
+
+			Expect(build(launch, cache)).NotTo(ContainSubstring("Warning"))
+		})
+	})
+
+	context("layer names", func() {
+		build := func(layers ...libcnb.Layer) {
+			buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+				return libcnb.BuildResult{Layers: layers}, nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+		}
+
+		it("rejects invalid names", func() {
+			build(libcnb.Layer{Name: "test/name"})
+
+			Expect(tomlWriter.Calls).To(BeEmpty())
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError(ContainSubstring(`invalid layer name "test/name"`)))
+		})
+
+		it("rejects reserved names", func() {
+			build(libcnb.Layer{Name: "launch"})
+
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError(`invalid layer name "launch": name is reserved`))
+		})
+
+		it("rejects duplicate names", func() {
+			build(
+				libcnb.Layer{Name: "bravo"},
+				libcnb.Layer{Name: "alpha"},
+				libcnb.Layer{Name: "bravo"},
+				libcnb.Layer{Name: "alpha"},
+				libcnb.Layer{Name: "charlie"},
+			)
+
+			Expect(tomlWriter.Calls).To(BeEmpty())
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("duplicate layer names: alpha, bravo"))
+		})
+	})
+
+	context("layer persistence hooks", func() {
+		it.Before(func() {
+			buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+				layer := libcnb.Layer{Name: "test-name", Path: filepath.Join(layersPath, "test-name")}
+				return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
+			}
+		})
+
+		it("calls hooks in order after writing layer metadata", func() {
+			var calls []string
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLayerPersistenceHook(func(layer libcnb.Layer) error {
+						Expect(tomlWriter.Calls).To(HaveLen(1))
+						calls = append(calls, "first:"+layer.Name)
+						return nil
+					}),
+					libcnb.WithLayerPersistenceHook(func(layer libcnb.Layer) error {
+						calls = append(calls, "second:"+layer.Name)
+						return nil
+					}),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(calls).To(Equal([]string{"first:test-name", "second:test-name"}))
+		})
+
+		it("handles error from hook", func() {
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLayerPersistenceHook(func(libcnb.Layer) error {
+						return errors.New("test-error")
+					}),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).
+				To(MatchError("unable to run layer persistence hook for test-name\ntest-error"))
+		})
+	})
+
+	it("writes launch.toml with working-directory setting", func() {
+		var b bytes.Buffer
+		err := buildpackTOML.Execute(&b, map[string]string{"APIVersion": "0.8"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"), b.Bytes(), 0600)).To(Succeed())
+
+		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+			return libcnb.BuildResult{
+				Layers: []libcnb.Layer{},
 				Processes: []libcnb.Process{
 					{
 						Type:             "test-type",
@@ -580,33 +1603,399 @@ version = "1.1.1"
 		)
 
 		Expect(tomlWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "launch.toml")))
-		Expect(tomlWriter.Calls[0].Arguments[1]).To(Equal(libcnb.LaunchTOML{
-			Labels: []libcnb.Label{
-				{
-					Key:   "test-key",
-					Value: "test-value",
-				},
-			},
-			Processes: []libcnb.Process{
-				{
-					Type:    "test-type",
-					Command: []string{"test-command"},
-					Default: true,
-				},
-			},
-			Slices: []libcnb.Slice{
-				{
-					Paths: []string{"test-path"},
-				},
-			},
-		}))
+		Expect(tomlWriter.Calls[0].Arguments[1]).To(Equal(libcnb.LaunchTOML{
+			Labels: []libcnb.Label{
+				{
+					Key:   "test-key",
+					Value: "test-value",
+				},
+			},
+			Processes: []libcnb.Process{
+				{
+					Type:    "test-type",
+					Command: []string{"test-command"},
+					Default: true,
+				},
+			},
+			Slices: []libcnb.Slice{
+				{
+					Paths: []string{"test-path"},
+				},
+			},
+		}))
+	})
+
+	it("writes persistent metadata", func() {
+		m := map[string]interface{}{"test-key": "test-value"}
+
+		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+			return libcnb.BuildResult{PersistentMetadata: m}, nil
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(tomlWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "store.toml")))
+		Expect(tomlWriter.Calls[0].Arguments[1]).To(Equal(libcnb.Store{Metadata: m}))
+	})
+
+	context("dependency layers", func() {
+		var dependency libcnb.BuildpackDependency
+
+		it.Before(func() {
+			dependency = libcnb.BuildpackDependency{
+				ID:     "test-id",
+				URI:    "https://localhost/test-artifact.tgz",
+				SHA256: strings.Repeat("0", 64),
+			}
+
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				_, err := context.Layers.DependencyLayer(dependency)
+				return libcnb.NewBuildResult(), err
+			}
+		})
+
+		it("verifies dependencies with the configured verifier", func() {
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithSignatureVerifier(&mocks.SignatureVerifier{}),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Error(0)).
+				To(MatchError("unable to verify signature of dependency test-id: no signature-uri declared"))
+		})
+
+		it("verifies dependencies with the key from a binding", func() {
+			keyring, err := os.ReadFile(filepath.Join(workingDir, "testdata", "gpg", "rsa.asc"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(platformPath, "bindings", "signature"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(platformPath, "bindings", "signature", "type"), []byte("dependency-signature"), 0600)).
+				To(Succeed())
+			Expect(os.WriteFile(filepath.Join(platformPath, "bindings", "signature", "gpg.pub"), keyring, 0600)).To(Succeed())
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Error(0)).
+				To(MatchError("unable to verify signature of dependency test-id: no signature-uri declared"))
+		})
+
+		it("fails with an invalid key", func() {
+			Expect(os.MkdirAll(filepath.Join(platformPath, "bindings", "signature"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(platformPath, "bindings", "signature", "type"), []byte("dependency-signature"), 0600)).
+				To(Succeed())
+			Expect(os.WriteFile(filepath.Join(platformPath, "bindings", "signature", "cosign.pub"), []byte("test-key"), 0600)).
+				To(Succeed())
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(HavePrefix("unable to create dependency signature verifier")))
+		})
+
+		it("refuses downloads denied by the platform network policy", func() {
+			Expect(os.WriteFile(filepath.Join(platformPath, "env", "BP_NETWORK_DENIED_HOSTS"), []byte("localhost"), 0600)).
+				To(Succeed())
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			var policyErr *libcnb.NetworkPolicyError
+			Expect(errors.As(exitHandler.Calls[0].Arguments.Error(0), &policyErr)).To(BeTrue())
+			Expect(policyErr.URI).To(Equal("https://localhost/test-artifact.tgz"))
+		})
+
+		it("reads vendored dependencies from the buildpack file system", func() {
+			digest := sha256.Sum256([]byte("test-content"))
+			dependency.SHA256 = hex.EncodeToString(digest[:])
+			fsys := fstest.MapFS{
+				"dependencies/" + dependency.SHA256 + "/test-artifact.tgz": {Data: []byte("test-content")},
+			}
+
+			var layer libcnb.Layer
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				var err error
+				layer, err = context.Layers.DependencyLayer(dependency)
+				return libcnb.NewBuildResult(), err
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithBuildpackFS(fsys),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			Expect(os.ReadFile(filepath.Join(layer.Path, "test-artifact.tgz"))).To(Equal([]byte("test-content")))
+		})
+
+		it("fails with an invalid network policy", func() {
+			Expect(os.WriteFile(filepath.Join(platformPath, "env", "BP_NETWORK_REQUIRE_TLS"), []byte("test-value"), 0600)).
+				To(Succeed())
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(HavePrefix("unable to read network policy")))
+		})
+	})
+
+	it("writes shared state with the TOML writer", func() {
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			_, err := libcnb.PublishSharedState(&context.Layers, "test-state", map[string]string{"test-key": "test-value"})
+			return libcnb.NewBuildResult(), err
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(tomlWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "shared-state-test-state", "state.toml")))
+		Expect(tomlWriter.Calls[0].Arguments[1]).To(Equal(map[string]string{"test-key": "test-value"}))
+	})
+
+	it("does not write persistent metadata when store writes are disabled", func() {
+		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+			return libcnb.BuildResult{PersistentMetadata: map[string]interface{}{"test-key": "test-value"}}, nil
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithStoreWrites(false),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(tomlWriter.Calls).To(BeEmpty())
+	})
+
+	context("persistent metadata namespacing", func() {
+		var ctx libcnb.BuildContext
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(layersPath, "store.toml"),
+				[]byte(`
+[metadata]
+libcnb-namespaces = ["other-id", "test-id"]
+
+[metadata.test-id]
+test-key = "test-value"
+
+[metadata.other-id]
+other-key = "other-value"
+`),
+				0600),
+			).To(Succeed())
+		})
+
+		it("reads persistent metadata namespaced under the buildpack id", func() {
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				ctx = context
+				return libcnb.NewBuildResult(), nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithStoreNamespacing(true),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(ctx.PersistentMetadata).To(Equal(map[string]interface{}{"test-key": "test-value"}))
+		})
+
+		it("reads all persistent metadata when namespacing is disabled", func() {
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				ctx = context
+				return libcnb.NewBuildResult(), nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(ctx.PersistentMetadata).To(HaveKey("other-id"))
+			Expect(ctx.PersistentMetadata).To(HaveKey("test-id"))
+		})
+
+		it("retains persistent metadata of other buildpacks", func() {
+			m := map[string]interface{}{"new-key": "new-value"}
+
+			buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+				return libcnb.BuildResult{PersistentMetadata: m}, nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithStoreNamespacing(true),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(tomlWriter.Calls[0].Arguments[1]).To(Equal(libcnb.Store{Metadata: map[string]interface{}{
+				"test-id":                 m,
+				"other-id":                map[string]interface{}{"other-key": "other-value"},
+				libcnb.StoreNamespacesKey: []string{"other-id", "test-id"},
+			}}))
+		})
+
+		it("retains persistent metadata of other buildpacks when lazy loading", func() {
+			m := map[string]interface{}{"new-key": "new-value"}
+
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				Expect(context.LoadPersistentMetadata()).To(Equal(map[string]interface{}{"test-key": "test-value"}))
+				return libcnb.BuildResult{PersistentMetadata: m}, nil
+			}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithStoreNamespacing(true),
+					libcnb.WithLazyLoading(),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(tomlWriter.Calls[0].Arguments[1]).To(Equal(libcnb.Store{Metadata: map[string]interface{}{
+				"test-id":                 m,
+				"other-id":                map[string]interface{}{"other-key": "other-value"},
+				libcnb.StoreNamespacesKey: []string{"other-id", "test-id"},
+			}}))
+		})
+
+		context("legacy persistent metadata", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(layersPath, "store.toml"),
+					[]byte(`
+[metadata]
+libcnb-namespaces = ["other-id"]
+legacy-key = "legacy-value"
+
+[metadata.legacy-table]
+table-key = "table-value"
+
+[metadata.other-id]
+other-key = "other-value"
+`),
+					0600),
+				).To(Succeed())
+			})
+
+			it("reads legacy keys that are not known namespaces", func() {
+				buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+					ctx = context
+					return libcnb.NewBuildResult(), nil
+				}
+
+				libcnb.Build(buildFunc,
+					libcnb.NewConfig(
+						libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+						libcnb.WithTOMLWriter(tomlWriter),
+						libcnb.WithStoreNamespacing(true),
+						libcnb.WithLogger(log.NewDiscard())),
+				)
+
+				Expect(ctx.PersistentMetadata).To(Equal(map[string]interface{}{
+					"legacy-key":   "legacy-value",
+					"legacy-table": map[string]interface{}{"table-key": "table-value"},
+				}))
+			})
+
+			it("migrates legacy keys into the namespace of the buildpack", func() {
+				buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+					return libcnb.BuildResult{PersistentMetadata: context.PersistentMetadata}, nil
+				}
+
+				libcnb.Build(buildFunc,
+					libcnb.NewConfig(
+						libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+						libcnb.WithTOMLWriter(tomlWriter),
+						libcnb.WithStoreNamespacing(true),
+						libcnb.WithLogger(log.NewDiscard())),
+				)
+
+				Expect(tomlWriter.Calls[0].Arguments[1]).To(Equal(libcnb.Store{Metadata: map[string]interface{}{
+					"test-id": map[string]interface{}{
+						"legacy-key":   "legacy-value",
+						"legacy-table": map[string]interface{}{"table-key": "table-value"},
+					},
+					"other-id":                map[string]interface{}{"other-key": "other-value"},
+					libcnb.StoreNamespacesKey: []string{"other-id", "test-id"},
+				}}))
+			})
+		})
+	})
+
+	it("does not write empty files", func() {
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(tomlWriter.Calls).To(HaveLen(0))
+	})
+
+	it("writes empty files when configured to", func() {
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithAlwaysWritePhaseOutputs(),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(tomlWriter.Calls).To(HaveLen(2))
+		Expect(tomlWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "launch.toml")))
+		Expect(tomlWriter.Calls[0].Arguments[1]).To(Equal(libcnb.LaunchTOML{}))
+		Expect(tomlWriter.Calls[1].Arguments[0]).To(Equal(filepath.Join(layersPath, "build.toml")))
+		Expect(tomlWriter.Calls[1].Arguments[1]).To(Equal(libcnb.BuildTOML{}))
 	})
 
-	it("writes persistent metadata", func() {
-		m := map[string]interface{}{"test-key": "test-value"}
+	it("removes stale layers", func() {
+		Expect(os.WriteFile(filepath.Join(layersPath, "alpha.toml"), []byte(""), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(layersPath, "bravo.toml"), []byte(""), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(layersPath, "store.toml"), []byte(""), 0600)).To(Succeed())
+
+		layer := libcnb.Layer{Name: "alpha"}
 
 		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
-			return libcnb.BuildResult{PersistentMetadata: m}, nil
+			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
 		}
 
 		libcnb.Build(buildFunc,
@@ -616,43 +2005,416 @@ version = "1.1.1"
 				libcnb.WithLogger(log.NewDiscard())),
 		)
 
-		Expect(tomlWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "store.toml")))
-		Expect(tomlWriter.Calls[0].Arguments[1]).To(Equal(libcnb.Store{Metadata: m}))
+		Expect(tomlWriter.Calls).To(HaveLen(1))
+		Expect(tomlWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "alpha.toml")))
+		Expect(filepath.Join(layersPath, "bravo.toml")).NotTo(BeARegularFile())
+		Expect(filepath.Join(layersPath, "store.toml")).To(BeARegularFile())
 	})
 
-	it("does not write empty files", func() {
+	it("removes stale SBOMs", func() {
+		for _, f := range []string{"alpha.sbom.cdx.json", "bravo.toml", "bravo.sbom.cdx.json", "charlie.sbom.syft.json", "launch.sbom.cdx.json", "build.sbom.cdx.json"} {
+			Expect(os.WriteFile(filepath.Join(layersPath, f), []byte{}, 0600)).To(Succeed())
+		}
+
+		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+			return libcnb.BuildResult{Layers: []libcnb.Layer{{Name: "alpha"}}}, nil
+		}
+
 		libcnb.Build(buildFunc,
 			libcnb.NewConfig(
 				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
 				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithExitHandler(exitHandler),
 				libcnb.WithLogger(log.NewDiscard())),
 		)
 
-		Expect(tomlWriter.Calls).To(HaveLen(0))
+		Expect(filepath.Join(layersPath, "alpha.sbom.cdx.json")).To(BeARegularFile())
+		Expect(filepath.Join(layersPath, "bravo.sbom.cdx.json")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(layersPath, "charlie.sbom.syft.json")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(layersPath, "launch.sbom.cdx.json")).To(BeARegularFile())
+		Expect(filepath.Join(layersPath, "build.sbom.cdx.json")).To(BeARegularFile())
 	})
 
-	it("removes stale layers", func() {
+	it("removes scratch directories", func() {
+		var scratch string
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			var err error
+			scratch, err = context.Layers.Scratch("test-scratch")
+			if err != nil {
+				return libcnb.BuildResult{}, err
+			}
+			return libcnb.NewBuildResult(), os.WriteFile(filepath.Join(scratch, "test-file"), []byte{}, 0600)
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(exitHandler.Calls).To(BeEmpty())
+		Expect(scratch).To(HavePrefix(layersPath))
+		Expect(scratch).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(layersPath, ".scratch")).NotTo(BeAnExistingFile())
+	})
+
+	it("warns about unexpected files in the layers directory", func() {
+		Expect(os.MkdirAll(filepath.Join(layersPath, "alpha"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(layersPath, "bin"), 0755)).To(Succeed())
+		for _, f := range []string{"store.toml", "app.jar"} {
+			Expect(os.WriteFile(filepath.Join(layersPath, f), []byte{}, 0600)).To(Succeed())
+		}
+
+		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+			return libcnb.BuildResult{
+				Layers:    []libcnb.Layer{{Name: "alpha", Path: filepath.Join(layersPath, "alpha")}},
+				Processes: []libcnb.Process{{Type: "web", Command: []string{"test-command"}, Default: true}},
+			}, nil
+		}
+
+		out := &bytes.Buffer{}
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.New(out)),
+				libcnb.WithUnexpectedFileWarnings()),
+		)
+
+		Expect(out.String()).To(Equal(fmt.Sprintf("Warning: the following files in the layers directory %s are not part of a "+
+			"contributed layer and will not be exported:\n  app.jar\n  bin/\n", layersPath)))
+	})
+
+	it("records changes without making them in a dry run", func() {
 		Expect(os.WriteFile(filepath.Join(layersPath, "alpha.toml"), []byte(""), 0600)).To(Succeed())
 		Expect(os.WriteFile(filepath.Join(layersPath, "bravo.toml"), []byte(""), 0600)).To(Succeed())
-		Expect(os.WriteFile(filepath.Join(layersPath, "store.toml"), []byte(""), 0600)).To(Succeed())
 
-		layer := libcnb.Layer{Name: "alpha"}
+		layer := libcnb.Layer{
+			Name:              "alpha",
+			Path:              filepath.Join(layersPath, "alpha"),
+			LaunchEnvironment: libcnb.Environment{},
+			LayerTypes:        libcnb.LayerTypes{Launch: true},
+		}
+		layer.LaunchEnvironment.Override("TEST_KEY", "test-value")
 
 		buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+			return libcnb.BuildResult{
+				Layers:    []libcnb.Layer{layer},
+				Processes: []libcnb.Process{{Type: "web", Command: []string{"test-command"}, Default: true}},
+			}, nil
+		}
+
+		out := &bytes.Buffer{}
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.New(out)),
+				libcnb.WithDryRun()),
+		)
+
+		Expect(out.String()).To(Equal(fmt.Sprintf(`Dry run: the following changes would be made
++ %[1]s/alpha/env.launch/TEST_KEY.override
+~ %[1]s/alpha.toml
+- %[1]s/bravo.toml
++ %[1]s/launch.toml
+`, layersPath)))
+		Expect(filepath.Join(layersPath, "alpha")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(layersPath, "bravo.toml")).To(BeARegularFile())
+		Expect(filepath.Join(layersPath, "launch.toml")).NotTo(BeAnExistingFile())
+	})
+
+	it("leaves ignored files and scratch directories in place in a dry run", func() {
+		Expect(os.MkdirAll(filepath.Join(layersPath, "alpha"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(layersPath, "alpha", "README.md"), []byte(""), 0600)).To(Succeed())
+
+		layer := libcnb.Layer{
+			Name:       "alpha",
+			Path:       filepath.Join(layersPath, "alpha"),
+			LayerTypes: libcnb.LayerTypes{Cache: true},
+		}
+		layer.Ignore("*.md")
+
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			scratch, err := context.Layers.Scratch("test-scratch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(scratch, "test-file"), []byte(""), 0600)).To(Succeed())
+
 			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
 		}
 
+		out := &bytes.Buffer{}
 		libcnb.Build(buildFunc,
 			libcnb.NewConfig(
-				libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
-				libcnb.WithTOMLWriter(tomlWriter),
-				libcnb.WithLogger(log.NewDiscard())),
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.New(out)),
+				libcnb.WithDryRun()),
 		)
 
-		Expect(tomlWriter.Calls).To(HaveLen(1))
-		Expect(tomlWriter.Calls[0].Arguments[0]).To(Equal(filepath.Join(layersPath, "alpha.toml")))
-		Expect(filepath.Join(layersPath, "bravo.toml")).NotTo(BeARegularFile())
+		Expect(out.String()).To(Equal(fmt.Sprintf(`Dry run: the following changes would be made
+- %[1]s/.scratch
+- %[1]s/alpha/README.md
++ %[1]s/alpha.toml
+`, layersPath)))
+		Expect(filepath.Join(layersPath, "alpha", "README.md")).To(BeARegularFile())
+		Expect(filepath.Join(layersPath, ".scratch", "test-scratch", "test-file")).To(BeARegularFile())
+	})
+
+	it("persists completed layers when terminated", func() {
+		Expect(os.WriteFile(filepath.Join(layersPath, "bravo.toml"), []byte(""), 0600)).To(Succeed())
+
+		layer := libcnb.Layer{
+			Name:              "alpha",
+			Path:              filepath.Join(layersPath, "alpha"),
+			LayerTypes:        libcnb.LayerTypes{Cache: true},
+			LaunchEnvironment: libcnb.Environment{},
+		}
+		layer.LaunchEnvironment.Override("TEST_KEY", "test-value")
+
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			context.CompleteLayer(layer)
+			_, err := context.Layers.Scratch("test-scratch")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(syscall.Kill(os.Getpid(), syscall.SIGTERM)).To(Succeed())
+			<-context.Context.Done()
+			return libcnb.BuildResult{}, context.Context.Err()
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+				libcnb.WithPartialResultsOnTerminate()),
+		)
+
+		Expect(exitHandler.Calls).To(HaveLen(1))
+		Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError("build terminated, persisted 1 completed layer(s)"))
+		Expect(filepath.Join(layersPath, "alpha.toml")).To(BeARegularFile())
+		Expect(filepath.Join(layersPath, "alpha", "env.launch", "TEST_KEY.override")).To(BeARegularFile())
+		Expect(filepath.Join(layersPath, "bravo.toml")).NotTo(BeAnExistingFile())
 		Expect(filepath.Join(layersPath, "store.toml")).To(BeARegularFile())
+		Expect(filepath.Join(layersPath, "launch.toml")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(layersPath, ".scratch")).NotTo(BeAnExistingFile())
+	})
+
+	// Persisting completed layers while the build function is still running is a data race, detected by make test.
+	it("persists completed layers once the build function returns when terminated", func() {
+		layer := libcnb.Layer{
+			Name:              "alpha",
+			Path:              filepath.Join(layersPath, "alpha"),
+			LayerTypes:        libcnb.LayerTypes{Cache: true},
+			LaunchEnvironment: libcnb.Environment{},
+		}
+
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			context.CompleteLayer(layer)
+			Expect(syscall.Kill(os.Getpid(), syscall.SIGTERM)).To(Succeed())
+			<-context.Context.Done()
+
+			layer.LaunchEnvironment.Override("TEST_KEY", "test-value")
+			return libcnb.BuildResult{}, context.Context.Err()
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+				libcnb.WithPartialResultsOnTerminate()),
+		)
+
+		Expect(exitHandler.Calls).To(HaveLen(1))
+		Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError("build terminated, persisted 1 completed layer(s)"))
+		Expect(os.ReadFile(filepath.Join(layersPath, "alpha", "env.launch", "TEST_KEY.override"))).To(Equal([]byte("test-value")))
+	})
+
+	it("waits for the build function to return when terminated with a timeout", func() {
+		layer := libcnb.Layer{
+			Name:              "alpha",
+			Path:              filepath.Join(layersPath, "alpha"),
+			LayerTypes:        libcnb.LayerTypes{Cache: true},
+			LaunchEnvironment: libcnb.Environment{},
+		}
+
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			context.CompleteLayer(layer)
+			Expect(syscall.Kill(os.Getpid(), syscall.SIGTERM)).To(Succeed())
+			<-context.Context.Done()
+
+			time.Sleep(10 * time.Millisecond)
+			layer.LaunchEnvironment.Override("TEST_KEY", "test-value")
+			return libcnb.BuildResult{}, context.Context.Err()
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+				libcnb.WithPartialResultsOnTerminate(),
+				libcnb.WithTimeout(time.Minute)),
+		)
+
+		Expect(exitHandler.Calls).To(HaveLen(1))
+		Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError("build terminated, persisted 1 completed layer(s)"))
+		Expect(os.ReadFile(filepath.Join(layersPath, "alpha", "env.launch", "TEST_KEY.override"))).To(Equal([]byte("test-value")))
+	})
+
+	it("uses the result of a build function that completes when terminated", func() {
+		layer := libcnb.Layer{Name: "alpha", Path: filepath.Join(layersPath, "alpha"), LayerTypes: libcnb.LayerTypes{Cache: true}}
+
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			Expect(syscall.Kill(os.Getpid(), syscall.SIGTERM)).To(Succeed())
+			<-context.Context.Done()
+			return libcnb.BuildResult{Layers: []libcnb.Layer{layer}}, nil
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+				libcnb.WithPartialResultsOnTerminate()),
+		)
+
+		Expect(exitHandler.Calls).To(BeEmpty())
+		Expect(filepath.Join(layersPath, "alpha.toml")).To(BeARegularFile())
+	})
+
+	it("ignores completed layers when not terminated", func() {
+		buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			context.CompleteLayer(libcnb.Layer{Name: "alpha", Path: filepath.Join(layersPath, "alpha")})
+			return libcnb.BuildResult{}, nil
+		}
+
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+				libcnb.WithPartialResultsOnTerminate()),
+		)
+
+		Expect(exitHandler.Calls).To(BeEmpty())
+		Expect(filepath.Join(layersPath, "alpha.toml")).NotTo(BeAnExistingFile())
+	})
+
+	context("buildpack plan option", func() {
+		var ctx libcnb.BuildContext
+
+		it.Before(func() {
+			buildFunc = func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				ctx = context
+				return libcnb.NewBuildResult(), nil
+			}
+			t.Setenv("CNB_BP_PLAN_PATH", "")
+			Expect(os.Unsetenv("CNB_BP_PLAN_PATH")).To(Succeed())
+		})
+
+		it("uses the given plan instead of CNB_BP_PLAN_PATH", func() {
+			plan := libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{{Name: "other-name"}}}
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithBuildpackPlan(plan)),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			Expect(ctx.Plan).To(Equal(plan))
+		})
+
+		it("decodes the plan from a reader", func() {
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithLazyLoading(),
+					libcnb.WithBuildpackPlanReader(strings.NewReader("[[entries]]\nname = \"other-name\"\n"))),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			Expect(ctx.LoadPlan()).To(Equal(libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{{Name: "other-name"}}}))
+		})
+	})
+
+	it("explains the resolved context", func() {
+		out := &bytes.Buffer{}
+		libcnb.Build(buildFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+				libcnb.WithBuildExplanation(out)),
+		)
+
+		Expect(out.String()).To(Equal(`Build context:
+  Buildpack:            test-id 1.1.1 (Buildpack API 0.8)
+  Plan entries:         test-name
+  Bindings:             alpha
+  Platform environment: TEST_ENV
+  Stack:                test-stack-id
+  Target:               unknown
+`))
+		Expect(out.String()).NotTo(ContainSubstring("test-value"))
+	})
+
+	context("warnings", func() {
+		it.Before(func() {
+			buildFunc = func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+				return libcnb.BuildResult{Warnings: []libcnb.Warning{
+					{Message: "BP_JVM_VERSION is not set, using 17", Remedy: "Set BP_JVM_VERSION to choose a version"},
+					{Message: "test-message"},
+				}}, nil
+			}
+		})
+
+		it("prints warnings at the end of the build", func() {
+			out := &bytes.Buffer{}
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(out.String()).To(HaveSuffix(`Warnings:
+  - BP_JVM_VERSION is not set, using 17
+    Set BP_JVM_VERSION to choose a version
+  - test-message
+`))
+			Expect(exitHandler.Calls).To(BeEmpty())
+		})
+
+		it("writes a warning report", func() {
+			path := filepath.Join(t.TempDir(), "warnings.toml")
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithWarningReport(path)),
+			)
+
+			Expect(tomlWriter.Calls[len(tomlWriter.Calls)-1].Arguments[0]).To(Equal(path))
+			Expect(tomlWriter.Calls[len(tomlWriter.Calls)-1].Arguments[1]).To(Equal(libcnb.WarningReport{
+				Buildpack:     "test-id",
+				LibcnbVersion: libcnb.Version(),
+				Warnings: []libcnb.Warning{
+					{Message: "BP_JVM_VERSION is not set, using 17", Remedy: "Set BP_JVM_VERSION to choose a version"},
+					{Message: "test-message"},
+				},
+			}))
+		})
 	})
 
 	it("writes build.toml", func() {
@@ -683,6 +2445,43 @@ version = "1.1.1"
 		}))
 	})
 
+	context("AddStandardLabels", func() {
+		it("adds labels from buildpack.toml", func() {
+			result := libcnb.NewBuildResult()
+			result.Labels = []libcnb.Label{{Key: "io.buildpacks.buildpack.test-id.version", Value: "0.0.0"}}
+
+			result.AddStandardLabels(libcnb.Buildpack{
+				Info: libcnb.BuildpackInfo{
+					ID:       "test-id",
+					Name:     "test-name",
+					Version:  "1.1.1",
+					Homepage: "https://example.com",
+					Licenses: []libcnb.License{
+						{Type: "Apache-2.0"},
+						{URI: "https://example.com/license"},
+					},
+				},
+			})
+
+			Expect(result.Labels).To(Equal([]libcnb.Label{
+				{Key: "io.buildpacks.buildpack.test-id.version", Value: "1.1.1"},
+				{Key: "io.buildpacks.buildpack.test-id.name", Value: "test-name"},
+				{Key: "io.buildpacks.buildpack.test-id.homepage", Value: "https://example.com"},
+				{Key: "io.buildpacks.buildpack.test-id.licenses", Value: "Apache-2.0,https://example.com/license"},
+			}))
+		})
+
+		it("omits fields that are not set", func() {
+			result := libcnb.NewBuildResult()
+
+			result.AddStandardLabels(libcnb.Buildpack{Info: libcnb.BuildpackInfo{ID: "test-id", Version: "1.1.1"}})
+
+			Expect(result.Labels).To(Equal([]libcnb.Label{
+				{Key: "io.buildpacks.buildpack.test-id.version", Value: "1.1.1"},
+			}))
+		})
+	})
+
 	context("Validates SBOM entries", func() {
 		it.Before(func() {
 			Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"),
@@ -766,6 +2565,40 @@ sbom-formats = []
 			Expect(exitHandler.Calls).To(BeEmpty())
 		})
 
+		it("sets SBOM times from SOURCE_DATE_EPOCH", func() {
+			t.Setenv("SOURCE_DATE_EPOCH", "1000000000")
+			Expect(os.WriteFile(filepath.Join(layersPath, "launch.sbom.cdx.json"), []byte{}, 0600)).To(Succeed())
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			info, err := os.Stat(filepath.Join(layersPath, "launch.sbom.cdx.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ModTime()).To(BeTemporally("==", time.Unix(1000000000, 0)))
+		})
+
+		it("sets SBOM times from SOURCE_DATE_EPOCH in the configured environment", func() {
+			Expect(os.WriteFile(filepath.Join(layersPath, "launch.sbom.cdx.json"), []byte{}, 0600)).To(Succeed())
+
+			libcnb.Build(buildFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, layersPath, platformPath, buildpackPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithEnvironment(append(os.Environ(), "SOURCE_DATE_EPOCH=1000000000"))),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			info, err := os.Stat(filepath.Join(layersPath, "launch.sbom.cdx.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ModTime()).To(BeTemporally("==", time.Unix(1000000000, 0)))
+		})
+
 		it("has a junk format", func() {
 			Expect(os.WriteFile(filepath.Join(layersPath, "launch.sbom.random.json"), []byte{}, 0600)).To(Succeed())
 			Expect(os.WriteFile(filepath.Join(layersPath, "layer.sbom.cdx.json"), []byte{}, 0600)).To(Succeed())
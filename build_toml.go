@@ -16,6 +16,10 @@
 
 package libcnb
 
+import (
+	"fmt"
+)
+
 // BuildTOML represents the contents of build.toml.
 type BuildTOML struct {
 	// Unmet is a collection of buildpack plan entries that should be passed through to subsequent providers.
@@ -25,3 +29,13 @@ type BuildTOML struct {
 func (b BuildTOML) isEmpty() bool {
 	return len(b.Unmet) == 0
 }
+
+// ReadBuildTOML decodes the build.toml file at the given path, as written by Build.
+func ReadBuildTOML(path string) (BuildTOML, error) {
+	var build BuildTOML
+	if err := decodeTOMLFile(path, &build); err != nil {
+		return BuildTOML{}, fmt.Errorf("unable to decode build metadata %s\n%w", path, err)
+	}
+
+	return build, nil
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libcnb_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/internal"
+)
+
+func testBuildTOML(t *testing.T, _ spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path string
+	)
+
+	it.Before(func() {
+		path = filepath.Join(t.TempDir(), "build.toml")
+	})
+
+	it("reads build.toml written by the TOMLWriter", func() {
+		build := libcnb.BuildTOML{
+			Unmet: []libcnb.UnmetPlanEntry{
+				{Name: "test-entry"},
+			},
+		}
+		Expect(internal.TOMLWriter{}.Write(path, build)).To(Succeed())
+
+		Expect(libcnb.ReadBuildTOML(path)).To(Equal(build))
+	})
+
+	it("returns an error if the file cannot be decoded", func() {
+		Expect(os.WriteFile(path, []byte("unmet = 1"), 0600)).To(Succeed())
+
+		_, err := libcnb.ReadBuildTOML(path)
+		Expect(err).To(MatchError(ContainSubstring("unable to decode build metadata")))
+	})
+}
@@ -16,6 +16,12 @@
 
 package libcnb
 
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
 // BuildpackInfo is information about the buildpack.
 type BuildpackInfo struct {
 	// ID is the ID of the buildpack.
@@ -46,6 +52,42 @@ type BuildpackInfo struct {
 	SBOMFormats []string `toml:"sbom-formats"`
 }
 
+// Ref returns the canonical reference to the buildpack, <id>@<version>, or just the ID if there is no version.
+func (b BuildpackInfo) Ref() string {
+	return ref(b.ID, b.Version)
+}
+
+// SBOMFormatTypes returns the SBOM formats declared in sbom-formats.
+func (b BuildpackInfo) SBOMFormatTypes() ([]SBOMFormat, error) {
+	var formats []SBOMFormat
+	for _, m := range b.SBOMFormats {
+		f, err := SBOMFormatFromMediaType(m)
+		if err != nil {
+			return nil, err
+		}
+		formats = append(formats, f)
+	}
+
+	return formats, nil
+}
+
+// Sanitize returns the buildpack ID with slashes replaced by underscores, so that it is safe to use in image
+// references, file names, and layer names.
+func (b BuildpackInfo) Sanitize() string {
+	return sanitize(b.ID)
+}
+
+func ref(id string, version string) string {
+	if version == "" {
+		return id
+	}
+	return fmt.Sprintf("%s@%s", id, version)
+}
+
+func sanitize(id string) string {
+	return strings.ReplaceAll(id, "/", "_")
+}
+
 // License contains information about a Software License
 // governing the use or redistribution of a buildpack
 type License struct {
@@ -58,6 +100,19 @@ type License struct {
 	URI string `toml:"uri"`
 }
 
+// licenseIDs returns the type of each license, or its URI if it has no type.
+func licenseIDs(licenses []License) []string {
+	var ids []string
+	for _, l := range licenses {
+		if l.Type != "" {
+			ids = append(ids, l.Type)
+		} else if l.URI != "" {
+			ids = append(ids, l.URI)
+		}
+	}
+	return ids
+}
+
 // BuildpackOrderBuildpack is a buildpack within in a buildpack order group.
 type BuildpackOrderBuildpack struct {
 	// ID is the id of the buildpack.
@@ -111,6 +166,38 @@ type Target struct {
 	Distros []TargetDistro `toml:"distros"`
 }
 
+// String returns the target info as os/arch, or os/arch/variant if it has a variant.
+func (t TargetInfo) String() string {
+	s := fmt.Sprintf("%s/%s", t.OS, t.Arch)
+	if t.Variant != "" {
+		s = fmt.Sprintf("%s/%s", s, t.Variant)
+	}
+	return s
+}
+
+// Matches returns whether the target supports the given target info and distro. Fields of the target that are empty
+// or "*" match any value, as do target distros when none are declared. Fields of the target info and distro that are
+// empty are unknown and match any value.
+func (t Target) Matches(info TargetInfo, distro TargetDistro) bool {
+	if !matchesTargetField(t.OS, info.OS) || !matchesTargetField(t.Arch, info.Arch) || !matchesTargetField(t.Variant, info.Variant) {
+		return false
+	}
+
+	if len(t.Distros) == 0 || distro.Name == "" {
+		return true
+	}
+	for _, d := range t.Distros {
+		if matchesTargetField(d.Name, distro.Name) && matchesTargetField(d.Version, distro.Version) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesTargetField(declared string, actual string) bool {
+	return declared == "" || declared == "*" || actual == "" || declared == actual
+}
+
 // Buildpack is the contents of the buildpack.toml file.
 type Buildpack struct {
 	// API is the api version expected by the buildpack.
@@ -131,3 +218,62 @@ type Buildpack struct {
 	// Metadata is arbitrary metadata attached to the buildpack.
 	Metadata map[string]interface{} `toml:"metadata"`
 }
+
+// stackTargets maps well-known stack IDs to their equivalent targets. Only the bionic stack is restricted to an
+// architecture, as the jammy and noble stacks are published for both amd64 and arm64.
+var stackTargets = map[string]Target{
+	"io.buildpacks.stacks.bionic": {
+		TargetInfo: TargetInfo{OS: "linux", Arch: "amd64"},
+		Distros:    []TargetDistro{{Name: "ubuntu", Version: "18.04"}},
+	},
+	"io.buildpacks.stacks.jammy": {
+		TargetInfo: TargetInfo{OS: "linux"},
+		Distros:    []TargetDistro{{Name: "ubuntu", Version: "22.04"}},
+	},
+	"io.buildpacks.stacks.noble": {
+		TargetInfo: TargetInfo{OS: "linux"},
+		Distros:    []TargetDistro{{Name: "ubuntu", Version: "24.04"}},
+	},
+}
+
+// EffectiveTargets returns the targets supported by the buildpack. If the buildpack declares targets they are returned
+// as-is. Otherwise, targets are synthesized from the deprecated stacks: well-known stacks map to their OS,
+// architecture and distribution, the "*" wildcard maps to a target matching any OS and architecture, and any other
+// stack maps to a Linux target with any architecture.
+func (b Buildpack) EffectiveTargets() []Target {
+	if len(b.Targets) > 0 {
+		return b.Targets
+	}
+
+	var (
+		targets  []Target
+		wildcard bool
+		generic  bool
+	)
+	for _, s := range b.Stacks {
+		if t, ok := stackTargets[s.ID]; ok {
+			targets = append(targets, t)
+		} else if s.ID == "*" {
+			if !wildcard {
+				targets = append(targets, Target{})
+				wildcard = true
+			}
+		} else if !generic {
+			targets = append(targets, Target{TargetInfo: TargetInfo{OS: "linux"}})
+			generic = true
+		}
+	}
+
+	return targets
+}
+
+// ReadBuildpackTOML decodes the buildpack.toml file at the given path. The path of the returned buildpack is the
+// directory containing the file.
+func ReadBuildpackTOML(path string) (Buildpack, error) {
+	buildpack := Buildpack{Path: filepath.Dir(path)}
+	if err := decodeTOMLFile(path, &buildpack); err != nil {
+		return Buildpack{}, fmt.Errorf("unable to decode buildpack %s\n%w", path, err)
+	}
+
+	return buildpack, nil
+}
@@ -16,6 +16,17 @@
 
 package libcnb
 
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/buildpacks/libcnb/v2/log"
+)
+
 // BuildpackPlan represents a buildpack plan.
 type BuildpackPlan struct {
 
@@ -23,6 +34,97 @@ type BuildpackPlan struct {
 	Entries []BuildpackPlanEntry `toml:"entries,omitempty"`
 }
 
+// Resolve merges the entries with the given name into a single entry, as a plan may contain one for each buildpack that
+// required it. Metadata from later entries replaces metadata with the same key from earlier entries. It returns false
+// if the plan contains no entry with the name. It is the same for plans provided to build and to generate.
+func (p BuildpackPlan) Resolve(name string) (BuildpackPlanEntry, bool) {
+	entry := BuildpackPlanEntry{Name: name, Metadata: map[string]interface{}{}}
+
+	found := false
+	for _, e := range p.Entries {
+		if e.Name != name {
+			continue
+		}
+
+		found = true
+		for k, v := range e.Metadata {
+			entry.Metadata[k] = v
+		}
+	}
+
+	return entry, found
+}
+
+// DeduplicationStrategy resolves the entries of a buildpack plan that share a name but differ in metadata into the
+// single entry that replaces them. Entries are in plan order.
+type DeduplicationStrategy func(name string, entries []BuildpackPlanEntry) (BuildpackPlanEntry, error)
+
+// KeepFirstEntry is a DeduplicationStrategy that keeps the first entry.
+func KeepFirstEntry(_ string, entries []BuildpackPlanEntry) (BuildpackPlanEntry, error) {
+	return entries[0], nil
+}
+
+// KeepLastEntry is a DeduplicationStrategy that keeps the last entry.
+func KeepLastEntry(_ string, entries []BuildpackPlanEntry) (BuildpackPlanEntry, error) {
+	return entries[len(entries)-1], nil
+}
+
+// MergeEntries is a DeduplicationStrategy that merges the metadata of the entries, as Resolve does.
+func MergeEntries(name string, entries []BuildpackPlanEntry) (BuildpackPlanEntry, error) {
+	entry, _ := BuildpackPlan{Entries: entries}.Resolve(name)
+	return entry, nil
+}
+
+// RequireIdenticalEntries is a DeduplicationStrategy that fails, for build implementations that cannot choose between
+// conflicting requirements.
+func RequireIdenticalEntries(name string, entries []BuildpackPlanEntry) (BuildpackPlanEntry, error) {
+	return BuildpackPlanEntry{}, fmt.Errorf("buildpack plan contains %d entries named %s with different metadata", len(entries), name)
+}
+
+// Deduplicate returns the plan with a single entry for each name, at the position of the first entry with the name.
+// Entries with identical metadata are collapsed, and entries with different metadata are resolved with strategy. Each
+// resolution is logged at debug level to logger, which may be nil.
+func (p BuildpackPlan) Deduplicate(strategy DeduplicationStrategy, logger log.Logger) (BuildpackPlan, error) {
+	var names []string
+	groups := map[string][]BuildpackPlanEntry{}
+	for _, e := range p.Entries {
+		if _, ok := groups[e.Name]; !ok {
+			names = append(names, e.Name)
+		}
+		groups[e.Name] = append(groups[e.Name], e)
+	}
+
+	var result BuildpackPlan
+	for _, name := range names {
+		entries := groups[name]
+
+		identical := true
+		for _, e := range entries[1:] {
+			if !reflect.DeepEqual(e.Metadata, entries[0].Metadata) {
+				identical = false
+				break
+			}
+		}
+		if identical {
+			result.Entries = append(result.Entries, entries[0])
+			continue
+		}
+
+		entry, err := strategy(name, entries)
+		if err != nil {
+			return BuildpackPlan{}, fmt.Errorf("unable to deduplicate buildpack plan entries named %s\n%w", name, err)
+		}
+		entry.Name = name
+
+		if logger != nil {
+			logger.Debugf("Deduplicated %d buildpack plan entries named %s to metadata %v", len(entries), name, entry.Metadata)
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+
+	return result, nil
+}
+
 // BuildpackPlanEntry represents an entry in the buildpack plan.
 type BuildpackPlanEntry struct {
 	// Name represents the name of the entry.
@@ -39,3 +141,44 @@ type UnmetPlanEntry struct {
 	// Name represents the name of the entry.
 	Name string `toml:"name"`
 }
+
+// ReadBuildpackPlan decodes the buildpack plan file at the given path, as provided to build and generate.
+func ReadBuildpackPlan(path string) (BuildpackPlan, error) {
+	var plan BuildpackPlan
+	if err := decodeTOMLFile(path, &plan); err != nil {
+		return BuildpackPlan{}, fmt.Errorf("unable to decode buildpack plan %s\n%w", path, err)
+	}
+
+	return plan, nil
+}
+
+// hasBuildpackPlan returns whether the buildpack plan is set with WithBuildpackPlan or WithBuildpackPlanReader, so
+// that CNB_BP_PLAN_PATH is not needed.
+func (c Config) hasBuildpackPlan() bool {
+	return c.buildpackPlan != nil || c.buildpackPlanReader != nil
+}
+
+// readBuildpackPlan returns the buildpack plan set with WithBuildpackPlan or WithBuildpackPlanReader or, if neither is
+// used, decodes the buildpack plan file at path. A plan file that does not exist is an empty plan.
+func (c Config) readBuildpackPlan(path string) (BuildpackPlan, error) {
+	if c.buildpackPlan != nil {
+		return *c.buildpackPlan, nil
+	}
+
+	var plan BuildpackPlan
+	if c.buildpackPlanReader != nil {
+		b, err := io.ReadAll(c.buildpackPlanReader)
+		if err != nil {
+			return BuildpackPlan{}, fmt.Errorf("unable to read buildpack plan\n%w", err)
+		}
+		if _, err := toml.Decode(string(b), &plan); err != nil {
+			return BuildpackPlan{}, fmt.Errorf("unable to decode buildpack plan\n%w", err)
+		}
+		return plan, nil
+	}
+
+	if err := decodeTOMLFile(path, &plan); err != nil && !os.IsNotExist(err) {
+		return BuildpackPlan{}, fmt.Errorf("unable to decode buildpack plan %s\n%w", path, err)
+	}
+	return plan, nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/log"
+)
+
+func testBuildpackPlan(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("Resolve", func() {
+		it("merges entries with the same name", func() {
+			plan := libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{
+				{Name: "test-name", Metadata: map[string]interface{}{"alpha": "1", "bravo": "1"}},
+				{Name: "other-name", Metadata: map[string]interface{}{"alpha": "2"}},
+				{Name: "test-name", Metadata: map[string]interface{}{"bravo": "3", "charlie": "3"}},
+			}}
+
+			entry, ok := plan.Resolve("test-name")
+			Expect(ok).To(BeTrue())
+			Expect(entry).To(Equal(libcnb.BuildpackPlanEntry{
+				Name:     "test-name",
+				Metadata: map[string]interface{}{"alpha": "1", "bravo": "3", "charlie": "3"},
+			}))
+		})
+
+		it("returns false without a matching entry", func() {
+			plan := libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{{Name: "other-name"}}}
+
+			entry, ok := plan.Resolve("test-name")
+			Expect(ok).To(BeFalse())
+			Expect(entry).To(Equal(libcnb.BuildpackPlanEntry{Name: "test-name", Metadata: map[string]interface{}{}}))
+		})
+	})
+	context("Deduplicate", func() {
+		plan := libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{
+			{Name: "test-name", Metadata: map[string]interface{}{"alpha": "1", "bravo": "1"}},
+			{Name: "other-name", Metadata: map[string]interface{}{"alpha": "2"}},
+			{Name: "test-name", Metadata: map[string]interface{}{"bravo": "3"}},
+			{Name: "other-name", Metadata: map[string]interface{}{"alpha": "2"}},
+		}}
+
+		it("keeps the first entry", func() {
+			Expect(plan.Deduplicate(libcnb.KeepFirstEntry, nil)).To(Equal(libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{
+				{Name: "test-name", Metadata: map[string]interface{}{"alpha": "1", "bravo": "1"}},
+				{Name: "other-name", Metadata: map[string]interface{}{"alpha": "2"}},
+			}}))
+		})
+
+		it("keeps the last entry", func() {
+			Expect(plan.Deduplicate(libcnb.KeepLastEntry, nil)).To(Equal(libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{
+				{Name: "test-name", Metadata: map[string]interface{}{"bravo": "3"}},
+				{Name: "other-name", Metadata: map[string]interface{}{"alpha": "2"}},
+			}}))
+		})
+
+		it("merges entries and logs the result", func() {
+			t.Setenv("BP_LOG_LEVEL", "DEBUG")
+			b := &bytes.Buffer{}
+
+			Expect(plan.Deduplicate(libcnb.MergeEntries, log.New(b))).To(Equal(libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{
+				{Name: "test-name", Metadata: map[string]interface{}{"alpha": "1", "bravo": "3"}},
+				{Name: "other-name", Metadata: map[string]interface{}{"alpha": "2"}},
+			}}))
+			Expect(b.String()).To(Equal("Deduplicated 2 buildpack plan entries named test-name to metadata map[alpha:1 bravo:3]\n"))
+		})
+
+		it("fails with conflicting entries", func() {
+			_, err := plan.Deduplicate(libcnb.RequireIdenticalEntries, nil)
+			Expect(err).To(MatchError("unable to deduplicate buildpack plan entries named test-name\nbuildpack plan contains 2 entries named test-name with different metadata"))
+		})
+
+		it("collapses identical entries without the strategy", func() {
+			_, err := libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{{Name: "test-name"}, {Name: "test-name"}}}.
+				Deduplicate(libcnb.RequireIdenticalEntries, nil)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+}
@@ -28,7 +28,7 @@ import (
 	. "github.com/onsi/gomega"
 )
 
-func testBuildpackTOML(t *testing.T, _ spec.G, it spec.S) {
+func testBuildpackTOML(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
 	)
@@ -48,4 +48,88 @@ func testBuildpackTOML(t *testing.T, _ spec.G, it spec.S) {
 		Expect(toml.NewEncoder(output).Encode(bp)).To(Succeed())
 		Expect(output.String()).NotTo(Or(ContainSubstring("Path = "), ContainSubstring("path = ")))
 	})
+
+	context("BuildpackInfo", func() {
+		it("returns the canonical reference", func() {
+			Expect(libcnb.BuildpackInfo{ID: "test-org/test-id", Version: "1.1.1"}.Ref()).To(Equal("test-org/test-id@1.1.1"))
+			Expect(libcnb.BuildpackInfo{ID: "test-org/test-id"}.Ref()).To(Equal("test-org/test-id"))
+		})
+
+		it("returns the sanitized ID", func() {
+			Expect(libcnb.BuildpackInfo{ID: "test-org/test-group/test-id"}.Sanitize()).To(Equal("test-org_test-group_test-id"))
+		})
+
+		it("returns the declared SBOM formats", func() {
+			formats, err := libcnb.BuildpackInfo{SBOMFormats: []string{libcnb.BOMMediaTypeSyft, libcnb.BOMMediaTypeCycloneDX}}.SBOMFormatTypes()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(formats).To(Equal([]libcnb.SBOMFormat{libcnb.SyftJSON, libcnb.CycloneDXJSON}))
+
+			_, err = libcnb.BuildpackInfo{SBOMFormats: []string{"application/test"}}.SBOMFormatTypes()
+			Expect(err).To(MatchError("unable to translate from media type application/test to SBOMFormat"))
+		})
+	})
+
+	context("EffectiveTargets", func() {
+		it("returns declared targets", func() {
+			bp := libcnb.Buildpack{
+				Stacks:  []libcnb.BuildpackStack{{ID: "io.buildpacks.stacks.bionic"}},
+				Targets: []libcnb.Target{{TargetInfo: libcnb.TargetInfo{OS: "linux", Arch: "arm64"}}},
+			}
+
+			Expect(bp.EffectiveTargets()).To(Equal([]libcnb.Target{{TargetInfo: libcnb.TargetInfo{OS: "linux", Arch: "arm64"}}}))
+		})
+
+		it("synthesizes targets from stacks", func() {
+			bp := libcnb.Buildpack{
+				Stacks: []libcnb.BuildpackStack{
+					{ID: "io.buildpacks.stacks.bionic"},
+					{ID: "io.buildpacks.stacks.jammy"},
+					{ID: "*"},
+					{ID: "test-stack"},
+				},
+			}
+
+			Expect(bp.EffectiveTargets()).To(Equal([]libcnb.Target{
+				{
+					TargetInfo: libcnb.TargetInfo{OS: "linux", Arch: "amd64"},
+					Distros:    []libcnb.TargetDistro{{Name: "ubuntu", Version: "18.04"}},
+				},
+				{
+					TargetInfo: libcnb.TargetInfo{OS: "linux"},
+					Distros:    []libcnb.TargetDistro{{Name: "ubuntu", Version: "22.04"}},
+				},
+				{},
+				{
+					TargetInfo: libcnb.TargetInfo{OS: "linux"},
+				},
+			}))
+		})
+
+		it("returns no targets when neither targets nor stacks are declared", func() {
+			Expect(libcnb.Buildpack{}.EffectiveTargets()).To(BeEmpty())
+		})
+	})
+
+	context("Target", func() {
+		target := libcnb.Target{
+			TargetInfo: libcnb.TargetInfo{OS: "linux", Arch: "*"},
+			Distros:    []libcnb.TargetDistro{{Name: "ubuntu", Version: "22.04"}, {Name: "debian"}},
+		}
+
+		it("matches wildcards, empty fields and declared distros", func() {
+			Expect(target.Matches(libcnb.TargetInfo{OS: "linux", Arch: "arm64"}, libcnb.TargetDistro{Name: "ubuntu", Version: "22.04"})).To(BeTrue())
+			Expect(target.Matches(libcnb.TargetInfo{OS: "linux", Arch: "amd64", Variant: "v1"}, libcnb.TargetDistro{Name: "debian", Version: "12"})).To(BeTrue())
+			Expect(target.Matches(libcnb.TargetInfo{Arch: "amd64"}, libcnb.TargetDistro{})).To(BeTrue())
+		})
+
+		it("does not match other targets", func() {
+			Expect(target.Matches(libcnb.TargetInfo{OS: "windows", Arch: "amd64"}, libcnb.TargetDistro{})).To(BeFalse())
+			Expect(target.Matches(libcnb.TargetInfo{OS: "linux", Arch: "amd64"}, libcnb.TargetDistro{Name: "ubuntu", Version: "24.04"})).To(BeFalse())
+		})
+
+		it("formats target info", func() {
+			Expect(libcnb.TargetInfo{OS: "linux", Arch: "arm", Variant: "v6"}.String()).To(Equal("linux/arm/v6"))
+			Expect(libcnb.TargetInfo{OS: "linux", Arch: "amd64"}.String()).To(Equal("linux/amd64"))
+		})
+	})
 }
@@ -0,0 +1,303 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// CACertificatesBindingType is the type of bindings holding additional CA certificates as PEM encoded secrets.
+	CACertificatesBindingType = "ca-certificates"
+
+	// CACertificatesLayerName is the name of the layer created by Layers.CACertificatesLayer.
+	CACertificatesLayerName = "ca-certificates"
+
+	// CACertificatesLayerKey is the layer metadata key holding the SHA256 fingerprints of the added certificates.
+	CACertificatesLayerKey = "certificates"
+)
+
+// systemCACertificateFiles are the locations of the system CA certificates on common Linux distributions, in the
+// order they are searched.
+var systemCACertificateFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// CACertificatesLayer returns a build and launch layer that adds the certificates in bindings of type
+// CACertificatesBindingType to the system truststore. Entries of the bindings that hold no PEM encoded certificates,
+// such as keys, are skipped. It returns false if there are no certificates.
+//
+// Each certificate is written to the certs directory of the layer, named by its subject name hash as OpenSSL's c_rehash
+// does, and the directory is prepended to SSL_CERT_DIR, adding the certificates to the truststore of the build and run
+// images. During the build, a truststore merging them with the system certificates, read from $SSL_CERT_FILE or the
+// distribution's default location, is also written to ca-certificates.crt and set as SSL_CERT_FILE, for tools that
+// ignore SSL_CERT_DIR. It is not set at launch, as it would hide the truststore of the run image.
+func (l *Layers) CACertificatesLayer(bindings Bindings) (Layer, bool, error) {
+	var certificates []*x509.Certificate
+	for _, b := range bindings.OfType(CACertificatesBindingType) {
+		var names []string
+		for name := range b.Secret {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			c, err := parseCertificates([]byte(b.Secret[name]))
+			if err != nil {
+				return Layer{}, false, fmt.Errorf("unable to parse certificates in %s of binding %s\n%w", name, b.Name, err)
+			}
+			certificates = append(certificates, c...)
+		}
+	}
+
+	if len(certificates) == 0 {
+		return Layer{}, false, nil
+	}
+
+	layer, err := l.Layer(CACertificatesLayerName)
+	if err != nil {
+		return Layer{}, false, err
+	}
+
+	layer, err = layer.Reset()
+	if err != nil {
+		return Layer{}, false, fmt.Errorf("unable to reset layer %s\n%w", CACertificatesLayerName, err)
+	}
+
+	system, err := systemCACertificates(l.environment)
+	if err != nil {
+		return Layer{}, false, err
+	}
+
+	certsDir := filepath.Join(layer.Path, "certs")
+	if err := os.MkdirAll(certsDir, 0755); err != nil {
+		return Layer{}, false, fmt.Errorf("unable to create directory %s\n%w", certsDir, err)
+	}
+
+	truststore := bytes.NewBuffer(system)
+	if truststore.Len() > 0 && !bytes.HasSuffix(system, []byte("\n")) {
+		truststore.WriteString("\n")
+	}
+
+	var fingerprints []string
+	hashes := map[string]int{}
+	for _, c := range certificates {
+		s := sha256.Sum256(c.Raw)
+		fingerprints = append(fingerprints, hex.EncodeToString(s[:]))
+
+		hash, err := subjectNameHash(c.RawSubject)
+		if err != nil {
+			return Layer{}, false, fmt.Errorf("unable to hash subject of certificate %s\n%w", c.Subject, err)
+		}
+
+		b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+		file := filepath.Join(certsDir, fmt.Sprintf("%s.%d", hash, hashes[hash]))
+		hashes[hash]++
+		if err := os.WriteFile(file, b, 0644); err != nil {
+			return Layer{}, false, fmt.Errorf("unable to write %s\n%w", file, err)
+		}
+
+		truststore.Write(b)
+	}
+
+	file := filepath.Join(layer.Path, "ca-certificates.crt")
+	if err := os.WriteFile(file, truststore.Bytes(), 0644); err != nil {
+		return Layer{}, false, fmt.Errorf("unable to write %s\n%w", file, err)
+	}
+
+	layer.Build = true
+	layer.Launch = true
+	layer.Metadata = map[string]interface{}{CACertificatesLayerKey: fingerprints}
+	layer.BuildEnvironment.Override("SSL_CERT_FILE", file)
+	layer.SharedEnvironment.PrependPath("SSL_CERT_DIR", certsDir)
+
+	return layer, true, nil
+}
+
+// parseCertificates returns the certificates in the CERTIFICATE blocks of PEM encoded data, failing if any cannot be
+// parsed.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, c)
+	}
+
+	return certificates, nil
+}
+
+// attributeTypeAndValue is an attribute of a relative distinguished name.
+type attributeTypeAndValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// subjectNameHash returns the hash of a DER encoded subject name as computed by OpenSSL's X509_NAME_hash, which names
+// the files of certificate directories. It is the first four bytes, little-endian, of the SHA-1 of the canonical
+// encoding of the name: the encoding of its relative distinguished names, without the enclosing sequence, with string
+// values converted to lowercase UTF-8 with whitespace trimmed and collapsed.
+func subjectNameHash(subject []byte) (string, error) {
+	var rdns []asn1.RawValue
+	if rest, err := asn1.Unmarshal(subject, &rdns); err != nil {
+		return "", err
+	} else if len(rest) > 0 {
+		return "", fmt.Errorf("trailing data after subject")
+	}
+
+	var canonical []byte
+	for _, rdn := range rdns {
+		var attributes []attributeTypeAndValue
+		if _, err := asn1.UnmarshalWithParams(rdn.FullBytes, &attributes, "set"); err != nil {
+			return "", err
+		}
+
+		var encoded [][]byte
+		for _, a := range attributes {
+			if s, ok := asn1String(a.Value); ok {
+				a.Value = asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(canonicalString(s))}
+			}
+
+			b, err := asn1.Marshal(a)
+			if err != nil {
+				return "", err
+			}
+			encoded = append(encoded, b)
+		}
+		sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+
+		b, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(encoded, nil)})
+		if err != nil {
+			return "", err
+		}
+		canonical = append(canonical, b...)
+	}
+
+	s := sha1.Sum(canonical) //nolint:gosec
+	return fmt.Sprintf("%08x", binary.LittleEndian.Uint32(s[:4])), nil
+}
+
+// asn1String returns the value of the string types that OpenSSL canonicalizes, decoded to UTF-8.
+func asn1String(v asn1.RawValue) (string, bool) {
+	if v.Class != asn1.ClassUniversal {
+		return "", false
+	}
+
+	switch v.Tag {
+	case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagIA5String, 26: // VisibleString
+		return string(v.Bytes), true
+	case asn1.TagT61String:
+		r := make([]rune, len(v.Bytes))
+		for i, b := range v.Bytes {
+			r[i] = rune(b)
+		}
+		return string(r), true
+	case asn1.TagBMPString:
+		u := make([]uint16, len(v.Bytes)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(v.Bytes[2*i:])
+		}
+		return string(utf16.Decode(u)), true
+	case 28: // UniversalString
+		r := make([]rune, len(v.Bytes)/4)
+		for i := range r {
+			r[i] = rune(binary.BigEndian.Uint32(v.Bytes[4*i:]))
+		}
+		return string(r), true
+	default:
+		return "", false
+	}
+}
+
+// canonicalString trims leading and trailing whitespace from s, collapses other whitespace to a single space and
+// lowercases ASCII letters, as OpenSSL does.
+func canonicalString(s string) string {
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+	}
+
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isSpace(c) {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// systemCACertificates returns the contents of $SSL_CERT_FILE, looked up as by lookupEnv, or, if it is not set, the
+// first system CA certificates file that exists. It returns nil if there is none.
+func systemCACertificates(environment map[string]string) ([]byte, error) {
+	files := systemCACertificateFiles
+	if f, ok := lookupEnv(environment, "SSL_CERT_FILE"); ok {
+		files = []string{f}
+	}
+
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read %s\n%w", f, err)
+		}
+		return b, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package caches defines cache layers for the caches of well-known package managers, so that language buildpacks
+// configure them consistently.
+//
+// Each Manager is plain data: the name of its layer and the build environment variables that point the package manager
+// at it. Support for another package manager is added by declaring a Manager, and, so that it can be looked up by name,
+// adding it to Managers.
+package caches
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+// Variable is a build environment variable that points a package manager at its cache.
+type Variable struct {
+	// Name is the name of the environment variable.
+	Name string
+
+	// Format is the format of the value, with a single %s verb that is replaced by the path of the cache layer.
+	Format string
+
+	// Delimiter, if set, appends the value to any existing value, separated by the delimiter, rather than overriding it.
+	Delimiter string
+}
+
+// Manager describes the cache of a package manager.
+type Manager struct {
+	// Name is the name of the package manager.
+	Name string
+
+	// Layer is the name of the cache layer.
+	Layer string
+
+	// Variables are the build environment variables that point the package manager at the cache layer.
+	Variables []Variable
+}
+
+var (
+	// Gradle is the cache of Gradle, its user home.
+	Gradle = Manager{
+		Name:      "gradle",
+		Layer:     "gradle-cache",
+		Variables: []Variable{{Name: "GRADLE_USER_HOME", Format: "%s"}},
+	}
+
+	// Maven is the cache of Maven, its local repository.
+	Maven = Manager{
+		Name:      "maven",
+		Layer:     "maven-cache",
+		Variables: []Variable{{Name: "MAVEN_OPTS", Format: "-Dmaven.repo.local=%s", Delimiter: " "}},
+	}
+
+	// NPM is the cache of npm.
+	NPM = Manager{
+		Name:      "npm",
+		Layer:     "npm-cache",
+		Variables: []Variable{{Name: "npm_config_cache", Format: "%s"}},
+	}
+
+	// Yarn is the cache of Yarn.
+	Yarn = Manager{
+		Name:      "yarn",
+		Layer:     "yarn-cache",
+		Variables: []Variable{{Name: "YARN_CACHE_FOLDER", Format: "%s"}},
+	}
+
+	// Pip is the cache of pip.
+	Pip = Manager{
+		Name:      "pip",
+		Layer:     "pip-cache",
+		Variables: []Variable{{Name: "PIP_CACHE_DIR", Format: "%s"}},
+	}
+
+	// Go is the module and build caches of Go.
+	Go = Manager{
+		Name:  "go",
+		Layer: "go-cache",
+		Variables: []Variable{
+			{Name: "GOMODCACHE", Format: "%s/mod"},
+			{Name: "GOCACHE", Format: "%s/build"},
+		},
+	}
+
+	// Managers are the package managers that can be looked up by name.
+	Managers = []Manager{Gradle, Maven, NPM, Yarn, Pip, Go}
+)
+
+// Lookup returns the package manager in Managers with the given name.
+func Lookup(name string) (Manager, bool) {
+	for _, m := range Managers {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Manager{}, false
+}
+
+// Contribute creates the cache layer of the package manager and sets its build environment. The layer is a build and
+// cache layer, but not a launch layer, as package manager caches are not needed by the application. Contents restored
+// from a previous build are kept. The layer must be added to the layers of the build result.
+func (m Manager) Contribute(layers *libcnb.Layers) (libcnb.Layer, error) {
+	layer, err := layers.Layer(m.Layer)
+	if err != nil {
+		return libcnb.Layer{}, fmt.Errorf("unable to create %s cache layer\n%w", m.Name, err)
+	}
+
+	if err := os.MkdirAll(layer.Path, 0755); err != nil {
+		return libcnb.Layer{}, fmt.Errorf("unable to create %s cache directory %s\n%w", m.Name, layer.Path, err)
+	}
+
+	layer.LayerTypes = libcnb.LayerTypes{Build: true, Cache: true}
+	for _, v := range m.Variables {
+		if v.Delimiter != "" {
+			layer.BuildEnvironment.Appendf(v.Name, v.Delimiter, v.Format, layer.Path)
+		} else {
+			layer.BuildEnvironment.Overridef(v.Name, v.Format, layer.Path)
+		}
+	}
+
+	return layer, nil
+}
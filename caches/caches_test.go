@@ -0,0 +1,107 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package caches_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/caches"
+)
+
+func testCaches(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layers *libcnb.Layers
+	)
+
+	it.Before(func() {
+		layers = &libcnb.Layers{Path: t.TempDir()}
+	})
+
+	it("contributes a build and cache layer", func() {
+		layer, err := caches.Gradle.Contribute(layers)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(layer.Name).To(Equal("gradle-cache"))
+		Expect(layer.LayerTypes).To(Equal(libcnb.LayerTypes{Build: true, Cache: true}))
+		Expect(layer.Path).To(BeADirectory())
+		Expect(layer.BuildEnvironment).To(Equal(libcnb.Environment{"GRADLE_USER_HOME.override": layer.Path}))
+		Expect(layer.LaunchEnvironment).To(BeEmpty())
+	})
+
+	it("keeps restored contents", func() {
+		Expect(os.MkdirAll(filepath.Join(layers.Path, "npm-cache"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(layers.Path, "npm-cache", "index"), []byte{}, 0600)).To(Succeed())
+
+		layer, err := caches.NPM.Contribute(layers)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(filepath.Join(layer.Path, "index")).To(BeARegularFile())
+	})
+
+	it("appends delimited variables", func() {
+		layer, err := caches.Maven.Contribute(layers)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(layer.BuildEnvironment).To(Equal(libcnb.Environment{
+			"MAVEN_OPTS.delim":  " ",
+			"MAVEN_OPTS.append": "-Dmaven.repo.local=" + layer.Path,
+		}))
+	})
+
+	it("sets several variables", func() {
+		layer, err := caches.Go.Contribute(layers)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(layer.BuildEnvironment).To(Equal(libcnb.Environment{
+			"GOMODCACHE.override": filepath.Join(layer.Path, "mod"),
+			"GOCACHE.override":    filepath.Join(layer.Path, "build"),
+		}))
+	})
+
+	it("contributes a custom package manager", func() {
+		m := caches.Manager{
+			Name:      "test-manager",
+			Layer:     "test-cache",
+			Variables: []caches.Variable{{Name: "TEST_CACHE", Format: "%s/cache"}},
+		}
+
+		layer, err := m.Contribute(layers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(layer.BuildEnvironment).To(Equal(libcnb.Environment{"TEST_CACHE.override": filepath.Join(layer.Path, "cache")}))
+	})
+
+	context("Lookup", func() {
+		it("returns a known package manager", func() {
+			m, ok := caches.Lookup("yarn")
+			Expect(ok).To(BeTrue())
+			Expect(m).To(Equal(caches.Yarn))
+		})
+
+		it("does not return an unknown package manager", func() {
+			_, ok := caches.Lookup("unknown")
+			Expect(ok).To(BeFalse())
+		})
+	})
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package compat converts between the types of libcnb v1 and v2, so that buildpacks can use libraries written against
+// either major version while they migrate.
+//
+// The v1 types are mirrored here rather than imported, so that depending on v2 does not require v1. They have the
+// same fields as in v1, so a library on v1 is adapted by copying its values field by field. Types that are unchanged
+// between v1 and v2 are aliases of the v2 types.
+package compat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+// Aliases of the types that are unchanged between v1 and v2.
+type (
+	BuildpackPlan      = libcnb.BuildpackPlan
+	BuildpackPlanEntry = libcnb.BuildpackPlanEntry
+	Environment        = libcnb.Environment
+	Exec               = libcnb.Exec
+	Label              = libcnb.Label
+	LayerTypes         = libcnb.LayerTypes
+	Slice              = libcnb.Slice
+	UnmetPlanEntry     = libcnb.UnmetPlanEntry
+)
+
+// Profile is the v1 collection of profile.d scripts of a layer, keyed by file name. v2 has no equivalent; scripts are
+// written to the profile.d directory of the layer instead.
+type Profile map[string]string
+
+// Layer is the v1 layer.
+type Layer struct {
+	// LayerTypes indicates the type of layer.
+	LayerTypes `toml:"types"`
+
+	// Metadata is the metadata associated with the layer.
+	Metadata map[string]interface{} `toml:"metadata"`
+
+	// Name is the name of the layer.
+	Name string `toml:"-"`
+
+	// Path is the filesystem location of the layer.
+	Path string `toml:"-"`
+
+	// BuildEnvironment are the environment variables set at build time.
+	BuildEnvironment Environment `toml:"-"`
+
+	// LaunchEnvironment are the environment variables set at launch time.
+	LaunchEnvironment Environment `toml:"-"`
+
+	// SharedEnvironment are the environment variables set at both build and launch times.
+	SharedEnvironment Environment `toml:"-"`
+
+	// Profile is the profile.d scripts set in the layer.
+	Profile Profile `toml:"-"`
+
+	// Exec is the exec.d executables set in the layer.
+	Exec Exec `toml:"-"`
+}
+
+// Process is the v1 process, whose command is a single string that is run with a shell unless Direct is set.
+type Process struct {
+	// Type is the type of the process.
+	Type string `toml:"type"`
+
+	// Command is the command of the process.
+	Command string `toml:"command"`
+
+	// Arguments are arguments to the command.
+	Arguments []string `toml:"args"`
+
+	// Direct indicates whether the command is executed directly, rather than with a shell.
+	Direct bool `toml:"direct"`
+
+	// Default indicates that the process type is the default process type of the application image.
+	Default bool `toml:"default,omitempty"`
+
+	// WorkingDirectory is the directory to execute the command in.
+	WorkingDirectory string `toml:"working-dir,omitempty"`
+}
+
+// LayerContributor is the v1 interface of the types that contribute a layer.
+type LayerContributor interface {
+	// Contribute accepts a layer and transforms it, returning a layer.
+	Contribute(layer Layer) (Layer, error)
+
+	// Name is the name of the layer.
+	Name() string
+}
+
+// BuildResult is the v1 result of build, whose layers are contributed by LayerContributors.
+type BuildResult struct {
+	// Labels are the image labels contributed by the buildpack.
+	Labels []Label
+
+	// Layers are the layer contributors of the buildpack.
+	Layers []LayerContributor
+
+	// PersistentMetadata is metadata that is persisted even across cache cleaning.
+	PersistentMetadata map[string]interface{}
+
+	// Processes are the process types contributed by the buildpack.
+	Processes []Process
+
+	// Slices are the application slices contributed by the buildpack.
+	Slices []Slice
+
+	// Unmet contains buildpack plan entries that were not satisfied by the buildpack.
+	Unmet []UnmetPlanEntry
+}
+
+// FromV1Layer converts a v1 layer to a v2 layer. As v2 layers have no profile, the profile.d scripts of the layer are
+// written to its profile.d directory, as v1 did when the layer was persisted.
+func FromV1Layer(layer Layer) (libcnb.Layer, error) {
+	if len(layer.Profile) > 0 {
+		dir := filepath.Join(layer.Path, "profile.d")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return libcnb.Layer{}, fmt.Errorf("unable to create directory %s\n%w", dir, err)
+		}
+
+		for name, script := range layer.Profile {
+			file := filepath.Join(dir, name)
+			//nolint:gosec
+			if err := os.WriteFile(file, []byte(script), 0644); err != nil {
+				return libcnb.Layer{}, fmt.Errorf("unable to write profile.d script %s\n%w", file, err)
+			}
+		}
+	}
+
+	return libcnb.Layer{
+		LayerTypes:        layer.LayerTypes,
+		Metadata:          layer.Metadata,
+		Name:              layer.Name,
+		Path:              layer.Path,
+		BuildEnvironment:  layer.BuildEnvironment,
+		LaunchEnvironment: layer.LaunchEnvironment,
+		SharedEnvironment: layer.SharedEnvironment,
+		Exec:              layer.Exec,
+	}, nil
+}
+
+// ToV1Layer converts a v2 layer to a v1 layer with an empty profile.
+func ToV1Layer(layer libcnb.Layer) Layer {
+	return Layer{
+		LayerTypes:        layer.LayerTypes,
+		Metadata:          layer.Metadata,
+		Name:              layer.Name,
+		Path:              layer.Path,
+		BuildEnvironment:  layer.BuildEnvironment,
+		LaunchEnvironment: layer.LaunchEnvironment,
+		SharedEnvironment: layer.SharedEnvironment,
+		Profile:           Profile{},
+		Exec:              layer.Exec,
+	}
+}
+
+// FromV1Process converts a v1 process to a v2 process. A direct process executes its command with its arguments, and
+// any other process runs its command with bash, as the lifecycle did for v1 processes.
+func FromV1Process(process Process) libcnb.Process {
+	p := libcnb.Process{
+		Type:             process.Type,
+		Arguments:        process.Arguments,
+		WorkingDirectory: process.WorkingDirectory,
+		Default:          process.Default,
+	}
+
+	if process.Direct {
+		p.Command = []string{process.Command}
+	} else {
+		p.Command = []string{"bash", "-c", process.Command}
+	}
+
+	return p
+}
+
+// ToV1Process converts a v2 process to a v1 process. A process whose command is bash -c <script> becomes a process
+// running the script with a shell, and any other process a direct process whose command is the first element of the
+// command, followed by the rest of the command and the arguments.
+func ToV1Process(process libcnb.Process) Process {
+	p := Process{
+		Type:             process.Type,
+		WorkingDirectory: process.WorkingDirectory,
+		Default:          process.Default,
+	}
+
+	switch {
+	case len(process.Command) == 3 && process.Command[0] == "bash" && process.Command[1] == "-c":
+		p.Command = process.Command[2]
+		p.Arguments = process.Arguments
+	case len(process.Command) > 0:
+		p.Direct = true
+		p.Command = process.Command[0]
+		p.Arguments = append(append([]string(nil), process.Command[1:]...), process.Arguments...)
+	}
+
+	return p
+}
+
+// ToV1BuildResult converts a v2 build result to a v1 build result. Each layer becomes a LayerContributor that returns
+// it unchanged. The warnings of the result have no v1 equivalent and are dropped.
+func ToV1BuildResult(result libcnb.BuildResult) BuildResult {
+	r := BuildResult{
+		Labels:             result.Labels,
+		PersistentMetadata: result.PersistentMetadata,
+		Slices:             result.Slices,
+		Unmet:              result.Unmet,
+	}
+
+	for _, l := range result.Layers {
+		r.Layers = append(r.Layers, layerContributor{layer: ToV1Layer(l)})
+	}
+	for _, p := range result.Processes {
+		r.Processes = append(r.Processes, ToV1Process(p))
+	}
+
+	return r
+}
+
+// FromV1BuildResult converts a v1 build result to a v2 build result. As v1 did, each LayerContributor is called with
+// the layer of its name from layers, and the layer it returns is contributed.
+func FromV1BuildResult(result BuildResult, layers *libcnb.Layers) (libcnb.BuildResult, error) {
+	r := libcnb.BuildResult{
+		Labels:             result.Labels,
+		PersistentMetadata: result.PersistentMetadata,
+		Slices:             result.Slices,
+		Unmet:              result.Unmet,
+	}
+
+	for _, c := range result.Layers {
+		name := c.Name()
+		if strings.TrimSpace(name) == "" {
+			return libcnb.BuildResult{}, fmt.Errorf("unable to contribute layer: layer contributor %T has no name", c)
+		}
+
+		layer, err := layers.Layer(name)
+		if err != nil {
+			return libcnb.BuildResult{}, fmt.Errorf("unable to create layer %s\n%w", name, err)
+		}
+
+		contributed, err := c.Contribute(ToV1Layer(layer))
+		if err != nil {
+			return libcnb.BuildResult{}, fmt.Errorf("unable to contribute layer %s\n%w", name, err)
+		}
+
+		l, err := FromV1Layer(contributed)
+		if err != nil {
+			return libcnb.BuildResult{}, err
+		}
+		r.Layers = append(r.Layers, l)
+	}
+
+	for _, p := range result.Processes {
+		r.Processes = append(r.Processes, FromV1Process(p))
+	}
+
+	return r, nil
+}
+
+type layerContributor struct {
+	layer Layer
+}
+
+func (l layerContributor) Contribute(Layer) (Layer, error) {
+	return l.layer, nil
+}
+
+func (l layerContributor) Name() string {
+	return l.layer.Name
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compat_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/compat"
+)
+
+type testContributor struct {
+	name string
+	err  error
+}
+
+func (c testContributor) Contribute(layer compat.Layer) (compat.Layer, error) {
+	layer.LayerTypes.Launch = true
+	layer.Profile["test.sh"] = "export TEST=1"
+	return layer, c.err
+}
+
+func (c testContributor) Name() string {
+	return c.name
+}
+
+func testCompat(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path string
+	)
+
+	it.Before(func() {
+		path = t.TempDir()
+	})
+
+	it("converts layers and writes their profile", func() {
+		v1 := compat.Layer{
+			LayerTypes:        compat.LayerTypes{Cache: true},
+			Metadata:          map[string]interface{}{"alpha": "1"},
+			Name:              "test-layer",
+			Path:              filepath.Join(path, "test-layer"),
+			BuildEnvironment:  compat.Environment{"TEST.default": "build"},
+			LaunchEnvironment: compat.Environment{},
+			SharedEnvironment: compat.Environment{},
+			Profile:           compat.Profile{"test.sh": "export TEST=1"},
+		}
+
+		v2, err := compat.FromV1Layer(v1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v2.LayerTypes).To(Equal(libcnb.LayerTypes{Cache: true}))
+		Expect(v2.Metadata).To(Equal(map[string]interface{}{"alpha": "1"}))
+		Expect(v2.BuildEnvironment).To(Equal(libcnb.Environment{"TEST.default": "build"}))
+		Expect(os.ReadFile(filepath.Join(path, "test-layer", "profile.d", "test.sh"))).To(Equal([]byte("export TEST=1")))
+
+		v1.Profile = compat.Profile{}
+		Expect(compat.ToV1Layer(v2)).To(Equal(v1))
+	})
+
+	it("converts processes", func() {
+		Expect(compat.FromV1Process(compat.Process{Type: "web", Command: "java -jar app.jar", Default: true})).
+			To(Equal(libcnb.Process{Type: "web", Command: []string{"bash", "-c", "java -jar app.jar"}, Default: true}))
+		Expect(compat.FromV1Process(compat.Process{Type: "web", Command: "java", Arguments: []string{"-jar", "app.jar"}, Direct: true})).
+			To(Equal(libcnb.Process{Type: "web", Command: []string{"java"}, Arguments: []string{"-jar", "app.jar"}}))
+
+		Expect(compat.ToV1Process(libcnb.Process{Type: "web", Command: []string{"bash", "-c", "java -jar app.jar"}})).
+			To(Equal(compat.Process{Type: "web", Command: "java -jar app.jar"}))
+		Expect(compat.ToV1Process(libcnb.Process{Type: "web", Command: []string{"java", "-jar"}, Arguments: []string{"app.jar"}})).
+			To(Equal(compat.Process{Type: "web", Command: "java", Arguments: []string{"-jar", "app.jar"}, Direct: true}))
+	})
+
+	it("converts build results", func() {
+		layers := &libcnb.Layers{Path: path}
+
+		result, err := compat.FromV1BuildResult(compat.BuildResult{
+			Layers:    []compat.LayerContributor{testContributor{name: "test-layer"}},
+			Processes: []compat.Process{{Type: "web", Command: "test-command", Direct: true}},
+			Labels:    []compat.Label{{Key: "test-key", Value: "test-value"}},
+		}, layers)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Labels).To(Equal([]libcnb.Label{{Key: "test-key", Value: "test-value"}}))
+		Expect(result.Processes).To(Equal([]libcnb.Process{{Type: "web", Command: []string{"test-command"}}}))
+		Expect(result.Layers).To(HaveLen(1))
+		Expect(result.Layers[0].Name).To(Equal("test-layer"))
+		Expect(result.Layers[0].LayerTypes.Launch).To(BeTrue())
+		Expect(filepath.Join(path, "test-layer", "profile.d", "test.sh")).To(BeARegularFile())
+
+		v1 := compat.ToV1BuildResult(result)
+		Expect(v1.Labels).To(Equal(result.Labels))
+		Expect(v1.Processes).To(Equal([]compat.Process{{Type: "web", Command: "test-command", Direct: true}}))
+		Expect(v1.Layers).To(HaveLen(1))
+		Expect(v1.Layers[0].Name()).To(Equal("test-layer"))
+	})
+
+	it("returns errors from layer contributors", func() {
+		_, err := compat.FromV1BuildResult(compat.BuildResult{
+			Layers: []compat.LayerContributor{testContributor{name: "test-layer", err: errors.New("test-error")}},
+		}, &libcnb.Layers{Path: path})
+		Expect(err).To(MatchError("unable to contribute layer test-layer\ntest-error"))
+	})
+}
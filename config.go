@@ -17,7 +17,11 @@
 package libcnb
 
 import (
+	"io"
+	"io/fs"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/buildpacks/libcnb/v2/internal"
 	"github.com/buildpacks/libcnb/v2/log"
@@ -50,6 +54,17 @@ type ExitHandler interface {
 	Pass()
 }
 
+// Flusher is the interface implemented by a type that buffers output, such as a log sink, that must be flushed before
+// the process exits.
+type Flusher interface {
+
+	// Flush is called before the exit handler exits, to write any buffered output.
+	Flush() error
+}
+
+// DefaultFlushTimeout is how long the exit handler waits for flushers to finish before exiting anyway.
+const DefaultFlushTimeout = 5 * time.Second
+
 //go:generate mockery --name TOMLWriter --case=underscore
 
 // TOMLWriter is the interface implemented by a type that wants to serialize an object to a TOML file.
@@ -59,6 +74,33 @@ type TOMLWriter interface {
 	Write(path string, value interface{}) error
 }
 
+// TOMLWriterOption is a function for configuring a TOMLWriter created by NewTOMLWriter.
+type TOMLWriterOption func(config tomlWriterConfig) tomlWriterConfig
+
+type tomlWriterConfig struct {
+	indent *string
+}
+
+// WithTOMLIndent creates a TOMLWriterOption that sets the string used to indent nested tables. The default is two
+// spaces.
+func WithTOMLIndent(indent string) TOMLWriterOption {
+	return func(config tomlWriterConfig) tomlWriterConfig {
+		config.indent = &indent
+		return config
+	}
+}
+
+// NewTOMLWriter creates the default TOMLWriter, which encodes values using github.com/BurntSushi/toml, configured with
+// the given options. Pass it to WithTOMLWriter to control the style of the files written by the phases.
+func NewTOMLWriter(options ...TOMLWriterOption) TOMLWriter {
+	config := tomlWriterConfig{}
+	for _, opt := range options {
+		config = opt(config)
+	}
+
+	return internal.TOMLWriter{Indent: config.indent}
+}
+
 //go:generate mockery --name ExecDWriter --case=underscore
 
 // ExecDWriter is the interface implemented by a type that wants to write exec.d output to file descriptor 3.
@@ -80,30 +122,176 @@ type Config struct {
 	tomlWriter          TOMLWriter
 	contentWriter       internal.DirectoryContentsWriter
 	extension           bool
+
+	storeWritesDisabled bool
+	storeNamespacing    bool
+
+	layerPersistenceHooks []LayerPersistenceHook
+	maxPlanMetadataSize   int
+	mergeBuildPlans       bool
+	bindingOptions        []BindingOption
+	maxPlatformFileSize   int64
+
+	alwaysWritePhaseOutputs bool
+	lazyLoading             bool
+	buildpackFS             fs.FS
+
+	expectedDefaultProcessType string
+	applicationPath            string
+	environment                map[string]string
+	quiet                      bool
+	strictEnvironmentNames     bool
+	contextFormatter           ContextFormatter
+	dryRun                     bool
+	unexpectedFileWarnings     bool
+	flushers                   []Flusher
+	flushTimeout               time.Duration
+	partialResultsOnTerminate  bool
+	execdTimeout               time.Duration
+	timeout                    time.Duration
+	secretStores               SecretStores
+	signatureVerifier          SignatureVerifier
+	strictTargets              bool
+	strictGenerateResults      bool
+	outputSink                 io.Writer
+	warningReportPath          string
+	detectExplanation          io.Writer
+	buildExplanation           io.Writer
+	verifyOutput               io.Writer
+	buildpackPlan              *BuildpackPlan
+	buildpackPlanReader        io.Reader
+	rootUserCheck              bool
+	rootUserCheckFails         bool
+	contextLogger              log.Logger
+	observer                   Observer
+	options                    []Option
 }
 
+// LayerPersistenceHook is a function called by Build once a contributed layer's environment and metadata have been
+// written.
+type LayerPersistenceHook func(layer Layer) error
+
 // Option is a function for configuring a Config instance.
 type Option func(config Config) Config
 
-// NewConfig will generate a config from the given set of options
+// NewConfig will generate a config from the given set of options, with defaults for every phase.
 func NewConfig(options ...Option) Config {
-	config := Config{}
+	return newConfig(append([]Option{
+		WithArguments(os.Args),
+		WithEnvironmentWriter(internal.EnvironmentWriter{}),
+		WithExitHandler(internal.NewExitHandler()),
+		WithLogger(log.New(os.Stdout)),
+		WithTOMLWriter(internal.TOMLWriter{}),
+		WithDirectoryContentFormatter(internal.NewPlainDirectoryContentFormatter()),
+		WithContextFormatter(NewPlainContextFormatter()),
+	}, options...))
+}
+
+// NewDetectConfig will generate a config from the given set of options, with defaults for only what Detect uses.
+func NewDetectConfig(options ...Option) Config {
+	return newConfig(append([]Option{
+		WithArguments(os.Args),
+		WithExitHandler(internal.NewExitHandler()),
+		WithLogger(log.New(os.Stdout)),
+		WithTOMLWriter(internal.TOMLWriter{}),
+		WithDirectoryContentFormatter(internal.NewPlainDirectoryContentFormatter()),
+		WithContextFormatter(NewPlainContextFormatter()),
+	}, options...))
+}
 
-	// apply defaults
-	options = append([]Option{
+// NewBuildConfig will generate a config from the given set of options, with defaults for only what Build uses.
+func NewBuildConfig(options ...Option) Config {
+	return newConfig(append([]Option{
 		WithArguments(os.Args),
 		WithEnvironmentWriter(internal.EnvironmentWriter{}),
 		WithExitHandler(internal.NewExitHandler()),
 		WithLogger(log.New(os.Stdout)),
 		WithTOMLWriter(internal.TOMLWriter{}),
 		WithDirectoryContentFormatter(internal.NewPlainDirectoryContentFormatter()),
-	}, options...)
+		WithContextFormatter(NewPlainContextFormatter()),
+	}, options...))
+}
+
+// NewGenerateConfig will generate a config from the given set of options, with defaults for only what Generate uses.
+func NewGenerateConfig(options ...Option) Config {
+	return newConfig(append([]Option{
+		WithArguments(os.Args),
+		WithExitHandler(internal.NewExitHandler()),
+		WithLogger(log.New(os.Stdout)),
+		WithTOMLWriter(internal.TOMLWriter{}),
+		WithDirectoryContentFormatter(internal.NewPlainDirectoryContentFormatter()),
+		WithContextFormatter(NewPlainContextFormatter()),
+	}, options...))
+}
+
+// NewExecDConfig will generate a config from the given set of options, with defaults for only what RunExecD uses.
+func NewExecDConfig(options ...Option) Config {
+	return newConfig(append([]Option{
+		WithArguments(os.Args),
+		WithExecDWriter(internal.NewExecDWriter()),
+		WithExitHandler(internal.NewExitHandler()),
+	}, options...))
+}
+
+// With creates a new Config from the options this one was created with, including the defaults, followed by options,
+// which take precedence. It lets frameworks wrapping libcnb add their own defaults and pass the options of their users
+// through. Nil options, and options given nil values, are ignored.
+func (c Config) With(options ...Option) Config {
+	return newConfig(append(append([]Option{}, c.options...), options...))
+}
+
+func newConfig(options []Option) Config {
+	config := Config{options: append([]Option{}, options...)}
 
 	for _, opt := range options {
-		config = opt(config)
+		if opt != nil {
+			config = opt(config)
+		}
 	}
 
-	config.contentWriter = internal.NewDirectoryContentsWriter(config.dirContentFormatter, config.logger.DebugWriter())
+	if w, ok := config.environmentWriter.(internal.EnvironmentWriter); ok && w.Lookup == nil {
+		w.Lookup = config.lookupEnv
+		config.environmentWriter = w
+	}
+	if w, ok := config.tomlWriter.(internal.TOMLWriter); ok && w.Lookup == nil {
+		w.Lookup = config.lookupEnv
+		config.tomlWriter = w
+	}
+
+	if s, ok := config.lookupEnv(EnvQuiet); ok {
+		if quiet, err := strconv.ParseBool(s); err == nil {
+			config.quiet = config.quiet || quiet
+		}
+	}
+	if s, ok := config.lookupEnv(EnvStrictEnvironmentNames); ok {
+		config.strictEnvironmentNames, _ = strconv.ParseBool(s)
+	}
+
+	if len(config.flushers) > 0 && config.exitHandler != nil {
+		timeout := config.flushTimeout
+		if timeout == 0 {
+			timeout = DefaultFlushTimeout
+		}
+		logger := config.logger
+		if logger == nil {
+			logger = log.New(os.Stderr)
+		}
+		config.exitHandler = flushingExitHandler{
+			delegate: config.exitHandler,
+			flushers: config.flushers,
+			timeout:  timeout,
+			logger:   logger,
+		}
+	}
+
+	config.contextLogger = config.logger
+	if config.quiet && config.logger != nil {
+		config.logger = quietLogger{config.logger}
+	}
+
+	if config.dirContentFormatter != nil && config.logger != nil {
+		config.contentWriter = internal.NewDirectoryContentsWriter(config.dirContentFormatter, config.logger.DebugWriter())
+	}
 
 	return config
 }
@@ -111,7 +299,9 @@ func NewConfig(options ...Option) Config {
 // WithArguments creates an Option that sets a collection of arguments.
 func WithArguments(arguments []string) Option {
 	return func(config Config) Config {
-		config.arguments = arguments
+		if arguments != nil {
+			config.arguments = arguments
+		}
 		return config
 	}
 }
@@ -119,7 +309,9 @@ func WithArguments(arguments []string) Option {
 // WithEnvironmentWriter creates an Option that sets an EnvironmentWriter implementation.
 func WithEnvironmentWriter(environmentWriter EnvironmentWriter) Option {
 	return func(config Config) Config {
-		config.environmentWriter = environmentWriter
+		if environmentWriter != nil {
+			config.environmentWriter = environmentWriter
+		}
 		return config
 	}
 }
@@ -127,7 +319,9 @@ func WithEnvironmentWriter(environmentWriter EnvironmentWriter) Option {
 // WithExitHandler creates an Option that sets an ExitHandler implementation.
 func WithExitHandler(exitHandler ExitHandler) Option {
 	return func(config Config) Config {
-		config.exitHandler = exitHandler
+		if exitHandler != nil {
+			config.exitHandler = exitHandler
+		}
 		return config
 	}
 }
@@ -135,7 +329,9 @@ func WithExitHandler(exitHandler ExitHandler) Option {
 // WithTOMLWriter creates an Option that sets a TOMLWriter implementation.
 func WithTOMLWriter(tomlWriter TOMLWriter) Option {
 	return func(config Config) Config {
-		config.tomlWriter = tomlWriter
+		if tomlWriter != nil {
+			config.tomlWriter = tomlWriter
+		}
 		return config
 	}
 }
@@ -143,7 +339,9 @@ func WithTOMLWriter(tomlWriter TOMLWriter) Option {
 // WithExecDWriter creates an Option that sets a ExecDWriter implementation.
 func WithExecDWriter(execdWriter ExecDWriter) Option {
 	return func(config Config) Config {
-		config.execdWriter = execdWriter
+		if execdWriter != nil {
+			config.execdWriter = execdWriter
+		}
 		return config
 	}
 }
@@ -151,7 +349,9 @@ func WithExecDWriter(execdWriter ExecDWriter) Option {
 // WithLogger creates an Option that sets a ExecDWriter implementation.
 func WithLogger(logger log.Logger) Option {
 	return func(config Config) Config {
-		config.logger = logger
+		if logger != nil {
+			config.logger = logger
+		}
 		return config
 	}
 }
@@ -159,7 +359,494 @@ func WithLogger(logger log.Logger) Option {
 // WithDirectoryContentFormatter creates an Option that sets a ExecDWriter implementation.
 func WithDirectoryContentFormatter(formatter log.DirectoryContentFormatter) Option {
 	return func(config Config) Config {
-		config.dirContentFormatter = formatter
+		if formatter != nil {
+			config.dirContentFormatter = formatter
+		}
+		return config
+	}
+}
+
+// WithContextFormatter creates an Option that sets the ContextFormatter used to render the buildpack or extension
+// metadata and platform in debug logs.
+func WithContextFormatter(formatter ContextFormatter) Option {
+	return func(config Config) Config {
+		if formatter != nil {
+			config.contextFormatter = formatter
+		}
+		return config
+	}
+}
+
+// WithDryRun creates an Option that makes Build run the BuildFunc without writing its result. Instead of writing layer
+// metadata and environments, launch.toml, build.toml and store.toml, and removing stale layer metadata and SBOMs, Build
+// writes a summary of the changes it would make as a warning. Layer persistence hooks are not run. Files written by the
+// BuildFunc itself are not affected.
+func WithDryRun() Option {
+	return func(config Config) Config {
+		config.dryRun = true
+		return config
+	}
+}
+
+// WithUnexpectedFileWarnings creates an Option that makes Build warn about files in the layers directory that are
+// neither part of a contributed layer nor files the lifecycle reads, such as files a buildpack meant to write to a layer
+// directory. They are not exported.
+func WithUnexpectedFileWarnings() Option {
+	return func(config Config) Config {
+		config.unexpectedFileWarnings = true
+		return config
+	}
+}
+
+// WithFlusher creates an Option that registers a Flusher, which the exit handler flushes before exiting. Flushers are
+// flushed in the order they are registered, and failures to flush are logged as warnings.
+func WithFlusher(flusher Flusher) Option {
+	return func(config Config) Config {
+		if flusher != nil {
+			config.flushers = append(config.flushers, flusher)
+		}
+		return config
+	}
+}
+
+// WithFlushTimeout creates an Option that sets how long the exit handler waits for flushers to finish before exiting
+// anyway. The default is DefaultFlushTimeout.
+func WithFlushTimeout(timeout time.Duration) Option {
+	return func(config Config) Config {
+		config.flushTimeout = timeout
+		return config
+	}
+}
+
+// WithPartialResultsOnTerminate creates an Option that makes Build cancel the context of the BuildFunc when the process
+// receives SIGTERM. If the BuildFunc then returns an error, Build persists the layers marked complete with
+// BuildContext.CompleteLayer, so that cached layers can be reused by the next build, and removes the metadata of every
+// other layer so the lifecycle does not restore partially contributed layers.
+func WithPartialResultsOnTerminate() Option {
+	return func(config Config) Config {
+		config.partialResultsOnTerminate = true
+		return config
+	}
+}
+
+// WithExecDTimeout creates an Option that sets how long RunExecD waits for an ExecD to complete before failing, so that
+// a hanging ExecD does not stop the container from starting. If not set, the timeout is read from BP_EXECD_TIMEOUT, and
+// if that is not set either, RunExecD waits indefinitely.
+func WithExecDTimeout(timeout time.Duration) Option {
+	return func(config Config) Config {
+		config.execdTimeout = timeout
+		return config
+	}
+}
+
+// WithTimeout creates an Option that sets how long the build, detect or generate function may run. When the timeout
+// elapses, the Context of the BuildContext, DetectContext or GenerateContext is canceled and the phase fails with an
+// error wrapping context.DeadlineExceeded, so that platforms can bound the time a buildpack takes. The function itself
+// cannot be stopped and keeps running until it returns, so it should return once its context is done. A timeout of
+// zero, the default, lets the function run indefinitely.
+func WithTimeout(timeout time.Duration) Option {
+	return func(config Config) Config {
+		config.timeout = timeout
+		return config
+	}
+}
+
+// WithSignatureVerifier creates an Option that sets the SignatureVerifier Layers.DependencyLayer verifies the
+// signatures of dependencies with. By default, Build creates one with NewSignatureVerifier from the bindings and
+// buildpack metadata, and signatures are not verified if they supply no key.
+func WithSignatureVerifier(verifier SignatureVerifier) Option {
+	return func(config Config) Config {
+		if verifier != nil {
+			config.signatureVerifier = verifier
+		}
+		return config
+	}
+}
+
+// WithSecretStore creates an Option that registers store to resolve the secret references of bindings with the given
+// URI scheme, when BuildContext.ResolveBinding is called.
+func WithSecretStore(scheme string, store SecretStore) Option {
+	return func(config Config) Config {
+		if store == nil {
+			return config
+		}
+
+		stores := SecretStores{}
+		for k, v := range config.secretStores {
+			stores[k] = v
+		}
+		stores[scheme] = store
+		config.secretStores = stores
+		return config
+	}
+}
+
+// WithStrictTargets creates an Option that makes Generate fail, rather than warn, when the target being built for
+// matches none of the targets declared in extension.toml.
+func WithStrictTargets() Option {
+	return func(config Config) Config {
+		config.strictTargets = true
+		return config
+	}
+}
+
+// WithStrictGenerateResults creates an Option that makes Generate fail, rather than warn, when the GenerateResult has
+// neither a build.Dockerfile, a run.Dockerfile nor unmet plan entries, and so has no effect on the build.
+func WithStrictGenerateResults() Option {
+	return func(config Config) Config {
+		config.strictGenerateResults = true
+		return config
+	}
+}
+
+// WithWarningReport creates an Option that makes Build write the warnings in the BuildResult, and those for the use of
+// deprecated features, to a TOML file at path, as a WarningReport, so that platforms can collect them. Nothing is
+// written when there are no warnings.
+func WithWarningReport(path string) Option {
+	return func(config Config) Config {
+		config.warningReportPath = path
+		return config
+	}
+}
+
+// EnvDetectExplain is the name of the environment variable that, when set to a true boolean value, makes Detect explain
+// its outcome on stdout as WithDetectExplanation does, so that running bin/detect directly can be used for debugging.
+const EnvDetectExplain = "BP_DETECT_EXPLAIN"
+
+// WithDetectExplanation creates an Option that makes Detect write why detection passed or failed to w, along with the
+// build plan it writes, in addition to exiting with the usual status code.
+func WithDetectExplanation(w io.Writer) Option {
+	return func(config Config) Config {
+		config.detectExplanation = w
+		return config
+	}
+}
+
+// EnvExplain is the name of the environment variable that, when set to a true boolean value, makes Build print a
+// summary of the resolved context on stdout as WithBuildExplanation does.
+const EnvExplain = "CNB_EXPLAIN"
+
+// WithBuildExplanation creates an Option that makes Build write a summary of the resolved BuildContext to w before
+// calling the BuildFunc: the buildpack plan entries, the names and types of bindings, the names of platform environment
+// variables, and the stack and target. Values are not written, so the summary can be shared without exposing secrets.
+func WithBuildExplanation(w io.Writer) Option {
+	return func(config Config) Config {
+		config.buildExplanation = w
+		return config
+	}
+}
+
+// WithVerifyOutput creates an Option that makes Verify write the outcome of each check to w. The default is stdout.
+func WithVerifyOutput(w io.Writer) Option {
+	return func(config Config) Config {
+		config.verifyOutput = w
+		return config
+	}
+}
+
+// WithBuildpackPlan creates an Option that sets the buildpack plan provided to Build and Generate, rather than reading
+// it from the file at CNB_BP_PLAN_PATH, for embedding libcnb in tools such as plan synthesizers and tests.
+func WithBuildpackPlan(plan BuildpackPlan) Option {
+	return func(config Config) Config {
+		config.buildpackPlan = &plan
+		return config
+	}
+}
+
+// WithBuildpackPlanReader creates an Option that makes Build and Generate decode the buildpack plan from r, such as
+// os.Stdin, rather than from the file at CNB_BP_PLAN_PATH.
+func WithBuildpackPlanReader(r io.Reader) Option {
+	return func(config Config) Config {
+		config.buildpackPlanReader = r
+		return config
+	}
+}
+
+// WithRootUserCheck creates an Option that makes Detect and Build check whether they run as root while the build image
+// expects a non-root user, as set by CNB_USER_ID, which is a platform misconfiguration that leaves layers unreadable at
+// launch. If fail is true the phase fails, otherwise a warning is logged.
+func WithRootUserCheck(fail bool) Option {
+	return func(config Config) Config {
+		config.rootUserCheck = true
+		config.rootUserCheckFails = fail
+		return config
+	}
+}
+
+// WithObserver creates an Option that sets an Observer that is sent the steps of Build, in order, as typed events.
+func WithObserver(observer Observer) Option {
+	return func(config Config) Config {
+		if observer != nil {
+			config.observer = observer
+		}
+		return config
+	}
+}
+
+// WithOutputSink creates an Option that makes Generate write the generated Dockerfiles and extend-config.toml to w as
+// an uncompressed tar archive, rather than to the output directory, so that platforms running extensions in-process can
+// ship the outputs over the wire rather than through a shared volume. Nothing is written to the output directory.
+func WithOutputSink(w io.Writer) Option {
+	return func(config Config) Config {
+		if w != nil {
+			config.outputSink = w
+		}
+		return config
+	}
+}
+
+// WithStoreWrites creates an Option that sets whether persistent metadata is written to store.toml. Writes are enabled
+// by default.
+func WithStoreWrites(enabled bool) Option {
+	return func(config Config) Config {
+		config.storeWritesDisabled = !enabled
+		return config
+	}
+}
+
+// WithStoreNamespacing creates an Option that sets whether persistent metadata is namespaced under the buildpack ID in
+// store.toml. Namespacing is disabled by default, as the lifecycle gives each buildpack its own store.toml. It is for
+// buildpacks that share a layers directory, such as several buildpacks run by one binary. When enabled, metadata
+// written before it was enabled is migrated into the namespace of the buildpack.
+func WithStoreNamespacing(enabled bool) Option {
+	return func(config Config) Config {
+		config.storeNamespacing = enabled
+		return config
+	}
+}
+
+// WithLayerPersistenceHook creates an Option that adds a LayerPersistenceHook. Hooks are called, in the order they are
+// added, for each contributed layer after its environment and metadata are written and before stale layers are
+// removed, so that additional per-layer artifacts can be written alongside it.
+func WithLayerPersistenceHook(hook LayerPersistenceHook) Option {
+	return func(config Config) Config {
+		if hook != nil {
+			config.layerPersistenceHooks = append(config.layerPersistenceHooks, hook)
+		}
 		return config
 	}
 }
+
+// WithMaxPlanMetadataSize creates an Option that sets the maximum size, in bytes, of the TOML encoding of each build
+// plan requirement metadata value returned by detection. A size of zero uses DefaultMaxPlanMetadataSize and a negative
+// size disables the check.
+func WithMaxPlanMetadataSize(size int) Option {
+	return func(config Config) Config {
+		config.maxPlanMetadataSize = size
+		return config
+	}
+}
+
+// WithBuildPlanMerge creates an Option that makes Detect merge its build plans with those already in the build plan file,
+// as MergeBuildPlans does, rather than replace them, so that tools running several detectors can write a single build
+// plan. Detect fails if the merged build plan is not valid.
+func WithBuildPlanMerge() Option {
+	return func(config Config) Config {
+		config.mergeBuildPlans = true
+		return config
+	}
+}
+
+// WithBindingOptions creates an Option that sets the BindingOptions used when reading platform bindings. Nil
+// BindingOptions are ignored, and if none remain, the BindingOptions already set are kept.
+func WithBindingOptions(options ...BindingOption) Option {
+	return func(config Config) Config {
+		var bindingOptions []BindingOption
+		for _, o := range options {
+			if o != nil {
+				bindingOptions = append(bindingOptions, o)
+			}
+		}
+
+		if len(bindingOptions) > 0 {
+			config.bindingOptions = bindingOptions
+		}
+		return config
+	}
+}
+
+// WithMaxPlatformFileSize creates an Option that sets the maximum size, in bytes, of each file read from the platform
+// environment directory and of each binding secret, failing the phase if a file is larger. Files of any size are read
+// by default, or if the size is zero or negative. A MaxSecretSize binding option set with WithBindingOptions takes
+// precedence for bindings.
+func WithMaxPlatformFileSize(size int64) Option {
+	return func(config Config) Config {
+		config.maxPlatformFileSize = size
+		return config
+	}
+}
+
+// platformBindingOptions returns the BindingOptions used when reading platform bindings.
+func (c Config) platformBindingOptions() []BindingOption {
+	return append([]BindingOption{MaxSecretSize(c.maxPlatformFileSize)}, c.bindingOptions...)
+}
+
+// readPlatformEnvironment reads the platform environment directory at path.
+func (c Config) readPlatformEnvironment(path string) (map[string]string, error) {
+	return internal.NewConfigMapFromPathWithOptions(path, internal.ConfigMapOptions{MaxFileSize: c.maxPlatformFileSize})
+}
+
+// WithAlwaysWritePhaseOutputs creates an Option that causes Build to write launch.toml and build.toml even when they
+// have no content, for consumers that rely on the presence of the files.
+func WithAlwaysWritePhaseOutputs() Option {
+	return func(config Config) Config {
+		config.alwaysWritePhaseOutputs = true
+		return config
+	}
+}
+
+// WithLazyLoading creates an Option that causes Build to defer reading store.toml and the buildpack plan until they are
+// first accessed through BuildContext.LoadPersistentMetadata and BuildContext.LoadPlan. When enabled, the
+// PersistentMetadata and Plan fields of the BuildContext are not populated.
+func WithLazyLoading() Option {
+	return func(config Config) Config {
+		config.lazyLoading = true
+		return config
+	}
+}
+
+// WithBuildpackFS creates an Option that sets the file system exposed to the buildpack as BuildpackFS, such as one
+// embedded with go:embed, in place of the buildpack directory.
+func WithBuildpackFS(fsys fs.FS) Option {
+	return func(config Config) Config {
+		if fsys != nil {
+			config.buildpackFS = fsys
+		}
+		return config
+	}
+}
+
+// buildpackFSOrDir returns the file system set with WithBuildpackFS or, if none is set, the directory at path.
+func (c Config) buildpackFSOrDir(path string) fs.FS {
+	if c.buildpackFS != nil {
+		return c.buildpackFS
+	}
+	return os.DirFS(path)
+}
+
+// WithExpectedDefaultProcessType creates an Option that causes Build to warn when the processes it contributes do not
+// have a default process of the given type, typically ProcessTypeWeb, for platforms that expect one.
+func WithExpectedDefaultProcessType(processType string) Option {
+	return func(config Config) Config {
+		config.expectedDefaultProcessType = processType
+		return config
+	}
+}
+
+// WithApplicationPath creates an Option that sets the application path exposed to phases, which otherwise use the
+// working directory. Setting it avoids changing the process-global working directory, for example in tests.
+func WithApplicationPath(path string) Option {
+	return func(config Config) Config {
+		config.applicationPath = path
+		return config
+	}
+}
+
+// applicationPathOrWd returns the path set with WithApplicationPath or, if none is set, the working directory.
+func (c Config) applicationPathOrWd() (string, error) {
+	if c.applicationPath != "" {
+		return c.applicationPath, nil
+	}
+	return os.Getwd()
+}
+
+// WithEnvironment creates an Option that sets the environment, as a list of key=value strings, that phases read the
+// lifecycle's variables from instead of the process environment. Phases read the environment once, when creating their
+// context, so phases configured with different environments and application paths can run concurrently in one process.
+// A nil environment leaves the process environment in use.
+func WithEnvironment(environ []string) Option {
+	return func(config Config) Config {
+		if environ != nil {
+			config.environment = environmentMap(environ)
+		}
+		return config
+	}
+}
+
+// lookupEnv returns the value of the variable named by key in the environment set with WithEnvironment or, if none is
+// set, in the process environment.
+func (c Config) lookupEnv(key string) (string, bool) {
+	return lookupEnv(c.environment, key)
+}
+
+// environmentOrProcess returns the environment set with WithEnvironment or, if none is set, a snapshot of the process
+// environment.
+func (c Config) environmentOrProcess() map[string]string {
+	if c.environment != nil {
+		return c.environment
+	}
+	return environmentMap(os.Environ())
+}
+
+// EnvQuiet is the name of the environment variable that, when set to a true boolean value, enables quiet mode as
+// WithQuiet does.
+const EnvQuiet = "BP_QUIET"
+
+// WithQuiet creates an Option that suppresses libcnb's own debug output, such as the contents of directories and the
+// results of phases. Warnings are still written, and the logger in each context, used for the buildpack's own messages,
+// is not affected.
+func WithQuiet() Option {
+	return func(config Config) Config {
+		config.quiet = true
+		return config
+	}
+}
+
+// quietLogger is the logger libcnb writes its own messages to in quiet mode. It discards debug output.
+type quietLogger struct {
+	log.Logger
+}
+
+func (quietLogger) Debug(...interface{}) {}
+
+func (quietLogger) Debugf(string, ...interface{}) {}
+
+func (quietLogger) DebugWriter() io.Writer {
+	return io.Discard
+}
+
+func (quietLogger) IsDebugEnabled() bool {
+	return false
+}
+
+// flushingExitHandler is an ExitHandler that flushes the registered flushers, waiting at most timeout for them, before
+// delegating to the configured exit handler. Failures to flush are reported as warnings to logger.
+type flushingExitHandler struct {
+	delegate ExitHandler
+	flushers []Flusher
+	timeout  time.Duration
+	logger   log.Logger
+}
+
+func (f flushingExitHandler) Error(err error) {
+	f.flush()
+	f.delegate.Error(err)
+}
+
+func (f flushingExitHandler) Fail() {
+	f.flush()
+	f.delegate.Fail()
+}
+
+func (f flushingExitHandler) Pass() {
+	f.flush()
+	f.delegate.Pass()
+}
+
+func (f flushingExitHandler) flush() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, flusher := range f.flushers {
+			if err := flusher.Flush(); err != nil {
+				log.Warnf(f.logger, "Warning: unable to flush\n%s", err)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(f.timeout):
+		log.Warnf(f.logger, "Warning: timed out after %s waiting to flush", f.timeout)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ContextFormatter is the interface implemented by a type that renders the parts of a phase's context that libcnb
+// logs at debug level. Each method returns the text of a section, which is written to the debug log as is.
+//
+// The contents of directories are rendered separately, by the log.DirectoryContentFormatter set with
+// WithDirectoryContentFormatter.
+type ContextFormatter interface {
+
+	// Buildpack renders the buildpack metadata read from buildpack.toml.
+	Buildpack(buildpack Buildpack) string
+
+	// Extension renders the extension metadata read from extension.toml.
+	Extension(extension Extension) string
+
+	// Platform renders the platform, including its API version, bindings and environment.
+	Platform(platform Platform) string
+}
+
+// PlainContextFormatter is a ContextFormatter that renders each value using its default format.
+type PlainContextFormatter struct{}
+
+// NewPlainContextFormatter creates a new instance of PlainContextFormatter.
+func NewPlainContextFormatter() PlainContextFormatter {
+	return PlainContextFormatter{}
+}
+
+// Buildpack renders the buildpack metadata.
+func (PlainContextFormatter) Buildpack(buildpack Buildpack) string {
+	return fmt.Sprintf("Buildpack: %+v", buildpack)
+}
+
+// Extension renders the extension metadata.
+func (PlainContextFormatter) Extension(extension Extension) string {
+	return fmt.Sprintf("Extension: %+v", extension)
+}
+
+// Platform renders the platform API version, if set, bindings and environment, one per line.
+func (PlainContextFormatter) Platform(platform Platform) string {
+	var lines []string
+	if platform.API != "" {
+		lines = append(lines, fmt.Sprintf("Platform API: %s", platform.API))
+	}
+	lines = append(lines,
+		fmt.Sprintf("Platform Bindings: %+v", platform.Bindings),
+		fmt.Sprintf("Platform Environment: %s", platform.Environment),
+	)
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,287 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DecodeError is returned when a TOML file read by libcnb cannot be decoded. It locates the problem in the file so that
+// it can be acted on.
+type DecodeError struct {
+	// Path is the location of the file.
+	Path string
+
+	// Line is the line of the file the problem was found on, or 0 if unknown.
+	Line int
+
+	// Key is the dotted key of the field the problem was found in, if known.
+	Key string
+
+	// Message describes the problem.
+	Message string
+
+	// Err is the error returned by the TOML decoder.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	s := e.Message
+	if e.Key != "" {
+		s = fmt.Sprintf("field %q: %s", e.Key, s)
+	}
+	if e.Line > 0 {
+		s = fmt.Sprintf("line %d: %s", e.Line, s)
+	}
+	if e.Path != "" {
+		s = fmt.Sprintf("%s: %s", e.Path, s)
+	}
+	return s
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// tomlTypes maps the types reported by toml.MetaData to TOML type names.
+var tomlTypes = map[string]string{
+	"Array":        "array",
+	"ArrayHash":    "array of tables",
+	"Bool":         "boolean",
+	"Datetime":     "datetime",
+	"Float":        "float",
+	"Hash":         "table",
+	"Integer":      "integer",
+	"String":       "string",
+	"Inline Table": "table",
+}
+
+// decodeTOMLFile decodes the TOML file at path into v. Errors reading the file are returned unchanged, so that
+// os.IsNotExist can be used on them, and errors decoding it are returned as a *DecodeError.
+func decodeTOMLFile(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := toml.Decode(string(b), v); err != nil {
+		return newDecodeError(path, string(b), v, err)
+	}
+
+	return nil
+}
+
+// newDecodeError locates the problem reported by the TOML decoder. Syntax errors, and errors returned by values that
+// decode themselves, are a toml.ParseError that locates the problem. Otherwise the file is well-formed, and the problem
+// is a value whose type does not match its destination in v, which is found by decoding each key of the file on its own.
+func newDecodeError(path string, data string, v interface{}, err error) *DecodeError {
+	d := &DecodeError{Path: path, Message: err.Error(), Err: err}
+
+	var p toml.ParseError
+	if errors.As(err, &p) {
+		d.Line = p.Position.Line
+		d.Key = p.LastKey
+		d.Message = p.Message
+		return d
+	}
+
+	var raw map[string]interface{}
+	md, rawErr := toml.Decode(data, &raw)
+	if rawErr != nil {
+		return d
+	}
+
+	var (
+		key      toml.Key
+		expected reflect.Type
+	)
+	for _, k := range md.Keys() {
+		if key != nil && !hasKeyPrefix(k, key) {
+			break
+		}
+
+		t, ok := destinationType(reflect.TypeOf(v), k, &md)
+		if !ok {
+			continue
+		}
+
+		if _, err := toml.Decode(data, reflect.New(keyType(k, t, &md)).Interface()); err != nil {
+			key, expected = k, t
+		}
+	}
+	if key == nil {
+		return d
+	}
+
+	d.Key = key.String()
+	d.Line = keyLine(data, key, &md)
+
+	found := md.Type(key...)
+	if t, ok := tomlTypes[found]; ok {
+		found = t
+	}
+	d.Message = fmt.Sprintf("expected type %s but found %s", expected, found)
+
+	return d
+}
+
+// destinationType returns the type that the value of key is decoded into when decoding into a value of type t, matching
+// keys to struct fields as the TOML decoder does. It returns false if the type cannot be determined, because a value on
+// the way accepts any TOML value.
+func destinationType(t reflect.Type, key toml.Key, md *toml.MetaData) (reflect.Type, bool) {
+	for i, piece := range key {
+		t = indirectType(t)
+		if i > 0 && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && md.Type(key[:i]...) == "ArrayHash" {
+			t = indirectType(t.Elem())
+		}
+
+		if decodesItself(t) {
+			return nil, false
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := structField(t, piece)
+			if !ok {
+				return nil, false
+			}
+			t = f.Type
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil, false
+		}
+	}
+
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return nil, false
+	}
+	return t, true
+}
+
+// structField returns the field of the struct type t that the TOML decoder decodes key into: the field whose name, or
+// toml tag name, is key, or failing that is key ignoring case. Fields of embedded structs are promoted.
+func structField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var folded *reflect.StructField
+
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		if name == key {
+			return f, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			f := f
+			folded = &f
+		}
+	}
+
+	if folded == nil {
+		return reflect.StructField{}, false
+	}
+	return *folded, true
+}
+
+// keyType returns a type that the TOML decoder decodes only the value of key into, as a value of type leaf.
+func keyType(key toml.Key, leaf reflect.Type, md *toml.MetaData) reflect.Type {
+	t := leaf
+	for i := len(key) - 1; i >= 0; i-- {
+		if i < len(key)-1 && md.Type(key[:i+1]...) == "ArrayHash" {
+			t = reflect.SliceOf(t)
+		}
+
+		t = reflect.StructOf([]reflect.StructField{{
+			Name: "Value",
+			Type: t,
+			Tag:  reflect.StructTag("toml:" + strconv.Quote(key[i])),
+		}})
+	}
+
+	return t
+}
+
+// errLocate is returned by locator so that the TOML decoder reports the position of the value it was decoded from.
+var errLocate = errors.New("locate")
+
+// locator is a value that fails to decode any TOML value.
+type locator struct{}
+
+func (locator) UnmarshalTOML(interface{}) error {
+	return errLocate
+}
+
+// keyLine returns the line of the file that key is defined on, or 0 if unknown. The TOML decoder reports the position
+// of values that fail to decode themselves, so the line is that of the error decoding a locator as the value of key.
+func keyLine(data string, key toml.Key, md *toml.MetaData) int {
+	_, err := toml.Decode(data, reflect.New(keyType(key, reflect.TypeOf(locator{}), md)).Interface())
+
+	var p toml.ParseError
+	if errors.As(err, &p) {
+		return p.Position.Line
+	}
+	return 0
+}
+
+func hasKeyPrefix(key toml.Key, prefix toml.Key) bool {
+	if len(key) < len(prefix) {
+		return false
+	}
+
+	for i := range prefix {
+		if key[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+var (
+	unmarshalerType     = reflect.TypeOf((*toml.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decodesItself returns whether values of type t decode themselves rather than being decoded by the TOML decoder.
+func decodesItself(t reflect.Type) bool {
+	p := reflect.PointerTo(t)
+	return t.Implements(unmarshalerType) || t.Implements(textUnmarshalerType) ||
+		p.Implements(unmarshalerType) || p.Implements(textUnmarshalerType)
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func testDecode(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path string
+	)
+
+	it.Before(func() {
+		path = filepath.Join(t.TempDir(), "buildpack.toml")
+	})
+
+	decodeError := func(contents string) *libcnb.DecodeError {
+		Expect(os.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+
+		_, err := libcnb.ReadBuildpackTOML(path)
+
+		var d *libcnb.DecodeError
+		Expect(errors.As(err, &d)).To(BeTrue())
+		return d
+	}
+
+	it("reads buildpack.toml", func() {
+		Expect(os.WriteFile(path, []byte("api = \"0.10\"\n[buildpack]\nid = \"test-id\"\n"), 0600)).To(Succeed())
+
+		buildpack, err := libcnb.ReadBuildpackTOML(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(buildpack.API).To(Equal("0.10"))
+		Expect(buildpack.Info.ID).To(Equal("test-id"))
+		Expect(buildpack.Path).To(Equal(filepath.Dir(path)))
+	})
+
+	it("returns the field and types of mismatched values", func() {
+		d := decodeError("api = \"0.10\"\n\n[buildpack]\nid = 1\n")
+
+		Expect(d.Path).To(Equal(path))
+		Expect(d.Line).To(Equal(4))
+		Expect(d.Key).To(Equal("buildpack.id"))
+		Expect(d).To(MatchError(path + `: line 4: field "buildpack.id": expected type string but found integer`))
+	})
+
+	it("returns the location of duplicate keys", func() {
+		d := decodeError("api = \"0.10\"\napi = \"0.9\"\n")
+
+		Expect(d.Line).To(Equal(2))
+		Expect(d.Key).To(Equal("api"))
+		Expect(d).To(MatchError(path + `: line 2: field "api": Key 'api' has already been defined.`))
+	})
+
+	it("returns the field of mismatched values in arrays of tables", func() {
+		d := decodeError("api = \"0.10\"\n\n[[targets]]\nos = \"linux\"\n\n[[targets]]\nos = \"linux\"\narch = true\n")
+
+		Expect(d.Line).To(Equal(8))
+		Expect(d.Key).To(Equal("targets.arch"))
+		Expect(d.Message).To(Equal("expected type string but found boolean"))
+	})
+
+	it("returns the field of tables in place of values", func() {
+		d := decodeError("api = \"0.10\"\n\n[buildpack.id]\nname = \"test-name\"\n")
+
+		Expect(d.Line).To(Equal(3))
+		Expect(d.Key).To(Equal("buildpack.id"))
+		Expect(d.Message).To(Equal("expected type string but found table"))
+	})
+
+	it("returns file errors unchanged", func() {
+		_, err := libcnb.ReadBuildpackTOML(path)
+
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+		Expect(errors.As(err, new(*libcnb.DecodeError))).To(BeFalse())
+	})
+}
+
+// fuzzDecode checks that decoding arbitrary contents never panics and only fails with a *DecodeError.
+func fuzzDecode(f *testing.F, read func(path string) error) {
+	f.Add([]byte("api = \"0.10\"\n[buildpack]\nid = \"test-id\"\nversion = \"1.1.1\"\n"))
+	f.Add([]byte("api = \"0.10\"\napi = \"0.10\"\n"))
+	f.Add([]byte("api = [1, 2]\n[[targets]]\nos = 1\n"))
+	f.Add([]byte("[[entries]]\nname = \"test-name\"\n[entries.metadata]\ntest-key = 1e400\n"))
+
+	f.Fuzz(func(t *testing.T, contents []byte) {
+		path := filepath.Join(t.TempDir(), "file.toml")
+		if err := os.WriteFile(path, contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := read(path); err != nil && !errors.As(err, new(*libcnb.DecodeError)) {
+			t.Fatalf("unexpected error type %T: %s", errors.Unwrap(err), err)
+		}
+	})
+}
+
+func FuzzReadBuildpackTOML(f *testing.F) {
+	fuzzDecode(f, func(path string) error {
+		_, err := libcnb.ReadBuildpackTOML(path)
+		return err
+	})
+}
+
+func FuzzReadExtensionTOML(f *testing.F) {
+	fuzzDecode(f, func(path string) error {
+		_, err := libcnb.ReadExtensionTOML(path)
+		return err
+	})
+}
+
+func FuzzReadBuildpackPlan(f *testing.F) {
+	fuzzDecode(f, func(path string) error {
+		_, err := libcnb.ReadBuildpackPlan(path)
+		return err
+	})
+}
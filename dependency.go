@@ -0,0 +1,368 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	// DependencyLayerIDKey is the layer metadata key holding the ID of a cached dependency.
+	DependencyLayerIDKey = "id"
+
+	// DependencyLayerLicensesKey is the layer metadata key holding the licenses of a cached dependency.
+	DependencyLayerLicensesKey = "licenses"
+
+	// DependencyLayerSHA256Key is the layer metadata key holding the SHA256 checksum of a cached dependency.
+	DependencyLayerSHA256Key = "sha256"
+
+	// DependencyLayerURIKey is the layer metadata key holding the URI a cached dependency was downloaded from.
+	DependencyLayerURIKey = "uri"
+
+	// DependencyLayerVersionKey is the layer metadata key holding the version of a cached dependency.
+	DependencyLayerVersionKey = "version"
+)
+
+// BuildpackDependency describes an artifact that a buildpack downloads and contributes to a layer.
+type BuildpackDependency struct {
+	// ID is the ID of the dependency.
+	ID string `toml:"id"`
+
+	// Name is the human-readable name of the dependency.
+	Name string `toml:"name"`
+
+	// Version is the version of the dependency.
+	Version string `toml:"version"`
+
+	// URI is the location the dependency is downloaded from.
+	URI string `toml:"uri"`
+
+	// SHA256 is the hex-encoded SHA256 checksum of the dependency.
+	SHA256 string `toml:"sha256"`
+
+	// SignatureURI is the location of the signature of the dependency.
+	SignatureURI string `toml:"signature-uri"`
+
+	// Licenses are the licenses the dependency is distributed under.
+	Licenses []License `toml:"licenses"`
+
+	// PURL is the package URL of the dependency, for SBOMs.
+	PURL string `toml:"purl"`
+
+	// CPEs are the Common Platform Enumerations of the dependency, for SBOMs.
+	CPEs []string `toml:"cpes"`
+}
+
+// Dependencies returns the dependencies declared in the buildpack's [[metadata.dependencies]] tables.
+func (b Buildpack) Dependencies() ([]BuildpackDependency, error) {
+	raw, ok := b.Metadata["dependencies"]
+	if !ok {
+		return nil, nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(map[string]interface{}{"dependencies": raw}); err != nil {
+		return nil, fmt.Errorf("unable to encode dependencies\n%w", err)
+	}
+
+	var d struct {
+		Dependencies []BuildpackDependency `toml:"dependencies"`
+	}
+	if _, err := toml.Decode(buf.String(), &d); err != nil {
+		return nil, fmt.Errorf("unable to decode dependencies\n%w", err)
+	}
+
+	return d.Dependencies, nil
+}
+
+// LicenseIDs returns the identifiers of the licenses the dependency is distributed under: the type of each license, or
+// its URI if it has no type.
+func (b BuildpackDependency) LicenseIDs() []string {
+	return licenseIDs(b.Licenses)
+}
+
+// ArtifactName returns the file name of the dependency, derived from the last element of its URI. If that is not a
+// safe file name, such as "..", the ID of the dependency is used, or "artifact" if the ID is not a safe file name
+// either.
+func (b BuildpackDependency) ArtifactName() string {
+	if u, err := url.Parse(b.URI); err == nil && u.Path != "" {
+		if name := path.Base(u.Path); isSafeFileName(name) {
+			return name
+		}
+	}
+
+	if isSafeFileName(b.ID) {
+		return b.ID
+	}
+
+	return "artifact"
+}
+
+// isSafeFileName indicates whether name can be joined to a directory without escaping it.
+func isSafeFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// checksum returns the SHA256 checksum of the dependency in lowercase, failing if it is not 64 hex characters.
+func (b BuildpackDependency) checksum() (string, error) {
+	if b.SHA256 == "" {
+		return "", fmt.Errorf("dependency %s does not declare a sha256", b.ID)
+	}
+
+	s := strings.ToLower(b.SHA256)
+	if len(s) != sha256.Size*2 || strings.Trim(s, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("dependency %s declares an invalid sha256 %q, expected %d hex characters", b.ID, b.SHA256, sha256.Size*2)
+	}
+
+	return s, nil
+}
+
+// DependencyDownloader downloads dependencies, verifying their checksums and, optionally, their signatures.
+type DependencyDownloader struct {
+	// Client is the HTTP client used to download dependencies. If nil, http.DefaultClient is used. Requests are sent
+	// with the User-Agent returned by UserAgent.
+	Client *http.Client
+
+	// Verifier verifies the signatures of dependencies. If nil, signatures are not verified. If set, every dependency
+	// must have a SignatureURI.
+	Verifier SignatureVerifier
+
+	// FS holds vendored dependencies, such as a buildpack's BuildpackFS. A dependency vendored at
+	// dependencies/<sha256>/<artifact name> in FS, with its signature, if any, alongside it with a .sig suffix, is read
+	// from FS instead of being downloaded.
+	FS fs.FS
+
+	// Policy restricts the locations dependencies and signatures may be downloaded from, including the locations of
+	// redirects. Dependencies read from FS are not restricted. The zero value allows every download.
+	Policy NetworkPolicy
+}
+
+// Download downloads the dependency to destination. The file is only created once the SHA256 checksum, and signature
+// if there is a Verifier, of the downloaded content have been verified.
+func (d DependencyDownloader) Download(dependency BuildpackDependency, destination string) error {
+	checksum, err := dependency.checksum()
+	if err != nil {
+		return err
+	}
+
+	if d.Verifier != nil && dependency.SignatureURI == "" {
+		return fmt.Errorf("unable to verify signature of dependency %s: no signature-uri declared", dependency.ID)
+	}
+
+	body, err := d.open(d.vendoredPath(dependency, checksum), dependency.URI)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s\n%w", filepath.Dir(destination), err)
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(destination), fmt.Sprintf(".%s-*", filepath.Base(destination)))
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file in %s\n%w", filepath.Dir(destination), err)
+	}
+	defer os.Remove(out.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), body); err != nil {
+		out.Close()
+		return fmt.Errorf("unable to download %s\n%w", dependency.URI, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("unable to close %s\n%w", out.Name(), err)
+	}
+
+	if s := hex.EncodeToString(hash.Sum(nil)); s != checksum {
+		return fmt.Errorf("sha256 for %s %s does not match expected %s", dependency.URI, s, checksum)
+	}
+
+	if d.Verifier != nil {
+		if err := d.verify(dependency, d.vendoredPath(dependency, checksum), out.Name()); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(out.Name(), destination); err != nil {
+		return fmt.Errorf("unable to move %s to %s\n%w", out.Name(), destination, err)
+	}
+
+	return nil
+}
+
+// vendoredPath returns the path of the dependency, with the given checksum, in FS.
+func (d DependencyDownloader) vendoredPath(dependency BuildpackDependency, checksum string) string {
+	return path.Join("dependencies", checksum, dependency.ArtifactName())
+}
+
+// open opens the file at name in FS if it exists there, and otherwise downloads uri.
+func (d DependencyDownloader) open(name string, uri string) (io.ReadCloser, error) {
+	if d.FS != nil {
+		f, err := d.FS.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("unable to open %s\n%w", name, err)
+		}
+	}
+
+	resp, err := d.get(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (d DependencyDownloader) get(uri string) (*http.Response, error) {
+	if err := d.Policy.Check(uri); err != nil {
+		return nil, err
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if !d.Policy.IsZero() {
+		client = d.Policy.client(client)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request for %s\n%w", uri, err)
+	}
+	req.Header.Set("User-Agent", UserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s\n%w", uri, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to download %s: %s", uri, resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (d DependencyDownloader) verify(dependency BuildpackDependency, vendoredPath string, path string) error {
+	body, err := d.open(vendoredPath+".sig", dependency.SignatureURI)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	signature, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("unable to download %s\n%w", dependency.SignatureURI, err)
+	}
+
+	if err := d.Verifier.Verify(path, signature); err != nil {
+		return fmt.Errorf("signature verification failed for dependency %s from %s\n%w", dependency.ID, dependency.URI, err)
+	}
+
+	return nil
+}
+
+// DependencyLayer returns a cache layer holding the dependency, named after its SHA256 checksum. If a layer restored
+// from a previous build already holds the dependency it is reused as-is, otherwise the layer is reset and the
+// dependency downloaded into it. The dependency is located at filepath.Join(layer.Path, dependency.ArtifactName()).
+// For the Layers of a BuildContext, the signature of the dependency is verified if a SignatureVerifier is configured,
+// or if the bindings or buildpack metadata supply a key, as described by NewSignatureVerifier, and the dependency is
+// only downloaded if the NetworkPolicy of the platform permits it. Dependencies vendored in the BuildpackFS of the
+// build are read from it rather than downloaded.
+func (l *Layers) DependencyLayer(dependency BuildpackDependency) (Layer, error) {
+	return l.DependencyLayerWithDownloader(dependency, DependencyDownloader{Verifier: l.verifier, Policy: l.policy, FS: l.buildpackFS})
+}
+
+// DependencyLayerWithDownloader behaves like DependencyLayer, using downloader to download the dependency.
+func (l *Layers) DependencyLayerWithDownloader(dependency BuildpackDependency, downloader DependencyDownloader) (Layer, error) {
+	checksum, err := dependency.checksum()
+	if err != nil {
+		return Layer{}, err
+	}
+
+	layer, err := l.Layer(checksum)
+	if err != nil {
+		return Layer{}, err
+	}
+
+	artifact := filepath.Join(layer.Path, dependency.ArtifactName())
+	if layer.Metadata[DependencyLayerSHA256Key] == checksum {
+		if _, err := os.Stat(artifact); err == nil {
+			layer.Cache = true
+			return layer, nil
+		}
+	}
+
+	layer, err = layer.Reset()
+	if err != nil {
+		return Layer{}, fmt.Errorf("unable to reset layer %s\n%w", checksum, err)
+	}
+
+	if err := downloader.Download(dependency, artifact); err != nil {
+		return Layer{}, err
+	}
+
+	layer.Cache = true
+	layer.Metadata = map[string]interface{}{
+		DependencyLayerIDKey:      dependency.ID,
+		DependencyLayerSHA256Key:  checksum,
+		DependencyLayerURIKey:     dependency.URI,
+		DependencyLayerVersionKey: dependency.Version,
+	}
+	if licenses := dependency.LicenseIDs(); len(licenses) > 0 {
+		layer.Metadata[DependencyLayerLicensesKey] = licenses
+	}
+
+	return layer, nil
+}
+
+// dependencyLayerLicenses returns the licenses recorded in the metadata of a layer returned by DependencyLayer.
+func dependencyLayerLicenses(layer Layer) []string {
+	switch v := layer.Metadata[DependencyLayerLicensesKey].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		var licenses []string
+		for _, l := range v {
+			if s, ok := l.(string); ok {
+				licenses = append(licenses, s)
+			}
+		}
+		return licenses
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+const (
+	// DependencyVersionKey is the plan entry metadata key holding the version constraint of a required dependency.
+	DependencyVersionKey = "version"
+
+	// VersionLinesKey is the buildpack metadata key holding a table of named version lines, such as latest = "*", that
+	// a version constraint may name instead of spelling out a constraint.
+	VersionLinesKey = "version-lines"
+)
+
+// VersionConstraint is a parsed version constraint.
+type VersionConstraint interface {
+	// Check returns whether the version satisfies the constraint.
+	Check(version string) bool
+}
+
+// ConstraintParser parses a version constraint. Ecosystems that use a different constraint syntax than semver, such as
+// Maven version ranges, use their own parser.
+type ConstraintParser func(constraint string) (VersionConstraint, error)
+
+// ParseSemverConstraint is the default ConstraintParser. It parses semver constraints such as ">= 1.2, < 2", "~1.2" or
+// "1.2.*". An empty constraint or "*" matches every version, including versions that are not semver.
+func ParseSemverConstraint(constraint string) (VersionConstraint, error) {
+	constraint = strings.TrimSpace(constraint)
+	if constraint == "" || constraint == "*" {
+		return anyVersion{}, nil
+	}
+
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse version constraint %q\n%w", constraint, err)
+	}
+
+	return semverConstraint{constraints: c}, nil
+}
+
+type anyVersion struct{}
+
+func (anyVersion) Check(string) bool {
+	return true
+}
+
+type semverConstraint struct {
+	constraints *semver.Constraints
+}
+
+func (s semverConstraint) Check(version string) bool {
+	v, err := semver.NewVersion(version)
+	return err == nil && s.constraints.Check(v)
+}
+
+// DependencyResolver selects the dependency that satisfies a version constraint from those a buildpack declares.
+type DependencyResolver struct {
+	// Dependencies are the dependencies to choose from.
+	Dependencies []BuildpackDependency
+
+	// VersionLines maps the names of version lines to the constraints they stand for.
+	VersionLines map[string]string
+
+	// ParseConstraint parses version constraints. If nil, ParseSemverConstraint is used.
+	ParseConstraint ConstraintParser
+}
+
+// NewDependencyResolver creates a DependencyResolver for the dependencies and version lines declared in the
+// [[metadata.dependencies]] and [metadata.version-lines] tables of buildpack.toml.
+func NewDependencyResolver(buildpack Buildpack) (DependencyResolver, error) {
+	dependencies, err := buildpack.Dependencies()
+	if err != nil {
+		return DependencyResolver{}, err
+	}
+
+	resolver := DependencyResolver{Dependencies: dependencies}
+
+	if raw, ok := buildpack.Metadata[VersionLinesKey]; ok {
+		lines, ok := raw.(map[string]interface{})
+		if !ok {
+			return DependencyResolver{}, fmt.Errorf("unable to read %s: expected a table, got %T", VersionLinesKey, raw)
+		}
+
+		resolver.VersionLines = map[string]string{}
+		for name, v := range lines {
+			s, ok := v.(string)
+			if !ok {
+				return DependencyResolver{}, fmt.Errorf("unable to read %s.%s: expected a string, got %T", VersionLinesKey, name, v)
+			}
+			resolver.VersionLines[name] = s
+		}
+	}
+
+	return resolver, nil
+}
+
+// Resolve returns the dependency with the given ID and the highest version that satisfies constraint. The constraint
+// may be the name of a version line. Versions are ordered as semver, and versions that are not semver are ordered
+// before those that are.
+func (r DependencyResolver) Resolve(id string, constraint string) (BuildpackDependency, error) {
+	if line, ok := r.VersionLines[constraint]; ok {
+		constraint = line
+	}
+
+	parse := r.ParseConstraint
+	if parse == nil {
+		parse = ParseSemverConstraint
+	}
+
+	c, err := parse(constraint)
+	if err != nil {
+		return BuildpackDependency{}, err
+	}
+
+	var candidates, versions []BuildpackDependency
+	for _, d := range r.Dependencies {
+		if d.ID != id {
+			continue
+		}
+		versions = append(versions, d)
+		if c.Check(d.Version) {
+			candidates = append(candidates, d)
+		}
+	}
+
+	if len(candidates) == 0 {
+		available := "none"
+		if len(versions) > 0 {
+			var v []string
+			for _, d := range versions {
+				v = append(v, d.Version)
+			}
+			available = strings.Join(v, ", ")
+		}
+		return BuildpackDependency{}, fmt.Errorf("no dependency %s satisfies version constraint %q; available versions: %s",
+			id, constraint, available)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return compareDependencyVersions(candidates[i].Version, candidates[j].Version) < 0
+	})
+	return candidates[len(candidates)-1], nil
+}
+
+// ResolveEntry returns the dependency named by the plan entry that satisfies the version constraint in the
+// DependencyVersionKey of its metadata, if any.
+func (r DependencyResolver) ResolveEntry(entry BuildpackPlanEntry) (BuildpackDependency, error) {
+	constraint := ""
+	if v, ok := entry.Metadata[DependencyVersionKey]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return BuildpackDependency{}, fmt.Errorf("unable to read %s of plan entry %s: expected a string, got %T", DependencyVersionKey, entry.Name, v)
+		}
+		constraint = s
+	}
+
+	return r.Resolve(entry.Name, constraint)
+}
+
+// compareDependencyVersions compares versions as semver, ordering versions that are not semver before those that are,
+// and lexically among themselves.
+func compareDependencyVersions(a string, b string) int {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+
+	switch {
+	case errA == nil && errB == nil:
+		return va.Compare(vb)
+	case errA == nil:
+		return 1
+	case errB == nil:
+		return -1
+	default:
+		return strings.Compare(a, b)
+	}
+}
@@ -0,0 +1,423 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/internal"
+	"github.com/buildpacks/libcnb/v2/mocks"
+)
+
+func testDependency(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		dependency libcnb.BuildpackDependency
+		requests   int
+		userAgent  string
+		server     *httptest.Server
+	)
+
+	it.Before(func() {
+		requests = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			userAgent = r.UserAgent()
+			switch r.URL.Path {
+			case "/test-path/test-artifact.tgz":
+				_, _ = w.Write([]byte("test-content"))
+			case "/test-path/test-artifact.tgz.sig":
+				_, _ = w.Write([]byte("test-signature"))
+			case "/redirect":
+				http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+"/test-path/test-artifact.tgz", http.StatusFound)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		s := sha256.Sum256([]byte("test-content"))
+		dependency = libcnb.BuildpackDependency{
+			ID:      "test-id",
+			Version: "1.1.1",
+			URI:     server.URL + "/test-path/test-artifact.tgz",
+			SHA256:  hex.EncodeToString(s[:]),
+		}
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	it("reads dependencies from buildpack metadata", func() {
+		buildpack := libcnb.Buildpack{Metadata: map[string]interface{}{
+			"dependencies": []map[string]interface{}{
+				{
+					"id":       "test-id",
+					"version":  "1.1.1",
+					"uri":      "https://localhost/test-artifact.tgz",
+					"sha256":   "test-sha256",
+					"licenses": []map[string]interface{}{{"type": "Apache-2.0"}},
+				},
+			},
+		}}
+
+		Expect(buildpack.Dependencies()).To(Equal([]libcnb.BuildpackDependency{
+			{
+				ID:       "test-id",
+				Version:  "1.1.1",
+				URI:      "https://localhost/test-artifact.tgz",
+				SHA256:   "test-sha256",
+				Licenses: []libcnb.License{{Type: "Apache-2.0"}},
+			},
+		}))
+	})
+
+	it("derives the artifact name from the URI", func() {
+		Expect(dependency.ArtifactName()).To(Equal("test-artifact.tgz"))
+	})
+
+	it("does not derive unsafe artifact names from the URI", func() {
+		for _, uri := range []string{"https://localhost/..", "https://localhost/", "https://localhost/a%2f..", `https://localhost/..\test`} {
+			dependency.URI = uri
+			Expect(dependency.ArtifactName()).To(Equal("test-id"), "uri %s", uri)
+		}
+
+		dependency.ID = ".."
+		Expect(dependency.ArtifactName()).To(Equal("artifact"))
+	})
+
+	context("NetworkPolicy", func() {
+		it("reads the policy from the environment and bindings", func() {
+			policy, err := libcnb.NewNetworkPolicy(
+				map[string]string{"BP_NETWORK_ALLOWED_HOSTS": "example.com, *.Example.org"},
+				libcnb.Bindings{{Name: "test-policy", Type: "network-policy", Secret: map[string]string{
+					"denied-hosts": "bad.example.org",
+					"require-tls":  "true",
+				}}},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy).To(Equal(libcnb.NetworkPolicy{
+				AllowedHosts: []string{"example.com", "*.example.org"},
+				DeniedHosts:  []string{"bad.example.org"},
+				RequireTLS:   true,
+			}))
+		})
+
+		it("fails with an invalid TLS setting", func() {
+			_, err := libcnb.NewNetworkPolicy(map[string]string{"BP_NETWORK_REQUIRE_TLS": "sometimes"}, nil)
+			Expect(err).To(MatchError(ContainSubstring(`unable to parse require TLS setting "sometimes" of network policy from environment`)))
+		})
+
+		it("checks locations", func() {
+			policy := libcnb.NetworkPolicy{
+				AllowedHosts: []string{"example.com", "*.example.org"},
+				DeniedHosts:  []string{"bad.example.org"},
+				RequireTLS:   true,
+			}
+
+			Expect(policy.Check("https://example.com:8443/artifact.tgz")).To(Succeed())
+			Expect(policy.Check("https://cdn.example.org/artifact.tgz")).To(Succeed())
+			Expect(policy.Check("https://bad.example.org/artifact.tgz")).To(MatchError(ContainSubstring("host bad.example.org is denied by bad.example.org")))
+			Expect(policy.Check("https://example.net/artifact.tgz")).To(MatchError(ContainSubstring("host example.net is not one of the allowed hosts *.example.org, example.com")))
+			Expect(policy.Check("http://example.com/artifact.tgz")).To(MatchError(ContainSubstring("scheme http is not https, and TLS is required")))
+			Expect(libcnb.NetworkPolicy{}.Check("http://example.net/artifact.tgz")).To(Succeed())
+		})
+
+		it("fails downloads before making requests", func() {
+			downloader := libcnb.DependencyDownloader{Policy: libcnb.NetworkPolicy{RequireTLS: true}}
+
+			err := downloader.Download(dependency, filepath.Join(t.TempDir(), "test-artifact.tgz"))
+			var policyErr *libcnb.NetworkPolicyError
+			Expect(errors.As(err, &policyErr)).To(BeTrue())
+			Expect(policyErr.URI).To(Equal(dependency.URI))
+			Expect(err).To(MatchError(ContainSubstring("vendor the dependency in the buildpack")))
+			Expect(requests).To(Equal(0))
+		})
+
+		it("checks redirects", func() {
+			dependency.URI = server.URL + "/redirect"
+			downloader := libcnb.DependencyDownloader{Policy: libcnb.NetworkPolicy{AllowedHosts: []string{"127.0.0.1"}}}
+
+			err := downloader.Download(dependency, filepath.Join(t.TempDir(), "test-artifact.tgz"))
+			var policyErr *libcnb.NetworkPolicyError
+			Expect(errors.As(err, &policyErr)).To(BeTrue())
+			Expect(policyErr.Reason).To(Equal("host localhost is not one of the allowed hosts 127.0.0.1"))
+			Expect(requests).To(Equal(1))
+		})
+	})
+
+	context("DependencyResolver", func() {
+		var resolver libcnb.DependencyResolver
+
+		it.Before(func() {
+			var err error
+			resolver, err = libcnb.NewDependencyResolver(libcnb.Buildpack{Metadata: map[string]interface{}{
+				"dependencies": []map[string]interface{}{
+					{"id": "test-id", "version": "1.1.1"},
+					{"id": "test-id", "version": "1.10.0"},
+					{"id": "test-id", "version": "2.0.0"},
+					{"id": "other-id", "version": "3.0.0"},
+				},
+				"version-lines": map[string]interface{}{"latest": "*", "lts": "1.*"},
+			}})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it("resolves the highest version satisfying a constraint", func() {
+			Expect(resolver.Resolve("test-id", "~1.1")).To(HaveField("Version", "1.1.1"))
+			Expect(resolver.Resolve("test-id", "1.*")).To(HaveField("Version", "1.10.0"))
+			Expect(resolver.Resolve("test-id", "*")).To(HaveField("Version", "2.0.0"))
+			Expect(resolver.Resolve("test-id", "")).To(HaveField("Version", "2.0.0"))
+		})
+
+		it("resolves version lines", func() {
+			Expect(resolver.Resolve("test-id", "lts")).To(HaveField("Version", "1.10.0"))
+			Expect(resolver.Resolve("test-id", "latest")).To(HaveField("Version", "2.0.0"))
+		})
+
+		it("resolves a plan entry", func() {
+			Expect(resolver.ResolveEntry(libcnb.BuildpackPlanEntry{
+				Name:     "test-id",
+				Metadata: map[string]interface{}{"version": "< 2.0.0"},
+			})).To(HaveField("Version", "1.10.0"))
+			Expect(resolver.ResolveEntry(libcnb.BuildpackPlanEntry{Name: "other-id"})).To(HaveField("Version", "3.0.0"))
+		})
+
+		it("uses a custom constraint parser", func() {
+			resolver.ParseConstraint = func(constraint string) (libcnb.VersionConstraint, error) {
+				return prefixConstraint(constraint), nil
+			}
+
+			Expect(resolver.Resolve("test-id", "1.1")).To(HaveField("Version", "1.10.0"))
+		})
+
+		it("fails without a satisfying version", func() {
+			_, err := resolver.Resolve("test-id", ">= 3")
+			Expect(err).To(MatchError(`no dependency test-id satisfies version constraint ">= 3"; available versions: 1.1.1, 1.10.0, 2.0.0`))
+
+			_, err = resolver.Resolve("unknown-id", "")
+			Expect(err).To(MatchError(`no dependency unknown-id satisfies version constraint ""; available versions: none`))
+		})
+
+		it("fails with an invalid constraint", func() {
+			_, err := resolver.Resolve("test-id", "not a constraint")
+			Expect(err).To(MatchError(ContainSubstring(`unable to parse version constraint "not a constraint"`)))
+		})
+	})
+
+	context("DependencyDownloader", func() {
+		it("downloads and verifies the dependency", func() {
+			destination := filepath.Join(t.TempDir(), "test-artifact.tgz")
+
+			Expect(libcnb.DependencyDownloader{}.Download(dependency, destination)).To(Succeed())
+			Expect(os.ReadFile(destination)).To(Equal([]byte("test-content")))
+			Expect(userAgent).To(Equal(libcnb.UserAgent()))
+		})
+
+		it("does not create the file when the checksum does not match", func() {
+			destination := filepath.Join(t.TempDir(), "test-artifact.tgz")
+			dependency.SHA256 = strings.Repeat("0", 64)
+
+			Expect(libcnb.DependencyDownloader{}.Download(dependency, destination)).
+				To(MatchError(ContainSubstring("does not match expected " + strings.Repeat("0", 64))))
+			Expect(destination).NotTo(BeAnExistingFile())
+			Expect(filepath.Glob(filepath.Join(filepath.Dir(destination), "*"))).To(BeEmpty())
+		})
+
+		it("returns an error for an unsuccessful response", func() {
+			dependency.URI = server.URL + "/dne"
+
+			Expect(libcnb.DependencyDownloader{}.Download(dependency, filepath.Join(t.TempDir(), "dne"))).
+				To(MatchError(ContainSubstring("404 Not Found")))
+		})
+
+		it("reads vendored dependencies from FS", func() {
+			destination := filepath.Join(t.TempDir(), "test-artifact.tgz")
+			downloader := libcnb.DependencyDownloader{FS: fstest.MapFS{
+				fmt.Sprintf("dependencies/%s/test-artifact.tgz", dependency.SHA256): {Data: []byte("test-content")},
+			}}
+
+			Expect(downloader.Download(dependency, destination)).To(Succeed())
+			Expect(os.ReadFile(destination)).To(Equal([]byte("test-content")))
+			Expect(requests).To(Equal(0))
+		})
+
+		it("downloads dependencies that are not vendored in FS", func() {
+			destination := filepath.Join(t.TempDir(), "test-artifact.tgz")
+
+			Expect(libcnb.DependencyDownloader{FS: fstest.MapFS{}}.Download(dependency, destination)).To(Succeed())
+			Expect(requests).To(Equal(1))
+		})
+	})
+
+	context("DependencyDownloader with a SignatureVerifier", func() {
+		var (
+			destination string
+			verifier    *mocks.SignatureVerifier
+		)
+
+		it.Before(func() {
+			destination = filepath.Join(t.TempDir(), "test-artifact.tgz")
+			dependency.SignatureURI = server.URL + "/test-path/test-artifact.tgz.sig"
+			verifier = &mocks.SignatureVerifier{}
+		})
+
+		it("verifies the signature", func() {
+			verifier.On("Verify", mock.Anything, []byte("test-signature")).Return(nil)
+
+			Expect(libcnb.DependencyDownloader{Verifier: verifier}.Download(dependency, destination)).To(Succeed())
+			Expect(destination).To(BeARegularFile())
+		})
+
+		it("does not create the file when verification fails", func() {
+			verifier.On("Verify", mock.Anything, mock.Anything).Return(errors.New("invalid signature"))
+
+			Expect(libcnb.DependencyDownloader{Verifier: verifier}.Download(dependency, destination)).
+				To(MatchError(fmt.Sprintf("signature verification failed for dependency test-id from %s\ninvalid signature", dependency.URI)))
+			Expect(destination).NotTo(BeAnExistingFile())
+		})
+
+		it("requires a signature", func() {
+			dependency.SignatureURI = ""
+
+			Expect(libcnb.DependencyDownloader{Verifier: verifier}.Download(dependency, destination)).
+				To(MatchError("unable to verify signature of dependency test-id: no signature-uri declared"))
+		})
+	})
+
+	context("DependencyLayer", func() {
+		var layers libcnb.Layers
+
+		it.Before(func() {
+			layers = libcnb.Layers{Path: t.TempDir()}
+		})
+
+		it("downloads the dependency into a layer named after its checksum", func() {
+			layer, err := layers.DependencyLayer(dependency)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(layer.Name).To(Equal(dependency.SHA256))
+			Expect(layer.Cache).To(BeTrue())
+			Expect(layer.Metadata).To(Equal(map[string]interface{}{
+				"id":      "test-id",
+				"sha256":  dependency.SHA256,
+				"uri":     dependency.URI,
+				"version": "1.1.1",
+			}))
+			Expect(os.ReadFile(filepath.Join(layer.Path, "test-artifact.tgz"))).To(Equal([]byte("test-content")))
+			Expect(requests).To(Equal(1))
+		})
+
+		it("reuses a layer restored from a previous build", func() {
+			layer, err := layers.DependencyLayer(dependency)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(internal.TOMLWriter{}.Write(filepath.Join(layers.Path, layer.Name+".toml"), layer)).To(Succeed())
+
+			layer, err = layers.DependencyLayer(dependency)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(layer.Cache).To(BeTrue())
+			Expect(filepath.Join(layer.Path, "test-artifact.tgz")).To(BeARegularFile())
+			Expect(requests).To(Equal(1))
+		})
+
+		it("downloads again when the cached artifact is missing", func() {
+			layer, err := layers.DependencyLayer(dependency)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(internal.TOMLWriter{}.Write(filepath.Join(layers.Path, layer.Name+".toml"), layer)).To(Succeed())
+			Expect(os.RemoveAll(layer.Path)).To(Succeed())
+
+			layer, err = layers.DependencyLayer(dependency)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(layer.Path, "test-artifact.tgz")).To(BeARegularFile())
+			Expect(requests).To(Equal(2))
+		})
+
+		it("records the licenses of the dependency", func() {
+			dependency.Licenses = []libcnb.License{{Type: "Apache-2.0"}, {URI: "https://example.com/license"}}
+
+			layer, err := layers.DependencyLayer(dependency)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layer.Metadata).To(HaveKeyWithValue("licenses", []string{"Apache-2.0", "https://example.com/license"}))
+			Expect(internal.TOMLWriter{}.Write(filepath.Join(layers.Path, layer.Name+".toml"), layer)).To(Succeed())
+
+			restored, err := layers.DependencyLayer(dependency)
+			Expect(err).NotTo(HaveOccurred())
+
+			other, err := layers.Layer("other")
+			Expect(err).NotTo(HaveOccurred())
+			other.Metadata = map[string]interface{}{"licenses": []string{"MIT", "Apache-2.0"}}
+
+			result := libcnb.NewBuildResult()
+			result.Layers = []libcnb.Layer{restored, other}
+			result.AddDependencyLicensesLabel(libcnb.Buildpack{Info: libcnb.BuildpackInfo{ID: "test-buildpack"}})
+
+			Expect(result.Labels).To(Equal([]libcnb.Label{{
+				Key:   "io.buildpacks.buildpack.test-buildpack.dependency-licenses",
+				Value: "Apache-2.0,MIT,https://example.com/license",
+			}}))
+		})
+
+		it("returns an error when the dependency has no checksum", func() {
+			dependency.SHA256 = ""
+
+			_, err := layers.DependencyLayer(dependency)
+			Expect(err).To(MatchError("dependency test-id does not declare a sha256"))
+		})
+
+		it("returns an error when the checksum is not hex encoded", func() {
+			dependency.SHA256 = "../" + dependency.SHA256[3:]
+
+			_, err := layers.DependencyLayer(dependency)
+			Expect(err).To(MatchError(ContainSubstring("dependency test-id declares an invalid sha256")))
+		})
+
+		it("accepts uppercase checksums", func() {
+			checksum := dependency.SHA256
+			dependency.SHA256 = strings.ToUpper(checksum)
+
+			layer, err := layers.DependencyLayer(dependency)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(layer.Name).To(Equal(checksum))
+			Expect(layer.Metadata).To(HaveKeyWithValue("sha256", checksum))
+		})
+	})
+}
+
+type prefixConstraint string
+
+func (p prefixConstraint) Check(version string) bool {
+	return strings.HasPrefix(version, string(p))
+}
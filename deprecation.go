@@ -0,0 +1,157 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/buildpacks/libcnb/v2/log"
+)
+
+// EnvDeprecationMode is the name of the environment variable that sets how the use of deprecated features is reported,
+// one of DeprecationModeWarn, DeprecationModeError or DeprecationModeQuiet. It gives operators a single switch to
+// enforce migration away from deprecated features across buildpacks.
+const EnvDeprecationMode = "CNB_DEPRECATION_MODE"
+
+// DeprecationMode is how the use of deprecated features is reported.
+type DeprecationMode string
+
+const (
+	// DeprecationModeWarn logs a warning for each deprecated feature used. It is the default.
+	DeprecationModeWarn DeprecationMode = "warn"
+
+	// DeprecationModeError fails the phase with a *DeprecationError when a deprecated feature is used.
+	DeprecationModeError DeprecationMode = "error"
+
+	// DeprecationModeQuiet does not report the use of deprecated features.
+	DeprecationModeQuiet DeprecationMode = "quiet"
+)
+
+// Deprecation describes the use of a deprecated feature and how to migrate away from it.
+type Deprecation struct {
+	// Feature is the name of the deprecated feature.
+	Feature string
+
+	// API is the Buildpack API version the feature is deprecated for. Optional.
+	API string
+
+	// Replacement is the name of the feature that replaces the deprecated feature. Optional.
+	Replacement string
+
+	// Guidance describes how to migrate to the replacement. Optional.
+	Guidance string
+
+	// Reference is a URL of documentation about the deprecation. Optional.
+	Reference string
+}
+
+// Warning returns the deprecation as a Warning, with the migration guidance as its remedy.
+func (d Deprecation) Warning() Warning {
+	message := fmt.Sprintf("%s is deprecated", d.Feature)
+	if d.API != "" {
+		message = fmt.Sprintf("%s for Buildpack API %s", message, d.API)
+	}
+	if d.Replacement != "" {
+		message = fmt.Sprintf("%s, use %s instead", message, d.Replacement)
+	}
+
+	var remedy []string
+	if d.Guidance != "" {
+		remedy = append(remedy, d.Guidance)
+	}
+	if d.Reference != "" {
+		remedy = append(remedy, fmt.Sprintf("See %s for details.", d.Reference))
+	}
+
+	return Warning{Message: message, Remedy: strings.Join(remedy, "\n")}
+}
+
+// String formats the deprecation as a message followed by its indented migration guidance.
+func (d Deprecation) String() string {
+	w := d.Warning()
+	if w.Remedy == "" {
+		return w.Message
+	}
+	var b strings.Builder
+	b.WriteString(w.Message)
+	for _, line := range strings.Split(w.Remedy, "\n") {
+		b.WriteString("\n")
+		if line != "" {
+			b.WriteString("  " + line)
+		}
+	}
+	return b.String()
+}
+
+// DeprecationError is returned when a deprecated feature is used and the deprecation mode is DeprecationModeError.
+type DeprecationError struct {
+	Deprecation
+}
+
+func (e *DeprecationError) Error() string {
+	return fmt.Sprintf("%s is deprecated and %s is %s\n%s", e.Feature, EnvDeprecationMode, DeprecationModeError, e.Deprecation)
+}
+
+// deprecations reports the use of deprecated features according to a DeprecationMode.
+type deprecations struct {
+	mode   DeprecationMode
+	logger log.Logger
+
+	// warned are the deprecations reported as warnings.
+	warned []Deprecation
+}
+
+// newDeprecations reads the deprecation mode from env, defaulting to DeprecationModeWarn.
+func newDeprecations(env map[string]string, logger log.Logger) (deprecations, error) {
+	d := deprecations{mode: DeprecationModeWarn, logger: logger}
+
+	if s, ok := env[EnvDeprecationMode]; ok && s != "" {
+		switch m := DeprecationMode(s); m {
+		case DeprecationModeWarn, DeprecationModeError, DeprecationModeQuiet:
+			d.mode = m
+		default:
+			return deprecations{}, fmt.Errorf("unable to parse %s %q, expected one of %s, %s or %s",
+				EnvDeprecationMode, s, DeprecationModeWarn, DeprecationModeError, DeprecationModeQuiet)
+		}
+	}
+
+	return d, nil
+}
+
+// report reports the use of a deprecated feature, returning a *DeprecationError if the mode is DeprecationModeError.
+func (d *deprecations) report(deprecation Deprecation) error {
+	switch d.mode {
+	case DeprecationModeQuiet:
+		return nil
+	case DeprecationModeError:
+		return &DeprecationError{Deprecation: deprecation}
+	default:
+		log.Warnf(d.logger, "Warning: %s", deprecation)
+		d.warned = append(d.warned, deprecation)
+		return nil
+	}
+}
+
+// warnings returns the deprecations reported as warnings.
+func (d deprecations) warnings() []Warning {
+	var warnings []Warning
+	for _, deprecation := range d.warned {
+		warnings = append(warnings, deprecation.Warning())
+	}
+	return warnings
+}
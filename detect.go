@@ -17,15 +17,18 @@
 package libcnb
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/Masterminds/semver"
 
-	"github.com/buildpacks/libcnb/v2/internal"
 	"github.com/buildpacks/libcnb/v2/log"
 )
 
@@ -42,6 +45,15 @@ type DetectContext struct {
 	// Extension is metadata about the extension from extension.toml (empty when processing a buildpack)
 	Extension Extension
 
+	// BuildPlanPath is the location the build plan is written to. If detection passes with plans, Detect writes them to
+	// it after the DetectFunc returns, replacing any contents. Changing this value does not change where they are
+	// written.
+	BuildPlanPath string
+
+	// BuildpackFS is the buildpack's, or extension's, files. It is the file system set with WithBuildpackFS, or the
+	// buildpack or extension directory if none is set.
+	BuildpackFS fs.FS
+
 	// Logger is the way to write messages to the end user
 	Logger log.Logger
 
@@ -50,6 +62,24 @@ type DetectContext struct {
 
 	// StackID is the ID of the stack.
 	StackID string
+
+	// TargetInfo contains info of the target (os, arch, ...).
+	TargetInfo TargetInfo
+
+	// TargetDistro is the target distribution (name, version).
+	TargetDistro TargetDistro
+
+	// Phase is the lifecycle phase that invoked the buildpack or extension, PhaseDetect.
+	Phase Phase
+
+	// InvokedAt is the time the phase was invoked.
+	InvokedAt time.Time
+
+	// Arguments are the arguments the buildpack or extension was invoked with.
+	Arguments []string
+
+	// Context is canceled when the phase times out, as set with WithTimeout. Long-running work should observe it.
+	Context context.Context
 }
 
 // DetectResult contains the results of detection.
@@ -75,14 +105,31 @@ func Detect(detect DetectFunc, config Config) {
 		path        string
 		destination interface{}
 	)
-	ctx := DetectContext{Logger: config.logger}
+	ctx := DetectContext{Logger: config.contextLogger, Phase: PhaseDetect, InvokedAt: time.Now(), Arguments: config.arguments}
+	env := config.environmentOrProcess()
+
+	explanation := config.detectExplanation
+	if s, ok := env[EnvDetectExplain]; ok && explanation == nil {
+		if explain, err := strconv.ParseBool(s); err == nil && explain {
+			explanation = os.Stdout
+		}
+	}
+	explainf := func(format string, a ...interface{}) {
+		if explanation != nil {
+			_, _ = fmt.Fprintf(explanation, format+"\n", a...)
+		}
+	}
+
+	if !checkRootUser(config, env) {
+		return
+	}
 
 	var moduletype = "buildpack"
 	if config.extension {
 		moduletype = "extension"
 	}
 
-	ctx.ApplicationPath, err = os.Getwd()
+	ctx.ApplicationPath, err = config.applicationPathOrWd()
 	if err != nil {
 		config.exitHandler.Error(fmt.Errorf("unable to get working directory\n%w", err))
 		return
@@ -95,7 +142,7 @@ func Detect(detect DetectFunc, config Config) {
 	}
 
 	if !config.extension {
-		if s, ok := os.LookupEnv(EnvBuildpackDirectory); ok {
+		if s, ok := env[EnvBuildpackDirectory]; ok {
 			path = filepath.Clean(s)
 		} else {
 			config.exitHandler.Error(fmt.Errorf("unable to get CNB_BUILDPACK_DIR, not found"))
@@ -105,7 +152,7 @@ func Detect(detect DetectFunc, config Config) {
 		destination = &ctx.Buildpack
 		file = filepath.Join(ctx.Buildpack.Path, "buildpack.toml")
 	} else {
-		if s, ok := os.LookupEnv(EnvExtensionDirectory); ok {
+		if s, ok := env[EnvExtensionDirectory]; ok {
 			path = filepath.Clean(s)
 		} else {
 			config.exitHandler.Error(fmt.Errorf("unable to get CNB_EXTENSION_DIR, not found"))
@@ -116,13 +163,19 @@ func Detect(detect DetectFunc, config Config) {
 		file = filepath.Join(ctx.Extension.Path, "extension.toml")
 	}
 
-	if _, err = toml.DecodeFile(file, destination); err != nil && !os.IsNotExist(err) {
+	ctx.BuildpackFS = config.buildpackFSOrDir(path)
+
+	if err = decodeTOMLFile(file, destination); err != nil && !os.IsNotExist(err) {
 		config.exitHandler.Error(fmt.Errorf("unable to decode %s %s\n%w", moduletype, file, err))
 		return
 	}
-	config.logger.Debugf("%s: %+v", moduletype, ctx.Buildpack)
-
 	if config.logger.IsDebugEnabled() {
+		if config.extension {
+			config.logger.Debug(config.contextFormatter.Extension(ctx.Extension))
+		} else {
+			config.logger.Debug(config.contextFormatter.Buildpack(ctx.Buildpack))
+		}
+
 		if err := config.contentWriter.Write(moduletype+" contents", path); err != nil {
 			config.logger.Debugf("unable to write %s contents\n%w", moduletype, err)
 		}
@@ -152,17 +205,20 @@ func Detect(detect DetectFunc, config Config) {
 
 	var buildPlanPath string
 
-	ctx.Platform.Path, ok = os.LookupEnv(EnvPlatformDirectory)
+	ctx.Platform.Path, ok = env[EnvPlatformDirectory]
 	if !ok {
 		config.exitHandler.Error(fmt.Errorf("expected CNB_PLATFORM_DIR to be set"))
 		return
 	}
 
-	buildPlanPath, ok = os.LookupEnv(EnvDetectPlanPath)
+	ctx.Platform.API = env[EnvPlatformAPI]
+
+	buildPlanPath, ok = env[EnvDetectPlanPath]
 	if !ok {
 		config.exitHandler.Error(fmt.Errorf("expected CNB_BUILD_PLAN_PATH to be set"))
 		return
 	}
+	ctx.BuildPlanPath = buildPlanPath
 
 	if config.logger.IsDebugEnabled() {
 		if err := config.contentWriter.Write("Platform contents", ctx.Platform.Path); err != nil {
@@ -171,44 +227,98 @@ func Detect(detect DetectFunc, config Config) {
 	}
 
 	file = filepath.Join(ctx.Platform.Path, "bindings")
-	if ctx.Platform.Bindings, err = NewBindings(ctx.Platform.Path); err != nil {
+	if ctx.Platform.Bindings, err = newBindings(env, ctx.Platform.Path, config.platformBindingOptions()...); err != nil {
 		config.exitHandler.Error(fmt.Errorf("unable to read platform bindings %s\n%w", file, err))
 		return
 	}
-	config.logger.Debugf("Platform Bindings: %+v", ctx.Platform.Bindings)
 
 	file = filepath.Join(ctx.Platform.Path, "env")
-	if ctx.Platform.Environment, err = internal.NewConfigMapFromPath(file); err != nil {
+	if ctx.Platform.Environment, err = config.readPlatformEnvironment(file); err != nil {
 		config.exitHandler.Error(fmt.Errorf("unable to read platform environment %s\n%w", file, err))
 		return
 	}
-	config.logger.Debugf("Platform Environment: %s", ctx.Platform.Environment)
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debug(config.contextFormatter.Platform(ctx.Platform))
+	}
 
-	if ctx.StackID, ok = os.LookupEnv(EnvStackID); !ok {
+	if ctx.StackID, ok = env[EnvStackID]; !ok {
 		config.logger.Debug("CNB_STACK_ID not set")
 	} else {
 		config.logger.Debugf("Stack: %s", ctx.StackID)
 	}
 
-	result, err := detect(ctx)
+	if APIFeatures(api).SupportsTargets {
+		ctx.TargetInfo = TargetInfo{}
+		ctx.TargetInfo.OS, _ = env[EnvTargetOS]
+		ctx.TargetInfo.Arch, _ = env[EnvTargetArch]
+		ctx.TargetInfo.Variant, _ = env[EnvTargetArchVariant]
+		config.logger.Debugf("System: %+v", ctx.TargetInfo)
+
+		ctx.TargetDistro = TargetDistro{}
+		ctx.TargetDistro.Name, _ = env[EnvTargetDistroName]
+		ctx.TargetDistro.Version, _ = env[EnvTargetDistroVersion]
+		config.logger.Debugf("Distro: %+v", ctx.TargetDistro)
+
+		if !config.extension {
+			if err := validateTargets("buildpack.toml", ctx.Buildpack.EffectiveTargets(), ctx.TargetInfo, ctx.TargetDistro); err != nil {
+				log.Warnf(config.logger, "%s, failing detection", err)
+				explainf("Detection failed: %s", err)
+				config.exitHandler.Fail()
+				return
+			}
+		}
+	}
+
+	var cancel context.CancelFunc
+	ctx.Context, cancel = config.phaseContext()
+	defer cancel()
+
+	result, err := callWithTimeout(ctx.Context, config, PhaseDetect, func() (DetectResult, error) { return detect(ctx) })
 	if err != nil {
 		config.exitHandler.Error(err)
 		return
 	}
-	config.logger.Debugf("Result: %+v", result)
+
+	maxSize := config.maxPlanMetadataSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxPlanMetadataSize
+	}
+	if err := validatePlanMetadata(result.Plans, maxSize); err != nil {
+		config.exitHandler.Error(fmt.Errorf("invalid build plan\n%w", err))
+		return
+	}
+
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debugf("Result: %+v", result)
+	}
+
+	if !result.Pass && len(result.Plans) > 0 {
+		config.exitHandler.Error(fmt.Errorf("detection failed but returned %d build plan(s); either set Pass or return no plans", len(result.Plans)))
+		return
+	}
 
 	if !result.Pass {
+		explainf("Detection failed: the %s did not pass detection", moduletype)
 		config.exitHandler.Fail()
 		return
 	}
 
 	if len(result.Plans) > 0 {
-		var plans BuildPlans
-		if len(result.Plans) > 0 {
-			plans.BuildPlan = result.Plans[0]
-		}
-		if len(result.Plans) > 1 {
-			plans.Or = result.Plans[1:]
+		plans := buildPlans(result.Plans)
+
+		if config.mergeBuildPlans {
+			var existing BuildPlans
+			if err := decodeTOMLFile(buildPlanPath, &existing); err != nil && !os.IsNotExist(err) {
+				config.exitHandler.Error(fmt.Errorf("unable to decode existing buildplan %s\n%w", buildPlanPath, err))
+				return
+			} else if err == nil {
+				plans = MergeBuildPlans(existing, plans)
+			}
+
+			if err := plans.Validate(); err != nil {
+				config.exitHandler.Error(fmt.Errorf("invalid merged build plan %s\n%w", buildPlanPath, err))
+				return
+			}
 		}
 
 		config.logger.Debugf("Writing build plans: %s <= %+v", buildPlanPath, plans)
@@ -218,5 +328,24 @@ func Detect(detect DetectFunc, config Config) {
 		}
 	}
 
+	if explanation != nil {
+		if len(result.Plans) == 0 {
+			explainf("Detection passed without a build plan")
+		} else {
+			explainf("Detection passed with the build plan:")
+			_ = toml.NewEncoder(explanation).Encode(buildPlans(result.Plans))
+		}
+	}
+
 	config.exitHandler.Pass()
 }
+
+// buildPlans returns plans in the form they are written to the build plan: the first plan, with the rest as
+// alternatives.
+func buildPlans(plans []BuildPlan) BuildPlans {
+	p := BuildPlans{BuildPlan: plans[0]}
+	if len(plans) > 1 {
+		p.Or = plans[1:]
+	}
+	return p
+}
@@ -17,10 +17,15 @@
 package libcnb_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
@@ -31,6 +36,12 @@ import (
 	"github.com/buildpacks/libcnb/v2/mocks"
 )
 
+type flusherFunc func() error
+
+func (f flusherFunc) Flush() error {
+	return f()
+}
+
 func testDetect(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
@@ -230,6 +241,19 @@ version = "1.1.1"
 			}
 		})
 
+		it("uses application path option", func() {
+			path := t.TempDir()
+
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithApplicationPath(path),
+					libcnb.WithExitHandler(exitHandler)),
+			)
+
+			Expect(ctx.ApplicationPath).To(Equal(path))
+		})
+
 		it("creates context", func() {
 			libcnb.Detect(detectFunc,
 				libcnb.NewConfig(
@@ -238,6 +262,10 @@ version = "1.1.1"
 			)
 
 			Expect(ctx.ApplicationPath).To(Equal(applicationPath))
+			Expect(ctx.Phase).To(Equal(libcnb.PhaseDetect))
+			Expect(ctx.InvokedAt).To(BeTemporally("~", time.Now(), time.Minute))
+			Expect(ctx.Arguments).To(Equal([]string{commandPath}))
+			Expect(ctx.BuildPlanPath).To(Equal(buildPlanPath))
 			Expect(ctx.Buildpack).To(Equal(libcnb.Buildpack{
 				API: "0.8",
 				Info: libcnb.BuildpackInfo{
@@ -292,6 +320,339 @@ version = "1.1.1"
 		Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("test-error"))
 	})
 
+	it("provides a context to DetectFunc", func() {
+		var ctx libcnb.DetectContext
+		detectFunc = func(context libcnb.DetectContext) (libcnb.DetectResult, error) {
+			ctx = context
+			return libcnb.DetectResult{}, nil
+		}
+
+		libcnb.Detect(detectFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, platformPath, buildPlanPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(ctx.Context).NotTo(BeNil())
+		Expect(ctx.Context.Err()).To(MatchError("context canceled"))
+	})
+
+	context("flushers", func() {
+		it.Before(func() {
+			detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+				return libcnb.DetectResult{Pass: true}, nil
+			}
+		})
+
+		it("flushes before exiting", func() {
+			var calls []int
+			flusher := flusherFunc(func() error {
+				calls = append(calls, len(exitHandler.Calls))
+				return nil
+			})
+
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithFlusher(flusher),
+					libcnb.WithFlusher(flusher),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(calls).To(Equal([]int{0, 0}))
+			Expect(exitHandler.Calls).To(HaveLen(1))
+			Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+		})
+
+		it("exits when flushing times out", func() {
+			blocked := make(chan struct{})
+			defer close(blocked)
+
+			out := &bytes.Buffer{}
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithFlusher(flusherFunc(func() error {
+						<-blocked
+						return nil
+					})),
+					libcnb.WithFlushTimeout(10*time.Millisecond),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(exitHandler.Calls).To(HaveLen(1))
+			Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+			Expect(out.String()).To(Equal("Warning: timed out after 10ms waiting to flush\n"))
+		})
+
+		it("warns when flushing fails", func() {
+			out := &bytes.Buffer{}
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithFlusher(flusherFunc(func() error { return errors.New("test-error") })),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(exitHandler.Calls).To(HaveLen(1))
+			Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+			Expect(out.String()).To(Equal("Warning: unable to flush\ntest-error\n"))
+		})
+	})
+
+	context("target matching", func() {
+		var ctx libcnb.DetectContext
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"),
+				[]byte(`
+api = "0.10"
+
+[buildpack]
+id = "test-id"
+name = "test-name"
+version = "1.1.1"
+
+[[targets]]
+os = "linux"
+arch = "amd64"
+
+[[targets.distros]]
+name = "ubuntu"
+version = "22.04"
+`),
+				0600),
+			).To(Succeed())
+
+			detectFunc = func(context libcnb.DetectContext) (libcnb.DetectResult, error) {
+				ctx = context
+				return libcnb.DetectResult{Pass: true}, nil
+			}
+
+			t.Setenv("CNB_TARGET_OS", "linux")
+			t.Setenv("CNB_TARGET_DISTRO_NAME", "ubuntu")
+			t.Setenv("CNB_TARGET_DISTRO_VERSION", "22.04")
+		})
+
+		it("passes target information when the target matches", func() {
+			t.Setenv("CNB_TARGET_ARCH", "amd64")
+
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+			Expect(ctx.TargetInfo).To(Equal(libcnb.TargetInfo{OS: "linux", Arch: "amd64"}))
+			Expect(ctx.TargetDistro).To(Equal(libcnb.TargetDistro{Name: "ubuntu", Version: "22.04"}))
+		})
+
+		it("fails detection when the target is not supported", func() {
+			t.Setenv("CNB_TARGET_ARCH", "arm64")
+
+			out := &bytes.Buffer{}
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(exitHandler.Calls[0].Method).To(Equal("Fail"))
+			Expect(ctx).To(BeZero())
+			Expect(out.String()).To(Equal("buildpack.toml declares no target matching linux/arm64 (ubuntu 22.04), failing detection\n"))
+		})
+
+		it("passes detection on arm64 for a buildpack declaring the jammy stack", func() {
+			Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"),
+				[]byte(`
+api = "0.10"
+
+[buildpack]
+id = "test-id"
+name = "test-name"
+version = "1.1.1"
+
+[[stacks]]
+id = "io.buildpacks.stacks.jammy"
+`),
+				0600),
+			).To(Succeed())
+			t.Setenv("CNB_TARGET_ARCH", "arm64")
+
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+			Expect(ctx.TargetInfo).To(Equal(libcnb.TargetInfo{OS: "linux", Arch: "arm64"}))
+		})
+	})
+
+	context("explanation", func() {
+		it("explains a failed detection", func() {
+			out := &bytes.Buffer{}
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithDetectExplanation(out)),
+			)
+
+			Expect(exitHandler.Calls[0].Method).To(Equal("Fail"))
+			Expect(out.String()).To(Equal("Detection failed: the buildpack did not pass detection\n"))
+		})
+
+		it("explains a passed detection with its build plan", func() {
+			detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+				return libcnb.DetectResult{Pass: true, Plans: []libcnb.BuildPlan{
+					{Provides: []libcnb.BuildPlanProvide{{Name: "test-name"}}},
+				}}, nil
+			}
+
+			out := &bytes.Buffer{}
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithDetectExplanation(out)),
+			)
+
+			Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+			Expect(out.String()).To(Equal(`Detection passed with the build plan:
+[[provides]]
+  name = "test-name"
+`))
+		})
+
+		it("explains a passed detection without a build plan", func() {
+			detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+				return libcnb.DetectResult{Pass: true}, nil
+			}
+
+			out := &bytes.Buffer{}
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithDetectExplanation(out)),
+			)
+
+			Expect(out.String()).To(Equal("Detection passed without a build plan\n"))
+		})
+	})
+
+	context("root user check", func() {
+		it.Before(func() {
+			t.Setenv("CNB_USER_ID", "1000")
+		})
+
+		it("warns when running as root but a non-root user is expected", func() {
+			out := &bytes.Buffer{}
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out)),
+					libcnb.WithRootUserCheck(false)),
+			)
+
+			if os.Getuid() == 0 {
+				Expect(out.String()).To(Equal("Warning: running as root, but the build image expects user 1000 (CNB_USER_ID); " +
+					"layers written as root may be unreadable at launch\n"))
+			} else {
+				Expect(out.String()).To(BeEmpty())
+			}
+			Expect(exitHandler.Calls[0].Method).To(Equal("Fail"))
+		})
+
+		it("fails when running as root but a non-root user is expected", func() {
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithRootUserCheck(true)),
+			)
+
+			if os.Getuid() == 0 {
+				Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(HavePrefix("running as root, but the build image expects user 1000")))
+			} else {
+				Expect(exitHandler.Calls[0].Method).To(Equal("Fail"))
+			}
+		})
+
+		it("does not check unless enabled", func() {
+			out := &bytes.Buffer{}
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out))),
+			)
+
+			Expect(out.String()).To(BeEmpty())
+			Expect(exitHandler.Calls[0].Method).To(Equal("Fail"))
+		})
+	})
+
+	context("Config.With", func() {
+		it.Before(func() {
+			detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+				return libcnb.DetectResult{Pass: true}, nil
+			}
+		})
+
+		it("applies options over those of the config", func() {
+			flushes := 0
+			config := libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(&mocks.ExitHandler{}),
+				libcnb.WithFlusher(flusherFunc(func() error {
+					flushes++
+					return nil
+				})),
+				libcnb.WithLogger(log.NewDiscard()))
+
+			libcnb.Detect(detectFunc, config.With(libcnb.WithExitHandler(exitHandler)))
+
+			Expect(exitHandler.Calls).To(HaveLen(1))
+			Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+			Expect(flushes).To(Equal(1))
+		})
+
+		it("ignores nil options and values", func() {
+			config := libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()))
+
+			libcnb.Detect(detectFunc, config.With(
+				nil,
+				libcnb.WithExitHandler(nil),
+				libcnb.WithLogger(nil),
+				libcnb.WithTOMLWriter(nil),
+				libcnb.WithFlusher(nil),
+				libcnb.WithEnvironment(nil)))
+
+			Expect(exitHandler.Calls).To(HaveLen(1))
+			Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+		})
+	})
+
 	it("does not write empty files", func() {
 		detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
 			return libcnb.DetectResult{Pass: true}, nil
@@ -308,6 +669,143 @@ version = "1.1.1"
 		Expect(tomlWriter.Calls).To(HaveLen(0))
 	})
 
+	it("returns an error when detection fails with build plans", func() {
+		detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+			return libcnb.DetectResult{
+				Pass:  false,
+				Plans: []libcnb.BuildPlan{{Provides: []libcnb.BuildPlanProvide{{Name: "test-name"}}}},
+			}, nil
+		}
+
+		libcnb.Detect(detectFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, platformPath, buildPlanPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(tomlWriter.Calls).To(BeEmpty())
+		Expect(exitHandler.Calls[0].Arguments.Get(0)).
+			To(MatchError("detection failed but returned 1 build plan(s); either set Pass or return no plans"))
+	})
+
+	context("build plan metadata", func() {
+		var metadata map[string]interface{}
+
+		it.Before(func() {
+			detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+				return libcnb.DetectResult{
+					Pass:  true,
+					Plans: []libcnb.BuildPlan{{Requires: []libcnb.BuildPlanRequire{{Name: "test-name", Metadata: metadata}}}},
+				}, nil
+			}
+		})
+
+		detect := func(options ...libcnb.Option) {
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(append([]libcnb.Option{
+					libcnb.WithArguments([]string{commandPath, platformPath, buildPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLogger(log.NewDiscard())}, options...)...),
+			)
+		}
+
+		it("rejects values that cannot be encoded", func() {
+			metadata = map[string]interface{}{"test-key": func() {}}
+
+			detect()
+
+			Expect(tomlWriter.Calls).To(BeEmpty())
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError(
+				"invalid build plan\nbuild plan requirement test-name metadata test-key cannot be encoded as TOML\nunsupported type: func"))
+		})
+
+		it("rejects NaN values", func() {
+			metadata = map[string]interface{}{"test-key": map[string]interface{}{"nested": []float64{math.NaN()}}}
+
+			detect()
+
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError(
+				"invalid build plan\nbuild plan requirement test-name metadata test-key.nested[0] contains a NaN or infinite number"))
+		})
+
+		it("rejects cyclic values", func() {
+			cycle := map[string]interface{}{"version": "1.0"}
+			cycle["self"] = cycle
+			metadata = map[string]interface{}{"test-key": cycle}
+
+			detect()
+
+			Expect(tomlWriter.Calls).To(BeEmpty())
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError(
+				"invalid build plan\nbuild plan requirement test-name metadata test-key.self contains a reference cycle"))
+		})
+
+		it("accepts values referenced more than once", func() {
+			shared := map[string]interface{}{"version": "1.0"}
+			metadata = map[string]interface{}{"test-key": map[string]interface{}{"a": shared, "b": shared}}
+
+			detect()
+
+			Expect(tomlWriter.Calls).To(HaveLen(1))
+		})
+
+		it("rejects values larger than the maximum size", func() {
+			metadata = map[string]interface{}{"test-key": strings.Repeat("a", 100)}
+
+			detect(libcnb.WithMaxPlanMetadataSize(64))
+
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError(
+				"invalid build plan\nbuild plan requirement test-name metadata test-key is 114 bytes, exceeding the maximum of 64"))
+		})
+
+		it("accepts large values when the size check is disabled", func() {
+			metadata = map[string]interface{}{"test-key": strings.Repeat("a", libcnb.DefaultMaxPlanMetadataSize)}
+
+			detect(libcnb.WithMaxPlanMetadataSize(-1))
+
+			Expect(tomlWriter.Calls).To(HaveLen(1))
+		})
+	})
+
+	it("writes the build plan with a detect config", func() {
+		detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+			return libcnb.DetectResult{
+				Pass:  true,
+				Plans: []libcnb.BuildPlan{{Provides: []libcnb.BuildPlanProvide{{Name: "test-name"}}}},
+			}, nil
+		}
+
+		libcnb.Detect(detectFunc,
+			libcnb.NewDetectConfig(
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(tomlWriter.Calls[0].Arguments.Get(0)).To(Equal(buildPlanPath))
+		Expect(exitHandler.Calls[0].Method).To(BeIdenticalTo("Pass"))
+	})
+
+	it("defaults the arguments of a detect config to the process arguments", func() {
+		var ctx libcnb.DetectContext
+		detectFunc = func(context libcnb.DetectContext) (libcnb.DetectResult, error) {
+			ctx = context
+			return libcnb.DetectResult{Pass: true}, nil
+		}
+
+		libcnb.Detect(detectFunc,
+			libcnb.NewDetectConfig(
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(ctx.Arguments).To(Equal(os.Args))
+	})
+
 	it("writes one build plan", func() {
 		detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
 			return libcnb.DetectResult{
@@ -419,4 +917,91 @@ version = "1.1.1"
 			},
 		}))
 	})
+
+	context("build plan merge", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(buildPlanPath, []byte(`
+[[provides]]
+name = "existing"
+
+[[requires]]
+name = "existing"
+
+[[or]]
+
+[[or.requires]]
+name = "alternative"
+`), 0600)).To(Succeed())
+
+			detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+				return libcnb.DetectResult{
+					Pass: true,
+					Plans: []libcnb.BuildPlan{{
+						Provides: []libcnb.BuildPlanProvide{{Name: "existing"}, {Name: "test-name"}},
+						Requires: []libcnb.BuildPlanRequire{{Name: "test-name"}},
+					}},
+				}, nil
+			}
+		})
+
+		it("merges with the existing build plan", func() {
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, platformPath, buildPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithBuildPlanMerge(),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(tomlWriter.Calls[0].Arguments.Get(1)).To(Equal(libcnb.BuildPlans{
+				BuildPlan: libcnb.BuildPlan{
+					Provides: []libcnb.BuildPlanProvide{{Name: "existing"}, {Name: "test-name"}},
+					Requires: []libcnb.BuildPlanRequire{{Name: "existing"}, {Name: "test-name"}},
+				},
+				Or: []libcnb.BuildPlan{{
+					Provides: []libcnb.BuildPlanProvide{{Name: "existing"}, {Name: "test-name"}},
+					Requires: []libcnb.BuildPlanRequire{{Name: "alternative"}, {Name: "test-name"}},
+				}},
+			}))
+		})
+
+		it("replaces the existing build plan by default", func() {
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, platformPath, buildPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(tomlWriter.Calls[0].Arguments.Get(1)).To(Equal(libcnb.BuildPlans{
+				BuildPlan: libcnb.BuildPlan{
+					Provides: []libcnb.BuildPlanProvide{{Name: "existing"}, {Name: "test-name"}},
+					Requires: []libcnb.BuildPlanRequire{{Name: "test-name"}},
+				},
+			}))
+		})
+
+		it("fails if the merged build plan is invalid", func() {
+			detectFunc = func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+				return libcnb.DetectResult{
+					Pass:  true,
+					Plans: []libcnb.BuildPlan{{Requires: []libcnb.BuildPlanRequire{{}}}},
+				}, nil
+			}
+
+			libcnb.Detect(detectFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath, platformPath, buildPlanPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithTOMLWriter(tomlWriter),
+					libcnb.WithBuildPlanMerge(),
+					libcnb.WithLogger(log.NewDiscard())),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(ContainSubstring("build plan 0 has a requirement without a name")))
+			Expect(tomlWriter.Calls).To(BeEmpty())
+		})
+	})
 }
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// DockerfileFinding is a violation of the image extension specification found in a Dockerfile.
+type DockerfileFinding struct {
+	// Line is the line of the Dockerfile the instruction starts on, or 0 if the finding is about the whole file.
+	Line int
+
+	// Message describes the violation.
+	Message string
+}
+
+func (f DockerfileFinding) String() string {
+	if f.Line == 0 {
+		return f.Message
+	}
+	return fmt.Sprintf("line %d: %s", f.Line, f.Message)
+}
+
+// DockerfileError is returned when a Dockerfile generated by an extension violates the image extension specification.
+type DockerfileError struct {
+	// Name is the name of the Dockerfile, build.Dockerfile or run.Dockerfile.
+	Name string
+
+	// Findings are the violations found in the Dockerfile.
+	Findings []DockerfileFinding
+}
+
+func (e *DockerfileError) Error() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "%s does not follow the image extension specification", e.Name)
+	for _, f := range e.Findings {
+		_, _ = fmt.Fprintf(&b, "\n  %s", f)
+	}
+	return b.String()
+}
+
+// ValidateBuildDockerfile validates content as a build.Dockerfile, which must extend the build image by declaring
+// ARG base_image and using it as its only FROM instruction. It returns a *DockerfileError listing the violations found.
+func ValidateBuildDockerfile(content []byte) error {
+	findings := validateExtendingDockerfile(parseDockerfile(content))
+	if len(findings) > 0 {
+		return &DockerfileError{Name: "build.Dockerfile", Findings: findings}
+	}
+	return nil
+}
+
+// ValidateRunDockerfile validates content as a run.Dockerfile, which must either switch the run image with a single
+// FROM instruction and nothing else, or extend the run image in the same way as a build.Dockerfile. When extending, it
+// may not copy from other images with COPY --from, as there are no other build stages. It returns a *DockerfileError
+// listing the violations found.
+func ValidateRunDockerfile(content []byte) error {
+	instructions := parseDockerfile(content)
+
+	var findings []DockerfileFinding
+	if from, ok := switchedRunImage(instructions); ok {
+		for _, i := range instructions {
+			if i != from {
+				findings = append(findings, DockerfileFinding{Line: i.line,
+					Message: fmt.Sprintf("%s is not allowed when switching the run image to %s, only a single FROM instruction is", i.keyword, from.arguments)})
+			}
+		}
+	} else {
+		findings = validateExtendingDockerfile(instructions)
+		for _, i := range instructions {
+			if i.keyword == "COPY" && hasFlag(i.arguments, "--from") {
+				findings = append(findings, DockerfileFinding{Line: i.line,
+					Message: "COPY --from is not allowed, files can only be copied from the build context"})
+			}
+		}
+	}
+
+	if len(findings) > 0 {
+		return &DockerfileError{Name: "run.Dockerfile", Findings: findings}
+	}
+	return nil
+}
+
+// dockerfileInstruction is an instruction in a Dockerfile.
+type dockerfileInstruction struct {
+	line      int
+	keyword   string
+	arguments string
+}
+
+// parseDockerfile splits content into instructions, joining continuation lines and skipping comments and blank lines.
+func parseDockerfile(content []byte) []*dockerfileInstruction {
+	var (
+		instructions []*dockerfileInstruction
+		current      *dockerfileInstruction
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		continued := strings.HasSuffix(line, "\\")
+		line = strings.TrimSpace(strings.TrimSuffix(line, "\\"))
+
+		if current == nil {
+			keyword, arguments, _ := strings.Cut(line, " ")
+			current = &dockerfileInstruction{line: n, keyword: strings.ToUpper(keyword), arguments: strings.TrimSpace(arguments)}
+			instructions = append(instructions, current)
+		} else if line != "" {
+			current.arguments = strings.TrimSpace(current.arguments + " " + line)
+		}
+
+		if !continued {
+			current = nil
+		}
+	}
+
+	return instructions
+}
+
+// switchedRunImage returns the FROM instruction of a run.Dockerfile that switches the run image rather than extending
+// it.
+func switchedRunImage(instructions []*dockerfileInstruction) (*dockerfileInstruction, bool) {
+	for _, i := range instructions {
+		if i.keyword == "FROM" {
+			return i, !isBaseImage(i.arguments)
+		}
+	}
+	return nil, false
+}
+
+// validateExtendingDockerfile validates a Dockerfile that extends the base image.
+func validateExtendingDockerfile(instructions []*dockerfileInstruction) []DockerfileFinding {
+	var (
+		findings []DockerfileFinding
+		froms    []*dockerfileInstruction
+		declared bool
+	)
+
+	for _, i := range instructions {
+		switch i.keyword {
+		case "ARG":
+			if len(froms) == 0 && strings.HasPrefix(i.arguments, "base_image") {
+				declared = true
+			}
+		case "FROM":
+			froms = append(froms, i)
+		}
+	}
+
+	if len(froms) == 0 {
+		return append(findings, DockerfileFinding{Message: "FROM ${base_image} is missing"})
+	}
+
+	if !declared {
+		findings = append(findings, DockerfileFinding{Line: froms[0].line, Message: "ARG base_image must be declared before FROM"})
+	}
+	if !isBaseImage(froms[0].arguments) {
+		findings = append(findings, DockerfileFinding{Line: froms[0].line,
+			Message: fmt.Sprintf("FROM %s must be FROM ${base_image}", froms[0].arguments)})
+	}
+	for _, f := range froms[1:] {
+		findings = append(findings, DockerfileFinding{Line: f.line, Message: "multi-stage builds are not allowed, only a single FROM instruction is"})
+	}
+
+	return findings
+}
+
+// isBaseImage returns whether the arguments of a FROM instruction refer to the base_image argument.
+func isBaseImage(arguments string) bool {
+	for _, f := range strings.Fields(arguments) {
+		if strings.HasPrefix(f, "--") {
+			continue
+		}
+		return f == "${base_image}" || f == "$base_image"
+	}
+	return false
+}
+
+// hasFlag returns whether the arguments of an instruction include the given flag.
+func hasFlag(arguments string, flag string) bool {
+	for _, f := range strings.Fields(arguments) {
+		if !strings.HasPrefix(f, "--") {
+			return false
+		}
+		if f == flag || strings.HasPrefix(f, flag+"=") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dryRunRecorder records the changes Build would make to the layers directory when run with WithDryRun, instead of
+// making them.
+type dryRunRecorder struct {
+	changes []string
+}
+
+// writeEnvironment records the files an EnvironmentWriter would write to dir, one per environment variable.
+func (r *dryRunRecorder) writeEnvironment(dir string, environment map[string]string) {
+	var keys []string
+	for k := range environment {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		r.write(filepath.Join(dir, k))
+	}
+}
+
+// write records a write to path, marking it as a change to an existing file if path exists.
+func (r *dryRunRecorder) write(path string) {
+	marker := "+"
+	if _, err := os.Stat(path); err == nil {
+		marker = "~"
+	}
+
+	r.changes = append(r.changes, fmt.Sprintf("%s %s", marker, path))
+}
+
+// remove records the removal of path, if path exists.
+func (r *dryRunRecorder) remove(path string) error {
+	if _, err := os.Lstat(path); err != nil {
+		return nil
+	}
+
+	r.changes = append(r.changes, fmt.Sprintf("- %s", path))
+	return nil
+}
+
+// summary returns the recorded changes, with files that would be added marked +, changed marked ~ and removed marked -.
+func (r *dryRunRecorder) summary() string {
+	if len(r.changes) == 0 {
+		return "Dry run: no changes would be made"
+	}
+
+	return fmt.Sprintf("Dry run: the following changes would be made\n%s", strings.Join(r.changes, "\n"))
+}
+
+// dryRunEnvironmentWriter is an EnvironmentWriter that records writes with a dryRunRecorder.
+type dryRunEnvironmentWriter struct {
+	recorder *dryRunRecorder
+}
+
+func (w dryRunEnvironmentWriter) Write(dir string, environment map[string]string) error {
+	w.recorder.writeEnvironment(dir, environment)
+	return nil
+}
+
+// dryRunTOMLWriter is a TOMLWriter that records writes with a dryRunRecorder.
+type dryRunTOMLWriter struct {
+	recorder *dryRunRecorder
+}
+
+func (w dryRunTOMLWriter) Write(path string, value interface{}) error {
+	w.recorder.write(path)
+	return nil
+}
@@ -17,66 +17,113 @@
 package libcnb
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+// EnvStrictEnvironmentNames is the name of the environment variable that, when true, makes Build fail when the
+// environment of a contributed layer contains an invalid environment variable name. Otherwise invalid names are
+// reported as warnings, and the variables are written as given.
+const EnvStrictEnvironmentNames = "CNB_STRICT_ENV_NAMES"
+
+var environmentVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateEnvironmentVariableName returns an error if name is not a valid POSIX environment variable name: a letter or
+// underscore followed by letters, digits and underscores.
+func ValidateEnvironmentVariableName(name string) error {
+	if !environmentVariableName.MatchString(name) {
+		return fmt.Errorf("invalid environment variable name %q, names must consist of letters, digits and underscores "+
+			"and not start with a digit", name)
+	}
+	return nil
+}
+
 // Environment represents the file-based environment variable specification.
 type Environment map[string]string
 
 // Append formats using the default formats for its operands and appends the value of this environment variable to any
 // previous declarations of the value without any delimitation. Spaces are added between operands when neither is a
 // string. If delimitation is important during concatenation, callers are required to add it.
+// A conflict with the delimiter of a prepended value of the variable is reported by Validate.
 func (e Environment) Append(name string, delimiter string, a ...interface{}) {
-	e.delimiter(name, delimiter)
-	e[fmt.Sprintf("%s.append", name)] = fmt.Sprint(a...)
+	e.delimiter(name, delimiter, "prepend")
+	e[name+".append"] = sprint(a...)
 }
 
 // Appendf formats according to a format specifier and appends the value of this environment variable to any previous
 // declarations of the value without any delimitation.  If delimitation is important during concatenation, callers are
 // required to add it.
+// A conflict with the delimiter of a prepended value of the variable is reported by Validate.
 func (e Environment) Appendf(name string, delimiter string, format string, a ...interface{}) {
-	e.delimiter(name, delimiter)
-	e[fmt.Sprintf("%s.append", name)] = fmt.Sprintf(format, a...)
+	e.delimiter(name, delimiter, "prepend")
+	e[name+".append"] = fmt.Sprintf(format, a...)
+}
+
+// AppendPath appends the paths, separated by os.PathListSeparator, to any previous declarations of the value of this
+// environment variable, delimited by os.PathListSeparator. It is the simplest way to manage path list variables such
+// as LD_LIBRARY_PATH:
+//
+//	layer.SharedEnvironment.AppendPath("LD_LIBRARY_PATH", filepath.Join(layer.Path, "lib"))
+func (e Environment) AppendPath(name string, paths ...string) {
+	e.Append(name, string(os.PathListSeparator), strings.Join(paths, string(os.PathListSeparator)))
 }
 
 // Default formats using the default formats for its operands and sets a default for an environment variable with this
 // value. Spaces are added between operands when neither is a string.
 func (e Environment) Default(name string, a ...interface{}) {
-	e[fmt.Sprintf("%s.default", name)] = fmt.Sprint(a...)
+	e[name+".default"] = sprint(a...)
 }
 
 // Defaultf formats according to a format specifier and sets a default for an environment variable with this value.
 func (e Environment) Defaultf(name string, format string, a ...interface{}) {
-	e[fmt.Sprintf("%s.default", name)] = fmt.Sprintf(format, a...)
+	e[name+".default"] = fmt.Sprintf(format, a...)
 }
 
 // Override formats using the default formats for its operands and overrides any existing value for an environment
 // variable with this value. Spaces are added between operands when neither is a string.
 func (e Environment) Override(name string, a ...interface{}) {
-	e[fmt.Sprintf("%s.override", name)] = fmt.Sprint(a...)
+	e[name+".override"] = sprint(a...)
 }
 
 // Overridef formats according to a format specifier and overrides any existing value for an environment variable with
 // this value.
 func (e Environment) Overridef(name string, format string, a ...interface{}) {
-	e[fmt.Sprintf("%s.override", name)] = fmt.Sprintf(format, a...)
+	e[name+".override"] = fmt.Sprintf(format, a...)
 }
 
 // Prepend formats using the default formats for its operands and prepends the value of this environment variable to any
 // previous declarations of the value without any delimitation.  Spaces are added between operands when neither is a
 // string. If delimitation is important during concatenation, callers are required to add it.
+// A conflict with the delimiter of an appended value of the variable is reported by Validate.
 func (e Environment) Prepend(name string, delimiter string, a ...interface{}) {
-	e.delimiter(name, delimiter)
-	e[fmt.Sprintf("%s.prepend", name)] = fmt.Sprint(a...)
+	e.delimiter(name, delimiter, "append")
+	e[name+".prepend"] = sprint(a...)
 }
 
 // Prependf formats using the default formats for its operands and prepends the value of this environment variable to
 // any previous declarations of the value without any delimitation.  If delimitation is important during concatenation,
 // callers are required to add it.
+// A conflict with the delimiter of an appended value of the variable is reported by Validate.
 func (e Environment) Prependf(name string, delimiter string, format string, a ...interface{}) {
-	e.delimiter(name, delimiter)
-	e[fmt.Sprintf("%s.prepend", name)] = fmt.Sprintf(format, a...)
+	e.delimiter(name, delimiter, "append")
+	e[name+".prepend"] = fmt.Sprintf(format, a...)
+}
+
+// PrependPath prepends the paths, separated by os.PathListSeparator, to any previous declarations of the value of this
+// environment variable, delimited by os.PathListSeparator. It is the simplest way to manage path list variables such as
+// PATH:
+//
+//	layer.SharedEnvironment.PrependPath("PATH", filepath.Join(layer.Path, "tools"))
+func (e Environment) PrependPath(name string, paths ...string) {
+	e.Prepend(name, string(os.PathListSeparator), strings.Join(paths, string(os.PathListSeparator)))
 }
 
 // ProcessAppend formats using the default formats for its operands and appends the value of this environment variable
@@ -93,6 +140,12 @@ func (e Environment) ProcessAppendf(processType string, name string, delimiter s
 	e.Appendf(filepath.Join(processType, name), delimiter, format, a...)
 }
 
+// ProcessAppendPath appends the paths, separated by os.PathListSeparator, to any previous declarations of the value of
+// this environment variable for the process type, delimited by os.PathListSeparator.
+func (e Environment) ProcessAppendPath(processType string, name string, paths ...string) {
+	e.AppendPath(filepath.Join(processType, name), paths...)
+}
+
 // ProcessDefault formats using the default formats for its operands and sets a default for an environment variable with
 // this value. Spaces are added between operands when neither is a string.
 func (e Environment) ProcessDefault(processType string, name string, a ...interface{}) {
@@ -131,6 +184,154 @@ func (e Environment) ProcessPrependf(processType string, name string, delimiter
 	e.Prependf(filepath.Join(processType, name), delimiter, format, a...)
 }
 
-func (e Environment) delimiter(name string, delimiter string) {
-	e[fmt.Sprintf("%s.delim", name)] = delimiter
+// ProcessPrependPath prepends the paths, separated by os.PathListSeparator, to any previous declarations of the value
+// of this environment variable for the process type, delimited by os.PathListSeparator.
+func (e Environment) ProcessPrependPath(processType string, name string, paths ...string) {
+	e.PrependPath(filepath.Join(processType, name), paths...)
+}
+
+// MirrorToProcesses copies each variable that applies to all processes to each of the given processes. Process-specific
+// variables are applied after those that apply to all processes, so the mirrored values take precedence over values
+// set for all processes by later buildpacks. Existing process-specific variables are not replaced.
+func (e Environment) MirrorToProcesses(processes ...Process) {
+	shared := map[string]string{}
+	for k, v := range e {
+		if !strings.Contains(k, string(filepath.Separator)) {
+			shared[k] = v
+		}
+	}
+
+	for _, p := range processes {
+		if p.Type == "" {
+			continue
+		}
+		for k, v := range shared {
+			if _, ok := e[filepath.Join(p.Type, k)]; !ok {
+				e[filepath.Join(p.Type, k)] = v
+			}
+		}
+	}
+}
+
+// Validate returns an error listing the variables with invalid names, as validated by ValidateEnvironmentVariableName,
+// and a DelimiterConflictError for each variable appended and prepended to with different delimiters. Build validates
+// the environment of each contributed layer before writing it, as the lifecycle would otherwise export them as broken
+// variables, failing on invalid names only if $CNB_STRICT_ENV_NAMES is true.
+func (e Environment) Validate() error {
+	return errors.Join(append(delimiterConflicts.errors(e), e.validateNames())...)
+}
+
+// validateNames returns an error listing the variables with invalid names.
+func (e Environment) validateNames() error {
+	seen := map[string]bool{}
+	var invalid []string
+	for k := range e {
+		name := k
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[:i]
+		}
+		name = filepath.Base(name)
+
+		if ValidateEnvironmentVariableName(name) != nil && !seen[name] {
+			seen[name] = true
+			invalid = append(invalid, strconv.Quote(name))
+		}
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+
+	sort.Strings(invalid)
+	return fmt.Errorf("invalid environment variable names %s, names must consist of letters, digits and underscores "+
+		"and not start with a digit", strings.Join(invalid, ", "))
+}
+
+// DelimiterConflictError is returned by Validate when a variable is both appended and prepended to with different
+// delimiters. The specification allows a single delimiter per variable, so one of the
+// delimiters would otherwise be silently lost.
+type DelimiterConflictError struct {
+	// Name is the name of the variable.
+	Name string
+
+	// Existing is the delimiter already set for the variable.
+	Existing string
+
+	// Delimiter is the conflicting delimiter.
+	Delimiter string
+}
+
+func (d DelimiterConflictError) Error() string {
+	return fmt.Sprintf("conflicting delimiters %q and %q for environment variable %s, "+
+		"appended and prepended values of a variable must use the same delimiter", d.Existing, d.Delimiter, d.Name)
+}
+
+// delimiterConflicts records the conflicting delimiters of the variables of each Environment until they are reported
+// by Validate. They are kept out of the Environment itself, as every key of an Environment is written as a file.
+var delimiterConflicts = &conflictRegistry{conflicts: map[uintptr]map[string]string{}}
+
+// conflictRegistry maps the identity of an Environment to the conflicting delimiters of its variables, by name.
+type conflictRegistry struct {
+	mu        sync.Mutex
+	conflicts map[uintptr]map[string]string
+}
+
+func (r *conflictRegistry) record(e Environment, name string, delimiter string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := reflect.ValueOf(e).Pointer()
+	if r.conflicts[id] == nil {
+		r.conflicts[id] = map[string]string{}
+	}
+	r.conflicts[id][name] = delimiter
+}
+
+// errors returns a DelimiterConflictError for each recorded conflict that e still contains, sorted by name. A conflict
+// no longer contained in e, such as one recorded for an earlier Environment at the same address, is ignored.
+func (r *conflictRegistry) errors(e Environment) []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conflicts := r.conflicts[reflect.ValueOf(e).Pointer()]
+
+	var names []string
+	for name := range conflicts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		existing, ok := e[name+".delim"]
+		_, appended := e[name+".append"]
+		_, prepended := e[name+".prepend"]
+		if !ok || existing == conflicts[name] || !appended || !prepended {
+			continue
+		}
+		errs = append(errs, DelimiterConflictError{Name: name, Existing: existing, Delimiter: conflicts[name]})
+	}
+	return errs
+}
+
+// delimiter sets the delimiter of the variable. If the variable has a value for the other operation with a different
+// delimiter, the existing delimiter is kept and the conflict is recorded, to be reported by Validate.
+func (e Environment) delimiter(name string, delimiter string, other string) {
+	if existing, ok := e[name+".delim"]; ok && existing != delimiter {
+		if _, ok := e[name+"."+other]; ok {
+			delimiterConflicts.record(e, name, delimiter)
+			return
+		}
+	}
+	e[name+".delim"] = delimiter
+}
+
+// sprint is equivalent to fmt.Sprint, but avoids formatting when given a single string.
+func sprint(a ...interface{}) string {
+	if len(a) == 1 {
+		if s, ok := a[0].(string); ok {
+			return s
+		}
+	}
+
+	return fmt.Sprint(a...)
 }
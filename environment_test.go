@@ -17,6 +17,8 @@
 package libcnb_test
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -26,7 +28,7 @@ import (
 	"github.com/buildpacks/libcnb/v2"
 )
 
-func testEnvironment(t *testing.T, _ spec.G, it spec.S) {
+func testEnvironment(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
 
@@ -140,4 +142,126 @@ func testEnvironment(t *testing.T, _ spec.G, it spec.S) {
 			filepath.Join("test-process", "TEST_NAME.prepend"): "test-value",
 		}))
 	})
+
+	it("mirrors variables that apply to all processes to each process", func() {
+		environment.Override("TEST_NAME", "test-value")
+		environment.ProcessOverride("worker", "TEST_NAME", "worker-value")
+
+		environment.MirrorToProcesses(libcnb.Process{Type: "web"}, libcnb.Process{Type: "worker"}, libcnb.Process{})
+
+		Expect(environment).To(Equal(libcnb.Environment{
+			"TEST_NAME.override":                          "test-value",
+			filepath.Join("web", "TEST_NAME.override"):    "test-value",
+			filepath.Join("worker", "TEST_NAME.override"): "worker-value",
+		}))
+	})
+
+	context("delimiters", func() {
+		it("allows append and prepend with the same delimiter", func() {
+			environment.Append("TEST_NAME", ":", "test-append")
+			environment.Prepend("TEST_NAME", ":", "test-prepend")
+			Expect(environment).To(Equal(libcnb.Environment{
+				"TEST_NAME.delim":   ":",
+				"TEST_NAME.append":  "test-append",
+				"TEST_NAME.prepend": "test-prepend",
+			}))
+		})
+
+		it("allows replacing the delimiter of a single operation", func() {
+			environment.Append("TEST_NAME", ":", "test-value")
+			environment.Append("TEST_NAME", " ", "test-value")
+			Expect(environment).To(HaveKeyWithValue("TEST_NAME.delim", " "))
+		})
+
+		it("reports conflicting delimiters when validated", func() {
+			environment.Append("TEST_NAME", ":", "test-append")
+			environment.Prependf("TEST_NAME", " ", "test-%s", "prepend")
+			Expect(environment).To(Equal(libcnb.Environment{
+				"TEST_NAME.delim":   ":",
+				"TEST_NAME.append":  "test-append",
+				"TEST_NAME.prepend": "test-prepend",
+			}))
+
+			var conflict libcnb.DelimiterConflictError
+			Expect(errors.As(environment.Validate(), &conflict)).To(BeTrue())
+			Expect(conflict).To(Equal(libcnb.DelimiterConflictError{
+				Name:      "TEST_NAME",
+				Existing:  ":",
+				Delimiter: " ",
+			}))
+		})
+
+		it("appends paths", func() {
+			environment.AppendPath("TEST_PATH", "/a", "/b")
+			Expect(environment).To(Equal(libcnb.Environment{
+				"TEST_PATH.delim":  string(os.PathListSeparator),
+				"TEST_PATH.append": "/a" + string(os.PathListSeparator) + "/b",
+			}))
+		})
+
+		it("prepends paths", func() {
+			environment.PrependPath("TEST_PATH", "/a")
+			Expect(environment).To(Equal(libcnb.Environment{
+				"TEST_PATH.delim":   string(os.PathListSeparator),
+				"TEST_PATH.prepend": "/a",
+			}))
+		})
+	})
+
+	it("appends process-specific paths", func() {
+		environment.ProcessAppendPath("web", "LD_LIBRARY_PATH", "/a", "/b")
+		Expect(environment).To(Equal(libcnb.Environment{
+			filepath.Join("web", "LD_LIBRARY_PATH.delim"):  string(os.PathListSeparator),
+			filepath.Join("web", "LD_LIBRARY_PATH.append"): "/a" + string(os.PathListSeparator) + "/b",
+		}))
+	})
+
+	it("prepends process-specific paths", func() {
+		environment.ProcessPrependPath("web", "PATH", "/a")
+		Expect(environment).To(Equal(libcnb.Environment{
+			filepath.Join("web", "PATH.delim"):   string(os.PathListSeparator),
+			filepath.Join("web", "PATH.prepend"): "/a",
+		}))
+	})
+
+	context("names", func() {
+		it("validates names", func() {
+			Expect(libcnb.ValidateEnvironmentVariableName("TEST_NAME")).To(Succeed())
+			Expect(libcnb.ValidateEnvironmentVariableName("_test_name1")).To(Succeed())
+			Expect(libcnb.ValidateEnvironmentVariableName("TEST NAME")).To(MatchError(ContainSubstring(`invalid environment variable name "TEST NAME"`)))
+			Expect(libcnb.ValidateEnvironmentVariableName("1TEST")).NotTo(Succeed())
+			Expect(libcnb.ValidateEnvironmentVariableName("")).NotTo(Succeed())
+		})
+
+		it("validates the environment", func() {
+			environment.Override("TEST_NAME", "test-value")
+			environment.ProcessAppend("web", "TEST_PATH", ":", "test-value")
+			Expect(environment.Validate()).To(Succeed())
+
+			environment.Append("TEST NAME", ":", "test-value")
+			environment.ProcessDefault("web", "test-name", "test-value")
+			Expect(environment.Validate()).To(MatchError(ContainSubstring(`invalid environment variable names "TEST NAME", "test-name"`)))
+		})
+
+		it("does not panic", func() {
+			t.Setenv(libcnb.EnvStrictEnvironmentNames, "true")
+
+			Expect(func() { environment.ProcessOverride("web", "TEST NAME", "test-value") }).NotTo(Panic())
+			Expect(environment.Validate()).To(MatchError(ContainSubstring(`invalid environment variable names "TEST NAME"`)))
+		})
+	})
+}
+
+func BenchmarkEnvironment(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		environment := libcnb.Environment{}
+		for j := 0; j < 100; j++ {
+			environment.Append("TEST_APPEND", ":", "test-value")
+			environment.Default("TEST_DEFAULT", "test-value")
+			environment.Override("TEST_OVERRIDE", "test-value")
+			environment.Prepend("TEST_PREPEND", ":", "test-value")
+		}
+	}
 }
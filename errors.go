@@ -0,0 +1,35 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"github.com/buildpacks/libcnb/v2/internal"
+)
+
+// ErrRetryable marks a failure as transient (e.g. a registry or network hiccup). When an error returned from a
+// DetectFunc, BuildFunc or GenerateFunc wraps ErrRetryable, the default ExitHandler exits with status code 75 instead
+// of 1, so that platforms can retry the phase.
+//
+//	return libcnb.BuildResult{}, fmt.Errorf("unable to download %s\n%w", uri, errors.Join(libcnb.ErrRetryable, err))
+var ErrRetryable = internal.ErrRetryable
+
+// ErrUserFacing returns an error whose message is shown to the end user as-is. When an error returned from a
+// DetectFunc, BuildFunc or GenerateFunc wraps a user facing error, the default ExitHandler writes only that message
+// rather than the full chain of wrapping errors.
+func ErrUserFacing(message string) error {
+	return internal.UserFacingError{Message: message}
+}
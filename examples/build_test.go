@@ -19,21 +19,6 @@ type Builder struct {
 	Logger log.Logger
 }
 
-// BuildpackPlan may contain multiple entries for a single buildpack, resolve
-// into a single entry.
-func resolve(plan libcnb.BuildpackPlan, name string) libcnb.BuildpackPlanEntry {
-	entry := libcnb.BuildpackPlanEntry{
-		Name:     name,
-		Metadata: map[string]interface{}{},
-	}
-	for _, e := range plan.Entries {
-		for k, v := range e.Metadata {
-			entry.Metadata[k] = v
-		}
-	}
-	return entry
-}
-
 func populateLayer(layer libcnb.Layer, version string) (libcnb.Layer, error) {
 	exampleFile := filepath.Join(layer.Path, "example.txt")
 	if err := os.WriteFile(exampleFile, []byte(version), 0600); err != nil {
@@ -66,7 +51,7 @@ func populateLayer(layer libcnb.Layer, version string) (libcnb.Layer, error) {
 
 func (b Builder) Build(context libcnb.BuildContext) (libcnb.BuildResult, error) {
 	// Reduce possible multiple buildpack plan entries to a single entry
-	entry := resolve(context.Plan, Provides)
+	entry, _ := context.Plan.Resolve(Provides)
 	result := libcnb.NewBuildResult()
 
 	// Read metadata from the buildpack plan, often contributed by libcnb.Requires
@@ -21,6 +21,21 @@ func (Generator) Generate(context libcnb.GenerateContext) (libcnb.GenerateResult
 	fmt.Println(context.Extension.Info.ID)
 
 	result := libcnb.NewGenerateResult()
+
+	// Reduce possible multiple buildpack plan entries to a single entry, the
+	// same way as in the Build phase
+	entry, ok := context.Plan.Resolve(Provides)
+	if !ok {
+		result.Unmet = append(result.Unmet, libcnb.UnmetPlanEntry{Name: Provides})
+		return result, nil
+	}
+
+	version := DefaultVersion
+	if v, ok := entry.Metadata["version"].(string); ok {
+		version = v
+	}
+	result.RunDockerfile = []byte(fmt.Sprintf("FROM example/run:%s\n", version))
+
 	return result, nil
 }
 
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package harness runs the detect and build phases of a libcnb buildpack in-process, against a temporary workspace
+// laid out the way the lifecycle would lay it out. It doubles as a template for buildpack acceptance tests:
+//
+//	h := harness.New(t, `api = "0.10"
+//	[buildpack]
+//	id = "example"
+//	version = "1.0.0"`)
+//	h.WriteApplicationFile("version.toml", "")
+//
+//	detect := h.Detect(detector.Detect)
+//	Expect(detect.Pass).To(BeTrue())
+//
+//	Expect(h.Build(builder.Build)).To(Succeed())
+//	layer, err := h.Layer("example")
+//
+// Lifecycle extends this to a group of buildpacks, resolving their build plans the way the lifecycle does.
+package harness
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/log"
+)
+
+// Harness is a temporary lifecycle workspace for a single buildpack.
+type Harness struct {
+	// ApplicationPath is the location of the application source code.
+	ApplicationPath string
+
+	// BuildpackPath is the location of the buildpack, containing buildpack.toml.
+	BuildpackPath string
+
+	// BuildPlanPath is the location the build plan is written to during detection.
+	BuildPlanPath string
+
+	// BuildpackPlanPath is the location the buildpack plan is read from during build.
+	BuildpackPlanPath string
+
+	// LayersPath is the location of the buildpack's layers.
+	LayersPath string
+
+	// PlatformPath is the location of the platform directory.
+	PlatformPath string
+
+	// Options are additional options passed to every phase.
+	Options []libcnb.Option
+
+	t testing.TB
+}
+
+// DetectResult is the outcome of running the detect phase.
+type DetectResult struct {
+	// Pass indicates whether detection passed.
+	Pass bool
+
+	// Plans are the build plans written by the buildpack.
+	Plans libcnb.BuildPlans
+}
+
+// New creates a Harness with a fresh workspace, writing the given contents to buildpack.toml. The workspace is removed
+// when the test completes.
+func New(t testing.TB, buildpackTOML string) *Harness {
+	t.Helper()
+
+	root := t.TempDir()
+	h := &Harness{
+		ApplicationPath:   filepath.Join(root, "workspace"),
+		BuildpackPath:     filepath.Join(root, "buildpack"),
+		BuildPlanPath:     filepath.Join(root, "plan.toml"),
+		BuildpackPlanPath: filepath.Join(root, "buildpack-plan.toml"),
+		LayersPath:        filepath.Join(root, "layers"),
+		PlatformPath:      filepath.Join(root, "platform"),
+		t:                 t,
+	}
+
+	for _, d := range []string{h.ApplicationPath, h.BuildpackPath, h.LayersPath, filepath.Join(h.PlatformPath, "env")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("unable to create %s: %s", d, err)
+		}
+	}
+
+	h.writeFile(filepath.Join(h.BuildpackPath, "buildpack.toml"), buildpackTOML)
+
+	return h
+}
+
+// WriteApplicationFile writes a file, relative to the application path.
+func (h *Harness) WriteApplicationFile(name string, contents string) {
+	h.t.Helper()
+	h.writeFile(filepath.Join(h.ApplicationPath, name), contents)
+}
+
+// SetPlatformEnvironment writes a platform environment variable, as a user would with `pack build --env`.
+func (h *Harness) SetPlatformEnvironment(name string, value string) {
+	h.t.Helper()
+	h.writeFile(filepath.Join(h.PlatformPath, "env", name), value)
+}
+
+// Detect runs the detect phase and returns its outcome. The test fails if detection returns an error.
+func (h *Harness) Detect(detect libcnb.DetectFunc) DetectResult {
+	h.t.Helper()
+
+	exit := &exitHandler{}
+	libcnb.Detect(detect, h.config(exit, "detect"))
+
+	if exit.err != nil {
+		h.t.Fatalf("detect failed: %s", exit.err)
+	}
+
+	result := DetectResult{Pass: exit.passed}
+	if _, err := toml.DecodeFile(h.BuildPlanPath, &result.Plans); err != nil && !os.IsNotExist(err) {
+		h.t.Fatalf("unable to decode build plan %s: %s", h.BuildPlanPath, err)
+	}
+
+	return result
+}
+
+// Build runs the build phase and returns the error reported by the buildpack, if any. If a previous call to Detect
+// produced a build plan, its requirements become the buildpack plan.
+func (h *Harness) Build(build libcnb.BuildFunc) error {
+	h.t.Helper()
+
+	var plans libcnb.BuildPlans
+	if _, err := toml.DecodeFile(h.BuildPlanPath, &plans); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to decode build plan %s\n%w", h.BuildPlanPath, err)
+	}
+
+	var plan libcnb.BuildpackPlan
+	for _, r := range plans.Requires {
+		plan.Entries = append(plan.Entries, libcnb.BuildpackPlanEntry{Name: r.Name, Metadata: r.Metadata})
+	}
+
+	return h.BuildWithPlan(build, plan)
+}
+
+// BuildWithPlan runs the build phase with the given buildpack plan and returns the error reported by the buildpack, if
+// any.
+func (h *Harness) BuildWithPlan(build libcnb.BuildFunc, plan libcnb.BuildpackPlan) error {
+	h.t.Helper()
+
+	if err := libcnb.NewTOMLWriter().Write(h.BuildpackPlanPath, plan); err != nil {
+		return fmt.Errorf("unable to write buildpack plan %s\n%w", h.BuildpackPlanPath, err)
+	}
+
+	exit := &exitHandler{}
+	libcnb.Build(build, h.config(exit, "build"))
+
+	return exit.err
+}
+
+// Layer reads the metadata of a layer contributed during build.
+func (h *Harness) Layer(name string) (libcnb.Layer, error) {
+	return libcnb.ReadLayerTOML(filepath.Join(h.LayersPath, fmt.Sprintf("%s.toml", name)))
+}
+
+// LaunchTOML reads the launch.toml written during build.
+func (h *Harness) LaunchTOML() (libcnb.LaunchTOML, error) {
+	return libcnb.ReadLaunchTOML(filepath.Join(h.LayersPath, "launch.toml"))
+}
+
+func (h *Harness) config(exit *exitHandler, command string) libcnb.Config {
+	options := append([]libcnb.Option{
+		libcnb.WithArguments([]string{filepath.Join(h.BuildpackPath, "bin", command)}),
+		libcnb.WithApplicationPath(h.ApplicationPath),
+		libcnb.WithEnvironment(h.environment()),
+		libcnb.WithExitHandler(exit),
+		libcnb.WithLogger(log.NewDiscard()),
+	}, h.Options...)
+
+	return libcnb.NewConfig(options...)
+}
+
+// environment returns the process environment with the lifecycle's variables for the workspace added. Phases read it
+// instead of the process environment, so harnesses can be run concurrently.
+func (h *Harness) environment() []string {
+	return append(os.Environ(),
+		fmt.Sprintf("%s=%s", libcnb.EnvBuildpackDirectory, h.BuildpackPath),
+		fmt.Sprintf("%s=%s", libcnb.EnvLayersDirectory, h.LayersPath),
+		fmt.Sprintf("%s=%s", libcnb.EnvPlatformDirectory, h.PlatformPath),
+		fmt.Sprintf("%s=%s", libcnb.EnvDetectPlanPath, h.BuildPlanPath),
+		fmt.Sprintf("%s=%s", libcnb.EnvBuildPlanPath, h.BuildpackPlanPath),
+	)
+}
+
+func (h *Harness) writeFile(path string, contents string) {
+	h.t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		h.t.Fatalf("unable to create %s: %s", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		h.t.Fatalf("unable to write %s: %s", path, err)
+	}
+}
+
+// exitHandler records the outcome of a phase instead of exiting the process.
+type exitHandler struct {
+	err    error
+	passed bool
+}
+
+func (e *exitHandler) Error(err error) {
+	e.err = err
+}
+
+func (e *exitHandler) Fail() {
+	e.passed = false
+}
+
+func (e *exitHandler) Pass() {
+	e.passed = true
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package harness_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/examples/harness"
+)
+
+const buildpackTOML = `
+api = "0.10"
+
+[buildpack]
+id = "test-id"
+name = "test-name"
+version = "1.1.1"
+`
+
+func detect(context libcnb.DetectContext) (libcnb.DetectResult, error) {
+	if _, err := os.Stat(filepath.Join(context.ApplicationPath, "version.txt")); os.IsNotExist(err) {
+		return libcnb.DetectResult{}, nil
+	}
+
+	return libcnb.DetectResult{
+		Pass: true,
+		Plans: []libcnb.BuildPlan{
+			{
+				Provides: []libcnb.BuildPlanProvide{{Name: "test-name"}},
+				Requires: []libcnb.BuildPlanRequire{
+					{Name: "test-name", Metadata: map[string]interface{}{"version": context.Platform.Environment["BP_TEST_VERSION"]}},
+				},
+			},
+		},
+	}, nil
+}
+
+func build(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+	result := libcnb.NewBuildResult()
+
+	layer, err := context.Layers.Layer("test-layer")
+	if err != nil {
+		return result, err
+	}
+	if layer, err = layer.Reset(); err != nil {
+		return result, err
+	}
+	layer.Launch = true
+	layer.Metadata = context.Plan.Entries[0].Metadata
+
+	if err := os.WriteFile(filepath.Join(layer.Path, "version"), []byte(layer.Metadata["version"].(string)), 0600); err != nil {
+		return result, err
+	}
+
+	result.Layers = append(result.Layers, layer)
+	result.Processes = append(result.Processes, libcnb.NewDirectProcess(context.Buildpack.API, "test-command"))
+	return result, nil
+}
+
+func testHarness(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		h *harness.Harness
+	)
+
+	it.Before(func() {
+		h = harness.New(t, buildpackTOML)
+	})
+
+	it("fails detection when the application does not match", func() {
+		Expect(h.Detect(detect).Pass).To(BeFalse())
+	})
+
+	context("application matches", func() {
+		it.Before(func() {
+			h.WriteApplicationFile("version.txt", "")
+			h.SetPlatformEnvironment("BP_TEST_VERSION", "2.2.2")
+		})
+
+		it("passes detection and writes the build plan", func() {
+			result := h.Detect(detect)
+
+			Expect(result.Pass).To(BeTrue())
+			Expect(result.Plans.Requires).To(Equal([]libcnb.BuildPlanRequire{
+				{Name: "test-name", Metadata: map[string]interface{}{"version": "2.2.2"}},
+			}))
+		})
+
+		it("builds from the detected plan", func() {
+			Expect(h.Detect(detect).Pass).To(BeTrue())
+			Expect(h.Build(build)).To(Succeed())
+
+			layer, err := h.Layer("test-layer")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layer.Launch).To(BeTrue())
+			Expect(layer.Metadata).To(Equal(map[string]interface{}{"version": "2.2.2"}))
+			Expect(filepath.Join(layer.Path, "version")).To(BeARegularFile())
+
+			launch, err := h.LaunchTOML()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(launch.Processes).To(Equal([]libcnb.Process{{Command: []string{"test-command"}, Arguments: []string{}}}))
+		})
+
+		it("returns the error from build", func() {
+			Expect(h.Detect(detect).Pass).To(BeTrue())
+			Expect(h.Build(func(libcnb.BuildContext) (libcnb.BuildResult, error) {
+				return libcnb.BuildResult{}, fmt.Errorf("test-error")
+			})).To(MatchError("test-error"))
+		})
+	})
+
+	it("runs harnesses concurrently", func() {
+		harnesses := make([]*harness.Harness, 4)
+		errs := make([]error, len(harnesses))
+		for i := range harnesses {
+			harnesses[i] = harness.New(t, buildpackTOML)
+			harnesses[i].WriteApplicationFile("version.txt", "")
+			harnesses[i].SetPlatformEnvironment("BP_TEST_VERSION", fmt.Sprintf("%d.0.0", i))
+		}
+
+		var wg sync.WaitGroup
+		for i, h := range harnesses {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.Detect(detect)
+				errs[i] = h.Build(build)
+			}()
+		}
+		wg.Wait()
+
+		for i, h := range harnesses {
+			Expect(errs[i]).NotTo(HaveOccurred())
+
+			layer, err := h.Layer("test-layer")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layer.Metadata).To(Equal(map[string]interface{}{"version": fmt.Sprintf("%d.0.0", i)}))
+		}
+	})
+}
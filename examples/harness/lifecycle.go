@@ -0,0 +1,231 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package harness
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+// Buildpack is a buildpack taking part in a Lifecycle simulation.
+type Buildpack struct {
+	// TOML is the contents of the buildpack's buildpack.toml.
+	TOML string
+
+	// Detect is the buildpack's detect function.
+	Detect libcnb.DetectFunc
+
+	// Build is the buildpack's build function.
+	Build libcnb.BuildFunc
+
+	// Optional indicates that the group may pass without this buildpack.
+	Optional bool
+}
+
+// LifecycleResult is the outcome of a Lifecycle run.
+type LifecycleResult struct {
+	// Group is the IDs of the buildpacks selected during detection, in the order they were built.
+	Group []string
+}
+
+// Lifecycle simulates the lifecycle's detect and build phases for an ordered group of buildpacks sharing an
+// application and platform. Detection runs for every buildpack, the build plans are resolved the way the lifecycle
+// resolves them, and each selected buildpack is then built with the buildpack plan entries it provides. Buildpacks are
+// run in-process and do not see the environment contributed by the layers of earlier buildpacks.
+type Lifecycle struct {
+	// ApplicationPath is the location of the application source code shared by all buildpacks.
+	ApplicationPath string
+
+	// PlatformPath is the location of the platform directory shared by all buildpacks.
+	PlatformPath string
+
+	// Buildpacks are the workspaces of the buildpacks in the group, in order.
+	Buildpacks []*Harness
+
+	group []Buildpack
+	ids   []string
+	t     testing.TB
+}
+
+// NewLifecycle creates a Lifecycle for an ordered group of buildpacks. The workspace is removed when the test completes.
+func NewLifecycle(t testing.TB, buildpacks ...Buildpack) *Lifecycle {
+	t.Helper()
+
+	l := &Lifecycle{group: buildpacks, t: t}
+	for i, b := range buildpacks {
+		h := New(t, b.TOML)
+		if i == 0 {
+			l.ApplicationPath, l.PlatformPath = h.ApplicationPath, h.PlatformPath
+		}
+		h.ApplicationPath, h.PlatformPath = l.ApplicationPath, l.PlatformPath
+
+		var bp libcnb.Buildpack
+		if _, err := toml.Decode(b.TOML, &bp); err != nil {
+			t.Fatalf("unable to decode buildpack.toml: %s", err)
+		}
+
+		l.Buildpacks = append(l.Buildpacks, h)
+		l.ids = append(l.ids, bp.Info.ID)
+	}
+
+	return l
+}
+
+// WriteApplicationFile writes a file, relative to the application path.
+func (l *Lifecycle) WriteApplicationFile(name string, contents string) {
+	l.t.Helper()
+	l.Buildpacks[0].WriteApplicationFile(name, contents)
+}
+
+// SetPlatformEnvironment writes a platform environment variable, as a user would with `pack build --env`.
+func (l *Lifecycle) SetPlatformEnvironment(name string, value string) {
+	l.t.Helper()
+	l.Buildpacks[0].SetPlatformEnvironment(name, value)
+}
+
+// Run runs detection for the group, resolves the build plans, and builds the selected buildpacks in order. It returns
+// an error if a buildpack that is not optional fails detection, if no combination of build plans satisfies the group,
+// or if a buildpack fails to build.
+func (l *Lifecycle) Run() (LifecycleResult, error) {
+	l.t.Helper()
+
+	var candidates [][]*libcnb.BuildPlan
+	for i, b := range l.group {
+		d := l.Buildpacks[i].Detect(b.Detect)
+		if !d.Pass && !b.Optional {
+			return LifecycleResult{}, fmt.Errorf("%s failed detection", l.ids[i])
+		}
+
+		var options []*libcnb.BuildPlan
+		if d.Pass {
+			plan := d.Plans.BuildPlan
+			options = append(options, &plan)
+			for j := range d.Plans.Or {
+				options = append(options, &d.Plans.Or[j])
+			}
+		}
+		if b.Optional {
+			options = append(options, nil)
+		}
+		candidates = append(candidates, options)
+	}
+
+	selected, ok := resolve(candidates, nil)
+	if !ok {
+		return LifecycleResult{}, errors.New("no combination of build plans satisfies the group")
+	}
+
+	var result LifecycleResult
+	met := map[string]bool{}
+	for i, plan := range selected {
+		if plan == nil {
+			continue
+		}
+
+		var bpPlan libcnb.BuildpackPlan
+		for _, p := range plan.Provides {
+			if met[p.Name] {
+				continue
+			}
+			for _, other := range selected {
+				if other == nil {
+					continue
+				}
+				for _, r := range other.Requires {
+					if r.Name == p.Name {
+						bpPlan.Entries = append(bpPlan.Entries, libcnb.BuildpackPlanEntry{Name: r.Name, Metadata: r.Metadata})
+					}
+				}
+			}
+		}
+
+		h := l.Buildpacks[i]
+		if err := h.BuildWithPlan(l.group[i].Build, bpPlan); err != nil {
+			return result, fmt.Errorf("unable to build %s\n%w", l.ids[i], err)
+		}
+		result.Group = append(result.Group, l.ids[i])
+
+		buildTOML, err := libcnb.ReadBuildTOML(filepath.Join(h.LayersPath, "build.toml"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return result, err
+		}
+		unmet := map[string]bool{}
+		for _, u := range buildTOML.Unmet {
+			unmet[u.Name] = true
+		}
+		for _, e := range bpPlan.Entries {
+			if !unmet[e.Name] {
+				met[e.Name] = true
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// resolve returns the first selection of build plans, taking one option per buildpack in order, in which every
+// requirement is provided and every provision is required. A nil option excludes the buildpack.
+func resolve(candidates [][]*libcnb.BuildPlan, selected []*libcnb.BuildPlan) ([]*libcnb.BuildPlan, bool) {
+	if len(candidates) == 0 {
+		return selected, satisfied(selected)
+	}
+
+	for _, option := range candidates[0] {
+		if s, ok := resolve(candidates[1:], append(selected[:len(selected):len(selected)], option)); ok {
+			return s, true
+		}
+	}
+
+	return nil, false
+}
+
+func satisfied(selected []*libcnb.BuildPlan) bool {
+	provided, required := map[string]bool{}, map[string]bool{}
+	found := false
+	for _, plan := range selected {
+		if plan == nil {
+			continue
+		}
+		found = true
+		for _, p := range plan.Provides {
+			provided[p.Name] = true
+		}
+		for _, r := range plan.Requires {
+			required[r.Name] = true
+		}
+	}
+
+	for name := range required {
+		if !provided[name] {
+			return false
+		}
+	}
+	for name := range provided {
+		if !required[name] {
+			return false
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package harness_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/examples/harness"
+)
+
+func testLifecycle(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		plans map[string]libcnb.BuildpackPlan
+	)
+
+	buildpack := func(api string, id string, optional bool, detect libcnb.DetectFunc) harness.Buildpack {
+		return harness.Buildpack{
+			TOML:   "api = \"" + api + "\"\n[buildpack]\nid = \"" + id + "\"\nversion = \"1.0.0\"\n",
+			Detect: detect,
+			Build: func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+				plans[id] = context.Plan
+				return libcnb.NewBuildResult(), nil
+			},
+			Optional: optional,
+		}
+	}
+
+	provides := func(name string) libcnb.DetectFunc {
+		return func(libcnb.DetectContext) (libcnb.DetectResult, error) {
+			return libcnb.DetectResult{Pass: true, Plans: []libcnb.BuildPlan{
+				{Provides: []libcnb.BuildPlanProvide{{Name: name}}},
+			}}, nil
+		}
+	}
+
+	requires := func(name string) libcnb.DetectFunc {
+		return func(context libcnb.DetectContext) (libcnb.DetectResult, error) {
+			if _, err := os.Stat(filepath.Join(context.ApplicationPath, "app.jar")); os.IsNotExist(err) {
+				return libcnb.DetectResult{}, nil
+			}
+
+			return libcnb.DetectResult{Pass: true, Plans: []libcnb.BuildPlan{
+				{Requires: []libcnb.BuildPlanRequire{{Name: name, Metadata: map[string]interface{}{"version": "17"}}}},
+			}}, nil
+		}
+	}
+
+	it.Before(func() {
+		plans = map[string]libcnb.BuildpackPlan{}
+	})
+
+	it("builds the group with resolved buildpack plans", func() {
+		l := harness.NewLifecycle(t,
+			buildpack("0.8", "jdk", false, provides("jdk")),
+			buildpack("0.10", "app", false, requires("jdk")),
+		)
+		l.WriteApplicationFile("app.jar", "")
+
+		result, err := l.Run()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Group).To(Equal([]string{"jdk", "app"}))
+		Expect(plans["jdk"]).To(Equal(libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{
+			{Name: "jdk", Metadata: map[string]interface{}{"version": "17"}},
+		}}))
+		Expect(plans["app"]).To(Equal(libcnb.BuildpackPlan{}))
+	})
+
+	it("excludes optional buildpacks whose plans are not required", func() {
+		l := harness.NewLifecycle(t,
+			buildpack("0.8", "jdk", true, provides("jdk")),
+			buildpack("0.10", "other", false, provides("other")),
+			buildpack("0.10", "app", false, requires("other")),
+		)
+		l.WriteApplicationFile("app.jar", "")
+
+		result, err := l.Run()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Group).To(Equal([]string{"other", "app"}))
+	})
+
+	it("fails if a buildpack that is not optional fails detection", func() {
+		l := harness.NewLifecycle(t,
+			buildpack("0.8", "jdk", false, provides("jdk")),
+			buildpack("0.10", "app", false, requires("jdk")),
+		)
+
+		_, err := l.Run()
+		Expect(err).To(MatchError("app failed detection"))
+	})
+
+	it("fails if the group cannot be satisfied", func() {
+		l := harness.NewLifecycle(t,
+			buildpack("0.8", "jdk", false, provides("jdk")),
+			buildpack("0.10", "app", false, requires("jre")),
+		)
+		l.WriteApplicationFile("app.jar", "")
+
+		_, err := l.Run()
+		Expect(err).To(MatchError("no combination of build plans satisfies the group"))
+	})
+}
@@ -18,12 +18,17 @@ package libcnb
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
-
-	"github.com/buildpacks/libcnb/v2/internal"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
 )
 
+// EnvExecDTimeout is the name of the environment variable that sets how long RunExecD waits for an ExecD to complete,
+// as a duration such as "10s", when WithExecDTimeout is not used.
+const EnvExecDTimeout = "BP_EXECD_TIMEOUT"
+
 //go:generate mockery --name ExecD --case=underscore
 
 // ExecD describes an interface for types that follow the Exec.d specification.
@@ -35,15 +40,7 @@ type ExecD interface {
 // RunExecD is called by the main function of a buildpack's execd binary, encompassing multiple execd
 // executors in one binary.
 func RunExecD(execDMap map[string]ExecD, options ...Option) {
-	config := Config{
-		arguments:   os.Args,
-		execdWriter: internal.NewExecDWriter(),
-		exitHandler: internal.NewExitHandler(),
-	}
-
-	for _, option := range options {
-		config = option(config)
-	}
+	config := NewExecDConfig(options...)
 
 	if len(config.arguments) == 0 {
 		config.exitHandler.Error(fmt.Errorf("expected command name"))
@@ -58,7 +55,16 @@ func RunExecD(execDMap map[string]ExecD, options ...Option) {
 		return
 	}
 
-	r, err := e.Execute()
+	timeout := config.execdTimeout
+	if s, ok := lookupEnv(config.environment, EnvExecDTimeout); ok && timeout == 0 {
+		var err error
+		if timeout, err = time.ParseDuration(s); err != nil {
+			config.exitHandler.Error(fmt.Errorf("unable to parse %s %q\n%w", EnvExecDTimeout, s, err))
+			return
+		}
+	}
+
+	r, err := executeExecD(c, e, timeout)
 	if err != nil {
 		config.exitHandler.Error(err)
 		return
@@ -69,3 +75,83 @@ func RunExecD(execDMap map[string]ExecD, options ...Option) {
 		return
 	}
 }
+
+type execDResult struct {
+	output map[string]string
+	err    error
+}
+
+// executeExecD executes e, converting a panic into an error and failing if it does not complete within timeout. A
+// timeout of zero waits indefinitely.
+func executeExecD(name string, e ExecD, timeout time.Duration) (map[string]string, error) {
+	result := make(chan execDResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- execDResult{err: fmt.Errorf("exec.d %s panicked: %v\n%s", name, r, debug.Stack())}
+			}
+		}()
+
+		output, err := e.Execute()
+		result <- execDResult{output: output, err: err}
+	}()
+
+	if timeout <= 0 {
+		r := <-result
+		return r.output, r.err
+	}
+
+	select {
+	case r := <-result:
+		return r.output, r.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("exec.d %s did not complete within %s", name, timeout)
+	}
+}
+
+// ExecDConflictError is returned by MergeExecDOutputs when more than one output sets the same variable to different
+// values.
+type ExecDConflictError struct {
+	// Names are the names of the conflicting variables, sorted.
+	Names []string
+}
+
+func (e *ExecDConflictError) Error() string {
+	return fmt.Sprintf("conflicting values for %s", strings.Join(e.Names, ", "))
+}
+
+// MergeExecDOutputs merges the outputs of several ExecD contributors, such as the sub-providers of an ExecD that
+// aggregates them, into a single output. When more than one output sets a variable to different values, the value from
+// the last output is kept and an *ExecDConflictError naming the variables is returned with the merged output, so that
+// callers can either fail or warn and use it:
+//
+//	env, err := libcnb.MergeExecDOutputs(a, b)
+//	var conflict *libcnb.ExecDConflictError
+//	if errors.As(err, &conflict) {
+//		logger.Debugf("Warning: %s", conflict)
+//	}
+func MergeExecDOutputs(maps ...map[string]string) (map[string]string, error) {
+	merged := map[string]string{}
+	conflicts := map[string]bool{}
+
+	for _, m := range maps {
+		for k, v := range m {
+			if existing, ok := merged[k]; ok && existing != v {
+				conflicts[k] = true
+			}
+			merged[k] = v
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return merged, nil
+	}
+
+	var names []string
+	for k := range conflicts {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return merged, &ExecDConflictError{Names: names}
+}
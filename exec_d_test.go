@@ -17,8 +17,10 @@
 package libcnb_test
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
@@ -28,7 +30,7 @@ import (
 	"github.com/buildpacks/libcnb/v2/mocks"
 )
 
-func testExecD(t *testing.T, _ spec.G, it spec.S) {
+func testExecD(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
 
@@ -127,4 +129,84 @@ func testExecD(t *testing.T, _ spec.G, it spec.S) {
 		Expect(execdWriter.Calls).To(HaveLen(0))
 		Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError(err))
 	})
+
+	it("fails when an execd panics", func() {
+		execd := &mocks.ExecD{}
+		execd.On("Execute", mock.Anything).Panic("test-panic")
+
+		libcnb.RunExecD(map[string]libcnb.ExecD{"execd": execd},
+			libcnb.WithArguments([]string{"execd"}),
+			libcnb.WithExitHandler(exitHandler),
+			libcnb.WithExecDWriter(execdWriter),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(HavePrefix("exec.d execd panicked: test-panic")))
+		Expect(execdWriter.Calls).To(BeEmpty())
+	})
+
+	it("fails when an execd does not complete within the timeout", func() {
+		execd := &mocks.ExecD{}
+		execd.On("Execute", mock.Anything).After(time.Second).Return(map[string]string{}, nil)
+
+		libcnb.RunExecD(map[string]libcnb.ExecD{"execd": execd},
+			libcnb.WithArguments([]string{"execd"}),
+			libcnb.WithExitHandler(exitHandler),
+			libcnb.WithExecDWriter(execdWriter),
+			libcnb.WithExecDTimeout(10*time.Millisecond),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError("exec.d execd did not complete within 10ms"))
+		Expect(execdWriter.Calls).To(BeEmpty())
+	})
+
+	it("reads the timeout from the environment", func() {
+		execd := &mocks.ExecD{}
+		execd.On("Execute", mock.Anything).After(time.Second).Return(map[string]string{}, nil)
+
+		libcnb.RunExecD(map[string]libcnb.ExecD{"execd": execd},
+			libcnb.WithArguments([]string{"execd"}),
+			libcnb.WithExitHandler(exitHandler),
+			libcnb.WithExecDWriter(execdWriter),
+			libcnb.WithEnvironment([]string{"BP_EXECD_TIMEOUT=10ms"}),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError("exec.d execd did not complete within 10ms"))
+	})
+
+	it("fails with an invalid timeout in the environment", func() {
+		execd := &mocks.ExecD{}
+
+		libcnb.RunExecD(map[string]libcnb.ExecD{"execd": execd},
+			libcnb.WithArguments([]string{"execd"}),
+			libcnb.WithExitHandler(exitHandler),
+			libcnb.WithEnvironment([]string{"BP_EXECD_TIMEOUT=test-value"}),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(HavePrefix(`unable to parse BP_EXECD_TIMEOUT "test-value"`)))
+		Expect(execd.Calls).To(BeEmpty())
+	})
+
+	context("MergeExecDOutputs", func() {
+		it("merges outputs", func() {
+			merged, err := libcnb.MergeExecDOutputs(
+				map[string]string{"ALPHA": "1", "BRAVO": "2"},
+				map[string]string{"BRAVO": "2", "CHARLIE": "3"},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged).To(Equal(map[string]string{"ALPHA": "1", "BRAVO": "2", "CHARLIE": "3"}))
+		})
+
+		it("keeps the last value and returns conflicts", func() {
+			merged, err := libcnb.MergeExecDOutputs(
+				map[string]string{"ALPHA": "1", "BRAVO": "1", "CHARLIE": "1"},
+				map[string]string{"CHARLIE": "2", "ALPHA": "2"},
+			)
+			Expect(merged).To(Equal(map[string]string{"ALPHA": "2", "BRAVO": "1", "CHARLIE": "2"}))
+
+			var conflict *libcnb.ExecDConflictError
+			Expect(errors.As(err, &conflict)).To(BeTrue())
+			Expect(conflict.Names).To(Equal([]string{"ALPHA", "CHARLIE"}))
+			Expect(err).To(MatchError("conflicting values for ALPHA, CHARLIE"))
+		})
+	})
 }
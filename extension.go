@@ -16,6 +16,11 @@
 
 package libcnb
 
+import (
+	"fmt"
+	"path/filepath"
+)
+
 // ExtensionInfo is information about the extension.
 type ExtensionInfo struct {
 	// ID is the ID of the extension.
@@ -40,6 +45,17 @@ type ExtensionInfo struct {
 	Licenses []License `toml:"licenses"`
 }
 
+// Ref returns the canonical reference to the extension, <id>@<version>, or just the ID if there is no version.
+func (e ExtensionInfo) Ref() string {
+	return ref(e.ID, e.Version)
+}
+
+// Sanitize returns the extension ID with slashes replaced by underscores, so that it is safe to use in image
+// references, file names, and layer names.
+func (e ExtensionInfo) Sanitize() string {
+	return sanitize(e.ID)
+}
+
 // Extension is the contents of the extension.toml file.
 type Extension struct {
 	// API is the api version expected by the extension.
@@ -57,3 +73,14 @@ type Extension struct {
 	// Metadata is arbitrary metadata attached to the extension.
 	Metadata map[string]interface{} `toml:"metadata"`
 }
+
+// ReadExtensionTOML decodes the extension.toml file at the given path. The path of the returned extension is the
+// directory containing the file.
+func ReadExtensionTOML(path string) (Extension, error) {
+	extension := Extension{Path: filepath.Dir(path)}
+	if err := decodeTOMLFile(path, &extension); err != nil {
+		return Extension{}, fmt.Errorf("unable to decode extension %s\n%w", path, err)
+	}
+
+	return extension, nil
+}
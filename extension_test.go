@@ -48,4 +48,11 @@ func testExtensionTOML(t *testing.T, _ spec.G, it spec.S) {
 		Expect(toml.NewEncoder(output).Encode(extn)).To(Succeed())
 		Expect(output.String()).NotTo(Or(ContainSubstring("Path = "), ContainSubstring("path = ")))
 	})
+
+	it("returns the canonical reference and sanitized ID", func() {
+		info := libcnb.ExtensionInfo{ID: "test-org/test-id", Version: "1.1.1"}
+
+		Expect(info.Ref()).To(Equal("test-org/test-id@1.1.1"))
+		Expect(info.Sanitize()).To(Equal("test-org_test-id"))
+	})
 }
@@ -0,0 +1,322 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fixture captures the inputs of a phase into a sanitized archive that can be attached to a bug report, and
+// replays such an archive so that the phase can be run locally against the same inputs.
+//
+// A fixture contains the buildpack.toml or extension.toml, the buildpack plan, the platform directory and the
+// lifecycle and buildpack environment variables. Binding secrets, and the values of environment variables whose names
+// suggest they hold credentials, are redacted. The application source is not captured.
+package fixture
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/archive"
+)
+
+// Redacted replaces secret values in a fixture.
+const Redacted = "<redacted>"
+
+// sensitiveName matches the names of environment variables and binding entries whose values are redacted.
+var sensitiveName = regexp.MustCompile(`(?i)password|passwd|secret|token|credential|private_?key|api_?key|access_?key`)
+
+// capturedPrefixes are the prefixes of the environment variables captured in a fixture.
+var capturedPrefixes = []string{"CNB_", "BP_", "BPL_"}
+
+// pathVariables are the environment variables holding paths, which are not captured but set by Replay to the
+// locations of the replayed inputs.
+var pathVariables = map[string]bool{
+	libcnb.EnvBuildpackDirectory: true,
+	libcnb.EnvExtensionDirectory: true,
+	libcnb.EnvLayersDirectory:    true,
+	libcnb.EnvOutputDirectory:    true,
+	libcnb.EnvPlatformDirectory:  true,
+	libcnb.EnvDetectPlanPath:     true,
+	libcnb.EnvBuildPlanPath:      true,
+	libcnb.EnvServiceBindings:    true,
+}
+
+// metadata is the contents of fixture.toml.
+type metadata struct {
+	Phase       libcnb.Phase `toml:"phase"`
+	Extension   bool         `toml:"extension"`
+	Environment []string     `toml:"environment"`
+}
+
+// Capture writes the inputs of phase, located using the lifecycle environment variables in environ (typically
+// os.Environ()), to w as a gzip compressed tar archive.
+func Capture(w io.Writer, phase libcnb.Phase, environ []string) error {
+	env := map[string]string{}
+	for _, e := range environ {
+		if k, v, ok := strings.Cut(e, "="); ok {
+			env[k] = v
+		}
+	}
+
+	staging, err := os.MkdirTemp("", "fixture")
+	if err != nil {
+		return fmt.Errorf("unable to create staging directory\n%w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	m := metadata{Phase: phase}
+
+	if path, ok := env[libcnb.EnvExtensionDirectory]; ok && env[libcnb.EnvBuildpackDirectory] == "" {
+		m.Extension = true
+		if err := copyFile(filepath.Join(path, "extension.toml"), filepath.Join(staging, "buildpack", "extension.toml")); err != nil {
+			return err
+		}
+	} else if path, ok := env[libcnb.EnvBuildpackDirectory]; ok {
+		if err := copyFile(filepath.Join(path, "buildpack.toml"), filepath.Join(staging, "buildpack", "buildpack.toml")); err != nil {
+			return err
+		}
+	}
+
+	if path, ok := env[libcnb.EnvBuildPlanPath]; ok {
+		if err := copyFile(path, filepath.Join(staging, "plan.toml")); err != nil {
+			return err
+		}
+	}
+
+	if path, ok := env[libcnb.EnvPlatformDirectory]; ok {
+		if err := captureEnvironmentDirectory(filepath.Join(path, "env"), filepath.Join(staging, "platform", "env")); err != nil {
+			return err
+		}
+
+		bindings := filepath.Join(path, "bindings")
+		if root, ok := env[libcnb.EnvServiceBindings]; ok {
+			bindings = root
+		}
+		if err := captureBindings(bindings, filepath.Join(staging, "platform", "bindings")); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range env {
+		if pathVariables[k] || !captured(k) {
+			continue
+		}
+		if sensitiveName.MatchString(k) {
+			v = Redacted
+		}
+		m.Environment = append(m.Environment, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(m.Environment)
+
+	f, err := os.Create(filepath.Join(staging, "fixture.toml"))
+	if err != nil {
+		return fmt.Errorf("unable to create fixture.toml\n%w", err)
+	}
+	if err := toml.NewEncoder(f).Encode(m); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to encode fixture.toml\n%w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to close fixture.toml\n%w", err)
+	}
+
+	return archive.Compress(w, staging)
+}
+
+// Fixture is a captured phase replayed into a directory.
+type Fixture struct {
+	// Phase is the phase the fixture was captured from.
+	Phase libcnb.Phase
+
+	// Extension indicates whether the fixture was captured from an extension.
+	Extension bool
+
+	// ApplicationPath is the location of an empty application directory, to which the application can be copied.
+	ApplicationPath string
+
+	// BuildpackPath is the location of the buildpack, or extension, containing its buildpack.toml or extension.toml.
+	BuildpackPath string
+
+	// LayersPath is the location of an empty layers directory.
+	LayersPath string
+
+	// OutputPath is the location of an empty output directory, for extensions.
+	OutputPath string
+
+	// PlatformPath is the location of the platform directory.
+	PlatformPath string
+
+	// Environment is the captured environment, with the path variables set to the locations of the replayed inputs.
+	Environment []string
+}
+
+// Replay extracts the fixture archive read from r into dir and returns the locations of its inputs.
+func Replay(r io.Reader, dir string) (Fixture, error) {
+	if err := archive.Decompress(r, dir); err != nil {
+		return Fixture{}, fmt.Errorf("unable to extract fixture\n%w", err)
+	}
+
+	var m metadata
+	file := filepath.Join(dir, "fixture.toml")
+	if _, err := toml.DecodeFile(file, &m); err != nil {
+		return Fixture{}, fmt.Errorf("unable to decode %s\n%w", file, err)
+	}
+
+	f := Fixture{
+		Phase:           m.Phase,
+		Extension:       m.Extension,
+		ApplicationPath: filepath.Join(dir, "application"),
+		BuildpackPath:   filepath.Join(dir, "buildpack"),
+		LayersPath:      filepath.Join(dir, "layers"),
+		OutputPath:      filepath.Join(dir, "output"),
+		PlatformPath:    filepath.Join(dir, "platform"),
+	}
+
+	for _, d := range []string{f.ApplicationPath, f.BuildpackPath, f.LayersPath, f.OutputPath, f.PlatformPath} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return Fixture{}, fmt.Errorf("unable to create %s\n%w", d, err)
+		}
+	}
+
+	directory := libcnb.EnvBuildpackDirectory
+	if f.Extension {
+		directory = libcnb.EnvExtensionDirectory
+	}
+
+	f.Environment = append(m.Environment,
+		fmt.Sprintf("%s=%s", directory, f.BuildpackPath),
+		fmt.Sprintf("%s=%s", libcnb.EnvLayersDirectory, f.LayersPath),
+		fmt.Sprintf("%s=%s", libcnb.EnvOutputDirectory, f.OutputPath),
+		fmt.Sprintf("%s=%s", libcnb.EnvPlatformDirectory, f.PlatformPath),
+		fmt.Sprintf("%s=%s", libcnb.EnvDetectPlanPath, filepath.Join(dir, "plan.toml")),
+		fmt.Sprintf("%s=%s", libcnb.EnvBuildPlanPath, filepath.Join(dir, "plan.toml")),
+	)
+
+	return f, nil
+}
+
+// Options returns the options that run a phase against the fixture's inputs rather than those of the process.
+func (f Fixture) Options() []libcnb.Option {
+	return []libcnb.Option{
+		libcnb.WithApplicationPath(f.ApplicationPath),
+		libcnb.WithEnvironment(f.Environment),
+	}
+}
+
+func captured(name string) bool {
+	for _, p := range capturedPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureEnvironmentDirectory copies the environment variable files in source to destination, redacting sensitive
+// values.
+func captureEnvironmentDirectory(source string, destination string) error {
+	entries, err := os.ReadDir(source)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read %s\n%w", source, err)
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		if sensitiveName.MatchString(e.Name()) {
+			if err := writeFile(filepath.Join(destination, e.Name()), Redacted); err != nil {
+				return err
+			}
+		} else if err := copyFile(filepath.Join(source, e.Name()), filepath.Join(destination, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// captureBindings copies the bindings in source to destination. The type and provider of each binding are kept, and
+// the values of all other entries are redacted.
+func captureBindings(source string, destination string) error {
+	bindings, err := os.ReadDir(source)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read %s\n%w", source, err)
+	}
+
+	for _, b := range bindings {
+		if !b.IsDir() {
+			continue
+		}
+
+		entries, err := os.ReadDir(filepath.Join(source, b.Name()))
+		if err != nil {
+			return fmt.Errorf("unable to read binding %s\n%w", b.Name(), err)
+		}
+
+		for _, e := range entries {
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+
+			from, to := filepath.Join(source, b.Name(), e.Name()), filepath.Join(destination, b.Name(), e.Name())
+			if e.Name() == "type" || e.Name() == "provider" {
+				err = copyFile(from, to)
+			} else {
+				err = writeFile(to, Redacted)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies source to destination if source exists.
+func copyFile(source string, destination string) error {
+	b, err := os.ReadFile(source)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read %s\n%w", source, err)
+	}
+
+	return writeFile(destination, string(b))
+}
+
+func writeFile(path string, contents string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create %s\n%w", filepath.Dir(path), err)
+	}
+
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		return fmt.Errorf("unable to write %s\n%w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fixture_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/fixture"
+	"github.com/buildpacks/libcnb/v2/log"
+)
+
+func testFixture(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		buildpackPath string
+		environ       []string
+		planPath      string
+		platformPath  string
+	)
+
+	writeFile := func(path string, contents string) {
+		t.Helper()
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+	}
+
+	it.Before(func() {
+		buildpackPath = t.TempDir()
+		planPath = filepath.Join(t.TempDir(), "plan.toml")
+		platformPath = t.TempDir()
+
+		writeFile(filepath.Join(buildpackPath, "buildpack.toml"), `
+api = "0.8"
+
+[buildpack]
+id = "test-id"
+version = "1.1.1"
+`)
+		writeFile(filepath.Join(buildpackPath, "bin", "build"), "test-binary")
+		writeFile(planPath, `
+[[entries]]
+name = "test-entry"
+`)
+		writeFile(filepath.Join(platformPath, "env", "BP_TEST_KEY"), "test-value")
+		writeFile(filepath.Join(platformPath, "env", "GITHUB_TOKEN"), "test-secret")
+		writeFile(filepath.Join(platformPath, "bindings", "test-binding", "type"), "test-type")
+		writeFile(filepath.Join(platformPath, "bindings", "test-binding", "provider"), "test-provider")
+		writeFile(filepath.Join(platformPath, "bindings", "test-binding", "username"), "test-username")
+
+		environ = []string{
+			"CNB_BUILDPACK_DIR=" + buildpackPath,
+			"CNB_BP_PLAN_PATH=" + planPath,
+			"CNB_LAYERS_DIR=/layers",
+			"CNB_PLATFORM_DIR=" + platformPath,
+			"CNB_PLATFORM_API=0.12",
+			"BP_LOG_LEVEL=DEBUG",
+			"BP_REGISTRY_PASSWORD=test-secret",
+			"HOME=/home/test",
+		}
+	})
+
+	it("captures and replays a build", func() {
+		var b bytes.Buffer
+		Expect(fixture.Capture(&b, libcnb.PhaseBuild, environ)).To(Succeed())
+
+		dir := t.TempDir()
+		f, err := fixture.Replay(&b, dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(f.Phase).To(Equal(libcnb.PhaseBuild))
+		Expect(f.Extension).To(BeFalse())
+		Expect(f.ApplicationPath).To(BeADirectory())
+		Expect(f.LayersPath).To(BeADirectory())
+		Expect(filepath.Join(f.BuildpackPath, "buildpack.toml")).To(BeARegularFile())
+		Expect(filepath.Join(f.BuildpackPath, "bin")).NotTo(BeAnExistingFile())
+		Expect(f.Environment).To(ContainElements(
+			"BP_LOG_LEVEL=DEBUG",
+			"BP_REGISTRY_PASSWORD=<redacted>",
+			"CNB_PLATFORM_API=0.12",
+			"CNB_BUILDPACK_DIR="+f.BuildpackPath,
+			"CNB_LAYERS_DIR="+f.LayersPath,
+		))
+		Expect(f.Environment).NotTo(ContainElement(HavePrefix("HOME=")))
+		Expect(f.Environment).NotTo(ContainElement("CNB_LAYERS_DIR=/layers"))
+
+		var ctx libcnb.BuildContext
+		libcnb.Build(func(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+			ctx = context
+			return libcnb.NewBuildResult(), nil
+		}, libcnb.NewConfig(append(f.Options(),
+			libcnb.WithArguments([]string{filepath.Join(f.BuildpackPath, "bin", "build")}),
+			libcnb.WithLogger(log.NewDiscard()))...),
+		)
+
+		Expect(ctx.ApplicationPath).To(Equal(f.ApplicationPath))
+		Expect(ctx.Buildpack.Info.ID).To(Equal("test-id"))
+		Expect(ctx.Plan.Entries).To(Equal([]libcnb.BuildpackPlanEntry{{Name: "test-entry"}}))
+		Expect(ctx.Platform.API).To(Equal("0.12"))
+		Expect(ctx.Platform.Environment).To(Equal(map[string]string{
+			"BP_TEST_KEY":  "test-value",
+			"GITHUB_TOKEN": "<redacted>",
+		}))
+		Expect(ctx.Platform.Bindings).To(HaveLen(1))
+		Expect(ctx.Platform.Bindings[0].Type).To(Equal("test-type"))
+		Expect(ctx.Platform.Bindings[0].Provider).To(Equal("test-provider"))
+		Expect(ctx.Platform.Bindings[0].Secret).To(Equal(map[string]string{"username": "<redacted>"}))
+	})
+
+	it("captures an extension", func() {
+		extensionPath := t.TempDir()
+		writeFile(filepath.Join(extensionPath, "extension.toml"), `api = "0.8"`)
+
+		var b bytes.Buffer
+		Expect(fixture.Capture(&b, libcnb.PhaseGenerate, []string{"CNB_EXTENSION_DIR=" + extensionPath})).To(Succeed())
+
+		f, err := fixture.Replay(&b, t.TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(f.Phase).To(Equal(libcnb.PhaseGenerate))
+		Expect(f.Extension).To(BeTrue())
+		Expect(filepath.Join(f.BuildpackPath, "extension.toml")).To(BeARegularFile())
+		Expect(f.Environment).To(ContainElement("CNB_EXTENSION_DIR=" + f.BuildpackPath))
+	})
+}
@@ -17,16 +17,24 @@
 package libcnb
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"text/template"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/Masterminds/semver"
 
-	"github.com/buildpacks/libcnb/v2/internal"
 	"github.com/buildpacks/libcnb/v2/log"
+	"github.com/buildpacks/libcnb/v2/reproducible"
 )
 
 // GenerateContext contains the inputs to generate.
@@ -38,6 +46,10 @@ type GenerateContext struct {
 	// Extension is metadata about the extension, from extension.toml.
 	Extension Extension
 
+	// BuildpackFS is the extension's files. It is the file system set with WithBuildpackFS, or the extension directory
+	// if none is set.
+	BuildpackFS fs.FS
+
 	// OutputDirectory is the location Dockerfiles should be written to.
 	OutputDirectory string
 
@@ -58,6 +70,18 @@ type GenerateContext struct {
 
 	// Deprecated: StackID is the ID of the stack.
 	StackID string
+
+	// Phase is the lifecycle phase that invoked the extension, PhaseGenerate.
+	Phase Phase
+
+	// InvokedAt is the time the phase was invoked.
+	InvokedAt time.Time
+
+	// Arguments are the arguments the extension was invoked with.
+	Arguments []string
+
+	// Context is canceled when the phase times out, as set with WithTimeout. Long-running work should observe it.
+	Context context.Context
 }
 
 // GenerateResult contains the results of detection.
@@ -70,6 +94,11 @@ type GenerateResult struct {
 	Config          *ExtendConfig
 }
 
+// isEmpty returns true if the result has no effect on the build.
+func (g GenerateResult) isEmpty() bool {
+	return len(g.Unmet) == 0 && len(g.RunDockerfile) == 0 && len(g.BuildDockerfile) == 0
+}
+
 // DockerfileArg is a Dockerfile argument
 type DockerfileArg struct {
 	Name  string `toml:"name"`
@@ -109,9 +138,10 @@ func Generate(generate GenerateFunc, config Config) {
 		file string
 		ok   bool
 	)
-	ctx := GenerateContext{Logger: config.logger}
+	ctx := GenerateContext{Logger: config.contextLogger, Phase: PhaseGenerate, InvokedAt: time.Now(), Arguments: config.arguments}
+	env := config.environmentOrProcess()
 
-	ctx.ApplicationPath, err = os.Getwd()
+	ctx.ApplicationPath, err = config.applicationPathOrWd()
 	if err != nil {
 		config.exitHandler.Error(fmt.Errorf("unable to get working directory\n%w", err))
 		return
@@ -123,12 +153,13 @@ func Generate(generate GenerateFunc, config Config) {
 		}
 	}
 
-	if s, ok := os.LookupEnv(EnvExtensionDirectory); ok {
+	if s, ok := env[EnvExtensionDirectory]; ok {
 		ctx.Extension.Path = filepath.Clean(s)
 	} else {
 		config.exitHandler.Error(fmt.Errorf("unable to get CNB_EXTENSION_DIR, not found"))
 		return
 	}
+	ctx.BuildpackFS = config.buildpackFSOrDir(ctx.Extension.Path)
 
 	if config.logger.IsDebugEnabled() {
 		if err := config.contentWriter.Write("Extension contents", ctx.Extension.Path); err != nil {
@@ -137,11 +168,13 @@ func Generate(generate GenerateFunc, config Config) {
 	}
 
 	file = filepath.Join(ctx.Extension.Path, "extension.toml")
-	if _, err = toml.DecodeFile(file, &ctx.Extension); err != nil && !os.IsNotExist(err) {
+	if err = decodeTOMLFile(file, &ctx.Extension); err != nil && !os.IsNotExist(err) {
 		config.exitHandler.Error(fmt.Errorf("unable to decode extension %s\n%w", file, err))
 		return
 	}
-	config.logger.Debugf("Extension: %+v", ctx.Extension)
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debug(config.contextFormatter.Extension(ctx.Extension))
+	}
 
 	API, err := semver.NewVersion(ctx.Extension.API)
 	if err != nil {
@@ -160,21 +193,23 @@ func Generate(generate GenerateFunc, config Config) {
 		return
 	}
 
-	outputDir, ok := os.LookupEnv(EnvOutputDirectory)
+	outputDir, ok := env[EnvOutputDirectory]
 	if !ok {
 		config.exitHandler.Error(fmt.Errorf("expected CNB_OUTPUT_DIR to be set"))
 		return
 	}
 	ctx.OutputDirectory = outputDir
 
-	ctx.Platform.Path, ok = os.LookupEnv(EnvPlatformDirectory)
+	ctx.Platform.Path, ok = env[EnvPlatformDirectory]
 	if !ok {
 		config.exitHandler.Error(fmt.Errorf("expected CNB_PLATFORM_DIR to be set"))
 		return
 	}
 
-	buildpackPlanPath, ok := os.LookupEnv(EnvBuildPlanPath)
-	if !ok {
+	ctx.Platform.API = env[EnvPlatformAPI]
+
+	buildpackPlanPath, ok := env[EnvBuildPlanPath]
+	if !ok && !config.hasBuildpackPlan() {
 		config.exitHandler.Error(fmt.Errorf("expected CNB_BP_PLAN_PATH to be set"))
 		return
 	}
@@ -185,77 +220,196 @@ func Generate(generate GenerateFunc, config Config) {
 		}
 	}
 
-	if ctx.Platform.Bindings, err = NewBindings(ctx.Platform.Path); err != nil {
+	if ctx.Platform.Bindings, err = newBindings(env, ctx.Platform.Path, config.platformBindingOptions()...); err != nil {
 		config.exitHandler.Error(fmt.Errorf("unable to read platform bindings %s\n%w", ctx.Platform.Path, err))
 		return
 	}
-	config.logger.Debugf("Platform Bindings: %+v", ctx.Platform.Bindings)
 
 	file = filepath.Join(ctx.Platform.Path, "env")
-	if ctx.Platform.Environment, err = internal.NewConfigMapFromPath(file); err != nil {
+	if ctx.Platform.Environment, err = config.readPlatformEnvironment(file); err != nil {
 		config.exitHandler.Error(fmt.Errorf("unable to read platform environment %s\n%w", file, err))
 		return
 	}
-	config.logger.Debugf("Platform Environment: %s", ctx.Platform.Environment)
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debug(config.contextFormatter.Platform(ctx.Platform))
+	}
 
-	if _, err = toml.DecodeFile(buildpackPlanPath, &ctx.Plan); err != nil && !os.IsNotExist(err) {
-		config.exitHandler.Error(fmt.Errorf("unable to decode buildpack plan %s\n%w", buildpackPlanPath, err))
+	if ctx.Plan, err = config.readBuildpackPlan(buildpackPlanPath); err != nil {
+		config.exitHandler.Error(err)
 		return
 	}
 	config.logger.Debugf("Buildpack Plan: %+v", ctx.Plan)
 
-	if ctx.StackID, ok = os.LookupEnv(EnvStackID); !ok {
+	if ctx.StackID, ok = env[EnvStackID]; !ok {
 		config.logger.Debug("CNB_STACK_ID not set")
 	} else {
 		config.logger.Debugf("Stack: %s", ctx.StackID)
 	}
 
-	if API.GreaterThan(semver.MustParse("0.9")) {
+	if APIFeatures(ctx.Extension.API).SupportsTargets {
 		ctx.TargetInfo = TargetInfo{}
-		ctx.TargetInfo.OS, _ = os.LookupEnv(EnvTargetOS)
-		ctx.TargetInfo.Arch, _ = os.LookupEnv(EnvTargetArch)
-		ctx.TargetInfo.Variant, _ = os.LookupEnv(EnvTargetArchVariant)
+		ctx.TargetInfo.OS, _ = env[EnvTargetOS]
+		ctx.TargetInfo.Arch, _ = env[EnvTargetArch]
+		ctx.TargetInfo.Variant, _ = env[EnvTargetArchVariant]
 		config.logger.Debugf("System: %+v", ctx.TargetInfo)
 
 		ctx.TargetDistro = TargetDistro{}
-		ctx.TargetDistro.Name, _ = os.LookupEnv(EnvTargetDistroName)
-		ctx.TargetDistro.Version, _ = os.LookupEnv(EnvTargetDistroVersion)
+		ctx.TargetDistro.Name, _ = env[EnvTargetDistroName]
+		ctx.TargetDistro.Version, _ = env[EnvTargetDistroVersion]
 		config.logger.Debugf("Distro: %+v", ctx.TargetDistro)
+
+		if err := validateTargets("extension.toml", ctx.Extension.Targets, ctx.TargetInfo, ctx.TargetDistro); err != nil {
+			if config.strictTargets {
+				config.exitHandler.Error(err)
+				return
+			}
+			log.Warnf(config.logger, "Warning: %s", err)
+		}
 	}
 
-	result, err := generate(ctx)
+	var cancel context.CancelFunc
+	ctx.Context, cancel = config.phaseContext()
+	defer cancel()
+
+	result, err := callWithTimeout(ctx.Context, config, PhaseGenerate, func() (GenerateResult, error) { return generate(ctx) })
 	if err != nil {
 		config.exitHandler.Error(err)
 		return
 	}
-	config.logger.Debugf("Result: %+v", result)
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debugf("Result: %+v", result)
+	}
 
-	if len(result.RunDockerfile) > 0 {
-		//nolint:gosec
-		if err := os.WriteFile(filepath.Join(ctx.OutputDirectory, "run.Dockerfile"), result.RunDockerfile, 0644); err != nil {
+	if result.isEmpty() {
+		err := fmt.Errorf("extension %s generated neither a build.Dockerfile, a run.Dockerfile nor unmet plan entries, "+
+			"so it has no effect on the build", ctx.Extension.Info.ID)
+		if config.strictGenerateResults {
 			config.exitHandler.Error(err)
 			return
 		}
+		log.Warnf(config.logger, "Warning: %s", err)
 	}
 
+	if len(result.RunDockerfile) > 0 {
+		if err := ValidateRunDockerfile(result.RunDockerfile); err != nil {
+			config.exitHandler.Error(err)
+			return
+		}
+	}
 	if len(result.BuildDockerfile) > 0 {
-		//nolint:gosec
-		if err := os.WriteFile(filepath.Join(ctx.OutputDirectory, "build.Dockerfile"), result.BuildDockerfile, 0644); err != nil {
+		if err := ValidateBuildDockerfile(result.BuildDockerfile); err != nil {
 			config.exitHandler.Error(err)
 			return
 		}
 	}
 
+	var outputs []generateOutput
+	if len(result.RunDockerfile) > 0 {
+		outputs = append(outputs, generateOutput{name: "run.Dockerfile", content: result.RunDockerfile})
+	}
+	if len(result.BuildDockerfile) > 0 {
+		outputs = append(outputs, generateOutput{name: "build.Dockerfile", content: result.BuildDockerfile})
+	}
 	if result.Config != nil {
-		configFile, err := os.Create(filepath.Join(ctx.OutputDirectory, "extend-config.toml"))
-		if err != nil {
+		b := &bytes.Buffer{}
+		if err := toml.NewEncoder(b).Encode(result.Config); err != nil {
 			config.exitHandler.Error(err)
 			return
 		}
+		outputs = append(outputs, generateOutput{name: "extend-config.toml", content: b.Bytes()})
+	}
 
-		if err := toml.NewEncoder(configFile).Encode(result.Config); err != nil {
+	if config.outputSink != nil {
+		if err := writeGenerateOutputs(config.outputSink, outputs, config.lookupEnv); err != nil {
+			config.exitHandler.Error(fmt.Errorf("unable to write outputs to sink\n%w", err))
+		}
+		return
+	}
+
+	for _, o := range outputs {
+		//nolint:gosec
+		if err := os.WriteFile(filepath.Join(ctx.OutputDirectory, o.name), o.content, 0644); err != nil {
 			config.exitHandler.Error(err)
 			return
 		}
 	}
+
+	if err := reproducible.Touch(ctx.OutputDirectory, config.lookupEnv); err != nil {
+		config.exitHandler.Error(err)
+		return
+	}
+}
+
+// generateOutput is a file written by Generate to the output directory.
+type generateOutput struct {
+	name    string
+	content []byte
+}
+
+// writeGenerateOutputs writes outputs to w as an uncompressed tar archive. If $SOURCE_DATE_EPOCH is set, it is used as
+// the modification time of every entry, otherwise the Unix epoch is.
+func writeGenerateOutputs(w io.Writer, outputs []generateOutput, lookup func(string) (string, bool)) error {
+	modTime, ok, err := reproducible.SourceDateEpoch(lookup)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		modTime = time.Unix(0, 0)
+	}
+
+	tw := tar.NewWriter(w)
+	for _, o := range outputs {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     o.name,
+			Mode:     0644,
+			Size:     int64(len(o.content)),
+			ModTime:  modTime,
+			Format:   tar.FormatPAX,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(o.content); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// validateTargets returns an error if targets are declared in file and none of them matches the target info and
+// distro. Targets are not validated when the target info is unknown.
+func validateTargets(file string, targets []Target, info TargetInfo, distro TargetDistro) error {
+	if len(targets) == 0 || (info.OS == "" && info.Arch == "") {
+		return nil
+	}
+
+	for _, t := range targets {
+		if t.Matches(info, distro) {
+			return nil
+		}
+	}
+
+	s := info.String()
+	if distro.Name != "" {
+		s = fmt.Sprintf("%s (%s %s)", s, distro.Name, distro.Version)
+	}
+	return fmt.Errorf("%s declares no target matching %s", file, s)
+}
+
+// RenderDockerfile renders the text/template at name in fsys, such as an extension's BuildpackFS, with the given data,
+// for use as GenerateResult.BuildDockerfile or GenerateResult.RunDockerfile. Templates can call the same functions as
+// those rendered by Layer.RenderTemplate, with env looking up variables in the process environment.
+func RenderDockerfile(fsys fs.FS, name string, data interface{}) ([]byte, error) {
+	t, err := template.New(path.Base(name)).Funcs(templateFuncs(nil)).ParseFS(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Dockerfile template %s\n%w", name, err)
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("unable to render Dockerfile template %s\n%w", name, err)
+	}
+
+	return b.Bytes(), nil
 }
@@ -17,13 +17,19 @@
 package libcnb_test
 
 import (
+	"archive/tar"
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"text/template"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
@@ -269,12 +275,27 @@ version = "1.1.1"
 			}
 		})
 
+		it("uses application path option", func() {
+			path := t.TempDir()
+
+			libcnb.Generate(generateFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithApplicationPath(path)),
+			)
+
+			Expect(ctx.ApplicationPath).To(Equal(path))
+		})
+
 		it("creates context", func() {
 			libcnb.Generate(generateFunc,
 				libcnb.NewConfig(
 					libcnb.WithArguments([]string{commandPath})),
 			)
 			Expect(ctx.ApplicationPath).To(Equal(applicationPath))
+			Expect(ctx.Phase).To(Equal(libcnb.PhaseGenerate))
+			Expect(ctx.InvokedAt).To(BeTemporally("~", time.Now(), time.Minute))
+			Expect(ctx.Arguments).To(Equal([]string{commandPath}))
 			Expect(ctx.Extension).To(Equal(libcnb.Extension{
 				API: "0.8",
 				Info: libcnb.ExtensionInfo{
@@ -373,6 +394,161 @@ version = "1.1.1"
 			Expect(ctx.TargetDistro.Name).To(Equal("ubuntu"))
 			Expect(ctx.TargetDistro.Version).To(Equal("24.04"))
 		})
+
+		it("does not warn when the target matches a declared target", func() {
+			out := &bytes.Buffer{}
+			libcnb.Generate(generateFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out)),
+					libcnb.WithStrictTargets(),
+				),
+			)
+
+			Expect(out.String()).NotTo(ContainSubstring("declares no target"))
+			Expect(exitHandler.Calls).To(BeEmpty())
+		})
+
+		it("warns when the target matches no declared target", func() {
+			t.Setenv("CNB_TARGET_ARCH", "arm64")
+			t.Setenv("CNB_TARGET_ARCH_VARIANT", "")
+
+			out := &bytes.Buffer{}
+			libcnb.Generate(generateFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out)),
+				),
+			)
+
+			Expect(out.String()).To(ContainSubstring("Warning: extension.toml declares no target matching linux/arm64 (ubuntu 24.04)"))
+			Expect(exitHandler.Calls).To(BeEmpty())
+		})
+
+		it("fails in strict mode when the target matches no declared target", func() {
+			t.Setenv("CNB_TARGET_ARCH", "arm64")
+			t.Setenv("CNB_TARGET_ARCH_VARIANT", "")
+
+			libcnb.Generate(generateFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithStrictTargets(),
+				),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("extension.toml declares no target matching linux/arm64 (ubuntu 24.04)"))
+		})
+	})
+
+	it("decodes the buildpack plan from a reader", func() {
+		var ctx libcnb.GenerateContext
+		generateFunc = func(context libcnb.GenerateContext) (libcnb.GenerateResult, error) {
+			ctx = context
+			return libcnb.NewGenerateResult(), nil
+		}
+
+		libcnb.Generate(generateFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+				libcnb.WithBuildpackPlanReader(strings.NewReader("[[entries]]\nname = \"other-name\"\n"))),
+		)
+
+		Expect(exitHandler.Calls).To(BeEmpty())
+		Expect(ctx.Plan).To(Equal(libcnb.BuildpackPlan{Entries: []libcnb.BuildpackPlanEntry{{Name: "other-name"}}}))
+	})
+
+	it("fails to decode an invalid buildpack plan from a reader", func() {
+		libcnb.Generate(generateFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+				libcnb.WithBuildpackPlanReader(strings.NewReader("test-value"))),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError(HavePrefix("unable to decode buildpack plan\n")))
+	})
+
+	context("empty result", func() {
+		it("warns when the result has no effect", func() {
+			out := &bytes.Buffer{}
+			libcnb.Generate(generateFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out)),
+				),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			Expect(out.String()).To(ContainSubstring("Warning: extension test-id generated neither a build.Dockerfile, " +
+				"a run.Dockerfile nor unmet plan entries, so it has no effect on the build"))
+		})
+
+		it("fails when strict", func() {
+			libcnb.Generate(generateFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.NewDiscard()),
+					libcnb.WithStrictGenerateResults(),
+				),
+			)
+
+			Expect(exitHandler.Calls[0].Arguments.Error(0)).To(MatchError(ContainSubstring("so it has no effect on the build")))
+		})
+
+		it("does not warn when plan entries are unmet", func() {
+			generateFunc = func(libcnb.GenerateContext) (libcnb.GenerateResult, error) {
+				result := libcnb.NewGenerateResult()
+				result.Unmet = []libcnb.UnmetPlanEntry{{Name: "test-entry"}}
+				return result, nil
+			}
+
+			out := &bytes.Buffer{}
+			libcnb.Generate(generateFunc,
+				libcnb.NewConfig(
+					libcnb.WithArguments([]string{commandPath}),
+					libcnb.WithExitHandler(exitHandler),
+					libcnb.WithLogger(log.New(out)),
+					libcnb.WithStrictGenerateResults(),
+				),
+			)
+
+			Expect(exitHandler.Calls).To(BeEmpty())
+			Expect(out.String()).NotTo(ContainSubstring("no effect"))
+		})
+	})
+
+	it("exposes the extension directory as BuildpackFS", func() {
+		var ctx libcnb.GenerateContext
+		generateFunc = func(context libcnb.GenerateContext) (libcnb.GenerateResult, error) {
+			ctx = context
+			return libcnb.NewGenerateResult(), nil
+		}
+
+		libcnb.Generate(generateFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithLogger(log.NewDiscard()),
+			),
+		)
+
+		Expect(fs.ReadFile(ctx.BuildpackFS, "extension.toml")).NotTo(BeEmpty())
+	})
+
+	it("renders Dockerfile templates", func() {
+		fsys := fstest.MapFS{"templates/run.Dockerfile": {Data: []byte("FROM {{ .Image }}\n")}}
+
+		Expect(libcnb.RenderDockerfile(fsys, "templates/run.Dockerfile", map[string]string{"Image": "test-image"})).
+			To(Equal([]byte("FROM test-image\n")))
 	})
 
 	it("fails if CNB_EXTENSION_DIR is not set", func() {
@@ -403,10 +579,27 @@ version = "1.1.1"
 		Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("test-error"))
 	})
 
+	it("defaults the arguments of a generate config to the process arguments", func() {
+		var ctx libcnb.GenerateContext
+		generateFunc = func(context libcnb.GenerateContext) (libcnb.GenerateResult, error) {
+			ctx = context
+			return libcnb.NewGenerateResult(), nil
+		}
+
+		libcnb.Generate(generateFunc,
+			libcnb.NewGenerateConfig(
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(ctx.Arguments).To(Equal(os.Args))
+	})
+
 	it("writes Dockerfiles", func() {
 		generateFunc = func(_ libcnb.GenerateContext) (libcnb.GenerateResult, error) {
 			result := libcnb.NewGenerateResult()
-			result.BuildDockerfile = []byte(`FROM foo:latest`)
+			result.BuildDockerfile = []byte("ARG base_image\nFROM ${base_image}\nRUN echo foo\n")
 			result.RunDockerfile = []byte(`FROM bar:latest`)
 			return result, nil
 		}
@@ -422,6 +615,124 @@ version = "1.1.1"
 		Expect(filepath.Join(outputPath, "run.Dockerfile")).To(BeARegularFile())
 	})
 
+	it("writes outputs to a sink", func() {
+		t.Setenv("SOURCE_DATE_EPOCH", "1000")
+
+		generateFunc = func(_ libcnb.GenerateContext) (libcnb.GenerateResult, error) {
+			result := libcnb.NewGenerateResult()
+			result.BuildDockerfile = []byte("ARG base_image\nFROM ${base_image}\nRUN echo foo\n")
+			result.RunDockerfile = []byte(`FROM bar:latest`)
+			result.Config = &libcnb.ExtendConfig{Build: libcnb.BuildConfig{Args: []libcnb.DockerfileArg{{Name: "test-name", Value: "test-value"}}}}
+			return result, nil
+		}
+
+		sink := &bytes.Buffer{}
+		libcnb.Generate(generateFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, outputPath, platformPath, buildpackPlanPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithOutputSink(sink),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(exitHandler.Calls).To(BeEmpty())
+		Expect(filepath.Join(outputPath, "build.Dockerfile")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(outputPath, "run.Dockerfile")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(outputPath, "extend-config.toml")).NotTo(BeAnExistingFile())
+
+		files := map[string]string{}
+		tr := tar.NewReader(sink)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.ModTime.Unix()).To(Equal(int64(1000)))
+
+			b, err := io.ReadAll(tr)
+			Expect(err).NotTo(HaveOccurred())
+			files[header.Name] = string(b)
+		}
+
+		Expect(files).To(HaveKeyWithValue("run.Dockerfile", "FROM bar:latest"))
+		Expect(files).To(HaveKeyWithValue("build.Dockerfile", "ARG base_image\nFROM ${base_image}\nRUN echo foo\n"))
+		Expect(files).To(HaveKeyWithValue("extend-config.toml", ContainSubstring(`name = "test-name"`)))
+	})
+
+	it("does not write Dockerfiles that violate the specification", func() {
+		generateFunc = func(_ libcnb.GenerateContext) (libcnb.GenerateResult, error) {
+			result := libcnb.NewGenerateResult()
+			result.BuildDockerfile = []byte("ARG base_image\nFROM ${base_image}\n")
+			result.RunDockerfile = []byte("FROM bar:latest\nRUN echo bar\n")
+			return result, nil
+		}
+
+		libcnb.Generate(generateFunc,
+			libcnb.NewConfig(
+				libcnb.WithArguments([]string{commandPath, outputPath, platformPath, buildpackPlanPath}),
+				libcnb.WithExitHandler(exitHandler),
+				libcnb.WithTOMLWriter(tomlWriter),
+				libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("run.Dockerfile does not follow the image extension specification\n" +
+			"  line 2: RUN is not allowed when switching the run image to bar:latest, only a single FROM instruction is"))
+		Expect(filepath.Join(outputPath, "build.Dockerfile")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(outputPath, "run.Dockerfile")).NotTo(BeAnExistingFile())
+	})
+
+	context("ValidateBuildDockerfile", func() {
+		it("accepts a Dockerfile extending the base image", func() {
+			Expect(libcnb.ValidateBuildDockerfile([]byte(`# syntax=docker/dockerfile:1
+ARG base_image
+FROM ${base_image}
+
+ARG build_id=0
+RUN echo ${build_id} \\
+  && echo done
+`))).To(Succeed())
+		})
+
+		it("reports each violation", func() {
+			err := libcnb.ValidateBuildDockerfile([]byte("FROM foo:latest\nRUN echo foo\nfrom bar:latest\n"))
+
+			var dockerfile *libcnb.DockerfileError
+			Expect(errors.As(err, &dockerfile)).To(BeTrue())
+			Expect(dockerfile.Name).To(Equal("build.Dockerfile"))
+			Expect(dockerfile.Findings).To(Equal([]libcnb.DockerfileFinding{
+				{Line: 1, Message: "ARG base_image must be declared before FROM"},
+				{Line: 1, Message: "FROM foo:latest must be FROM ${base_image}"},
+				{Line: 3, Message: "multi-stage builds are not allowed, only a single FROM instruction is"},
+			}))
+		})
+
+		it("reports a missing FROM", func() {
+			Expect(libcnb.ValidateBuildDockerfile([]byte("ARG base_image\n"))).
+				To(MatchError("build.Dockerfile does not follow the image extension specification\n  FROM ${base_image} is missing"))
+		})
+	})
+
+	context("ValidateRunDockerfile", func() {
+		it("accepts a Dockerfile switching the run image", func() {
+			Expect(libcnb.ValidateRunDockerfile([]byte("FROM example/run:latest\n"))).To(Succeed())
+		})
+
+		it("accepts a Dockerfile extending the run image", func() {
+			Expect(libcnb.ValidateRunDockerfile([]byte("ARG base_image\nFROM $base_image\nCOPY --chown=1000 app /app\n"))).To(Succeed())
+		})
+
+		it("reports copying from other images", func() {
+			err := libcnb.ValidateRunDockerfile([]byte("ARG base_image\nFROM ${base_image}\nCOPY --chown=1000 --from=example/tools /bin/tool /bin/tool\n"))
+
+			var dockerfile *libcnb.DockerfileError
+			Expect(errors.As(err, &dockerfile)).To(BeTrue())
+			Expect(dockerfile.Findings).To(Equal([]libcnb.DockerfileFinding{
+				{Line: 3, Message: "COPY --from is not allowed, files can only be copied from the build context"},
+			}))
+		})
+	})
+
 	it("writes extend-config.toml", func() {
 		generateFunc = func(_ libcnb.GenerateContext) (libcnb.GenerateResult, error) {
 			result := libcnb.NewGenerateResult()
@@ -0,0 +1,223 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultRegistry is the registry of image references that do not name one.
+const DefaultRegistry = "docker.io"
+
+var (
+	imageDomain     = regexp.MustCompile(`^(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?$`)
+	imageRepository = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	imageTag        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	imageDigest     = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+)
+
+// ImageReference is a parsed reference to an image, such as registry.example.com/repository:tag.
+type ImageReference struct {
+	// Registry is the registry of the image, or empty if the reference does not name one and DefaultRegistry applies.
+	Registry string
+
+	// Repository is the repository of the image.
+	Repository string
+
+	// Tag is the tag of the image, if any.
+	Tag string
+
+	// Digest is the digest of the image, if any.
+	Digest string
+}
+
+// ParseImageReference parses an image reference of the form [registry/]repository[:tag][@digest]. The first path
+// component is the registry if it contains a dot or a colon, or is localhost.
+func ParseImageReference(s string) (ImageReference, error) {
+	var r ImageReference
+
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, r.Digest = name[:i], name[i+1:]
+		if !imageDigest.MatchString(r.Digest) {
+			return ImageReference{}, fmt.Errorf("invalid image reference %q: invalid digest %q", s, r.Digest)
+		}
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, r.Tag = name[:i], name[i+1:]
+		if !imageTag.MatchString(r.Tag) {
+			return ImageReference{}, fmt.Errorf("invalid image reference %q: invalid tag %q", s, r.Tag)
+		}
+	}
+
+	if first, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		if !imageDomain.MatchString(first) {
+			return ImageReference{}, fmt.Errorf("invalid image reference %q: invalid registry %q", s, first)
+		}
+		r.Registry, name = first, rest
+	}
+
+	if !imageRepository.MatchString(name) {
+		return ImageReference{}, fmt.Errorf("invalid image reference %q: invalid repository %q", s, name)
+	}
+	r.Repository = name
+
+	return r, nil
+}
+
+// String returns the reference in the form it is parsed from.
+func (r ImageReference) String() string {
+	s := r.Repository
+	if r.Registry != "" {
+		s = r.Registry + "/" + s
+	}
+	if r.Tag != "" {
+		s = s + ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s = s + "@" + r.Digest
+	}
+	return s
+}
+
+// RegistryOrDefault returns the registry of the image, or DefaultRegistry if the reference does not name one.
+func (r ImageReference) RegistryOrDefault() string {
+	if r.Registry == "" {
+		return DefaultRegistry
+	}
+	return r.Registry
+}
+
+// WithTag returns the reference with the given tag and without a digest, as the digest identifies the image of the
+// previous tag.
+func (r ImageReference) WithTag(tag string) (ImageReference, error) {
+	if !imageTag.MatchString(tag) {
+		return ImageReference{}, fmt.Errorf("invalid tag %q", tag)
+	}
+
+	r.Tag, r.Digest = tag, ""
+	return r, nil
+}
+
+// TargetTag renders format, a text/template, with the fields OS, Arch, Variant, DistroName and DistroVersion of the
+// target, and returns the result if it is a valid tag. It is used to compute the tag of an image built for a target,
+// such as "{{ .DistroVersion }}-{{ .Arch }}".
+func TargetTag(format string, info TargetInfo, distro TargetDistro) (string, error) {
+	t, err := template.New("tag").Option("missingkey=error").Parse(format)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse tag format %q\n%w", format, err)
+	}
+
+	b := &bytes.Buffer{}
+	if err := t.Execute(b, struct {
+		OS            string
+		Arch          string
+		Variant       string
+		DistroName    string
+		DistroVersion string
+	}{info.OS, info.Arch, info.Variant, distro.Name, distro.Version}); err != nil {
+		return "", fmt.Errorf("unable to render tag format %q\n%w", format, err)
+	}
+
+	if !imageTag.MatchString(b.String()) {
+		return "", fmt.Errorf("tag format %q rendered invalid tag %q for target %s", format, b.String(), info)
+	}
+	return b.String(), nil
+}
+
+// RunImage is a run image an extension switches to, given by a reference and alternative references to the same image.
+type RunImage struct {
+	// Image is the reference of the run image.
+	Image string `toml:"image"`
+
+	// Mirrors are alternative references to the run image.
+	Mirrors []string `toml:"mirrors"`
+}
+
+// ForTarget returns the run image with the tag of its image and mirrors set to the tag rendered by TargetTag, so that
+// an extension can switch to the run image built for the target being built for.
+func (r RunImage) ForTarget(format string, info TargetInfo, distro TargetDistro) (RunImage, error) {
+	tag, err := TargetTag(format, info, distro)
+	if err != nil {
+		return RunImage{}, err
+	}
+
+	retag := func(s string) (string, error) {
+		ref, err := ParseImageReference(s)
+		if err != nil {
+			return "", err
+		}
+		if ref, err = ref.WithTag(tag); err != nil {
+			return "", err
+		}
+		return ref.String(), nil
+	}
+
+	image, err := retag(r.Image)
+	if err != nil {
+		return RunImage{}, err
+	}
+
+	result := RunImage{Image: image}
+	for _, m := range r.Mirrors {
+		mirror, err := retag(m)
+		if err != nil {
+			return RunImage{}, err
+		}
+		result.Mirrors = append(result.Mirrors, mirror)
+	}
+
+	return result, nil
+}
+
+// CheckRegistry checks that the registry of the image can be reached, by requesting the base of its registry API over
+// HTTPS. The registry is reachable if it responds with 200 OK or, when it requires authentication, 401 Unauthorized. If
+// client is nil, http.DefaultClient is used.
+func CheckRegistry(ctx context.Context, client *http.Client, ref ImageReference) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	registry := ref.RegistryOrDefault()
+	if registry == DefaultRegistry {
+		registry = "registry-1.docker.io"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://%s/v2/", registry), nil)
+	if err != nil {
+		return fmt.Errorf("unable to create request for registry %s\n%w", registry, err)
+	}
+	req.Header.Set("User-Agent", UserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach registry %s\n%w", registry, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("unable to reach registry %s: unexpected status %d", registry, resp.StatusCode)
+	}
+	return nil
+}
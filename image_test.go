@@ -0,0 +1,156 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	gocontext "context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func testImageReference(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		digest = "sha256:" + strings.Repeat("a", 64)
+	)
+
+	context("ParseImageReference", func() {
+		it("parses a repository", func() {
+			Expect(libcnb.ParseImageReference("paketobuildpacks/run")).To(Equal(libcnb.ImageReference{
+				Repository: "paketobuildpacks/run",
+			}))
+		})
+
+		it("parses a registry, tag and digest", func() {
+			Expect(libcnb.ParseImageReference("registry.example.com:5000/team/run:jammy@" + digest)).To(Equal(libcnb.ImageReference{
+				Registry:   "registry.example.com:5000",
+				Repository: "team/run",
+				Tag:        "jammy",
+				Digest:     digest,
+			}))
+		})
+
+		it("parses localhost as a registry", func() {
+			ref, err := libcnb.ParseImageReference("localhost/run:latest")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ref.Registry).To(Equal("localhost"))
+			Expect(ref.Repository).To(Equal("run"))
+		})
+
+		it("round-trips through String", func() {
+			for _, s := range []string{"run", "docker.io/library/run:1.0", "localhost:5000/run@" + digest} {
+				ref, err := libcnb.ParseImageReference(s)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ref.String()).To(Equal(s))
+			}
+		})
+
+		it("rejects invalid references", func() {
+			for _, s := range []string{"", "Upper/run", "run:", "run:-tag", "run@sha256:abc", "bad_host.com/run"} {
+				_, err := libcnb.ParseImageReference(s)
+				Expect(err).To(HaveOccurred(), s)
+			}
+		})
+	})
+
+	it("defaults the registry", func() {
+		Expect(libcnb.ImageReference{Repository: "run"}.RegistryOrDefault()).To(Equal(libcnb.DefaultRegistry))
+	})
+
+	it("replaces the tag and drops the digest", func() {
+		ref, err := libcnb.ImageReference{Repository: "run", Tag: "1", Digest: digest}.WithTag("2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ref.String()).To(Equal("run:2"))
+
+		_, err = ref.WithTag("bad tag")
+		Expect(err).To(MatchError(`invalid tag "bad tag"`))
+	})
+
+	context("TargetTag", func() {
+		info := libcnb.TargetInfo{OS: "linux", Arch: "arm64", Variant: "v8"}
+		distro := libcnb.TargetDistro{Name: "ubuntu", Version: "22.04"}
+
+		it("renders the tag", func() {
+			Expect(libcnb.TargetTag("{{ .DistroName }}-{{ .DistroVersion }}-{{ .Arch }}{{ .Variant }}", info, distro)).
+				To(Equal("ubuntu-22.04-arm64v8"))
+		})
+
+		it("rejects an invalid rendered tag", func() {
+			_, err := libcnb.TargetTag("{{ .OS }}/{{ .Arch }}", info, distro)
+			Expect(err).To(MatchError(`tag format "{{ .OS }}/{{ .Arch }}" rendered invalid tag "linux/arm64" for target linux/arm64/v8`))
+		})
+
+		it("rejects an unknown field", func() {
+			_, err := libcnb.TargetTag("{{ .Unknown }}", info, distro)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	it("switches a run image and its mirrors to a target", func() {
+		run := libcnb.RunImage{
+			Image:   "registry.example.com/run:latest@" + digest,
+			Mirrors: []string{"mirror.example.com/run", "run:latest"},
+		}
+
+		Expect(run.ForTarget("{{ .DistroVersion }}-{{ .Arch }}", libcnb.TargetInfo{OS: "linux", Arch: "amd64"}, libcnb.TargetDistro{Version: "22.04"})).
+			To(Equal(libcnb.RunImage{
+				Image:   "registry.example.com/run:22.04-amd64",
+				Mirrors: []string{"mirror.example.com/run:22.04-amd64", "run:22.04-amd64"},
+			}))
+	})
+
+	context("CheckRegistry", func() {
+		var (
+			server *httptest.Server
+			status int
+		)
+
+		it.Before(func() {
+			status = http.StatusUnauthorized
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v2/" || !strings.HasPrefix(r.Header.Get("User-Agent"), "libcnb/") {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(status)
+			}))
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		it("reaches a registry that requires authentication", func() {
+			ref := libcnb.ImageReference{Registry: strings.TrimPrefix(server.URL, "https://"), Repository: "run"}
+			Expect(libcnb.CheckRegistry(gocontext.Background(), server.Client(), ref)).To(Succeed())
+		})
+
+		it("fails on an unexpected status", func() {
+			status = http.StatusInternalServerError
+			ref := libcnb.ImageReference{Registry: strings.TrimPrefix(server.URL, "https://"), Repository: "run"}
+			Expect(libcnb.CheckRegistry(gocontext.Background(), server.Client(), ref)).To(MatchError(ContainSubstring("unexpected status 500")))
+		})
+	})
+}
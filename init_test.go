@@ -35,5 +35,21 @@ func TestUnit(t *testing.T) {
 	suite("ExecD", testExecD)
 	suite("BuildpackTOML", testBuildpackTOML)
 	suite("ExtensionTOML", testExtensionTOML)
+	suite("LaunchTOML", testLaunchTOML)
+	suite("BuildTOML", testBuildTOML)
+	suite("Process", testProcess)
+	suite("Store", testStore)
+	suite("Dependency", testDependency)
+	suite("Signature", testSignature)
+	suite("Verify", testVerify)
+	suite("SharedState", testSharedState)
+	suite("Decode", testDecode)
+	suite("CACertificates", testCACertificates)
+	suite("APIFeatures", testAPIFeatures)
+	suite("BuildpackPlan", testBuildpackPlan)
+	suite("ProjectMetadata", testProjectMetadata)
+	suite("Metadata", testMetadata)
+	suite("LaunchEnvironment", testLaunchEnvironment)
+	suite("ImageReference", testImageReference)
 	suite.Run(t)
 }
@@ -18,6 +18,7 @@ package internal
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,31 +27,109 @@ import (
 // ConfigMap represents a file-based projection of a collection of key-value pairs.
 type ConfigMap map[string]string
 
+// ConfigMapOptions configures how a ConfigMap is read from subdirectories.
+type ConfigMapOptions struct {
+	// Depth is the number of levels of subdirectories to read. Zero ignores subdirectories and a negative depth reads
+	// all levels.
+	Depth int
+
+	// Delimiter joins the directory names and file name of files in subdirectories into a key.
+	Delimiter string
+
+	// MaxFileSize is the maximum size, in bytes, of a file. Files of any size are read if it is zero or negative.
+	MaxFileSize int64
+}
+
 // NewConfigMapFromPath creates a new ConfigMap from the files located within a given path.
 func NewConfigMapFromPath(path string) (ConfigMap, error) {
+	return NewConfigMapFromPathWithOptions(path, ConfigMapOptions{})
+}
+
+// NewConfigMapFromPathWithOptions creates a new ConfigMap from the files located within a given path, including files
+// in subdirectories as configured by the options. Files that are not regular files, such as devices, sockets and named
+// pipes, are ignored. An error is returned if a file is larger than the maximum size, if one is set, or if a symlink creates a loop
+// between subdirectories, so that a malformed directory cannot exhaust memory or hang the caller.
+func NewConfigMapFromPathWithOptions(path string, options ConfigMapOptions) (ConfigMap, error) {
+	var ancestors []os.FileInfo
+	if root, err := os.Stat(path); err == nil {
+		ancestors = append(ancestors, root)
+	}
+
+	configMap := ConfigMap{}
+	if err := configMap.read(path, "", options.Depth, options.Delimiter, options.MaxFileSize, ancestors); err != nil {
+		return nil, err
+	}
+
+	return configMap, nil
+}
+
+func (c ConfigMap) read(path string, prefix string, depth int, delimiter string, maxFileSize int64, ancestors []os.FileInfo) error {
 	files, err := filepath.Glob(filepath.Join(path, "*"))
 	if err != nil {
-		return nil, fmt.Errorf("unable to glob %s\n%w", path, err)
+		return fmt.Errorf("unable to glob %s\n%w", path, err)
 	}
 
-	configMap := ConfigMap{}
 	for _, file := range files {
 		if strings.HasPrefix(filepath.Base(file), ".") {
 			// ignore hidden files
 			continue
 		}
 		if stat, err := os.Stat(file); err != nil {
-			return nil, fmt.Errorf("failed to stat file %s\n%w", file, err)
+			return fmt.Errorf("failed to stat file %s\n%w", file, err)
 		} else if stat.IsDir() {
+			if depth != 0 {
+				for _, a := range ancestors {
+					if os.SameFile(a, stat) {
+						return fmt.Errorf("unable to read directory %s\nsymlink loop detected", file)
+					}
+				}
+
+				if err := c.read(file, prefix+filepath.Base(file)+delimiter, depth-1, delimiter, maxFileSize, append(ancestors, stat)); err != nil {
+					return err
+				}
+			}
 			continue
+		} else if !stat.Mode().IsRegular() {
+			// ignore devices, sockets and named pipes
+			continue
+		} else if maxFileSize > 0 && stat.Size() > maxFileSize {
+			return fmt.Errorf("file %s is larger than the maximum of %d bytes", file, maxFileSize)
+		}
+
+		contents, err := readFile(file, maxFileSize)
+		if err != nil {
+			return err
 		}
+
+		c[prefix+filepath.Base(file)] = string(contents)
+	}
+
+	return nil
+}
+
+// readFile reads file, failing if it grows beyond maxFileSize bytes while being read when maxFileSize is positive.
+func readFile(file string, maxFileSize int64) ([]byte, error) {
+	if maxFileSize <= 0 {
 		contents, err := os.ReadFile(file)
 		if err != nil {
 			return nil, fmt.Errorf("unable to read file %s\n%w", file, err)
 		}
+		return contents, nil
+	}
 
-		configMap[filepath.Base(file)] = string(contents)
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s\n%w", file, err)
 	}
+	defer f.Close()
 
-	return configMap, nil
+	contents, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s\n%w", file, err)
+	}
+	if int64(len(contents)) > maxFileSize {
+		return nil, fmt.Errorf("file %s is larger than the maximum of %d bytes", file, maxFileSize)
+	}
+
+	return contents, nil
 }
@@ -19,6 +19,8 @@ package internal_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -27,7 +29,7 @@ import (
 	"github.com/buildpacks/libcnb/v2/internal"
 )
 
-func testConfigMap(t *testing.T, _ spec.G, it spec.S) {
+func testConfigMap(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
 
@@ -88,4 +90,71 @@ func testConfigMap(t *testing.T, _ spec.G, it spec.S) {
 
 		Expect(cm).To(BeEmpty())
 	})
+
+	context("subdirectories", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(path, "alpha", "bravo"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "test-key"), []byte("test-value"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "alpha", "test-key"), []byte("alpha-value"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "alpha", "bravo", "test-key"), []byte("bravo-value"), 0600)).To(Succeed())
+		})
+
+		it("reads subdirectories to a depth", func() {
+			cm, err := internal.NewConfigMapFromPathWithOptions(path, internal.ConfigMapOptions{Depth: 1, Delimiter: "."})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cm).To(Equal(internal.ConfigMap{
+				"test-key":       "test-value",
+				"alpha.test-key": "alpha-value",
+			}))
+		})
+
+		it("reads all subdirectories", func() {
+			cm, err := internal.NewConfigMapFromPathWithOptions(path, internal.ConfigMapOptions{Depth: -1, Delimiter: "/"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cm).To(Equal(internal.ConfigMap{
+				"test-key":             "test-value",
+				"alpha/test-key":       "alpha-value",
+				"alpha/bravo/test-key": "bravo-value",
+			}))
+		})
+	})
+
+	it("fails on files larger than the maximum size", func() {
+		Expect(os.WriteFile(filepath.Join(path, "test-key"), []byte("test-value"), 0600)).To(Succeed())
+
+		_, err := internal.NewConfigMapFromPathWithOptions(path, internal.ConfigMapOptions{MaxFileSize: 4})
+		Expect(err).To(MatchError(ContainSubstring("is larger than the maximum of 4 bytes")))
+
+		cm, err := internal.NewConfigMapFromPathWithOptions(path, internal.ConfigMapOptions{MaxFileSize: -1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm).To(Equal(internal.ConfigMap{"test-key": "test-value"}))
+	})
+
+	it("reads files of any size by default", func() {
+		contents := strings.Repeat("a", 11*1024*1024)
+		Expect(os.WriteFile(filepath.Join(path, "test-key"), []byte(contents), 0600)).To(Succeed())
+
+		cm, err := internal.NewConfigMapFromPath(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm["test-key"]).To(HaveLen(len(contents)))
+	})
+
+	it("ignores named pipes", func() {
+		Expect(syscall.Mkfifo(filepath.Join(path, "test-pipe"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "test-key"), []byte("test-value"), 0600)).To(Succeed())
+
+		cm, err := internal.NewConfigMapFromPath(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm).To(Equal(internal.ConfigMap{"test-key": "test-value"}))
+	})
+
+	it("fails on symlink loops", func() {
+		Expect(os.MkdirAll(filepath.Join(path, "alpha"), 0755)).To(Succeed())
+		Expect(os.Symlink("..", filepath.Join(path, "alpha", "loop"))).To(Succeed())
+
+		_, err := internal.NewConfigMapFromPathWithOptions(path, internal.ConfigMapOptions{Depth: -1, Delimiter: "."})
+		Expect(err).To(MatchError(ContainSubstring("symlink loop detected")))
+	})
 }
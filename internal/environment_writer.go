@@ -20,12 +20,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/buildpacks/libcnb/v2/reproducible"
 )
 
 // EnvironmentWriter is a type used to write an environment to file filesystem.
-type EnvironmentWriter struct{}
+type EnvironmentWriter struct {
+	// Lookup looks up $SOURCE_DATE_EPOCH. If nil, the process environment is used.
+	Lookup func(key string) (string, bool)
+}
 
 // Write creates the path directory, and creates a new file for each key with the value as the contents of each file.
+// If $SOURCE_DATE_EPOCH is set, the times of the directory and files are set to it.
 func (w EnvironmentWriter) Write(path string, environment map[string]string) error {
 	if len(environment) == 0 {
 		return nil
@@ -49,5 +55,13 @@ func (w EnvironmentWriter) Write(path string, environment map[string]string) err
 		}
 	}
 
-	return nil
+	return reproducible.Touch(path, lookup(w.Lookup))
+}
+
+// lookup returns l, or os.LookupEnv if l is nil.
+func lookup(l func(key string) (string, bool)) func(key string) (string, bool) {
+	if l == nil {
+		return os.LookupEnv
+	}
+	return l
 }
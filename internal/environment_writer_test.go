@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
@@ -79,4 +80,16 @@ func testEnvironmentWriter(t *testing.T, _ spec.G, it spec.S) {
 
 		Expect(path).NotTo(BeAnExistingFile())
 	})
+
+	it("sets the modification times from SOURCE_DATE_EPOCH", func() {
+		t.Setenv("SOURCE_DATE_EPOCH", "1000000000")
+
+		Expect(writer.Write(path, map[string]string{"some-proc/some-name": "some-content"})).To(Succeed())
+
+		for _, p := range []string{path, filepath.Join(path, "some-proc"), filepath.Join(path, "some-proc", "some-name")} {
+			info, err := os.Stat(p)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ModTime()).To(BeTemporally("==", time.Unix(1000000000, 0)))
+		}
+	})
 }
@@ -41,9 +41,7 @@ func WithExecDOutputWriter(writer io.Writer) ExecDOption {
 
 // NewExitHandler creates a new instance that calls os.Exit and writes to os.stderr.
 func NewExecDWriter(options ...ExecDOption) ExecDWriter {
-	h := ExecDWriter{
-		outputWriter: os.NewFile(3, "/dev/fd/3"),
-	}
+	h := ExecDWriter{}
 
 	for _, option := range options {
 		h = option(h)
@@ -58,5 +56,12 @@ func (e ExecDWriter) Write(value map[string]string) error {
 		return nil
 	}
 
-	return toml.NewEncoder(e.outputWriter).Encode(value)
+	w := e.outputWriter
+	if w == nil {
+		// fd 3 is only opened when writing, as the file closes it when garbage collected, which would close whatever
+		// else uses fd 3 in processes that create a writer without writing to it, such as tests.
+		w = os.NewFile(3, "/dev/fd/3")
+	}
+
+	return toml.NewEncoder(w).Encode(value)
 }
@@ -17,9 +17,13 @@
 package internal
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"io"
 	"os"
+	"strings"
+
+	"github.com/buildpacks/libcnb/v2/log"
 )
 
 const (
@@ -31,12 +35,28 @@ const (
 
 	// PassStatusCode is the status code returned for pass.
 	PassStatusCode = 0
+
+	// RetryableStatusCode is the status code returned for a retryable error.
+	RetryableStatusCode = 75
 )
 
+// ErrRetryable marks an error as transient, so that the platform may retry the phase.
+var ErrRetryable = errors.New("retryable failure")
+
+// UserFacingError is an error whose message is intended to be shown to the end user as-is.
+type UserFacingError struct {
+	Message string
+}
+
+func (u UserFacingError) Error() string {
+	return u.Message
+}
+
 // ExitHandler is the default implementation of the libcnb.ExitHandler interface.
 type ExitHandler struct {
-	exitFunc func(int)
-	writer   io.Writer
+	exitFunc  func(int)
+	writer    io.Writer
+	formatter func(error) []byte
 }
 
 // Option is a function for configuring an ExitHandler instance.
@@ -58,11 +78,76 @@ func WithExitHandlerWriter(writer io.Writer) Option {
 	}
 }
 
-// NewExitHandler creates a new instance that calls os.Exit and writes to os.stderr.
+// WithExitHandlerErrorFormatter creates an Option that configures how errors are formatted before they are written.
+func WithExitHandlerErrorFormatter(formatter func(error) []byte) Option {
+	return func(handler ExitHandler) ExitHandler {
+		handler.formatter = formatter
+		return handler
+	}
+}
+
+// PlainErrorFormatter formats an error as its message, or only the message of the user facing error it wraps, followed
+// by a newline.
+func PlainErrorFormatter(err error) []byte {
+	var u UserFacingError
+	if errors.As(err, &u) {
+		return []byte(u.Message + "\n")
+	}
+	return []byte(err.Error() + "\n")
+}
+
+// JSONError is an error formatted by JSONErrorFormatter.
+type JSONError struct {
+	// Code classifies the error: the code of the first error in the chain with an ErrorCode() string method, or
+	// "retryable", "user" or "error".
+	Code string `json:"code"`
+
+	// Message is the message of the error, as formatted by PlainErrorFormatter.
+	Message string `json:"message"`
+
+	// Remediation describes how to resolve the error, from the first error in the chain with a Remediation() string
+	// method.
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// JSONErrorFormatter formats an error as a single line JSONError, so that platforms parsing stderr can classify it.
+func JSONErrorFormatter(err error) []byte {
+	e := JSONError{Code: "error", Message: strings.TrimSuffix(string(PlainErrorFormatter(err)), "\n")}
+
+	var (
+		coded interface{ ErrorCode() string }
+		remed interface{ Remediation() string }
+		user  UserFacingError
+	)
+	switch {
+	case errors.As(err, &coded):
+		e.Code = coded.ErrorCode()
+	case errors.Is(err, ErrRetryable):
+		e.Code = "retryable"
+	case errors.As(err, &user):
+		e.Code = "user"
+	}
+	if errors.As(err, &remed) {
+		e.Remediation = remed.Remediation()
+	}
+
+	b, mErr := json.Marshal(e)
+	if mErr != nil {
+		return PlainErrorFormatter(err)
+	}
+	return append(b, '\n')
+}
+
+// NewExitHandler creates a new instance that calls os.Exit and writes to os.stderr. Errors are formatted with
+// PlainErrorFormatter, or with JSONErrorFormatter if $BP_LOG_FORMAT is log.FormatJSON.
 func NewExitHandler(options ...Option) ExitHandler {
 	h := ExitHandler{
-		exitFunc: os.Exit,
-		writer:   os.Stderr,
+		exitFunc:  os.Exit,
+		writer:    os.Stderr,
+		formatter: PlainErrorFormatter,
+	}
+	if strings.ToLower(os.Getenv(log.EnvLogFormat)) == log.FormatJSON {
+		h.formatter = JSONErrorFormatter
 	}
 
 	for _, option := range options {
@@ -73,7 +158,17 @@ func NewExitHandler(options ...Option) ExitHandler {
 }
 
 func (e ExitHandler) Error(err error) {
-	_, _ = fmt.Fprintln(e.writer, err)
+	formatter := e.formatter
+	if formatter == nil {
+		formatter = PlainErrorFormatter
+	}
+	_, _ = e.writer.Write(formatter(err))
+
+	if errors.Is(err, ErrRetryable) {
+		e.exitFunc(RetryableStatusCode)
+		return
+	}
+
 	e.exitFunc(ErrorStatusCode)
 }
 
@@ -19,6 +19,7 @@ package internal_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -27,7 +28,7 @@ import (
 	"github.com/buildpacks/libcnb/v2/internal"
 )
 
-func testExitHandler(t *testing.T, _ spec.G, it spec.S) {
+func testExitHandler(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
 
@@ -64,4 +65,69 @@ func testExitHandler(t *testing.T, _ spec.G, it spec.S) {
 		handler.Error(errors.New("test-message"))
 		Expect(b).To(ContainSubstring("test-message"))
 	})
+
+	it("exits with code 75 when the error is retryable", func() {
+		handler.Error(fmt.Errorf("unable to download\n%w", internal.ErrRetryable))
+		Expect(exitCode).To(Equal(75))
+		Expect(b.String()).To(Equal("unable to download\nretryable failure\n"))
+	})
+
+	it("writes only the message of a user facing error", func() {
+		handler.Error(fmt.Errorf("unable to build\n%w", internal.UserFacingError{Message: "test-message"}))
+		Expect(exitCode).To(Equal(1))
+		Expect(b.String()).To(Equal("test-message\n"))
+	})
+
+	context("JSON errors", func() {
+		it.Before(func() {
+			handler = internal.NewExitHandler(
+				internal.WithExitHandlerExitFunc(func(c int) { exitCode = c }),
+				internal.WithExitHandlerWriter(b),
+				internal.WithExitHandlerErrorFormatter(internal.JSONErrorFormatter),
+			)
+		})
+
+		it("writes the error as JSON", func() {
+			handler.Error(errors.New("test-message"))
+			Expect(exitCode).To(Equal(1))
+			Expect(b.String()).To(Equal(`{"code":"error","message":"test-message"}` + "\n"))
+		})
+
+		it("classifies retryable and user facing errors", func() {
+			handler.Error(fmt.Errorf("unable to download\n%w", internal.ErrRetryable))
+			handler.Error(fmt.Errorf("unable to build\n%w", internal.UserFacingError{Message: "test-message"}))
+			Expect(b.String()).To(Equal(`{"code":"retryable","message":"unable to download\nretryable failure"}` + "\n" +
+				`{"code":"user","message":"test-message"}` + "\n"))
+		})
+
+		it("uses the code and remediation of errors that provide them", func() {
+			handler.Error(fmt.Errorf("unable to build\n%w", remediableError{}))
+			Expect(b.String()).To(Equal(`{"code":"test-code","message":"unable to build\ntest-message","remediation":"test-remediation"}` + "\n"))
+		})
+	})
+
+	it("formats errors as JSON when BP_LOG_FORMAT is json", func() {
+		t.Setenv("BP_LOG_FORMAT", "json")
+		handler = internal.NewExitHandler(
+			internal.WithExitHandlerExitFunc(func(c int) { exitCode = c }),
+			internal.WithExitHandlerWriter(b),
+		)
+
+		handler.Error(errors.New("test-message"))
+		Expect(b.String()).To(Equal(`{"code":"error","message":"test-message"}` + "\n"))
+	})
+}
+
+type remediableError struct{}
+
+func (remediableError) Error() string {
+	return "test-message"
+}
+
+func (remediableError) ErrorCode() string {
+	return "test-code"
+}
+
+func (remediableError) Remediation() string {
+	return "test-remediation"
 }
@@ -22,14 +22,22 @@ import (
 	"path/filepath"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/buildpacks/libcnb/v2/reproducible"
 )
 
 // TOMLWriter is a type used to write TOML files to the filesystem.
-type TOMLWriter struct{}
+type TOMLWriter struct {
+	// Indent is the string used to indent nested tables. If nil, the encoder's default of two spaces is used.
+	Indent *string
+
+	// Lookup looks up $SOURCE_DATE_EPOCH. If nil, the process environment is used.
+	Lookup func(key string) (string, bool)
+}
 
-// Write creates the path's parent directories, and creates a new file or truncates an existing file and then marshals
-// the value to the file.
-func (TOMLWriter) Write(path string, value interface{}) error {
+// Write creates the path's parent directories and marshals the value to a temporary file in the same directory, which
+// then atomically replaces any existing file at path. If $SOURCE_DATE_EPOCH is set, the file's times are set to it.
+func (t TOMLWriter) Write(path string, value interface{}) error {
 	if value == nil {
 		return nil
 	}
@@ -39,11 +47,34 @@ func (TOMLWriter) Write(path string, value interface{}) error {
 		return fmt.Errorf("unable to mkdir %s\n%w", d, err)
 	}
 
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	file, err := os.CreateTemp(d, fmt.Sprintf(".%s-*", filepath.Base(path)))
 	if err != nil {
-		return fmt.Errorf("unable to open file %s\n%w", path, err)
+		return fmt.Errorf("unable to create temporary file in %s\n%w", d, err)
+	}
+	defer os.Remove(file.Name())
+
+	encoder := toml.NewEncoder(file)
+	if t.Indent != nil {
+		encoder.Indent = *t.Indent
+	}
+
+	if err := encoder.Encode(value); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return fmt.Errorf("unable to chmod file %s\n%w", file.Name(), err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("unable to close file %s\n%w", file.Name(), err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("unable to move %s to %s\n%w", file.Name(), path, err)
 	}
-	defer file.Close()
 
-	return toml.NewEncoder(file).Encode(value)
+	return reproducible.Touch(path, lookup(t.Lookup))
 }
@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
@@ -59,4 +60,23 @@ func testTOMLWriter(t *testing.T, _ spec.G, it spec.S) {
 some-field = "some-value"
 other-field = "other-value"`))
 	})
+
+	it("sets the modification time from SOURCE_DATE_EPOCH", func() {
+		t.Setenv("SOURCE_DATE_EPOCH", "1000000000")
+
+		Expect(tomlWriter.Write(path, map[string]string{"some-field": "some-value"})).To(Succeed())
+
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ModTime()).To(BeTemporally("==", time.Unix(1000000000, 0)))
+	})
+
+	it("uses the configured indent", func() {
+		indent := "\t"
+		tomlWriter = internal.TOMLWriter{Indent: &indent}
+
+		Expect(tomlWriter.Write(path, map[string]map[string]string{"table": {"some-field": "some-value"}})).To(Succeed())
+
+		Expect(os.ReadFile(path)).To(Equal([]byte("[table]\n\tsome-field = \"some-value\"\n")))
+	})
 }
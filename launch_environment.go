@@ -0,0 +1,149 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LaunchEnvironment returns the environment the lifecycle would launch a process of processType with, given the
+// contributed layers of the result and a base environment, so that authors can see why a variable has the value it has
+// at runtime before building an image. Launch layers are applied in order of their names, as the lifecycle applies the
+// layers of a buildpack. For each layer, its bin and lib directories are prepended to PATH and LD_LIBRARY_PATH if they
+// exist, and then the variables of SharedEnvironment, LaunchEnvironment and the process-specific variables of
+// LaunchEnvironment are applied. The environments of other buildpacks are not taken into account.
+func (b BuildResult) LaunchEnvironment(processType string, base map[string]string) map[string]string {
+	env := map[string]string{}
+	for k, v := range base {
+		env[k] = v
+	}
+
+	layers := make([]Layer, len(b.Layers))
+	copy(layers, b.Layers)
+	sort.SliceStable(layers, func(i, j int) bool { return layers[i].Name < layers[j].Name })
+
+	for _, l := range layers {
+		if !l.Launch {
+			continue
+		}
+
+		for dir, name := range map[string]string{"bin": "PATH", "lib": "LD_LIBRARY_PATH"} {
+			if info, err := os.Stat(filepath.Join(l.Path, dir)); err == nil && info.IsDir() {
+				env[name] = joinEnvironmentValues(filepath.Join(l.Path, dir), string(os.PathListSeparator), env[name])
+			}
+		}
+
+		applyEnvironment(env, l.SharedEnvironment, "")
+		applyEnvironment(env, l.LaunchEnvironment, "")
+		if processType != "" {
+			applyEnvironment(env, l.LaunchEnvironment, processType)
+		}
+	}
+
+	return env
+}
+
+// WriteLaunchEnvironments writes the environment, as computed by LaunchEnvironment, of each process type of the result
+// to w, with variables sorted by name. If the result has no processes, the environment common to all processes is
+// written.
+func (b BuildResult) WriteLaunchEnvironments(w io.Writer, base map[string]string) error {
+	var types []string
+	for _, p := range b.Processes {
+		types = append(types, p.Type)
+	}
+	if len(types) == 0 {
+		types = []string{""}
+	}
+
+	for _, t := range types {
+		title := fmt.Sprintf("process %s", t)
+		if t == "" {
+			title = "all processes"
+		}
+		if _, err := fmt.Fprintf(w, "Launch environment of %s:\n", title); err != nil {
+			return err
+		}
+
+		env := b.LaunchEnvironment(t, base)
+		var names []string
+		for k := range env {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, k := range names {
+			if _, err := fmt.Fprintf(w, "  %s=%s\n", k, env[k]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyEnvironment applies the variables of environment for processType, or those that are not process-specific if
+// processType is empty, to env in the order the lifecycle applies the files of an environment directory.
+func applyEnvironment(env map[string]string, environment Environment, processType string) {
+	var keys []string
+	for k := range environment {
+		dir, file := filepath.Split(k)
+		if filepath.Clean(dir) == processType || (dir == "" && processType == "") {
+			keys = append(keys, file)
+		}
+	}
+	sort.Strings(keys)
+
+	prefix := ""
+	if processType != "" {
+		prefix = processType + string(filepath.Separator)
+	}
+
+	for _, file := range keys {
+		value := environment[prefix+file]
+		name, action, ok := strings.Cut(file, ".")
+		if !ok {
+			action = "override"
+		}
+		delimiter := environment[prefix+name+".delim"]
+
+		switch action {
+		case "override":
+			env[name] = value
+		case "default":
+			if _, ok := env[name]; !ok {
+				env[name] = value
+			}
+		case "append":
+			env[name] = joinEnvironmentValues(env[name], delimiter, value)
+		case "prepend":
+			env[name] = joinEnvironmentValues(value, delimiter, env[name])
+		}
+	}
+}
+
+// joinEnvironmentValues joins two values with a delimiter, omitting the delimiter if either is empty.
+func joinEnvironmentValues(a string, delimiter string, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + delimiter + b
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func testLaunchEnvironment(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layersPath string
+		result     libcnb.BuildResult
+	)
+
+	it.Before(func() {
+		layersPath = t.TempDir()
+
+		jdk := libcnb.Layer{
+			Name:              "jdk",
+			Path:              filepath.Join(layersPath, "jdk"),
+			LayerTypes:        libcnb.LayerTypes{Launch: true},
+			SharedEnvironment: libcnb.Environment{},
+			LaunchEnvironment: libcnb.Environment{},
+		}
+		Expect(os.MkdirAll(filepath.Join(jdk.Path, "bin"), 0755)).To(Succeed())
+		jdk.SharedEnvironment.Override("JAVA_HOME", jdk.Path)
+		jdk.LaunchEnvironment.Default("JAVA_TOOL_OPTIONS", "-Xss1m")
+		jdk.LaunchEnvironment.ProcessOverride("worker", "JAVA_HOME", "/worker-jdk")
+
+		agent := libcnb.Layer{
+			Name:              "agent",
+			Path:              filepath.Join(layersPath, "agent"),
+			LayerTypes:        libcnb.LayerTypes{Launch: true},
+			SharedEnvironment: libcnb.Environment{},
+			LaunchEnvironment: libcnb.Environment{},
+		}
+		agent.LaunchEnvironment.Append("JAVA_TOOL_OPTIONS", " ", "-javaagent:agent.jar")
+
+		build := libcnb.Layer{
+			Name:              "build",
+			Path:              filepath.Join(layersPath, "build"),
+			LayerTypes:        libcnb.LayerTypes{Build: true},
+			SharedEnvironment: libcnb.Environment{},
+		}
+		build.SharedEnvironment.Override("JAVA_HOME", "/build-jdk")
+
+		result = libcnb.BuildResult{
+			Layers:    []libcnb.Layer{jdk, agent, build},
+			Processes: []libcnb.Process{{Type: "web"}, {Type: "worker"}},
+		}
+	})
+
+	it("merges launch layers in lifecycle order", func() {
+		Expect(result.LaunchEnvironment("web", map[string]string{"PATH": "/usr/bin"})).To(Equal(map[string]string{
+			"PATH":              filepath.Join(layersPath, "jdk", "bin") + string(os.PathListSeparator) + "/usr/bin",
+			"JAVA_HOME":         filepath.Join(layersPath, "jdk"),
+			"JAVA_TOOL_OPTIONS": "-javaagent:agent.jar",
+		}))
+	})
+
+	it("applies process-specific variables", func() {
+		Expect(result.LaunchEnvironment("worker", nil)).To(HaveKeyWithValue("JAVA_HOME", "/worker-jdk"))
+	})
+
+	it("writes the environment of each process type", func() {
+		b := &bytes.Buffer{}
+		Expect(result.WriteLaunchEnvironments(b, nil)).To(Succeed())
+
+		Expect(b.String()).To(Equal("Launch environment of process web:\n" +
+			"  JAVA_HOME=" + filepath.Join(layersPath, "jdk") + "\n" +
+			"  JAVA_TOOL_OPTIONS=-javaagent:agent.jar\n" +
+			"  PATH=" + filepath.Join(layersPath, "jdk", "bin") + "\n" +
+			"Launch environment of process worker:\n" +
+			"  JAVA_HOME=/worker-jdk\n" +
+			"  JAVA_TOOL_OPTIONS=-javaagent:agent.jar\n" +
+			"  PATH=" + filepath.Join(layersPath, "jdk", "bin") + "\n"))
+	})
+}
@@ -16,6 +16,10 @@
 
 package libcnb
 
+import (
+	"fmt"
+)
+
 // LaunchTOML represents the contents of launch.toml.
 type LaunchTOML struct {
 	// Labels is the collection of image labels contributed by the buildpack.
@@ -31,3 +35,13 @@ type LaunchTOML struct {
 func (l LaunchTOML) isEmpty() bool {
 	return len(l.Labels) == 0 && len(l.Processes) == 0 && len(l.Slices) == 0
 }
+
+// ReadLaunchTOML decodes the launch.toml file at the given path, as written by Build.
+func ReadLaunchTOML(path string) (LaunchTOML, error) {
+	var launch LaunchTOML
+	if err := decodeTOMLFile(path, &launch); err != nil {
+		return LaunchTOML{}, fmt.Errorf("unable to decode launch metadata %s\n%w", path, err)
+	}
+
+	return launch, nil
+}
@@ -17,13 +17,81 @@
 package libcnb
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
 
 	"github.com/BurntSushi/toml"
 )
 
+// templateFuncs returns the functions available to templates rendered by libcnb, in addition to the standard
+// functions. The env function looks up variables in environment or, if it is nil, the process environment.
+func templateFuncs(environment map[string]string) template.FuncMap {
+	env := os.Getenv
+	if environment != nil {
+		env = func(key string) string { return environment[key] }
+	}
+
+	return template.FuncMap{
+		"env":  env,
+		"join": strings.Join,
+	}
+}
+
+// lookupEnv looks up key in environment or, if it is nil, the process environment.
+func lookupEnv(environment map[string]string, key string) (string, bool) {
+	if environment == nil {
+		return os.LookupEnv(key)
+	}
+	v, ok := environment[key]
+	return v, ok
+}
+
+// Names of the files the lifecycle reads from the layers directory.
+const (
+	// BuildTOMLName is the name of the build metadata file.
+	BuildTOMLName = "build.toml"
+
+	// LaunchTOMLName is the name of the application metadata file.
+	LaunchTOMLName = "launch.toml"
+
+	// StoreTOMLName is the name of the persistent metadata file.
+	StoreTOMLName = "store.toml"
+
+	// LayerTOMLExtension is the extension of the metadata file of a layer, <layer>.toml.
+	LayerTOMLExtension = ".toml"
+)
+
+// reservedLayerNames are names that would collide with files the lifecycle reads from the layers directory.
+var reservedLayerNames = map[string]bool{"build": true, "launch": true, "store": true}
+
+// LayerTOMLName returns the name of the metadata file of the layer with the given name.
+func LayerTOMLName(name string) string {
+	return name + LayerTOMLExtension
+}
+
+// SBOMName returns the name of the SBOM file in the given format for the layer with the given name, or for the
+// buildpack's build or launch SBOM if name is "build" or "launch".
+func SBOMName(name string, bt SBOMFormat) string {
+	return fmt.Sprintf("%s.sbom.%s", name, bt)
+}
+
+// scratchDirectory is the directory, under the layers directory, containing the directories returned by
+// Layers.Scratch. It cannot collide with a layer, as its name is not a valid layer name.
+const scratchDirectory = ".scratch"
+
+// validLayerName matches layer names that are safe to use as both a directory and a <name>.toml file name.
+var validLayerName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
 const (
 	BOMFormatCycloneDXExtension = "cdx.json"
 	BOMFormatSPDXExtension      = "spdx.json"
@@ -50,6 +118,47 @@ func (e Exec) ProcessFilePath(processType string, name string) string {
 	return filepath.Join(e.Path, processType, name)
 }
 
+// Install copies the file at source in fsys, such as a buildpack's BuildpackFS, to the exec.d directory as an
+// executable with the given name.
+func (e Exec) Install(fsys fs.FS, source string, name string) error {
+	return copyFromFS(fsys, source, e.FilePath(name), 0755)
+}
+
+// ProcessInstall copies the file at source in fsys, such as a buildpack's BuildpackFS, to the exec.d directory of a
+// process type as an executable with the given name.
+func (e Exec) ProcessInstall(fsys fs.FS, source string, processType string, name string) error {
+	return copyFromFS(fsys, source, e.ProcessFilePath(processType, name), 0755)
+}
+
+// copyFromFS copies the file at source in fsys to destination, creating its parent directories.
+func copyFromFS(fsys fs.FS, source string, destination string, perm os.FileMode) error {
+	in, err := fsys.Open(source)
+	if err != nil {
+		return fmt.Errorf("unable to open %s\n%w", source, err)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s\n%w", filepath.Dir(destination), err)
+	}
+
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return fmt.Errorf("unable to open %s\n%w", destination, err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("unable to copy %s to %s\n%w", source, destination, err)
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("unable to close %s\n%w", destination, err)
+	}
+
+	return nil
+}
+
 // BOMFormat indicates the format of the SBOM entry
 type SBOMFormat int
 
@@ -89,6 +198,29 @@ func SBOMFormatFromString(from string) (SBOMFormat, error) {
 	return UnknownFormat, fmt.Errorf("unable to translate from %s to SBOMFormat", from)
 }
 
+// SBOMFormatFromMediaType returns the SBOMFormat with the given media type, as listed in the sbom-formats of
+// buildpack.toml.
+func SBOMFormatFromMediaType(mediaType string) (SBOMFormat, error) {
+	switch mediaType {
+	case CycloneDXJSON.MediaType():
+		return CycloneDXJSON, nil
+	case SPDXJSON.MediaType():
+		return SPDXJSON, nil
+	case SyftJSON.MediaType():
+		return SyftJSON, nil
+	}
+
+	return UnknownFormat, fmt.Errorf("unable to translate from media type %s to SBOMFormat", mediaType)
+}
+
+// SBOMDocument is the interface implemented by a software bill of materials that can be encoded in each SBOMFormat,
+// such as sbom.Document.
+type SBOMDocument interface {
+
+	// Encode returns the document encoded in format.
+	Encode(format SBOMFormat) ([]byte, error)
+}
+
 // Contribute represents a layer managed by the buildpack.
 type Layer struct {
 	// LayerTypes indicates the type of layer
@@ -114,6 +246,83 @@ type Layer struct {
 
 	// Exec is the exec.d executables set in the layer.
 	Exec Exec `toml:"-"`
+
+	// ignore are the patterns of the files removed from the layer before it is persisted.
+	ignore []string
+}
+
+// Ignore adds patterns of files that are removed from the layer before it is persisted, so that files such as test
+// fixtures and documentation are not shipped in the image. The specification has no way to exclude files from a layer
+// on export, so matching files are deleted. Patterns use the syntax of path.Match. A pattern without a slash matches
+// the name of a file or directory at any depth, and a pattern with a slash matches its path relative to the layer.
+// Matching directories are removed with their contents.
+func (l *Layer) Ignore(patterns ...string) {
+	l.ignore = append(l.ignore, patterns...)
+}
+
+// prune removes the files matching the ignore patterns from the layer with remove and returns their paths relative to
+// the layer.
+func (l Layer) prune(remove func(string) error) ([]string, error) {
+	for _, p := range l.ignore {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q\n%w", p, err)
+		}
+	}
+
+	if len(l.ignore) == 0 {
+		return nil, nil
+	}
+
+	var removed []string
+	err := filepath.WalkDir(l.Path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == l.Path {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if file == l.Path {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.Path, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !l.ignored(rel) {
+			return nil
+		}
+
+		if err := remove(file); err != nil {
+			return err
+		}
+		removed = append(removed, rel)
+
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to remove ignored files from layer %s\n%w", l.Name, err)
+	}
+
+	return removed, nil
+}
+
+func (l Layer) ignored(rel string) bool {
+	for _, p := range l.ignore {
+		name := rel
+		if !strings.Contains(p, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 func (l Layer) Reset() (Layer, error) {
@@ -141,9 +350,202 @@ func (l Layer) Reset() (Layer, error) {
 	return l, nil
 }
 
+// Difference is a value that differs between the metadata restored with a layer and the expected metadata.
+type Difference struct {
+	// Key is the dotted key of the value.
+	Key string
+
+	// Actual is the restored value, or nil if none was restored.
+	Actual interface{}
+
+	// Expected is the expected value, or nil if none is expected.
+	Expected interface{}
+}
+
+func (d Difference) String() string {
+	switch {
+	case d.Actual == nil:
+		return fmt.Sprintf("%s added %v", d.Key, d.Expected)
+	case d.Expected == nil:
+		return fmt.Sprintf("%s removed %v", d.Key, d.Actual)
+	default:
+		return fmt.Sprintf("%s changed %v → %v", d.Key, d.Actual, d.Expected)
+	}
+}
+
+// MetadataEquals decodes the layer's metadata into the type of expected, using its TOML tags, and compares it with
+// expected. It returns whether they are equal and, if not, the differences, sorted by key, so that the decision to
+// reuse or rebuild a restored layer can be logged:
+//
+//	if ok, diff, err := layer.MetadataEquals(metadata); err != nil {
+//		return libcnb.BuildResult{}, err
+//	} else if !ok {
+//		logger.Infof("%s changed, rebuilding", diff[0])
+//	}
+//
+// Keys in the metadata that are not part of the type of expected are ignored.
+func (l Layer) MetadataEquals(expected interface{}) (bool, []Difference, error) {
+	t := reflect.TypeOf(expected)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return false, nil, fmt.Errorf("unable to compare layer metadata with nil")
+	}
+
+	b := &bytes.Buffer{}
+	if err := toml.NewEncoder(b).Encode(l.Metadata); err != nil {
+		return false, nil, fmt.Errorf("unable to encode layer metadata\n%w", err)
+	}
+	restored := reflect.New(t)
+	if _, err := toml.NewDecoder(b).Decode(restored.Interface()); err != nil {
+		return false, nil, fmt.Errorf("unable to decode layer metadata\n%w", err)
+	}
+
+	actual, err := metadataMap(restored.Interface())
+	if err != nil {
+		return false, nil, err
+	}
+	wanted, err := metadataMap(expected)
+	if err != nil {
+		return false, nil, err
+	}
+
+	differences := metadataDifferences("", actual, wanted)
+	return len(differences) == 0, differences, nil
+}
+
+// metadataMap encodes v as TOML and decodes it as a map, so that values of different types are compared the same way.
+func metadataMap(v interface{}) (map[string]interface{}, error) {
+	b := &bytes.Buffer{}
+	if err := toml.NewEncoder(b).Encode(v); err != nil {
+		return nil, fmt.Errorf("unable to encode layer metadata\n%w", err)
+	}
+
+	m := map[string]interface{}{}
+	if _, err := toml.NewDecoder(b).Decode(&m); err != nil {
+		return nil, fmt.Errorf("unable to decode layer metadata\n%w", err)
+	}
+
+	return m, nil
+}
+
+// metadataDifferences returns the differences between actual and expected, with keys prefixed by prefix.
+func metadataDifferences(prefix string, actual map[string]interface{}, expected map[string]interface{}) []Difference {
+	keys := map[string]bool{}
+	for k := range actual {
+		keys[k] = true
+	}
+	for k := range expected {
+		keys[k] = true
+	}
+
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var differences []Difference
+	for _, k := range sorted {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		a, aOK := actual[k].(map[string]interface{})
+		e, eOK := expected[k].(map[string]interface{})
+		if aOK && eOK {
+			differences = append(differences, metadataDifferences(key, a, e)...)
+		} else if !reflect.DeepEqual(actual[k], expected[k]) {
+			differences = append(differences, Difference{Key: key, Actual: actual[k], Expected: expected[k]})
+		}
+	}
+
+	return differences
+}
+
+// RenderTemplate renders the text/template at name in fsys, such as a buildpack's BuildpackFS, with the given data to
+// destination, relative to the layer path. In addition to the standard functions, templates can call env to look up
+// an environment variable in the process environment and join to join a list of strings with a separator. Use
+// Layers.RenderTemplate to look up the environment a BuildContext was created with.
+func (l Layer) RenderTemplate(fsys fs.FS, name string, data interface{}, destination string) error {
+	return l.renderTemplate(nil, fsys, name, data, destination)
+}
+
+// RenderTemplateString behaves like RenderTemplate, parsing the template from text.
+func (l Layer) RenderTemplateString(text string, data interface{}, destination string) error {
+	return l.renderTemplateString(nil, text, data, destination)
+}
+
+func (l Layer) renderTemplate(environment map[string]string, fsys fs.FS, name string, data interface{}, destination string) error {
+	t, err := template.New(path.Base(name)).Funcs(templateFuncs(environment)).ParseFS(fsys, name)
+	if err != nil {
+		return fmt.Errorf("unable to parse template %s\n%w", name, err)
+	}
+
+	return l.render(t, data, destination)
+}
+
+func (l Layer) renderTemplateString(environment map[string]string, text string, data interface{}, destination string) error {
+	t, err := template.New(destination).Funcs(templateFuncs(environment)).Parse(text)
+	if err != nil {
+		return fmt.Errorf("unable to parse template for %s\n%w", destination, err)
+	}
+
+	return l.render(t, data, destination)
+}
+
+func (l Layer) render(t *template.Template, data interface{}, destination string) error {
+	file := filepath.Join(l.Path, destination)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s\n%w", filepath.Dir(file), err)
+	}
+
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open %s\n%w", file, err)
+	}
+
+	if err := t.Execute(out, data); err != nil {
+		out.Close()
+		return fmt.Errorf("unable to render template to %s\n%w", file, err)
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("unable to close %s\n%w", file, err)
+	}
+
+	return nil
+}
+
+// ContributeSBOM writes doc to the layer's SBOM file for each of formats, so that the files describe the same
+// components. Passing the formats declared in buildpack.toml, from BuildpackInfo.SBOMFormatTypes, keeps the files in
+// sync with them.
+func (l Layer) ContributeSBOM(doc SBOMDocument, formats ...SBOMFormat) error {
+	if len(formats) == 0 {
+		return fmt.Errorf("no SBOM formats for layer %s", l.Name)
+	}
+
+	for _, format := range formats {
+		b, err := doc.Encode(format)
+		if err != nil {
+			return fmt.Errorf("unable to encode SBOM for layer %s as %s\n%w", l.Name, format.MediaType(), err)
+		}
+
+		file := l.SBOMPath(format)
+		//nolint:gosec
+		if err := os.WriteFile(file, b, 0644); err != nil {
+			return fmt.Errorf("unable to write SBOM %s\n%w", file, err)
+		}
+	}
+
+	return nil
+}
+
 // SBOMPath returns the path to the layer specific SBOM File
 func (l Layer) SBOMPath(bt SBOMFormat) string {
-	return filepath.Join(filepath.Dir(l.Path), fmt.Sprintf("%s.sbom.%s", l.Name, bt))
+	return filepath.Join(filepath.Dir(l.Path), SBOMName(l.Name, bt))
 }
 
 // LayerTypes describes which types apply to a given layer. A layer may have any combination of Launch, Build, and
@@ -160,9 +562,48 @@ type LayerTypes struct {
 }
 
 // Layers represents the layers part of the specification.
+//
+// The Layers of a BuildContext capture the environment the context was created with, and their helpers look up
+// environment variables in it rather than in the process environment. Layers created directly, as a literal, use the
+// process environment. Helpers do not change process-global state, so distinct Layers can be used concurrently. The
+// environment is not part of the layers created from them, nor of their formatted value, so that it is not logged.
+// Their DependencyLayer verifies the signatures of dependencies with the SignatureVerifier of the build, if any, and
+// downloads them as permitted by the NetworkPolicy of the platform, unless they are vendored in the BuildpackFS.
 type Layers struct {
 	// Path is the layers filesystem location.
 	Path string
+
+	// environment is the environment captured when the layers were created, or nil to use the process environment.
+	environment map[string]string
+
+	// tomlWriter is the TOMLWriter configured when the layers were created, or nil to use the default TOMLWriter.
+	tomlWriter TOMLWriter
+
+	// verifier verifies the signatures of dependencies downloaded by DependencyLayer, or nil to not verify them.
+	verifier SignatureVerifier
+
+	// policy restricts where DependencyLayer downloads dependencies from. The zero value allows every download.
+	policy NetworkPolicy
+
+	// buildpackFS holds the dependencies vendored with the buildpack, or nil if there are none.
+	buildpackFS fs.FS
+}
+
+// String returns the path of the layers, leaving out the captured environment, which may hold secrets.
+func (l Layers) String() string {
+	return fmt.Sprintf("{Path:%s}", l.Path)
+}
+
+// RenderTemplate behaves like Layer.RenderTemplate, rendering the template to the layer with env looking up the
+// environment captured by the layers.
+func (l Layers) RenderTemplate(layer Layer, fsys fs.FS, name string, data interface{}, destination string) error {
+	return layer.renderTemplate(l.environment, fsys, name, data, destination)
+}
+
+// RenderTemplateString behaves like Layer.RenderTemplateString, rendering the template to the layer with env looking up
+// the environment captured by the layers.
+func (l Layers) RenderTemplateString(layer Layer, text string, data interface{}, destination string) error {
+	return layer.renderTemplateString(l.environment, text, data, destination)
 }
 
 // Layer creates a new layer, loading metadata if it exists.
@@ -176,20 +617,264 @@ func (l *Layers) Layer(name string) (Layer, error) {
 		Exec:              Exec{Path: filepath.Join(l.Path, name, "exec.d")},
 	}
 
-	f := filepath.Join(l.Path, fmt.Sprintf("%s.toml", name))
-	if _, err := toml.DecodeFile(f, &layer); err != nil && !os.IsNotExist(err) {
+	f := l.LayerTOMLPath(name)
+	if err := decodeTOMLFile(f, &layer); err != nil && !os.IsNotExist(err) {
 		return Layer{}, fmt.Errorf("unable to decode layer metadata %s\n%w", f, err)
 	}
 
 	return layer, nil
 }
 
+// List returns the layers that exist in the layers directory, sorted by name. A layer exists if either its directory
+// or its <layer>.toml metadata file exists, and its metadata, including its LayerTypes, is loaded if present.
+func (l *Layers) List() ([]Layer, error) {
+	entries, err := os.ReadDir(l.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read layers directory %s\n%w", l.Path, err)
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() {
+			if !strings.HasSuffix(name, ".toml") || strings.Contains(name, ".sbom.") {
+				continue
+			}
+			name = strings.TrimSuffix(name, ".toml")
+		}
+
+		if seen[name] || reservedLayerNames[name] || !validLayerName.MatchString(name) {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var layers []Layer
+	for _, name := range names {
+		layer, err := l.Layer(name)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+
+	return layers, nil
+}
+
+// Scratch returns a working directory for temporary files, created under the layers directory, for use instead of the
+// system temporary directory, which may be a small tmpfs in build containers. The directory is not a layer, so it is
+// never exported, and Build removes it, along with every other scratch directory, once the BuildFunc returns.
+func (l *Layers) Scratch(name string) (string, error) {
+	if !validLayerName.MatchString(name) {
+		return "", fmt.Errorf("invalid scratch directory name %q", name)
+	}
+
+	path := filepath.Join(l.Path, scratchDirectory, name)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return "", fmt.Errorf("unable to create scratch directory %s\n%w", path, err)
+	}
+
+	return path, nil
+}
+
+// Exists returns whether a layer with the given name exists, either as a directory or as a <layer>.toml metadata file.
+func (l *Layers) Exists(name string) bool {
+	for _, path := range []string{filepath.Join(l.Path, name), filepath.Join(l.Path, fmt.Sprintf("%s.toml", name))} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadLayerTOML decodes the <layer>.toml file at the given path, as written by Build. The name and path of the returned
+// layer are derived from the file name, so that a file at <layers>/<name>.toml yields a layer named <name> located at
+// <layers>/<name>.
+func ReadLayerTOML(path string) (Layer, error) {
+	name := strings.TrimSuffix(filepath.Base(path), ".toml")
+
+	layer := Layer{
+		Name: name,
+		Path: filepath.Join(filepath.Dir(path), name),
+	}
+
+	if err := decodeTOMLFile(path, &layer); err != nil {
+		return Layer{}, fmt.Errorf("unable to decode layer metadata %s\n%w", path, err)
+	}
+
+	return layer, nil
+}
+
 // BOMBuildPath returns the full path to the build SBoM file for the buildpack
 func (l Layers) BuildSBOMPath(bt SBOMFormat) string {
-	return filepath.Join(l.Path, fmt.Sprintf("build.sbom.%s", bt))
+	return filepath.Join(l.Path, SBOMName("build", bt))
 }
 
 // BOMLaunchPath returns the full path to the launch SBoM file for the buildpack
 func (l Layers) LaunchSBOMPath(bt SBOMFormat) string {
-	return filepath.Join(l.Path, fmt.Sprintf("launch.sbom.%s", bt))
+	return filepath.Join(l.Path, SBOMName("launch", bt))
+}
+
+// BuildTOMLPath returns the full path to the build metadata file for the buildpack.
+func (l Layers) BuildTOMLPath() string {
+	return filepath.Join(l.Path, BuildTOMLName)
+}
+
+// LaunchTOMLPath returns the full path to the application metadata file for the buildpack.
+func (l Layers) LaunchTOMLPath() string {
+	return filepath.Join(l.Path, LaunchTOMLName)
+}
+
+// StoreTOMLPath returns the full path to the persistent metadata file for the buildpack.
+func (l Layers) StoreTOMLPath() string {
+	return filepath.Join(l.Path, StoreTOMLName)
+}
+
+// LayerTOMLPath returns the full path to the metadata file of the layer with the given name.
+func (l Layers) LayerTOMLPath(name string) string {
+	return filepath.Join(l.Path, LayerTOMLName(name))
+}
+
+// validateLayers returns an error if any layer name is invalid or reserved, or if more than one layer has the same
+// name.
+func validateLayers(layers []Layer) error {
+	seen := map[string]int{}
+	for _, l := range layers {
+		if !validLayerName.MatchString(l.Name) {
+			return fmt.Errorf("invalid layer name %q: names must start with a letter or digit and contain only letters, digits, '.', '_', and '-'", l.Name)
+		}
+		if reservedLayerNames[l.Name] {
+			return fmt.Errorf("invalid layer name %q: name is reserved", l.Name)
+		}
+		seen[l.Name]++
+	}
+
+	var duplicates []string
+	for name, count := range seen {
+		if count > 1 {
+			duplicates = append(duplicates, name)
+		}
+	}
+	if len(duplicates) > 0 {
+		sort.Strings(duplicates)
+		return fmt.Errorf("duplicate layer names: %s", strings.Join(duplicates, ", "))
+	}
+
+	return nil
+}
+
+// NormalizePermissionsOption is a function for configuring NormalizePermissions.
+type NormalizePermissionsOption func(config normalizePermissionsConfig) normalizePermissionsConfig
+
+type normalizePermissionsConfig struct {
+	groupWritable bool
+}
+
+// WithGroupWritable creates a NormalizePermissionsOption that grants the group the same permissions as the owner.
+// This supports platforms that run images as an arbitrary user ID that is a member of the file's group.
+func WithGroupWritable() NormalizePermissionsOption {
+	return func(config normalizePermissionsConfig) normalizePermissionsConfig {
+		config.groupWritable = true
+		return config
+	}
+}
+
+// NormalizePermissions recursively sets the permissions of path and everything beneath it so that the contents are
+// readable by any user at launch, regardless of the user ID the run image uses. Directories become 0755 and files
+// become 0644, or 0755 if any execute bit was set. No file is left group or world-writable unless WithGroupWritable is
+// used, in which case the group gains the owner's permissions. Symbolic links are not followed.
+func NormalizePermissions(path string, options ...NormalizePermissionsOption) error {
+	config := normalizePermissionsConfig{}
+	for _, option := range options {
+		config = option(config)
+	}
+
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("unable to stat %s\n%w", p, err)
+		}
+
+		mode := fs.FileMode(0644)
+		if d.IsDir() || info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		if config.groupWritable {
+			mode |= 0020
+		}
+
+		if err := os.Chmod(p, mode); err != nil {
+			return fmt.Errorf("unable to chmod %s\n%w", p, err)
+		}
+
+		return nil
+	})
+}
+
+// layerTypeWarnings returns warnings for layers whose content does not match their types: launch environment,
+// profile.d scripts or exec.d executables in a layer that is not a launch layer, which the lifecycle ignores, and cache
+// layers that contain neither files nor metadata, which cache nothing.
+func layerTypeWarnings(layers []Layer) []string {
+	var warnings []string
+
+	for _, l := range layers {
+		if !l.LayerTypes.Launch {
+			var ignored []string
+			if len(l.LaunchEnvironment) > 0 {
+				ignored = append(ignored, "launch environment")
+			}
+			if hasEntries(filepath.Join(l.Path, "profile.d")) {
+				ignored = append(ignored, "profile.d scripts")
+			}
+			if l.Exec.Path != "" && hasEntries(l.Exec.Path) {
+				ignored = append(ignored, "exec.d executables")
+			}
+
+			if len(ignored) > 0 {
+				warnings = append(warnings, fmt.Sprintf("Warning: layer %q contributes %s but is not a launch layer, so the "+
+					"lifecycle ignores them", l.Name, strings.Join(ignored, " and ")))
+			}
+		}
+
+		if l.LayerTypes.Cache && len(l.Metadata) == 0 && !hasFiles(l.Path) {
+			warnings = append(warnings, fmt.Sprintf("Warning: layer %q is a cache layer but contains no files or metadata, "+
+				"so nothing is cached", l.Name))
+		}
+	}
+
+	return warnings
+}
+
+// hasEntries returns whether dir is a directory with at least one entry.
+func hasEntries(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) > 0
+}
+
+// hasFiles returns whether dir contains a file, at any depth, that is not a directory.
+func hasFiles(dir string) bool {
+	found := false
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
 }
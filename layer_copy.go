@@ -0,0 +1,164 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/buildpacks/libcnb/v2/log"
+)
+
+// copyBufferSize is the size of the buffers CopyFile streams files through.
+const copyBufferSize = 1024 * 1024
+
+// copyBuffers holds the buffers CopyFile streams files through, so that copying many files does not allocate a buffer
+// for each.
+var copyBuffers = sync.Pool{New: func() interface{} {
+	b := make([]byte, copyBufferSize)
+	return &b
+}}
+
+// CopyOption is a function for configuring how Layer.CopyFile copies a file.
+type CopyOption func(config copyConfig) copyConfig
+
+type copyConfig struct {
+	logger log.Logger
+	sha256 string
+}
+
+// WithProgress creates a CopyOption that logs the progress of the copy to logger at debug level, for every tenth of the
+// file copied.
+func WithProgress(logger log.Logger) CopyOption {
+	return func(config copyConfig) copyConfig {
+		config.logger = logger
+		return config
+	}
+}
+
+// WithExpectedSHA256 creates a CopyOption that verifies the hex-encoded SHA256 checksum of the file as it is copied. If
+// the checksum does not match, the copy fails and the destination is not created.
+func WithExpectedSHA256(sum string) CopyOption {
+	return func(config copyConfig) copyConfig {
+		config.sha256 = strings.ToLower(sum)
+		return config
+	}
+}
+
+// CopyFile copies the file at src to dst, a path relative to the layer, creating its parent directories. The file is
+// streamed through a reused buffer rather than read into memory, so that copying large files such as runtimes does not
+// need memory proportional to their size. The destination is only created, with the permissions of src, once the copy,
+// and checksum verification if any, have succeeded.
+func (l Layer) CopyFile(src string, dst string, options ...CopyOption) error {
+	config := copyConfig{}
+	for _, option := range options {
+		config = option(config)
+	}
+
+	if filepath.IsAbs(dst) || !filepath.IsLocal(dst) {
+		return fmt.Errorf("unable to copy %s to %s: destination must be relative to layer %s", src, dst, l.Name)
+	}
+	destination := filepath.Join(l.Path, dst)
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("unable to open %s\n%w", src, err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat %s\n%w", src, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("unable to copy %s: not a regular file", src)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s\n%w", filepath.Dir(destination), err)
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(destination), fmt.Sprintf(".%s-*", filepath.Base(destination)))
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file in %s\n%w", filepath.Dir(destination), err)
+	}
+	defer os.Remove(out.Name())
+
+	hash := sha256.New()
+	var w io.Writer = io.MultiWriter(out, hash)
+	if config.logger != nil && config.logger.IsDebugEnabled() {
+		w = &progressWriter{writer: w, logger: config.logger, name: src, total: info.Size()}
+	}
+
+	buf := copyBuffers.Get().(*[]byte)
+	_, err = io.CopyBuffer(w, in, *buf)
+	copyBuffers.Put(buf)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("unable to copy %s to %s\n%w", src, destination, err)
+	}
+
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		out.Close()
+		return fmt.Errorf("unable to set permissions of %s\n%w", out.Name(), err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("unable to close %s\n%w", out.Name(), err)
+	}
+
+	if config.sha256 != "" {
+		if s := hex.EncodeToString(hash.Sum(nil)); s != config.sha256 {
+			return fmt.Errorf("sha256 for %s %s does not match expected %s", src, s, config.sha256)
+		}
+	}
+
+	if err := os.Rename(out.Name(), destination); err != nil {
+		return fmt.Errorf("unable to move %s to %s\n%w", out.Name(), destination, err)
+	}
+
+	return nil
+}
+
+// progressWriter logs at debug level each time another tenth of total bytes has been written.
+type progressWriter struct {
+	writer  io.Writer
+	logger  log.Logger
+	name    string
+	total   int64
+	written int64
+	logged  int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.writer.Write(b)
+	p.written += int64(n)
+
+	if p.total > 0 {
+		if tenths := p.written * 10 / p.total; tenths > p.logged {
+			p.logged = tenths
+			p.logger.Debugf("Copying %s: %d%% (%d of %d bytes)", p.name, tenths*10, p.written, p.total)
+		}
+	}
+
+	return n, err
+}
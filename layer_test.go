@@ -17,16 +17,29 @@
 package libcnb_test
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
 
 	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/internal"
+	"github.com/buildpacks/libcnb/v2/log"
 )
 
+type testSBOMDocument struct{}
+
+func (testSBOMDocument) Encode(format libcnb.SBOMFormat) ([]byte, error) {
+	return []byte(format.String()), nil
+}
+
 func testLayer(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
@@ -50,6 +63,143 @@ func testLayer(t *testing.T, context spec.G, it spec.S) {
 			Expect(exec.ProcessFilePath("test-process", "test-name")).
 				To(Equal(filepath.Join("test-path", "test-process", "test-name")))
 		})
+
+		it("installs executables from a file system", func() {
+			exec = libcnb.Exec{Path: filepath.Join(t.TempDir(), "exec.d")}
+			fsys := fstest.MapFS{"bin/helper": {Data: []byte("test-content")}}
+
+			Expect(exec.Install(fsys, "bin/helper", "test-name")).To(Succeed())
+			Expect(exec.ProcessInstall(fsys, "bin/helper", "test-process", "test-name")).To(Succeed())
+
+			for _, path := range []string{exec.FilePath("test-name"), exec.ProcessFilePath("test-process", "test-name")} {
+				Expect(os.ReadFile(path)).To(Equal([]byte("test-content")))
+				info, err := os.Stat(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+			}
+		})
+	})
+
+	context("MetadataEquals", func() {
+		type jdk struct {
+			Version string            `toml:"version"`
+			Vendor  string            `toml:"vendor,omitempty"`
+			Options map[string]string `toml:"options,omitempty"`
+		}
+
+		it("returns true when the metadata matches", func() {
+			layer := libcnb.Layer{Metadata: map[string]interface{}{"version": "17.0.9", "other": "ignored"}}
+
+			ok, diff, err := layer.MetadataEquals(jdk{Version: "17.0.9"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(diff).To(BeEmpty())
+		})
+
+		it("returns the differences", func() {
+			layer := libcnb.Layer{Metadata: map[string]interface{}{
+				"version": "17.0.8",
+				"vendor":  "test-vendor",
+				"options": map[string]interface{}{"alpha": "1", "bravo": "2"},
+			}}
+
+			ok, diff, err := layer.MetadataEquals(&jdk{Version: "17.0.9", Options: map[string]string{"bravo": "3", "charlie": "4"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(diff).To(Equal([]libcnb.Difference{
+				{Key: "options.alpha", Actual: "1"},
+				{Key: "options.bravo", Actual: "2", Expected: "3"},
+				{Key: "options.charlie", Expected: "4"},
+				{Key: "vendor", Actual: "test-vendor"},
+				{Key: "version", Actual: "17.0.8", Expected: "17.0.9"},
+			}))
+			Expect(diff[4].String()).To(Equal("version changed 17.0.8 → 17.0.9"))
+			Expect(diff[0].String()).To(Equal("options.alpha removed 1"))
+			Expect(diff[2].String()).To(Equal("options.charlie added 4"))
+		})
+
+		it("fails when the metadata cannot be decoded into the expected type", func() {
+			layer := libcnb.Layer{Metadata: map[string]interface{}{"version": 17}}
+
+			_, _, err := layer.MetadataEquals(jdk{Version: "17.0.9"})
+			Expect(err).To(MatchError(HavePrefix("unable to decode layer metadata")))
+		})
+	})
+
+	context("RenderTemplate", func() {
+		var layer libcnb.Layer
+
+		it.Before(func() {
+			layer = libcnb.Layer{Name: "test-name", Path: filepath.Join(t.TempDir(), "test-name")}
+		})
+
+		it("renders a template from a file system", func() {
+			t.Setenv("TEST_PORT", "8080")
+			fsys := fstest.MapFS{"templates/server.conf": {Data: []byte(`listen {{ env "TEST_PORT" }}; hosts {{ join .Hosts "," }};`)}}
+
+			Expect(layer.RenderTemplate(fsys, "templates/server.conf", map[string]interface{}{"Hosts": []string{"alpha", "bravo"}}, "conf/server.conf")).
+				To(Succeed())
+
+			Expect(os.ReadFile(filepath.Join(layer.Path, "conf", "server.conf"))).
+				To(Equal([]byte("listen 8080; hosts alpha,bravo;")))
+		})
+
+		it("renders a template from a string", func() {
+			Expect(layer.RenderTemplateString("name = {{ .Name }}", layer, "test.conf")).To(Succeed())
+
+			Expect(os.ReadFile(filepath.Join(layer.Path, "test.conf"))).To(Equal([]byte("name = test-name")))
+		})
+
+		it("returns an error if the template cannot be rendered", func() {
+			Expect(layer.RenderTemplateString("{{ .Missing }}", layer, "test.conf")).
+				To(MatchError(ContainSubstring("unable to render template")))
+		})
+	})
+
+	context("CopyFile", func() {
+		var (
+			layer  libcnb.Layer
+			source string
+		)
+
+		it.Before(func() {
+			layer = libcnb.Layer{Name: "test-name", Path: filepath.Join(t.TempDir(), "test-name")}
+			source = filepath.Join(t.TempDir(), "test-file")
+			Expect(os.WriteFile(source, []byte("test-content"), 0755)).To(Succeed())
+		})
+
+		it("copies a file and verifies its checksum", func() {
+			s := sha256.Sum256([]byte("test-content"))
+
+			Expect(layer.CopyFile(source, "bin/test-file", libcnb.WithExpectedSHA256(hex.EncodeToString(s[:])))).To(Succeed())
+
+			Expect(os.ReadFile(filepath.Join(layer.Path, "bin", "test-file"))).To(Equal([]byte("test-content")))
+			info, err := os.Stat(filepath.Join(layer.Path, "bin", "test-file"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+		})
+
+		it("does not create the file when the checksum does not match", func() {
+			Expect(layer.CopyFile(source, "test-file", libcnb.WithExpectedSHA256("test-sha256"))).
+				To(MatchError(ContainSubstring("does not match expected test-sha256")))
+
+			entries, err := os.ReadDir(layer.Path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		it("logs progress", func() {
+			t.Setenv("BP_LOG_LEVEL", "DEBUG")
+			b := &bytes.Buffer{}
+
+			Expect(layer.CopyFile(source, "test-file", libcnb.WithProgress(log.New(b)))).To(Succeed())
+
+			Expect(b.String()).To(Equal(fmt.Sprintf("Copying %s: 100%% (12 of 12 bytes)\n", source)))
+		})
+
+		it("rejects destinations outside the layer", func() {
+			Expect(layer.CopyFile(source, "../test-file")).To(MatchError(ContainSubstring("destination must be relative to layer test-name")))
+		})
 	})
 
 	context("Reset", func() {
@@ -234,6 +384,44 @@ func testLayer(t *testing.T, context spec.G, it spec.S) {
 			Expect(l.SBOMPath(libcnb.SyftJSON)).To(Equal(filepath.Join(path, "test-name.sbom.syft.json")))
 		})
 
+		it("generates lifecycle file paths", func() {
+			Expect(layers.BuildTOMLPath()).To(Equal(filepath.Join(path, "build.toml")))
+			Expect(layers.LaunchTOMLPath()).To(Equal(filepath.Join(path, "launch.toml")))
+			Expect(layers.StoreTOMLPath()).To(Equal(filepath.Join(path, "store.toml")))
+			Expect(layers.LayerTOMLPath("test-name")).To(Equal(filepath.Join(path, "test-name.toml")))
+			Expect(libcnb.SBOMName("test-name", libcnb.CycloneDXJSON)).To(Equal("test-name.sbom.cdx.json"))
+		})
+
+		it("contributes an SBOM in each format", func() {
+			l, err := layers.Layer("test-name")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(l.ContributeSBOM(testSBOMDocument{}, libcnb.CycloneDXJSON, libcnb.SyftJSON)).To(Succeed())
+
+			Expect(os.ReadFile(l.SBOMPath(libcnb.CycloneDXJSON))).To(Equal([]byte("cdx.json")))
+			Expect(os.ReadFile(l.SBOMPath(libcnb.SyftJSON))).To(Equal([]byte("syft.json")))
+			Expect(l.SBOMPath(libcnb.SPDXJSON)).NotTo(BeAnExistingFile())
+		})
+
+		it("fails to contribute an SBOM without formats", func() {
+			l, err := layers.Layer("test-name")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(l.ContributeSBOM(testSBOMDocument{})).To(MatchError("no SBOM formats for layer test-name"))
+		})
+
+		it("creates scratch directories", func() {
+			scratch, err := layers.Scratch("test-scratch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scratch).To(BeADirectory())
+			Expect(filepath.Dir(filepath.Dir(scratch))).To(Equal(path))
+
+			Expect(layers.List()).To(BeEmpty())
+
+			_, err = layers.Scratch("../test-scratch")
+			Expect(err).To(MatchError(`invalid scratch directory name "../test-scratch"`))
+		})
+
 		it("maps from string to SBOM Format", func() {
 			fmt, err := libcnb.SBOMFormatFromString("cdx.json")
 			Expect(err).ToNot(HaveOccurred())
@@ -297,5 +485,87 @@ test-key = "test-value"
 			Expect(l.Build).To(BeFalse())
 			Expect(l.Cache).To(BeFalse())
 		})
+
+		it("reads layer metadata written by the TOMLWriter", func() {
+			layer := libcnb.Layer{
+				Name: "test-name",
+				Path: filepath.Join(path, "test-name"),
+				LayerTypes: libcnb.LayerTypes{
+					Build:  true,
+					Launch: true,
+				},
+				Metadata: map[string]interface{}{"test-key": "test-value"},
+			}
+			Expect(internal.TOMLWriter{}.Write(filepath.Join(path, "test-name.toml"), layer)).To(Succeed())
+
+			l, err := libcnb.ReadLayerTOML(filepath.Join(path, "test-name.toml"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(l).To(Equal(layer))
+		})
+
+		it("lists existing layers", func() {
+			Expect(os.MkdirAll(filepath.Join(path, "bravo"), 0755)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(path, "charlie"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "alpha.toml"), []byte("[types]\nlaunch = true\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "charlie.toml"), []byte("[types]\ncache = true\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "charlie.sbom.cdx.json"), []byte{}, 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "launch.toml"), []byte{}, 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "store.toml"), []byte{}, 0600)).To(Succeed())
+
+			l, err := layers.List()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(l).To(HaveLen(3))
+			Expect(l[0].Name).To(Equal("alpha"))
+			Expect(l[0].Launch).To(BeTrue())
+			Expect(l[1].Name).To(Equal("bravo"))
+			Expect(l[1].LayerTypes).To(Equal(libcnb.LayerTypes{}))
+			Expect(l[2].Name).To(Equal("charlie"))
+			Expect(l[2].Path).To(Equal(filepath.Join(path, "charlie")))
+			Expect(l[2].Cache).To(BeTrue())
+		})
+
+		it("checks whether a layer exists", func() {
+			Expect(os.MkdirAll(filepath.Join(path, "alpha"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "bravo.toml"), []byte{}, 0600)).To(Succeed())
+
+			Expect(layers.Exists("alpha")).To(BeTrue())
+			Expect(layers.Exists("bravo")).To(BeTrue())
+			Expect(layers.Exists("charlie")).To(BeFalse())
+		})
+	})
+
+	context("NormalizePermissions", func() {
+		it.Before(func() {
+			path = t.TempDir()
+			Expect(os.MkdirAll(filepath.Join(path, "test-directory"), 0777)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(path, "test-directory"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "test-directory", "test-file"), []byte{}, 0600)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(path, "test-directory", "test-file"), 0666)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(path, "test-executable"), []byte{}, 0700)).To(Succeed())
+		})
+
+		mode := func(name string) os.FileMode {
+			info, err := os.Stat(filepath.Join(path, name))
+			Expect(err).NotTo(HaveOccurred())
+			return info.Mode().Perm()
+		}
+
+		it("makes contents readable and not world-writable", func() {
+			Expect(libcnb.NormalizePermissions(path)).To(Succeed())
+
+			Expect(mode("test-directory")).To(Equal(os.FileMode(0755)))
+			Expect(mode(filepath.Join("test-directory", "test-file"))).To(Equal(os.FileMode(0644)))
+			Expect(mode("test-executable")).To(Equal(os.FileMode(0755)))
+		})
+
+		it("makes contents group writable", func() {
+			Expect(libcnb.NormalizePermissions(path, libcnb.WithGroupWritable())).To(Succeed())
+
+			Expect(mode("test-directory")).To(Equal(os.FileMode(0775)))
+			Expect(mode(filepath.Join("test-directory", "test-file"))).To(Equal(os.FileMode(0664)))
+			Expect(mode("test-executable")).To(Equal(os.FileMode(0775)))
+		})
 	})
 }
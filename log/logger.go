@@ -17,10 +17,38 @@
 package log
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// timestampFormat is RFC 3339 with millisecond precision.
+const timestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+const (
+	// EnvDebug is the name of the environment variable that enables debug logging when set to a true boolean value.
+	EnvDebug = "BP_DEBUG"
+
+	// EnvLogLevel is the name of the environment variable that sets the log level. Debug logging is enabled when it is
+	// "debug", case-insensitively.
+	EnvLogLevel = "BP_LOG_LEVEL"
+
+	// EnvLogFormat is the name of the environment variable that sets the format messages are written in, FormatPlain or
+	// FormatJSON.
+	EnvLogFormat = "BP_LOG_FORMAT"
+)
+
+const (
+	// FormatPlain writes messages as they are formatted. It is the default format.
+	FormatPlain = "plain"
+
+	// FormatJSON writes each line of a message as a JSON object with level and message fields.
+	FormatJSON = "json"
 )
 
 //go:generate mockery --name Logger --case=underscore
@@ -40,23 +68,116 @@ type Logger interface {
 	IsDebugEnabled() bool
 }
 
-// PlainLogger implements Logger and logs messages to a writer.
+// Warner is the interface implemented by a Logger that writes warnings regardless of whether debug logging is enabled.
+// It is optional, so that Loggers implemented before warnings were introduced continue to work.
+type Warner interface {
+	// Warn formats using the default formats for its operands
+	Warn(a ...interface{})
+
+	// Warnf formats according to a format specifier
+	Warnf(format string, a ...interface{})
+}
+
+// Warn writes a warning to logger if it implements Warner, and writes it as a debug message otherwise. Spaces are added
+// between operands when neither is a string.
+func Warn(logger Logger, a ...interface{}) {
+	if w, ok := logger.(Warner); ok {
+		w.Warn(a...)
+		return
+	}
+	logger.Debug(a...)
+}
+
+// Warnf writes a warning, formatted according to a format specifier, to logger if it implements Warner, and writes it
+// as a debug message otherwise.
+func Warnf(logger Logger, format string, a ...interface{}) {
+	if w, ok := logger.(Warner); ok {
+		w.Warnf(format, a...)
+		return
+	}
+	logger.Debugf(format, a...)
+}
+
+// PlainLogger implements Logger and Warner and logs messages to a writer.
 type PlainLogger struct {
 	debug io.Writer
+	info  io.Writer
 }
 
-// New creates a new instance of PlainLogger.  It configures debug logging if $BP_DEBUG or $BP_LOG_LEVEL are set.
-func New(debug io.Writer) PlainLogger {
-	if strings.ToLower(os.Getenv("BP_LOG_LEVEL")) == "debug" || os.Getenv("BP_DEBUG") != "" {
-		return PlainLogger{debug: debug}
+// Option is a function for configuring a PlainLogger.
+type Option func(logger PlainLogger) PlainLogger
+
+// WithTimestamps creates an Option that prefixes each debug line with the time it was written, in RFC 3339 format with
+// millisecond precision.
+func WithTimestamps() Option {
+	return func(logger PlainLogger) PlainLogger {
+		if logger.debug != nil {
+			logger.debug = timestampWriter{writer: logger.debug, timestamp: func() string {
+				return time.Now().Format(timestampFormat)
+			}}
+		}
+		return logger
 	}
+}
 
-	return PlainLogger{}
+// WithDeltaTimestamps creates an Option that prefixes each debug line with the time elapsed since the logger was
+// created, making it possible to see which steps of a phase are slow.
+func WithDeltaTimestamps() Option {
+	return func(logger PlainLogger) PlainLogger {
+		if logger.debug != nil {
+			start := time.Now()
+			logger.debug = timestampWriter{writer: logger.debug, timestamp: func() string {
+				return fmt.Sprintf("+%.3fs", time.Since(start).Seconds())
+			}}
+		}
+		return logger
+	}
+}
+
+// New creates a new instance of PlainLogger, configured by the options. Warnings are always written.
+//
+// Debug logging is configured by $BP_LOG_LEVEL and $BP_DEBUG. If $BP_LOG_LEVEL is set, debug logging is enabled only if
+// it is "debug" and $BP_DEBUG is ignored. Otherwise debug logging is enabled if $BP_DEBUG is a true boolean value, as
+// parsed by strconv.ParseBool, so that BP_DEBUG=false disables it. For compatibility, any other non-empty value of
+// $BP_DEBUG that is not a boolean also enables it.
+//
+// If $BP_LOG_FORMAT is FormatJSON, each line is written as a JSON object. Otherwise messages are written as plain text.
+func New(debug io.Writer, options ...Option) PlainLogger {
+	info := debug
+	if strings.ToLower(os.Getenv(EnvLogFormat)) == FormatJSON {
+		debug, info = jsonWriter{writer: debug, level: "debug"}, jsonWriter{writer: debug, level: "warn"}
+	}
+
+	logger := PlainLogger{info: info}
+	if debugEnabled() {
+		logger.debug = debug
+	}
+
+	for _, option := range options {
+		logger = option(logger)
+	}
+
+	return logger
+}
+
+// debugEnabled indicates whether $BP_LOG_LEVEL and $BP_DEBUG enable debug logging.
+func debugEnabled() bool {
+	if level, ok := os.LookupEnv(EnvLogLevel); ok && level != "" {
+		return strings.ToLower(level) == "debug"
+	}
+
+	s := os.Getenv(EnvDebug)
+	if s == "" {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(s)
+	return enabled || err != nil
 }
 
 // NewDiscard creates a new instance of PlainLogger that discards all log messages. Useful in testing.
 func NewDiscard() PlainLogger {
-	return PlainLogger{debug: io.Discard}
+	return PlainLogger{debug: io.Discard, info: io.Discard}
 }
 
 // Debug formats using the default formats for its operands and writes to the configured debug writer. Spaces are added
@@ -100,3 +221,83 @@ func (l PlainLogger) DebugWriter() io.Writer {
 func (l PlainLogger) IsDebugEnabled() bool {
 	return l.debug != nil
 }
+
+// Warn formats using the default formats for its operands and writes to the configured writer, regardless of whether
+// debug logging is enabled. Spaces are added between operands when neither is a string.
+func (l PlainLogger) Warn(a ...interface{}) {
+	if l.info == nil {
+		return
+	}
+
+	s := fmt.Sprint(a...)
+
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+
+	_, _ = fmt.Fprint(l.info, s)
+}
+
+// Warnf formats according to a format specifier and writes to the configured writer, regardless of whether debug
+// logging is enabled.
+func (l PlainLogger) Warnf(format string, a ...interface{}) {
+	if l.info == nil {
+		return
+	}
+
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+
+	_, _ = fmt.Fprintf(l.info, format, a...)
+}
+
+// jsonWriter writes each line written to it as a JSON object, with the given level, to writer.
+type jsonWriter struct {
+	writer io.Writer
+	level  string
+}
+
+type jsonLine struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+func (w jsonWriter) Write(p []byte) (int, error) {
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		if err := e.Encode(jsonLine{Level: w.level, Message: line}); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := w.writer.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// timestampWriter writes each line written to it to writer, prefixed with a timestamp.
+type timestampWriter struct {
+	writer    io.Writer
+	timestamp func() string
+}
+
+func (w timestampWriter) Write(p []byte) (int, error) {
+	t := w.timestamp()
+
+	var b bytes.Buffer
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if line != "" {
+			b.WriteString(t + " " + line)
+		}
+	}
+
+	if _, err := w.writer.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/sclevine/spec"
 
 	"github.com/buildpacks/libcnb/v2/log"
+	"github.com/buildpacks/libcnb/v2/log/mocks"
 )
 
 func testLogger(t *testing.T, context spec.G, it spec.S) {
@@ -56,6 +57,16 @@ func testLogger(t *testing.T, context spec.G, it spec.S) {
 		it("does not return non-discard writer", func() {
 			Expect(l.DebugWriter()).To(Equal(io.Discard))
 		})
+
+		it("writes warn log", func() {
+			l.Warn("test-message")
+			Expect(b.String()).To(Equal("test-message\n"))
+		})
+
+		it("writes warnf log", func() {
+			l.Warnf("test-%s", "message")
+			Expect(b.String()).To(Equal("test-message\n"))
+		})
 	})
 
 	context("with BP_DEBUG", func() {
@@ -73,6 +84,72 @@ func testLogger(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("with BP_DEBUG set to a boolean", func() {
+		it.After(func() {
+			Expect(os.Unsetenv("BP_DEBUG")).To(Succeed())
+		})
+
+		it("configures debug when true", func() {
+			Expect(os.Setenv("BP_DEBUG", "true")).To(Succeed())
+			Expect(log.New(b).IsDebugEnabled()).To(BeTrue())
+		})
+
+		it("does not configure debug when false", func() {
+			Expect(os.Setenv("BP_DEBUG", "false")).To(Succeed())
+			Expect(log.New(b).IsDebugEnabled()).To(BeFalse())
+		})
+
+		it("configures debug when not a boolean", func() {
+			Expect(os.Setenv("BP_DEBUG", "yes")).To(Succeed())
+			Expect(log.New(b).IsDebugEnabled()).To(BeTrue())
+		})
+	})
+
+	context("with BP_LOG_LEVEL and BP_DEBUG", func() {
+		it.Before(func() {
+			Expect(os.Setenv("BP_DEBUG", "true")).To(Succeed())
+			Expect(os.Setenv("BP_LOG_LEVEL", "INFO")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("BP_DEBUG")).To(Succeed())
+			Expect(os.Unsetenv("BP_LOG_LEVEL")).To(Succeed())
+		})
+
+		it("gives precedence to BP_LOG_LEVEL", func() {
+			Expect(log.New(b).IsDebugEnabled()).To(BeFalse())
+		})
+	})
+
+	context("with BP_LOG_FORMAT set to json", func() {
+		it.Before(func() {
+			Expect(os.Setenv("BP_LOG_FORMAT", "json")).To(Succeed())
+			Expect(os.Setenv("BP_LOG_LEVEL", "DEBUG")).To(Succeed())
+			l = log.New(b)
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("BP_LOG_FORMAT")).To(Succeed())
+			Expect(os.Unsetenv("BP_LOG_LEVEL")).To(Succeed())
+		})
+
+		it("writes each line as a JSON object", func() {
+			l.Debugf("test-%s\n\"quoted\"", "message")
+			l.Warn("test-warning")
+
+			Expect(b.String()).To(Equal(`{"level":"debug","message":"test-message"}
+{"level":"debug","message":"\"quoted\""}
+{"level":"warn","message":"test-warning"}
+`))
+		})
+
+		it("writes debug directly", func() {
+			_, err := l.DebugWriter().Write([]byte("test-message\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.String()).To(Equal(`{"level":"debug","message":"test-message"}` + "\n"))
+		})
+	})
+
 	context("with BP_LOG_LEVEL set to DEBUG", func() {
 		it.Before(func() {
 			Expect(os.Setenv("BP_LOG_LEVEL", "DEBUG")).To(Succeed())
@@ -117,5 +194,56 @@ func testLogger(t *testing.T, context spec.G, it spec.S) {
 		it("indicates that debug is enabled", func() {
 			Expect(l.IsDebugEnabled()).To(BeTrue())
 		})
+
+		it("prefixes debug lines with timestamps", func() {
+			l = log.New(b, log.WithTimestamps())
+
+			l.Debugf("test-message-1\ntest-message-2")
+			l.Warn("test-warning")
+
+			Expect(b.String()).To(MatchRegexp(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}(Z|[+-]\d{2}:\d{2}) test-message-1\n` +
+				`\S+ test-message-2\ntest-warning\n$`))
+		})
+
+		it("prefixes debug lines with delta timestamps", func() {
+			l = log.New(b, log.WithDeltaTimestamps())
+
+			l.Debug("test-message")
+
+			Expect(b.String()).To(MatchRegexp(`^\+\d+\.\d{3}s test-message\n$`))
+		})
+	})
+
+	context("Warn", func() {
+		it("writes warnings to a Warner", func() {
+			log.Warn(log.New(b), "test-", "warning")
+			log.Warnf(log.New(b), "test-%s", "warning")
+
+			Expect(b.String()).To(Equal("test-warning\ntest-warning\n"))
+		})
+
+		it("writes warnings as debug messages to a Logger that is not a Warner", func() {
+			logger := &mocks.Logger{}
+			logger.On("Debug", "test-", "warning").Return()
+			logger.On("Debugf", "test-%s", "warning").Return()
+
+			log.Warn(logger, "test-", "warning")
+			log.Warnf(logger, "test-%s", "warning")
+
+			logger.AssertExpectations(t)
+		})
 	})
 }
+
+func BenchmarkDebugfDisabled(b *testing.B) {
+	l := log.New(io.Discard)
+	environment := map[string]string{"TEST_KEY_1": "test-value-1", "TEST_KEY_2": "test-value-2"}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if l.IsDebugEnabled() {
+			l.Debugf("Platform Environment: %+v", environment)
+		}
+	}
+}
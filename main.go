@@ -21,6 +21,20 @@ import (
 	"path/filepath"
 )
 
+// Phase is the lifecycle phase that invoked a buildpack or extension.
+type Phase string
+
+const (
+	// PhaseDetect is the detect phase.
+	PhaseDetect Phase = "detect"
+
+	// PhaseBuild is the build phase.
+	PhaseBuild Phase = "build"
+
+	// PhaseGenerate is the generate phase.
+	PhaseGenerate Phase = "generate"
+)
+
 func main(detect DetectFunc, build BuildFunc, generate GenerateFunc, options ...Option) {
 	config := NewConfig(options...)
 
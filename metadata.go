@@ -0,0 +1,188 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+var (
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// NormalizeMetadata returns metadata converted to the types it has when it is read back from a TOML file, so that
+// metadata written by a buildpack compares equal to the same metadata restored in a later build. Layer and persistent
+// metadata are normalized before they are written.
+//
+// The supported types, and the types they are converted to, are:
+//
+//   - bool and string, unchanged
+//   - signed and unsigned integers, as int64, failing if an unsigned value overflows int64
+//   - floating point numbers, as float64
+//   - time.Time, in UTC
+//   - time.Duration, as its String form
+//   - types implementing encoding.TextMarshaler, as their text form
+//   - slices and arrays, as []interface{}, or as []map[string]interface{} if every element is a map
+//   - maps with string keys and structs, as map[string]interface{}, using the toml tags of structs
+//   - pointers and interfaces, as the value they point to
+//
+// Nil map values are removed, as TOML has no null value. Values of any other type, and nil elements of slices, are
+// rejected with an error naming the key path of the offending value.
+func NormalizeMetadata(metadata map[string]interface{}) (map[string]interface{}, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+
+	v, err := normalizeMetadataValue("", reflect.ValueOf(metadata))
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(map[string]interface{}), nil
+}
+
+func normalizeMetadataValue(path string, v reflect.Value) (interface{}, error) {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Kind() == reflect.Ptr && v.Type().Implements(textMarshalerType) {
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	switch {
+	case v.Type() == timeType:
+		return v.Interface().(time.Time).UTC(), nil
+	case v.Type() == durationType:
+		return v.Interface().(time.Duration).String(), nil
+	case v.Type().Implements(textMarshalerType):
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal metadata %s\n%w", metadataPath(path), err)
+		}
+		return string(b), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("metadata %s overflows int64: %d", metadataPath(path), v.Uint())
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Slice, reflect.Array:
+		return normalizeMetadataSlice(path, v)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported metadata type %s at %s, map keys must be strings", v.Type(), metadataPath(path))
+		}
+
+		m := map[string]interface{}{}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			e, err := normalizeMetadataValue(joinMetadataPath(path, k.String()), v.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				m[k.String()] = e
+			}
+		}
+		return m, nil
+	case reflect.Struct:
+		b := &bytes.Buffer{}
+		if err := toml.NewEncoder(b).Encode(v.Interface()); err != nil {
+			return nil, fmt.Errorf("unable to encode metadata %s\n%w", metadataPath(path), err)
+		}
+
+		m := map[string]interface{}{}
+		if _, err := toml.NewDecoder(b).Decode(&m); err != nil {
+			return nil, fmt.Errorf("unable to decode metadata %s\n%w", metadataPath(path), err)
+		}
+		return normalizeMetadataValue(path, reflect.ValueOf(m))
+	default:
+		return nil, fmt.Errorf("unsupported metadata type %s at %s", v.Type(), metadataPath(path))
+	}
+}
+
+func normalizeMetadataSlice(path string, v reflect.Value) (interface{}, error) {
+	s := make([]interface{}, 0, v.Len())
+	tables := v.Len() > 0
+	for i := 0; i < v.Len(); i++ {
+		p := fmt.Sprintf("%s[%d]", path, i)
+
+		e, err := normalizeMetadataValue(p, v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			return nil, fmt.Errorf("unsupported nil metadata at %s", metadataPath(p))
+		}
+
+		if _, ok := e.(map[string]interface{}); !ok {
+			tables = false
+		}
+		s = append(s, e)
+	}
+
+	if !tables {
+		return s, nil
+	}
+
+	t := make([]map[string]interface{}, 0, len(s))
+	for _, e := range s {
+		t = append(t, e.(map[string]interface{}))
+	}
+	return t, nil
+}
+
+func joinMetadataPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func metadataPath(path string) string {
+	if path == "" {
+		return "metadata"
+	}
+	return fmt.Sprintf("%q", path)
+}
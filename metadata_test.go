@@ -0,0 +1,101 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+type testMetadataStruct struct {
+	Name    string        `toml:"name"`
+	Created time.Time     `toml:"created"`
+	Timeout time.Duration `toml:"timeout"`
+}
+
+func testMetadata(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("normalizes metadata to the types it is read back as", func() {
+		metadata := map[string]interface{}{
+			"bool":     true,
+			"string":   "test-value",
+			"int":      1,
+			"uint8":    uint8(2),
+			"float32":  float32(1.5),
+			"time":     time.Date(2020, 1, 2, 3, 4, 5, 6, time.FixedZone("test-zone", 3600)),
+			"duration": 5 * time.Second,
+			"address":  netip.MustParseAddr("127.0.0.1"),
+			"pointer":  &[]string{"a", "b"},
+			"nil":      nil,
+			"struct":   testMetadataStruct{Name: "test-name", Created: time.Unix(0, 0), Timeout: time.Minute},
+			"tables":   []map[string]int{{"a": 1}, {"b": 2}},
+			"nested":   map[string]interface{}{"array": [2]int{1, 2}, "empty": []string{}},
+		}
+
+		normalized, err := libcnb.NormalizeMetadata(metadata)
+		Expect(err).NotTo(HaveOccurred())
+
+		b := &bytes.Buffer{}
+		Expect(toml.NewEncoder(b).Encode(normalized)).To(Succeed())
+		restored := map[string]interface{}{}
+		_, err = toml.NewDecoder(b).Decode(&restored)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(normalized).To(Equal(restored))
+		Expect(normalized).NotTo(HaveKey("nil"))
+		Expect(normalized).To(HaveKeyWithValue("time", time.Date(2020, 1, 2, 2, 4, 5, 6, time.UTC)))
+		Expect(normalized).To(HaveKeyWithValue("duration", "5s"))
+		Expect(normalized).To(HaveKeyWithValue("address", "127.0.0.1"))
+	})
+
+	it("returns nil for nil metadata", func() {
+		Expect(libcnb.NormalizeMetadata(nil)).To(BeNil())
+	})
+
+	it("fails on an unsupported type with the key path", func() {
+		_, err := libcnb.NormalizeMetadata(map[string]interface{}{
+			"a": map[string]interface{}{"b": []interface{}{"c", make(chan int)}},
+		})
+		Expect(err).To(MatchError(`unsupported metadata type chan int at "a.b[1]"`))
+	})
+
+	it("fails on maps without string keys", func() {
+		_, err := libcnb.NormalizeMetadata(map[string]interface{}{"a": map[int]string{1: "b"}})
+		Expect(err).To(MatchError(ContainSubstring(`unsupported metadata type map[int]string at "a"`)))
+	})
+
+	it("fails on nil slice elements", func() {
+		_, err := libcnb.NormalizeMetadata(map[string]interface{}{"a": []interface{}{nil}})
+		Expect(err).To(MatchError(`unsupported nil metadata at "a[0]"`))
+	})
+
+	it("fails on unsigned integers overflowing int64", func() {
+		_, err := libcnb.NormalizeMetadata(map[string]interface{}{"a": uint64(1 << 63)})
+		Expect(err).To(MatchError(ContainSubstring(`metadata "a" overflows int64`)))
+	})
+}
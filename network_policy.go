@@ -0,0 +1,189 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EnvNetworkAllowedHosts is the name of the environment variable that contains a comma-separated list of the hosts
+	// dependencies may be downloaded from.
+	EnvNetworkAllowedHosts = "BP_NETWORK_ALLOWED_HOSTS"
+
+	// EnvNetworkDeniedHosts is the name of the environment variable that contains a comma-separated list of the hosts
+	// dependencies may not be downloaded from.
+	EnvNetworkDeniedHosts = "BP_NETWORK_DENIED_HOSTS"
+
+	// EnvNetworkRequireTLS is the name of the environment variable that, if true, requires dependencies to be
+	// downloaded over HTTPS.
+	EnvNetworkRequireTLS = "BP_NETWORK_REQUIRE_TLS"
+
+	// NetworkPolicyBindingType is the type of bindings that supply a network policy, with the secrets allowed-hosts,
+	// denied-hosts and require-tls in the same format as the corresponding environment variables.
+	NetworkPolicyBindingType = "network-policy"
+)
+
+// NetworkPolicy restricts where dependencies may be downloaded from, so that egress policy can be enforced uniformly
+// across buildpacks. Hosts are host names without a port, and a host of the form *.example.com matches every subdomain
+// of example.com. The zero value allows every download.
+type NetworkPolicy struct {
+	// AllowedHosts are the hosts downloads are allowed from. If empty, every host that is not denied is allowed.
+	AllowedHosts []string
+
+	// DeniedHosts are the hosts downloads are denied from, even if they are allowed.
+	DeniedHosts []string
+
+	// RequireTLS requires downloads to use HTTPS.
+	RequireTLS bool
+}
+
+// NetworkPolicyError is returned when a download is not permitted by a NetworkPolicy.
+type NetworkPolicyError struct {
+	// URI is the location of the download.
+	URI string
+
+	// Reason is why the download is not permitted.
+	Reason string
+}
+
+func (e *NetworkPolicyError) Error() string {
+	return fmt.Sprintf("download of %s is not permitted by the network policy: %s; vendor the dependency in the "+
+		"buildpack, or ask the platform operator to change the policy set with %s, %s, %s or a %s binding",
+		e.URI, e.Reason, EnvNetworkAllowedHosts, EnvNetworkDeniedHosts, EnvNetworkRequireTLS, NetworkPolicyBindingType)
+}
+
+// NewNetworkPolicy creates the NetworkPolicy described by the environment and by any bindings of type
+// NetworkPolicyBindingType. Host lists are combined, and TLS is required if any of them requires it.
+func NewNetworkPolicy(environment map[string]string, bindings Bindings) (NetworkPolicy, error) {
+	var policy NetworkPolicy
+	if err := policy.add("environment", environment[EnvNetworkAllowedHosts], environment[EnvNetworkDeniedHosts], environment[EnvNetworkRequireTLS]); err != nil {
+		return NetworkPolicy{}, err
+	}
+
+	for _, b := range bindings.OfType(NetworkPolicyBindingType) {
+		if err := policy.add(fmt.Sprintf("binding %s", b.Name), b.Secret["allowed-hosts"], b.Secret["denied-hosts"], b.Secret["require-tls"]); err != nil {
+			return NetworkPolicy{}, err
+		}
+	}
+
+	return policy, nil
+}
+
+// NetworkPolicy returns the NetworkPolicy described by the platform environment and bindings.
+func (p Platform) NetworkPolicy() (NetworkPolicy, error) {
+	return NewNetworkPolicy(p.Environment, p.Bindings)
+}
+
+func (p *NetworkPolicy) add(source string, allowed string, denied string, requireTLS string) error {
+	p.AllowedHosts = append(p.AllowedHosts, splitHosts(allowed)...)
+	p.DeniedHosts = append(p.DeniedHosts, splitHosts(denied)...)
+
+	if s := strings.TrimSpace(requireTLS); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("unable to parse require TLS setting %q of network policy from %s\n%w", s, source, err)
+		}
+		p.RequireTLS = p.RequireTLS || b
+	}
+
+	return nil
+}
+
+func splitHosts(s string) []string {
+	var hosts []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// IsZero returns whether the policy allows every download.
+func (p NetworkPolicy) IsZero() bool {
+	return len(p.AllowedHosts) == 0 && len(p.DeniedHosts) == 0 && !p.RequireTLS
+}
+
+// Check returns a *NetworkPolicyError if the policy does not permit downloading uri.
+func (p NetworkPolicy) Check(uri string) error {
+	if p.IsZero() {
+		return nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("unable to parse %s\n%w", uri, err)
+	}
+	host := strings.ToLower(u.Hostname())
+
+	if p.RequireTLS && u.Scheme != "https" {
+		return &NetworkPolicyError{URI: uri, Reason: fmt.Sprintf("scheme %s is not https, and TLS is required", u.Scheme)}
+	}
+
+	for _, d := range p.DeniedHosts {
+		if matchHost(d, host) {
+			return &NetworkPolicyError{URI: uri, Reason: fmt.Sprintf("host %s is denied by %s", host, d)}
+		}
+	}
+
+	if len(p.AllowedHosts) == 0 {
+		return nil
+	}
+	for _, a := range p.AllowedHosts {
+		if matchHost(a, host) {
+			return nil
+		}
+	}
+
+	allowed := append([]string(nil), p.AllowedHosts...)
+	sort.Strings(allowed)
+	return &NetworkPolicyError{URI: uri, Reason: fmt.Sprintf("host %s is not one of the allowed hosts %s", host, strings.Join(allowed, ", "))}
+}
+
+// matchHost returns whether host matches pattern, a host name or, for *.example.com, any subdomain of example.com.
+func matchHost(pattern string, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == "*" || pattern == host
+}
+
+// client returns a copy of client that also checks the locations of redirects against the policy.
+func (p NetworkPolicy) client(client *http.Client) *http.Client {
+	c := *client
+	checkRedirect := client.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := p.Check(req.URL.String()); err != nil {
+			return err
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &c
+}
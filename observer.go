@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	// EventContextResolved is sent once the build context has been resolved, before the BuildFunc is called.
+	EventContextResolved EventType = "context-resolved"
+
+	// EventBuildFuncReturned is sent once the BuildFunc has returned a result without error.
+	EventBuildFuncReturned EventType = "build-func-returned"
+
+	// EventLayerWritten is sent once a contributed layer's environment and metadata have been written and its layer
+	// persistence hooks have run. Layer is the name of the layer and Path is its metadata file.
+	EventLayerWritten EventType = "layer-written"
+
+	// EventFileRemoved is sent once the metadata or SBOM file of a layer that was not contributed has been removed.
+	// Path is the removed file.
+	EventFileRemoved EventType = "file-removed"
+
+	// EventLaunchMetadataWritten is sent once launch.toml has been written. Path is the written file.
+	EventLaunchMetadataWritten EventType = "launch-metadata-written"
+
+	// EventBuildMetadataWritten is sent once build.toml has been written. Path is the written file.
+	EventBuildMetadataWritten EventType = "build-metadata-written"
+
+	// EventPersistentMetadataWritten is sent once store.toml has been written. Path is the written file.
+	EventPersistentMetadataWritten EventType = "persistent-metadata-written"
+
+	// EventFinished is sent once Build has completed successfully. It is the last event.
+	EventFinished EventType = "finished"
+
+	// EventFailed is sent when Build fails. Err is the error passed to the exit handler. It is the last event.
+	EventFailed EventType = "failed"
+)
+
+// Event is a step of Build.
+type Event struct {
+	// Type is the type of the event.
+	Type EventType
+
+	// Layer is the name of the layer the event concerns, if any.
+	Layer string
+
+	// Path is the path of the file the event concerns, if any.
+	Path string
+
+	// Err is the error that caused an EventFailed.
+	Err error
+}
+
+//go:generate mockery --name Observer --case=underscore
+
+// Observer is the interface implemented by a type that wants to follow the steps of Build, such as a framework
+// presenting progress. Events are sent in the order the steps are taken, from the goroutine that called Build. In
+// dry-run mode, events describe the changes that would be made.
+type Observer interface {
+
+	// Observe is called with each event.
+	Observe(event Event)
+}
+
+// observe sends event to the configured Observer, if any.
+func (c Config) observe(event Event) {
+	if c.observer != nil {
+		c.observer.Observe(event)
+	}
+}
+
+// observingExitHandler sends an EventFailed to an Observer before delegating errors to an ExitHandler.
+type observingExitHandler struct {
+	ExitHandler
+	observer Observer
+}
+
+func (o observingExitHandler) Error(err error) {
+	o.observer.Observe(Event{Type: EventFailed, Err: err})
+	o.ExitHandler.Error(err)
+}
@@ -20,12 +20,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/Masterminds/semver"
+
 	"github.com/buildpacks/libcnb/v2/internal"
 )
 
@@ -56,6 +59,10 @@ const (
 	// EnvOutputDirectory is the name of the environment variable that contains the path to the output directory
 	EnvOutputDirectory = "CNB_OUTPUT_DIR"
 
+	// EnvPlatformAPI is the name of the environment variable that contains the Platform API version used by the
+	// lifecycle
+	EnvPlatformAPI = "CNB_PLATFORM_API"
+
 	// EnvPlatformDirectory is the name of the environment variable that contains the path to the platform directory
 	EnvPlatformDirectory = "CNB_PLATFORM_DIR"
 
@@ -83,6 +90,10 @@ const (
 	// EnvTargetDistroVersion contains the version of the distro
 	EnvTargetDistroVersion = "CNB_TARGET_DISTRO_VERSION"
 
+	// EnvUserID is the name of the environment variable, set by the build image, that contains the ID of the user builds
+	// are expected to run as
+	EnvUserID = "CNB_USER_ID"
+
 	// DefaultPlatformBindingsLocation is the typical location for bindings, which exists under the platform directory
 	//
 	// Not guaranteed to exist, but often does. This should only be used as a fallback if EnvServiceBindings and EnvPlatformDirectory are not set
@@ -108,8 +119,72 @@ type Binding struct {
 	Secret map[string]string
 }
 
+// BindingOption is a function for configuring how bindings are created.
+type BindingOption func(config bindingConfig) bindingConfig
+
+type bindingConfig struct {
+	preserveWhitespace bool
+	configMapOptions   internal.ConfigMapOptions
+}
+
+// PreserveWhitespace creates a BindingOption that keeps leading and trailing whitespace in secret values, which are
+// otherwise trimmed. Use it for secrets where whitespace is significant, such as PEM blocks with trailing newlines.
+func PreserveWhitespace() BindingOption {
+	return func(config bindingConfig) bindingConfig {
+		config.preserveWhitespace = true
+		return config
+	}
+}
+
+// FlattenSubdirectories creates a BindingOption that reads files one level of subdirectories deep, such as those in
+// Kubernetes projected volumes, as secrets named <subdirectory>.<file>. Subdirectories are otherwise ignored. Note
+// that SecretFilePath and SecretReader do not map such names back to their files.
+func FlattenSubdirectories() BindingOption {
+	return func(config bindingConfig) bindingConfig {
+		config.configMapOptions.Depth = 1
+		config.configMapOptions.Delimiter = "."
+		return config
+	}
+}
+
+// RecurseSubdirectories creates a BindingOption that reads files in all levels of subdirectories as secrets named by
+// joining their path elements with the delimiter. Subdirectories are otherwise ignored.
+func RecurseSubdirectories(delimiter string) BindingOption {
+	return func(config bindingConfig) bindingConfig {
+		config.configMapOptions.Depth = -1
+		config.configMapOptions.Delimiter = delimiter
+		return config
+	}
+}
+
+// MaxSecretSize creates a BindingOption that sets the maximum size, in bytes, of a secret file, so that a malformed
+// binding cannot exhaust memory. Secrets of any size are read by default, or if the size is zero or negative.
+func MaxSecretSize(size int64) BindingOption {
+	return func(config bindingConfig) bindingConfig {
+		config.configMapOptions.MaxFileSize = size
+		return config
+	}
+}
+
+func newBindingConfig(options []BindingOption) bindingConfig {
+	config := bindingConfig{}
+	for _, option := range options {
+		if option != nil {
+			config = option(config)
+		}
+	}
+	return config
+}
+
 // NewBinding creates a new Binding initialized with a secret.
 func NewBinding(name string, path string, secret map[string]string) Binding {
+	return NewBindingWithOptions(name, path, secret)
+}
+
+// NewBindingWithOptions creates a new Binding initialized with a secret, configured by the options.
+func NewBindingWithOptions(name string, path string, secret map[string]string, options ...BindingOption) Binding {
+	config := newBindingConfig(options)
+
 	b := Binding{
 		Name:   name,
 		Path:   path,
@@ -123,7 +198,11 @@ func NewBinding(name string, path string, secret map[string]string) Binding {
 		case BindingProvider:
 			b.Provider = strings.TrimSpace(v)
 		default:
-			b.Secret[k] = strings.TrimSpace(v)
+			if config.preserveWhitespace {
+				b.Secret[k] = v
+			} else {
+				b.Secret[k] = strings.TrimSpace(v)
+			}
 		}
 	}
 
@@ -132,12 +211,17 @@ func NewBinding(name string, path string, secret map[string]string) Binding {
 
 // NewBindingFromPath creates a new binding from the files located at a path.
 func NewBindingFromPath(path string) (Binding, error) {
-	secret, err := internal.NewConfigMapFromPath(path)
+	return NewBindingFromPathWithOptions(path)
+}
+
+// NewBindingFromPathWithOptions creates a new binding from the files located at a path, configured by the options.
+func NewBindingFromPathWithOptions(path string, options ...BindingOption) (Binding, error) {
+	secret, err := internal.NewConfigMapFromPathWithOptions(path, newBindingConfig(options).configMapOptions)
 	if err != nil {
 		return Binding{}, fmt.Errorf("unable to create new config map from %s\n%w", path, err)
 	}
 
-	return NewBinding(filepath.Base(path), path, secret), nil
+	return NewBindingWithOptions(filepath.Base(path), path, secret, options...), nil
 }
 
 func (b Binding) String() string {
@@ -160,11 +244,50 @@ func (b Binding) SecretFilePath(name string) (string, bool) {
 	return filepath.Join(b.Path, name), true
 }
 
+// SecretReader opens the secret with the given name for reading. When the binding has a Path, the secret file is
+// opened on demand rather than read from Secret, so that large secrets such as certificate bundles need not be held in
+// memory, and its contents are not trimmed. Bindings without a Path, such as those from VCAP_SERVICES, are read from
+// Secret.
+func (b Binding) SecretReader(name string) (io.ReadCloser, error) {
+	if b.Path == "" {
+		v, ok := b.Secret[name]
+		if !ok {
+			return nil, fmt.Errorf("binding %s does not contain secret %s", b.Name, name)
+		}
+		return io.NopCloser(strings.NewReader(v)), nil
+	}
+
+	file := filepath.Join(b.Path, name)
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open secret %s\n%w", file, err)
+	}
+
+	return f, nil
+}
+
 // Bindings is a collection of bindings keyed by their name.
 type Bindings []Binding
 
+// OfType returns the bindings of the given type, compared case-insensitively, in their original order.
+func (b Bindings) OfType(bindingType string) Bindings {
+	var matches Bindings
+	for _, binding := range b {
+		if strings.EqualFold(binding.Type, bindingType) {
+			matches = append(matches, binding)
+		}
+	}
+	return matches
+}
+
 // NewBindingsFromPath creates a new instance from all the bindings at a given path.
 func NewBindingsFromPath(path string) (Bindings, error) {
+	return NewBindingsFromPathWithOptions(path)
+}
+
+// NewBindingsFromPathWithOptions creates a new instance from all the bindings at a given path, configured by the
+// options.
+func NewBindingsFromPathWithOptions(path string, options ...BindingOption) (Bindings, error) {
 	files, err := os.ReadDir(path)
 	if err != nil && errors.Is(err, fs.ErrNotExist) {
 		return Bindings{}, nil
@@ -180,7 +303,7 @@ func NewBindingsFromPath(path string) (Bindings, error) {
 			// ignore hidden files
 			continue
 		}
-		binding, err := NewBindingFromPath(bindingPath)
+		binding, err := NewBindingFromPathWithOptions(bindingPath, options...)
 		if err != nil {
 			return nil, fmt.Errorf("unable to create new binding from %s\n%w", file, err)
 		}
@@ -246,24 +369,38 @@ func NewBindingsFromVcapServicesEnv(content string) (Bindings, error) {
 // If that isn't defined, bindings are read from $VCAP_SERVICES.
 // If that isn't defined, the specified platform path will be used
 func NewBindings(platformDir string) (Bindings, error) {
-	if path, ok := os.LookupEnv(EnvServiceBindings); ok {
-		return NewBindingsFromPath(path)
+	return NewBindingsWithOptions(platformDir)
+}
+
+// NewBindingsWithOptions creates a new bindings in the same way as NewBindings, configured by the options.
+func NewBindingsWithOptions(platformDir string, options ...BindingOption) (Bindings, error) {
+	return newBindings(environmentMap(os.Environ()), platformDir, options...)
+}
+
+// newBindings creates a new bindings in the same way as NewBindingsWithOptions, reading the environment variables from
+// env rather than the process environment.
+func newBindings(env map[string]string, platformDir string, options ...BindingOption) (Bindings, error) {
+	if path, ok := env[EnvServiceBindings]; ok {
+		return NewBindingsFromPathWithOptions(path, options...)
 	}
 
-	if path, ok := os.LookupEnv(EnvPlatformDirectory); ok {
-		return NewBindingsFromPath(filepath.Join(path, "bindings"))
+	if path, ok := env[EnvPlatformDirectory]; ok {
+		return NewBindingsFromPathWithOptions(filepath.Join(path, "bindings"), options...)
 	}
 
-	if content, ok := os.LookupEnv(EnvVcapServices); ok {
+	if content, ok := env[EnvVcapServices]; ok {
 		return NewBindingsFromVcapServicesEnv(content)
 	}
 
-	return NewBindingsFromPath(filepath.Join(platformDir, "bindings"))
+	return NewBindingsFromPathWithOptions(filepath.Join(platformDir, "bindings"), options...)
 }
 
 // Platform is the contents of the platform directory.
 type Platform struct {
 
+	// API is the Platform API version used by the lifecycle, if the lifecycle provides it.
+	API string
+
 	// Bindings are the external bindings available to the application.
 	Bindings Bindings
 
@@ -273,3 +410,71 @@ type Platform struct {
 	// Path is the path to the platform.
 	Path string
 }
+
+// PlatformFeature is a capability of a platform that depends on its Platform API version.
+type PlatformFeature string
+
+const (
+	// PlatformFeatureSBOM is support for exporting SBOM files contributed by buildpacks.
+	PlatformFeatureSBOM PlatformFeature = "sbom"
+
+	// PlatformFeatureExtensions is support for image extensions.
+	PlatformFeatureExtensions PlatformFeature = "extensions"
+
+	// PlatformFeatureTargets is support for providing target information through CNB_TARGET_* variables.
+	PlatformFeatureTargets PlatformFeature = "targets"
+
+	// PlatformFeatureRunImageExtension is support for image extensions switching and extending the run image.
+	PlatformFeatureRunImageExtension PlatformFeature = "run-image-extension"
+)
+
+var platformFeatureAPIs = map[PlatformFeature]string{
+	PlatformFeatureSBOM:              "0.8",
+	PlatformFeatureExtensions:        "0.10",
+	PlatformFeatureTargets:           "0.12",
+	PlatformFeatureRunImageExtension: "0.12",
+}
+
+// SupportsFeature returns whether the platform's API version supports the feature. It returns false when the API
+// version is unknown, either because the lifecycle did not provide it or it cannot be parsed, or the feature is unknown.
+func (p Platform) SupportsFeature(feature PlatformFeature) bool {
+	minimum, ok := platformFeatureAPIs[feature]
+	if !ok || p.API == "" {
+		return false
+	}
+
+	api, err := semver.NewVersion(p.API)
+	if err != nil {
+		return false
+	}
+
+	return !api.LessThan(semver.MustParse(minimum))
+}
+
+// EffectiveEnvironment returns the environment a buildpack process runs with, given the lifecycle environment environ
+// (typically os.Environ()) and the buildpack's clear-env setting. When clear-env is false the lifecycle exports the
+// platform environment, so its values take precedence over environ. When clear-env is true the lifecycle does not
+// export it, so any platform variables present in environ were leaked from the host and are removed.
+func EffectiveEnvironment(info BuildpackInfo, platform Platform, environ []string) map[string]string {
+	env := environmentMap(environ)
+	for k, v := range platform.Environment {
+		if info.ClearEnvironment {
+			delete(env, k)
+		} else {
+			env[k] = v
+		}
+	}
+
+	return env
+}
+
+// environmentMap converts environ, a list of key=value strings, to a map. Later values for a key replace earlier ones.
+func environmentMap(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, e := range environ {
+		if k, v, ok := strings.Cut(e, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
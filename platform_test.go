@@ -17,7 +17,10 @@
 package libcnb_test
 
 import (
+	gocontext "context"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
@@ -150,6 +153,63 @@ func testPlatform(t *testing.T, context spec.G, it spec.S) {
 				Expect(secretFilePath).To(Equal(filepath.Join(path, "test-secret-key")))
 			})
 
+			it("streams secrets from the binding path", func() {
+				binding, err := libcnb.NewBindingFromPath(filepath.Join(path, "alpha"))
+				Expect(err).NotTo(HaveOccurred())
+
+				r, err := binding.SecretReader("test-secret-key")
+				Expect(err).NotTo(HaveOccurred())
+				defer r.Close()
+
+				Expect(io.ReadAll(r)).To(Equal([]byte("test-secret-value")))
+
+				_, err = binding.SecretReader("dne")
+				Expect(err).To(MatchError(ContainSubstring("unable to open secret %s", filepath.Join(path, "alpha", "dne"))))
+			})
+
+			it("streams secrets from a binding without a path", func() {
+				binding := libcnb.Binding{Name: "test-name", Secret: map[string]string{"test-key": "test-value"}}
+
+				r, err := binding.SecretReader("test-key")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(io.ReadAll(r)).To(Equal([]byte("test-value")))
+
+				_, err = binding.SecretReader("dne")
+				Expect(err).To(MatchError("binding test-name does not contain secret dne"))
+			})
+
+			it("preserves whitespace in secrets", func() {
+				path := filepath.Join(path, "alpha")
+				Expect(os.WriteFile(filepath.Join(path, "test-pem"), []byte("test-value\n"), 0600)).To(Succeed())
+
+				binding, err := libcnb.NewBindingFromPathWithOptions(path, libcnb.PreserveWhitespace())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Secret["test-pem"]).To(Equal("test-value\n"))
+				Expect(binding.Type).To(Equal("test-type"))
+
+				binding, err = libcnb.NewBindingFromPath(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Secret["test-pem"]).To(Equal("test-value"))
+			})
+
+			it("flattens subdirectories", func() {
+				path := filepath.Join(path, "alpha")
+				Expect(os.MkdirAll(filepath.Join(path, "test-directory"), 0755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(path, "test-directory", "test-key"), []byte("test-value"), 0600)).To(Succeed())
+
+				binding, err := libcnb.NewBindingFromPathWithOptions(path, libcnb.FlattenSubdirectories())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Secret).To(HaveKeyWithValue("test-directory.test-key", "test-value"))
+
+				binding, err = libcnb.NewBindingFromPathWithOptions(path, libcnb.RecurseSubdirectories("_"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Secret).To(HaveKeyWithValue("test-directory_test-key", "test-value"))
+
+				binding, err = libcnb.NewBindingFromPath(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.Secret).NotTo(HaveKey("test-directory.test-key"))
+			})
+
 			it("sanitizes secrets", func() {
 				path := filepath.Join(path, "alpha")
 
@@ -180,6 +240,16 @@ func testPlatform(t *testing.T, context spec.G, it spec.S) {
 				}))
 			})
 
+			it("creates bindings with options", func() {
+				Expect(os.WriteFile(filepath.Join(path, "alpha", "test-pem"), []byte("test-value\n"), 0600)).To(Succeed())
+				Expect(os.Setenv(libcnb.EnvServiceBindings, path))
+				defer os.Unsetenv(libcnb.EnvServiceBindings)
+
+				bindings, err := libcnb.NewBindingsWithOptions(libcnb.DefaultPlatformBindingsLocation, libcnb.PreserveWhitespace())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(bindings[0].Secret["test-pem"]).To(Equal("test-value\n"))
+			})
+
 			it("creates an empty binding if path does not exist", func() {
 				Expect(libcnb.NewBindingsFromPath("/path/doesnt/exist")).To(Equal(libcnb.Bindings{}))
 			})
@@ -239,4 +309,132 @@ func testPlatform(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 	})
+
+	context("EffectiveEnvironment", func() {
+		var (
+			environ  []string
+			platform libcnb.Platform
+		)
+
+		it.Before(func() {
+			environ = []string{"HOST_KEY=host-value", "SHARED_KEY=host-value", "MALFORMED"}
+			platform = libcnb.Platform{Environment: map[string]string{
+				"PLATFORM_KEY": "platform-value",
+				"SHARED_KEY":   "platform-value",
+			}}
+		})
+
+		it("exports the platform environment", func() {
+			Expect(libcnb.EffectiveEnvironment(libcnb.BuildpackInfo{}, platform, environ)).To(Equal(map[string]string{
+				"HOST_KEY":     "host-value",
+				"PLATFORM_KEY": "platform-value",
+				"SHARED_KEY":   "platform-value",
+			}))
+		})
+
+		it("removes leaked platform variables when clearing the environment", func() {
+			info := libcnb.BuildpackInfo{ClearEnvironment: true}
+
+			Expect(libcnb.EffectiveEnvironment(info, platform, environ)).To(Equal(map[string]string{
+				"HOST_KEY": "host-value",
+			}))
+		})
+	})
+
+	context("SupportsFeature", func() {
+		it("supports features introduced at or before the platform API", func() {
+			platform := libcnb.Platform{API: "0.10"}
+
+			Expect(platform.SupportsFeature(libcnb.PlatformFeatureSBOM)).To(BeTrue())
+			Expect(platform.SupportsFeature(libcnb.PlatformFeatureExtensions)).To(BeTrue())
+			Expect(platform.SupportsFeature(libcnb.PlatformFeatureTargets)).To(BeFalse())
+		})
+
+		it("does not support features when the platform API is unknown", func() {
+			Expect(libcnb.Platform{}.SupportsFeature(libcnb.PlatformFeatureSBOM)).To(BeFalse())
+			Expect(libcnb.Platform{API: "invalid"}.SupportsFeature(libcnb.PlatformFeatureSBOM)).To(BeFalse())
+		})
+
+		it("does not support unknown features", func() {
+			Expect(libcnb.Platform{API: "0.12"}.SupportsFeature("dne")).To(BeFalse())
+		})
+	})
+
+	it("returns the bindings of a type", func() {
+		bindings := libcnb.Bindings{
+			{Name: "alpha", Type: "PostgreSQL"},
+			{Name: "bravo", Type: "mysql"},
+			{Name: "charlie", Type: "postgresql"},
+		}
+
+		Expect(bindings.OfType("postgresql")).To(Equal(libcnb.Bindings{
+			{Name: "alpha", Type: "PostgreSQL"},
+			{Name: "charlie", Type: "postgresql"},
+		}))
+		Expect(bindings.OfType("redis")).To(BeEmpty())
+	})
+
+	context("SecretStores", func() {
+		var stores libcnb.SecretStores
+
+		it.Before(func() {
+			stores = libcnb.SecretStores{
+				"test": libcnb.SecretStoreFunc(func(_ gocontext.Context, binding libcnb.Binding, reference *url.URL) (map[string]string, error) {
+					if reference.Host == "missing" {
+						return nil, fmt.Errorf("secret %s not found", reference.Path)
+					}
+					return map[string]string{"username": binding.Name + reference.Path, "password": "resolved"}, nil
+				}),
+			}
+		})
+
+		it("resolves a secret reference", func() {
+			binding := libcnb.Binding{Name: "alpha", Type: "test-type", Secret: map[string]string{
+				"type":                        "test-type",
+				"password":                    "override",
+				libcnb.BindingSecretReference: "test://store/app",
+			}}
+
+			Expect(stores.Resolve(gocontext.Background(), binding)).To(Equal(libcnb.Binding{
+				Name: "alpha",
+				Type: "test-type",
+				Secret: map[string]string{
+					"type":     "test-type",
+					"username": "alpha/app",
+					"password": "override",
+				},
+			}))
+		})
+
+		it("returns a binding without a reference unchanged", func() {
+			binding := libcnb.Binding{Name: "alpha", Secret: map[string]string{"username": "test-username"}}
+
+			Expect(stores.Resolve(gocontext.Background(), binding)).To(Equal(binding))
+		})
+
+		it("fails without a store for the scheme", func() {
+			binding := libcnb.Binding{Name: "alpha", Secret: map[string]string{libcnb.BindingSecretReference: "vault://secret/app"}}
+
+			_, err := stores.Resolve(gocontext.Background(), binding)
+			Expect(err).To(MatchError(`unable to resolve secret reference of binding alpha: no secret store for scheme "vault"`))
+		})
+
+		it("fails when the store fails", func() {
+			binding := libcnb.Binding{Name: "alpha", Secret: map[string]string{libcnb.BindingSecretReference: "test://missing/app"}}
+
+			_, err := stores.Resolve(gocontext.Background(), binding)
+			Expect(err).To(MatchError("unable to resolve secret reference of binding alpha\nsecret /app not found"))
+		})
+	})
+
+	it("limits the size of secrets", func() {
+		Expect(os.MkdirAll(filepath.Join(path, "alpha"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "alpha", "type"), []byte("test-type"), 0600)).To(Succeed())
+
+		_, err := libcnb.NewBindingsFromPathWithOptions(path, libcnb.MaxSecretSize(4))
+		Expect(err).To(MatchError(ContainSubstring("is larger than the maximum of 4 bytes")))
+
+		_, err = libcnb.NewBindingsFromPathWithOptions(path, libcnb.MaxSecretSize(4), libcnb.MaxSecretSize(0))
+		Expect(err).NotTo(HaveOccurred())
+	})
 }
@@ -16,6 +16,31 @@
 
 package libcnb
 
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Well-known process types.
+const (
+	// ProcessTypeWeb is the type of a process that serves requests, and the type platforms commonly expect the default
+	// process to have.
+	ProcessTypeWeb = "web"
+
+	// ProcessTypeWorker is the type of a long-running process that does not serve requests.
+	ProcessTypeWorker = "worker"
+
+	// ProcessTypeTask is the type of a process that runs to completion.
+	ProcessTypeTask = "task"
+)
+
+// validProcessType matches process types permitted by the buildpack specification.
+var validProcessType = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
 // Process represents metadata about a type of command that can be run.
 type Process struct {
 	// Type is the type of the process.
@@ -33,4 +58,119 @@ type Process struct {
 	// Default can be set to true to indicate that the process
 	// type being defined should be the default process type for the app image.
 	Default bool `toml:"default,omitempty"`
+
+	// Direct indicates that the process is executed without a shell. It is only meaningful before Buildpack API 0.9,
+	// since later versions execute every process directly.
+	Direct bool `toml:"direct,omitempty"`
+}
+
+// NewShellProcess creates a Process that runs the given script in a shell, in the form expected by the given Buildpack
+// API version. Before Buildpack API 0.9 the lifecycle wraps the command in a shell itself. Since Buildpack API 0.9 it
+// no longer does, so the script is run with bash and cannot be overridden by the user.
+func NewShellProcess(api string, script string) Process {
+	if !APIFeatures(api).ExecutesProcessesDirectly {
+		return Process{
+			Command: []string{script},
+		}
+	}
+
+	return Process{
+		Command: []string{"bash", "-c", script},
+	}
+}
+
+// NewDirectProcess creates a Process that executes argv directly, without a shell, in the form expected by the given
+// Buildpack API version. The first element is the command and the remaining elements are its arguments, which the user
+// may override when launching the image.
+func NewDirectProcess(api string, argv ...string) Process {
+	if len(argv) == 0 {
+		return Process{}
+	}
+
+	return Process{
+		Command:   argv[:1],
+		Arguments: argv[1:],
+		Direct:    !APIFeatures(api).ExecutesProcessesDirectly,
+	}
+}
+
+// processWarnings returns warnings for processes with invalid types and, if expectedDefault is set, for a default
+// process without that type.
+func processWarnings(processes []Process, expectedDefault string) []string {
+	var warnings []string
+
+	var defaults []string
+	for _, p := range processes {
+		if !validProcessType.MatchString(p.Type) {
+			warnings = append(warnings, fmt.Sprintf("Warning: process type %q is invalid; process types must contain only letters, digits, '.', '_', and '-'", p.Type))
+		}
+		if p.Default {
+			defaults = append(defaults, p.Type)
+		}
+	}
+
+	if expectedDefault != "" && len(processes) > 0 {
+		if len(defaults) == 0 {
+			warnings = append(warnings, fmt.Sprintf("Warning: no default process is set; this platform expects the default process to be of type %q", expectedDefault))
+		}
+		for _, d := range defaults {
+			if d != expectedDefault {
+				warnings = append(warnings, fmt.Sprintf("Warning: default process is of type %q; this platform expects the default process to be of type %q", d, expectedDefault))
+			}
+		}
+	}
+
+	return warnings
+}
+
+// processScopedWarnings returns warnings for the launch environment variables and exec.d executables of layers that are
+// specific to a process type none of processes has, as they have no effect unless another buildpack declares that
+// process type. Nothing is checked when processes is empty, as the buildpack then only contributes to the processes of
+// others.
+func processScopedWarnings(layers []Layer, processes []Process) []string {
+	if len(processes) == 0 {
+		return nil
+	}
+
+	declared := map[string]bool{}
+	for _, p := range processes {
+		declared[p.Type] = true
+	}
+
+	var warnings []string
+	for _, l := range layers {
+		types := map[string]bool{}
+		for _, env := range []Environment{l.LaunchEnvironment, l.SharedEnvironment} {
+			for k := range env {
+				if t, _, ok := strings.Cut(k, string(filepath.Separator)); ok {
+					types[t] = true
+				}
+			}
+		}
+
+		if l.Exec.Path != "" {
+			if entries, err := os.ReadDir(l.Exec.Path); err == nil {
+				for _, e := range entries {
+					if e.IsDir() {
+						types[e.Name()] = true
+					}
+				}
+			}
+		}
+
+		var undeclared []string
+		for t := range types {
+			if !declared[t] {
+				undeclared = append(undeclared, t)
+			}
+		}
+		sort.Strings(undeclared)
+
+		for _, t := range undeclared {
+			warnings = append(warnings, fmt.Sprintf("Warning: layer %q contributes launch environment or exec.d executables "+
+				"for process type %q, which is not declared; they have no effect unless another buildpack declares it", l.Name, t))
+		}
+	}
+
+	return warnings
 }
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func testProcess(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("Buildpack API 0.9 and later", func() {
+		it("creates a shell process", func() {
+			Expect(libcnb.NewShellProcess("0.10", "echo $HOME && exec server")).To(Equal(libcnb.Process{
+				Command: []string{"bash", "-c", "echo $HOME && exec server"},
+			}))
+		})
+
+		it("creates a direct process", func() {
+			Expect(libcnb.NewDirectProcess("0.9", "server", "--port", "8080")).To(Equal(libcnb.Process{
+				Command:   []string{"server"},
+				Arguments: []string{"--port", "8080"},
+			}))
+		})
+
+		it("creates a direct process without arguments", func() {
+			Expect(libcnb.NewDirectProcess("0.10", "server")).To(Equal(libcnb.Process{
+				Command:   []string{"server"},
+				Arguments: []string{},
+			}))
+		})
+	})
+
+	context("before Buildpack API 0.9", func() {
+		it("creates a shell process", func() {
+			Expect(libcnb.NewShellProcess("0.8", "echo $HOME && exec server")).To(Equal(libcnb.Process{
+				Command: []string{"echo $HOME && exec server"},
+			}))
+		})
+
+		it("creates a direct process", func() {
+			Expect(libcnb.NewDirectProcess("0.8", "server", "--port", "8080")).To(Equal(libcnb.Process{
+				Command:   []string{"server"},
+				Arguments: []string{"--port", "8080"},
+				Direct:    true,
+			}))
+		})
+	})
+
+	it("creates an empty direct process", func() {
+		Expect(libcnb.NewDirectProcess("0.10")).To(Equal(libcnb.Process{}))
+	})
+}
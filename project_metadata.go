@@ -0,0 +1,232 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ProjectMetadataLabel is the key of the image label that describes the source of the application.
+	ProjectMetadataLabel = "io.buildpacks.project.metadata"
+
+	// EnvProjectRepository is the name of the environment variable that contains the URL of the repository the
+	// application was built from. It takes precedence over the repository detected in the application directory.
+	EnvProjectRepository = "BP_PROJECT_REPOSITORY"
+
+	// EnvProjectCommit is the name of the environment variable that contains the commit the application was built from.
+	// It takes precedence over the commit detected in the application directory.
+	EnvProjectCommit = "BP_PROJECT_COMMIT"
+)
+
+// ProjectMetadata is the value of the io.buildpacks.project.metadata image label.
+type ProjectMetadata struct {
+	// Source is the source of the application.
+	Source *ProjectSource `json:"source,omitempty"`
+}
+
+// ProjectSource describes where the application was built from.
+type ProjectSource struct {
+	// Type is the type of the source, such as git.
+	Type string `json:"type"`
+
+	// Version identifies the version of the source, such as the commit.
+	Version map[string]interface{} `json:"version"`
+
+	// Metadata is additional information about the source, such as the repository.
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// NewProjectMetadata creates the project metadata of the application at applicationPath. The repository and commit are
+// taken from $BP_PROJECT_REPOSITORY and $BP_PROJECT_COMMIT and, where those are not set, from the application's git
+// directory: the commit HEAD resolves to and the URL of the origin remote. Source is nil if neither is known.
+func NewProjectMetadata(applicationPath string) (ProjectMetadata, error) {
+	repository, commit, err := gitSource(applicationPath)
+	if err != nil {
+		return ProjectMetadata{}, err
+	}
+
+	if s, ok := os.LookupEnv(EnvProjectRepository); ok {
+		repository = s
+	}
+	if s, ok := os.LookupEnv(EnvProjectCommit); ok {
+		commit = s
+	}
+
+	if repository == "" && commit == "" {
+		return ProjectMetadata{}, nil
+	}
+
+	source := &ProjectSource{Type: "git", Version: map[string]interface{}{}, Metadata: map[string]interface{}{}}
+	if commit != "" {
+		source.Version["commit"] = commit
+	}
+	if repository != "" {
+		source.Metadata["repository"] = repository
+	}
+
+	return ProjectMetadata{Source: source}, nil
+}
+
+// AddProjectMetadataLabel adds the io.buildpacks.project.metadata image label, created by NewProjectMetadata, so that
+// the image records the repository and commit it was built from. The label is only added if either is known. An
+// existing label with the same key is replaced.
+func (b *BuildResult) AddProjectMetadataLabel(applicationPath string) error {
+	metadata, err := NewProjectMetadata(applicationPath)
+	if err != nil {
+		return err
+	}
+
+	if metadata.Source == nil {
+		return nil
+	}
+
+	value, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("unable to marshal project metadata\n%w", err)
+	}
+
+	b.setLabel(Label{Key: ProjectMetadataLabel, Value: string(value)})
+	return nil
+}
+
+// gitSource returns the URL of the origin remote and the commit HEAD resolves to in the git directory of the
+// application. Both are empty if the application is not a git repository.
+func gitSource(applicationPath string) (string, string, error) {
+	dir := filepath.Join(applicationPath, ".git")
+
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", fmt.Errorf("unable to stat %s\n%w", dir, err)
+	}
+
+	if !info.IsDir() {
+		// worktrees and submodules point to their git directory with a gitdir file
+		b, err := os.ReadFile(dir)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to read %s\n%w", dir, err)
+		}
+		s := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(b)), "gitdir:"))
+		if !filepath.IsAbs(s) {
+			s = filepath.Join(applicationPath, s)
+		}
+		dir = s
+	}
+
+	commit, err := gitHead(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	repository, err := gitOriginURL(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	return repository, commit, nil
+}
+
+func gitHead(dir string) (string, error) {
+	file := filepath.Join(dir, "HEAD")
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to read %s\n%w", file, err)
+	}
+
+	head := strings.TrimSpace(string(b))
+	ref, ok := strings.CutPrefix(head, "ref:")
+	if !ok {
+		return head, nil
+	}
+	ref = strings.TrimSpace(ref)
+
+	file = filepath.Join(dir, filepath.FromSlash(ref))
+	if b, err = os.ReadFile(file); err == nil {
+		return strings.TrimSpace(string(b)), nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("unable to read %s\n%w", file, err)
+	}
+
+	file = filepath.Join(dir, "packed-refs")
+	if b, err = os.ReadFile(file); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to read %s\n%w", file, err)
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		if commit, name, ok := strings.Cut(strings.TrimSpace(line), " "); ok && name == ref {
+			return commit, nil
+		}
+	}
+
+	// an unborn branch has no commit
+	return "", nil
+}
+
+func gitOriginURL(dir string) (string, error) {
+	file := filepath.Join(dir, "config")
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to open %s\n%w", file, err)
+	}
+	defer f.Close()
+
+	origin := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			origin = line == `[remote "origin"]`
+			continue
+		}
+
+		if key, value, ok := strings.Cut(line, "="); origin && ok && strings.TrimSpace(key) == "url" {
+			return withoutUserInfo(strings.TrimSpace(value)), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("unable to read %s\n%w", file, err)
+	}
+
+	return "", nil
+}
+
+// withoutUserInfo removes credentials from a repository URL, as the URL ends up in an image label.
+func withoutUserInfo(repository string) string {
+	u, err := url.Parse(repository)
+	if err != nil || u.User == nil {
+		return repository
+	}
+
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package reproducible contains helpers for producing files whose metadata does not vary between builds.
+package reproducible
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// EnvSourceDateEpoch is the name of the environment variable containing the timestamp, in seconds since the Unix
+// epoch, that reproducible builds should use for file modification times.
+const EnvSourceDateEpoch = "SOURCE_DATE_EPOCH"
+
+// SourceDateEpoch returns the time specified by $SOURCE_DATE_EPOCH, as found by lookup, and whether it is set. Pass
+// os.LookupEnv to read the process environment.
+func SourceDateEpoch(lookup func(key string) (string, bool)) (time.Time, bool, error) {
+	s, ok := lookup(EnvSourceDateEpoch)
+	if !ok || s == "" {
+		return time.Time{}, false, nil
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("unable to parse %s value %q\n%w", EnvSourceDateEpoch, s, err)
+	}
+
+	return time.Unix(i, 0).UTC(), true, nil
+}
+
+// Touch sets the access and modification times of path, and everything beneath it if it is a directory, to the time
+// specified by $SOURCE_DATE_EPOCH, as found by lookup. Symbolic links are not followed. If $SOURCE_DATE_EPOCH is not
+// set, Touch does nothing.
+func Touch(path string, lookup func(key string) (string, bool)) error {
+	t, ok, err := SourceDateEpoch(lookup)
+	if err != nil || !ok {
+		return err
+	}
+
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		if err := os.Chtimes(p, t, t); err != nil {
+			return fmt.Errorf("unable to set times on %s\n%w", p, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reproducible_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2/reproducible"
+)
+
+func testReproducible(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path string
+	)
+
+	it.Before(func() {
+		path = t.TempDir()
+		Expect(os.MkdirAll(filepath.Join(path, "test-directory"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "test-directory", "test-file"), []byte{}, 0644)).To(Succeed())
+		Expect(os.Symlink("dne", filepath.Join(path, "test-link"))).To(Succeed())
+	})
+
+	context("SOURCE_DATE_EPOCH is set", func() {
+		it.Before(func() {
+			t.Setenv("SOURCE_DATE_EPOCH", "1000000000")
+		})
+
+		it("returns the source date epoch", func() {
+			epoch, ok, err := reproducible.SourceDateEpoch(os.LookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(epoch).To(Equal(time.Unix(1000000000, 0).UTC()))
+		})
+
+		it("sets times recursively", func() {
+			Expect(reproducible.Touch(path, os.LookupEnv)).To(Succeed())
+
+			for _, p := range []string{path, filepath.Join(path, "test-directory"), filepath.Join(path, "test-directory", "test-file")} {
+				info, err := os.Stat(p)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.ModTime()).To(BeTemporally("==", time.Unix(1000000000, 0)))
+			}
+		})
+	})
+
+	context("SOURCE_DATE_EPOCH is not set", func() {
+		it.Before(func() {
+			t.Setenv("SOURCE_DATE_EPOCH", "")
+		})
+
+		it("does not change times", func() {
+			Expect(reproducible.Touch(path, os.LookupEnv)).To(Succeed())
+
+			info, err := os.Stat(filepath.Join(path, "test-directory", "test-file"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ModTime()).To(BeTemporally("~", time.Now(), time.Minute))
+		})
+	})
+
+	it("looks up SOURCE_DATE_EPOCH with the given function", func() {
+		environment := map[string]string{"SOURCE_DATE_EPOCH": "1000000000"}
+		lookup := func(key string) (string, bool) {
+			v, ok := environment[key]
+			return v, ok
+		}
+
+		Expect(reproducible.Touch(path, lookup)).To(Succeed())
+
+		info, err := os.Stat(filepath.Join(path, "test-directory", "test-file"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ModTime()).To(BeTemporally("==", time.Unix(1000000000, 0)))
+	})
+
+	it("returns an error for an invalid value", func() {
+		t.Setenv("SOURCE_DATE_EPOCH", "invalid")
+
+		Expect(reproducible.Touch(path, os.LookupEnv)).To(MatchError(ContainSubstring("unable to parse SOURCE_DATE_EPOCH value \"invalid\"")))
+	})
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sbom describes the components a layer contains as a single logical document that can be encoded in each of
+// the SBOM formats supported by the lifecycle, for use with libcnb.Layer.ContributeSBOM.
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/reproducible"
+)
+
+// Document is a software bill of materials.
+type Document struct {
+	// Name is the name of the subject of the document, such as the layer or the application.
+	Name string
+
+	// Version is the version of the subject of the document.
+	Version string
+
+	// Components are the components the subject contains.
+	Components []Component
+}
+
+// Component is a component listed in a Document.
+type Component struct {
+	// Name is the name of the component.
+	Name string
+
+	// Version is the version of the component.
+	Version string
+
+	// PURL is the package URL of the component.
+	PURL string
+
+	// CPEs are the Common Platform Enumerations of the component.
+	CPEs []string
+
+	// Licenses are the SPDX license identifiers of the component.
+	Licenses []string
+
+	// SHA256 is the SHA256 hash of the component's artifact.
+	SHA256 string
+}
+
+// FromDependencies returns a document describing the dependencies, such as those contributed to a layer by
+// libcnb.Layers.DependencyLayer, including their declared licenses.
+func FromDependencies(name string, version string, dependencies ...libcnb.BuildpackDependency) Document {
+	d := Document{Name: name, Version: version}
+	for _, dependency := range dependencies {
+		d.Components = append(d.Components, Component{
+			Name:     dependency.ID,
+			Version:  dependency.Version,
+			PURL:     dependency.PURL,
+			CPEs:     dependency.CPEs,
+			Licenses: dependency.LicenseIDs(),
+			SHA256:   dependency.SHA256,
+		})
+	}
+
+	return d
+}
+
+// Encode returns the document encoded in format.
+func (d Document) Encode(format libcnb.SBOMFormat) ([]byte, error) {
+	var v interface{}
+
+	switch format {
+	case libcnb.CycloneDXJSON:
+		v = d.cycloneDX()
+	case libcnb.SPDXJSON:
+		s, err := d.spdx()
+		if err != nil {
+			return nil, err
+		}
+		v = s
+	case libcnb.SyftJSON:
+		v = d.syft()
+	default:
+		return nil, fmt.Errorf("unsupported SBOM format %s", format)
+	}
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal %s SBOM\n%w", format.MediaType(), err)
+	}
+
+	return b, nil
+}
+
+func (d Document) cycloneDX() map[string]interface{} {
+	components := []map[string]interface{}{}
+	for _, c := range d.Components {
+		component := map[string]interface{}{
+			"type":    "library",
+			"name":    c.Name,
+			"version": c.Version,
+		}
+		if c.PURL != "" {
+			component["purl"] = c.PURL
+		}
+		if len(c.CPEs) > 0 {
+			component["cpe"] = c.CPEs[0]
+		}
+		if len(c.Licenses) > 0 {
+			var licenses []map[string]interface{}
+			for _, l := range c.Licenses {
+				licenses = append(licenses, map[string]interface{}{"license": map[string]string{"id": l}})
+			}
+			component["licenses"] = licenses
+		}
+		if c.SHA256 != "" {
+			component["hashes"] = []map[string]string{{"alg": "SHA-256", "content": c.SHA256}}
+		}
+		components = append(components, component)
+	}
+
+	return map[string]interface{}{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.4",
+		"version":     1,
+		"metadata": map[string]interface{}{
+			"component": map[string]string{"type": "application", "name": d.Name, "version": d.Version},
+		},
+		"components": components,
+	}
+}
+
+func (d Document) spdx() (map[string]interface{}, error) {
+	created, ok, err := reproducible.SourceDateEpoch(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		created = time.Now().UTC()
+	}
+
+	packages := []map[string]interface{}{}
+	for i, c := range d.Components {
+		p := map[string]interface{}{
+			"SPDXID":           fmt.Sprintf("SPDXRef-Package-%d", i),
+			"name":             c.Name,
+			"versionInfo":      c.Version,
+			"downloadLocation": "NOASSERTION",
+			"licenseConcluded": "NOASSERTION",
+			"licenseDeclared":  "NOASSERTION",
+		}
+		if len(c.Licenses) > 0 {
+			p["licenseDeclared"] = strings.Join(c.Licenses, " AND ")
+		}
+
+		var refs []map[string]string
+		if c.PURL != "" {
+			refs = append(refs, map[string]string{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": c.PURL})
+		}
+		for _, cpe := range c.CPEs {
+			refs = append(refs, map[string]string{"referenceCategory": "SECURITY", "referenceType": "cpe23Type", "referenceLocator": cpe})
+		}
+		if len(refs) > 0 {
+			p["externalRefs"] = refs
+		}
+
+		if c.SHA256 != "" {
+			p["checksums"] = []map[string]string{{"algorithm": "SHA256", "checksumValue": c.SHA256}}
+		}
+		packages = append(packages, p)
+	}
+
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              d.Name,
+		"documentNamespace": fmt.Sprintf("https://buildpacks.io/spdx/%s-%s", d.Name, d.digest()),
+		"creationInfo": map[string]interface{}{
+			"created":  created.Format(time.RFC3339),
+			"creators": []string{"Tool: libcnb"},
+		},
+		"packages": packages,
+	}, nil
+}
+
+func (d Document) syft() map[string]interface{} {
+	artifacts := []map[string]interface{}{}
+	for i, c := range d.Components {
+		licenses := c.Licenses
+		if licenses == nil {
+			licenses = []string{}
+		}
+		cpes := c.CPEs
+		if cpes == nil {
+			cpes = []string{}
+		}
+
+		artifacts = append(artifacts, map[string]interface{}{
+			"id":        fmt.Sprintf("%s-%d", d.digest()[:16], i),
+			"name":      c.Name,
+			"version":   c.Version,
+			"type":      "UnknownPackage",
+			"foundBy":   "libcnb",
+			"locations": []string{},
+			"licenses":  licenses,
+			"language":  "",
+			"cpes":      cpes,
+			"purl":      c.PURL,
+		})
+	}
+
+	return map[string]interface{}{
+		"artifacts":             artifacts,
+		"artifactRelationships": []string{},
+		"source":                map[string]string{"type": "directory", "target": d.Name},
+		"distro":                map[string]string{},
+		"descriptor":            map[string]string{"name": "libcnb"},
+		"schema": map[string]string{
+			"version": "16.0.0",
+			"url":     "https://raw.githubusercontent.com/anchore/syft/main/schema/json/schema-16.0.0.json",
+		},
+	}
+}
+
+// digest returns a hash of the document, identifying it within encodings that require a unique identifier.
+func (d Document) digest() string {
+	b, _ := json.Marshal(d)
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:])
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sbom_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/sbom"
+)
+
+func testDocument(t *testing.T, _ spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		document = sbom.Document{
+			Name:    "test-layer",
+			Version: "1.1.1",
+			Components: []sbom.Component{
+				{
+					Name:     "test-name",
+					Version:  "2.2.2",
+					PURL:     "pkg:generic/test-name@2.2.2",
+					CPEs:     []string{"cpe:2.3:a:test:test-name:2.2.2:*:*:*:*:*:*:*"},
+					Licenses: []string{"Apache-2.0"},
+					SHA256:   "test-sha256",
+				},
+			},
+		}
+	)
+
+	decode := func(format libcnb.SBOMFormat) map[string]interface{} {
+		b, err := document.Encode(format)
+		Expect(err).NotTo(HaveOccurred())
+
+		var v map[string]interface{}
+		Expect(json.Unmarshal(b, &v)).To(Succeed())
+		return v
+	}
+
+	it("encodes CycloneDX", func() {
+		v := decode(libcnb.CycloneDXJSON)
+
+		Expect(v["bomFormat"]).To(Equal("CycloneDX"))
+		Expect(v["components"]).To(Equal([]interface{}{
+			map[string]interface{}{
+				"type":     "library",
+				"name":     "test-name",
+				"version":  "2.2.2",
+				"purl":     "pkg:generic/test-name@2.2.2",
+				"cpe":      "cpe:2.3:a:test:test-name:2.2.2:*:*:*:*:*:*:*",
+				"licenses": []interface{}{map[string]interface{}{"license": map[string]interface{}{"id": "Apache-2.0"}}},
+				"hashes":   []interface{}{map[string]interface{}{"alg": "SHA-256", "content": "test-sha256"}},
+			},
+		}))
+	})
+
+	it("encodes SPDX", func() {
+		t.Setenv("SOURCE_DATE_EPOCH", "0")
+
+		v := decode(libcnb.SPDXJSON)
+
+		Expect(v["spdxVersion"]).To(Equal("SPDX-2.3"))
+		Expect(v["creationInfo"]).To(HaveKeyWithValue("created", "1970-01-01T00:00:00Z"))
+		Expect(v["packages"]).To(HaveLen(1))
+
+		p := v["packages"].([]interface{})[0].(map[string]interface{})
+		Expect(p["name"]).To(Equal("test-name"))
+		Expect(p["versionInfo"]).To(Equal("2.2.2"))
+		Expect(p["licenseDeclared"]).To(Equal("Apache-2.0"))
+		Expect(p["externalRefs"]).To(ContainElement(HaveKeyWithValue("referenceLocator", "pkg:generic/test-name@2.2.2")))
+		Expect(p["checksums"]).To(Equal([]interface{}{map[string]interface{}{"algorithm": "SHA256", "checksumValue": "test-sha256"}}))
+	})
+
+	it("encodes Syft", func() {
+		v := decode(libcnb.SyftJSON)
+
+		Expect(v["artifacts"]).To(HaveLen(1))
+
+		a := v["artifacts"].([]interface{})[0].(map[string]interface{})
+		Expect(a["name"]).To(Equal("test-name"))
+		Expect(a["version"]).To(Equal("2.2.2"))
+		Expect(a["purl"]).To(Equal("pkg:generic/test-name@2.2.2"))
+		Expect(a["licenses"]).To(Equal([]interface{}{"Apache-2.0"}))
+	})
+
+	it("encodes the same document deterministically", func() {
+		t.Setenv("SOURCE_DATE_EPOCH", "0")
+
+		for _, format := range []libcnb.SBOMFormat{libcnb.CycloneDXJSON, libcnb.SPDXJSON, libcnb.SyftJSON} {
+			first, err := document.Encode(format)
+			Expect(err).NotTo(HaveOccurred())
+			second, err := document.Encode(format)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(first).To(Equal(second))
+		}
+	})
+
+	it("describes dependencies", func() {
+		d := sbom.FromDependencies("test-layer", "1.1.1", libcnb.BuildpackDependency{
+			ID:       "test-id",
+			Version:  "2.2.2",
+			SHA256:   "test-sha256",
+			PURL:     "pkg:generic/test-id@2.2.2",
+			CPEs:     []string{"test-cpe"},
+			Licenses: []libcnb.License{{Type: "Apache-2.0"}, {URI: "https://example.com/license"}},
+		})
+
+		Expect(d).To(Equal(sbom.Document{
+			Name:    "test-layer",
+			Version: "1.1.1",
+			Components: []sbom.Component{{
+				Name:     "test-id",
+				Version:  "2.2.2",
+				PURL:     "pkg:generic/test-id@2.2.2",
+				CPEs:     []string{"test-cpe"},
+				Licenses: []string{"Apache-2.0", "https://example.com/license"},
+				SHA256:   "test-sha256",
+			}},
+		}))
+	})
+
+	it("fails for an unknown format", func() {
+		_, err := document.Encode(libcnb.UnknownFormat)
+		Expect(err).To(MatchError("unsupported SBOM format unknown"))
+	})
+}
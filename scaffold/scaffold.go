@@ -0,0 +1,267 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package scaffold generates a minimal buildpack project built on libcnb, for use by tools that create new buildpacks.
+//
+// The project contains a buildpack.toml describing the buildpack, a go.mod requiring libcnb, a main.go calling
+// libcnb.BuildpackMain with Detect and Build functions, and test stubs for both. The buildpack binary is expected to be
+// built as bin/main, with bin/detect and bin/build linking to it.
+package scaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+// DefaultLibcnbVersion is the version of libcnb required by the generated go.mod if Options.LibcnbVersion is empty and
+// the version libcnb was built with is not a release.
+const DefaultLibcnbVersion = "v2.0.0"
+
+// Options describes the buildpack to generate.
+type Options struct {
+	// ID is the id of the buildpack. It is required.
+	ID string
+
+	// Name is the name of the buildpack. It defaults to ID.
+	Name string
+
+	// Version is the version of the buildpack. It defaults to 0.0.1.
+	Version string
+
+	// API is the Buildpack API version of the buildpack. It defaults to libcnb.MaxSupportedBPVersion.
+	API string
+
+	// Module is the Go module path of the project. It is required.
+	Module string
+
+	// LibcnbVersion is the version of libcnb required by the project. It defaults to the version libcnb was built with
+	// if that is a release, and DefaultLibcnbVersion otherwise.
+	LibcnbVersion string
+
+	// Targets are the targets the buildpack supports.
+	Targets []libcnb.Target
+}
+
+type buildpackTOML struct {
+	API       string            `toml:"api"`
+	Buildpack buildpackInfo     `toml:"buildpack"`
+	Targets   []buildpackTarget `toml:"targets,omitempty"`
+}
+
+type buildpackInfo struct {
+	ID      string `toml:"id"`
+	Name    string `toml:"name"`
+	Version string `toml:"version"`
+}
+
+type buildpackTarget struct {
+	OS      string            `toml:"os,omitempty"`
+	Arch    string            `toml:"arch,omitempty"`
+	Variant string            `toml:"variant,omitempty"`
+	Distros []buildpackDistro `toml:"distros,omitempty"`
+}
+
+type buildpackDistro struct {
+	Name    string `toml:"name,omitempty"`
+	Version string `toml:"version,omitempty"`
+}
+
+var goFiles = map[string]string{
+	"main.go": `package main
+
+import (
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func main() {
+	libcnb.BuildpackMain(Detect, Build)
+}
+`,
+	"detect.go": `package main
+
+import (
+	"github.com/buildpacks/libcnb/v2"
+)
+
+// Detect decides whether {{ .ID }} applies to the application.
+func Detect(context libcnb.DetectContext) (libcnb.DetectResult, error) {
+	return libcnb.DetectResult{Pass: true}, nil
+}
+`,
+	"build.go": `package main
+
+import (
+	"github.com/buildpacks/libcnb/v2"
+)
+
+// Build contributes the layers of {{ .ID }} to the application image.
+func Build(context libcnb.BuildContext) (libcnb.BuildResult, error) {
+	return libcnb.NewBuildResult(), nil
+}
+`,
+	"detect_test.go": `package main
+
+import (
+	"testing"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func TestDetect(t *testing.T) {
+	result, err := Detect(libcnb.DetectContext{ApplicationPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Pass {
+		t.Error("expected detection to pass")
+	}
+}
+`,
+	"build_test.go": `package main
+
+import (
+	"testing"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func TestBuild(t *testing.T) {
+	_, err := Build(libcnb.BuildContext{
+		ApplicationPath: t.TempDir(),
+		Layers:          libcnb.Layers{Path: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+`,
+}
+
+// Files returns the files of the project, keyed by their path relative to the project directory.
+func Files(options Options) (map[string][]byte, error) {
+	if options.ID == "" {
+		return nil, errors.New("buildpack id is required")
+	}
+	if options.Module == "" {
+		return nil, errors.New("module path is required")
+	}
+	if options.Name == "" {
+		options.Name = options.ID
+	}
+	if options.Version == "" {
+		options.Version = "0.0.1"
+	}
+	if options.API == "" {
+		options.API = libcnb.MaxSupportedBPVersion
+	}
+	if options.LibcnbVersion == "" {
+		options.LibcnbVersion = DefaultLibcnbVersion
+		if v := libcnb.Version(); strings.HasPrefix(v, "v2.") {
+			options.LibcnbVersion = v
+		}
+	}
+
+	files := map[string][]byte{}
+
+	descriptor := buildpackTOML{
+		API:       options.API,
+		Buildpack: buildpackInfo{ID: options.ID, Name: options.Name, Version: options.Version},
+	}
+	for _, t := range options.Targets {
+		target := buildpackTarget{OS: t.OS, Arch: t.Arch, Variant: t.Variant}
+		for _, d := range t.Distros {
+			target.Distros = append(target.Distros, buildpackDistro{Name: d.Name, Version: d.Version})
+		}
+		descriptor.Targets = append(descriptor.Targets, target)
+	}
+
+	b := &bytes.Buffer{}
+	if err := toml.NewEncoder(b).Encode(descriptor); err != nil {
+		return nil, fmt.Errorf("unable to encode buildpack.toml\n%w", err)
+	}
+	files["buildpack.toml"] = b.Bytes()
+
+	files["go.mod"] = []byte(fmt.Sprintf("module %s\n\ngo 1.23\n\nrequire github.com/buildpacks/libcnb/v2 %s\n",
+		options.Module, options.LibcnbVersion))
+
+	for name, text := range goFiles {
+		t, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse template %s\n%w", name, err)
+		}
+
+		b := &bytes.Buffer{}
+		if err := t.Execute(b, options); err != nil {
+			return nil, fmt.Errorf("unable to render %s\n%w", name, err)
+		}
+
+		source, err := format.Source(b.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("unable to format %s\n%w", name, err)
+		}
+		files[name] = source
+	}
+
+	return files, nil
+}
+
+// Write writes the files of the project to dir, creating it if necessary. It fails without writing anything if any of
+// the files already exists.
+func Write(dir string, options Options) error {
+	files, err := Files(options)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+		if _, err := os.Lstat(file); err == nil {
+			return fmt.Errorf("unable to write %s\nfile already exists", file)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("unable to stat %s\n%w", file, err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s\n%w", dir, err)
+	}
+
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, files[name], 0644); err != nil {
+			return fmt.Errorf("unable to write %s\n%w", file, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scaffold_test
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/scaffold"
+)
+
+func testScaffold(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		dir     string
+		options scaffold.Options
+	)
+
+	it.Before(func() {
+		dir = filepath.Join(t.TempDir(), "test-buildpack")
+		options = scaffold.Options{
+			ID:            "example/test",
+			Name:          "Test Buildpack",
+			Module:        "example.com/test-buildpack",
+			LibcnbVersion: "v2.1.0",
+			Targets: []libcnb.Target{{
+				TargetInfo: libcnb.TargetInfo{OS: "linux", Arch: "amd64"},
+				Distros:    []libcnb.TargetDistro{{Name: "ubuntu", Version: "24.04"}},
+			}},
+		}
+	})
+
+	it("writes a buildpack project", func() {
+		Expect(scaffold.Write(dir, options)).To(Succeed())
+
+		var buildpack libcnb.Buildpack
+		_, err := toml.DecodeFile(filepath.Join(dir, "buildpack.toml"), &buildpack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buildpack.API).To(Equal(libcnb.MaxSupportedBPVersion))
+		Expect(buildpack.Info.ID).To(Equal("example/test"))
+		Expect(buildpack.Info.Name).To(Equal("Test Buildpack"))
+		Expect(buildpack.Info.Version).To(Equal("0.0.1"))
+		Expect(buildpack.Targets).To(Equal(options.Targets))
+
+		Expect(os.ReadFile(filepath.Join(dir, "go.mod"))).To(Equal([]byte(
+			"module example.com/test-buildpack\n\ngo 1.23\n\nrequire github.com/buildpacks/libcnb/v2 v2.1.0\n")))
+
+		for _, name := range []string{"main.go", "detect.go", "build.go", "detect_test.go", "build_test.go"} {
+			f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.AllErrors)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Name.Name).To(Equal("main"))
+		}
+		Expect(os.ReadFile(filepath.Join(dir, "main.go"))).To(ContainSubstring("libcnb.BuildpackMain(Detect, Build)"))
+	})
+
+	it("omits targets when there are none", func() {
+		options.Targets = nil
+
+		files, err := scaffold.Files(options)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(files["buildpack.toml"])).NotTo(ContainSubstring("targets"))
+	})
+
+	it("requires an id and a module", func() {
+		_, err := scaffold.Files(scaffold.Options{Module: "example.com/test-buildpack"})
+		Expect(err).To(MatchError("buildpack id is required"))
+
+		_, err = scaffold.Files(scaffold.Options{ID: "example/test"})
+		Expect(err).To(MatchError("module path is required"))
+	})
+
+	it("does not overwrite existing files", func() {
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "main.go"), []byte("existing"), 0600)).To(Succeed())
+
+		Expect(scaffold.Write(dir, options)).To(MatchError(ContainSubstring("file already exists")))
+		Expect(os.ReadFile(filepath.Join(dir, "main.go"))).To(Equal([]byte("existing")))
+		Expect(filepath.Join(dir, "buildpack.toml")).NotTo(BeAnExistingFile())
+	})
+}
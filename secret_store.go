@@ -0,0 +1,102 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// BindingSecretReference is the key of a binding secret that, instead of holding secret values itself, references
+// secrets held in an external secret manager, as a URI whose scheme selects the SecretStore that resolves it, such as
+// vault://secret/data/app or aws-sm://app/credentials.
+const BindingSecretReference = "secret-reference"
+
+// SecretStore resolves references to secrets held in an external secret manager, such as Vault or AWS Secrets Manager,
+// so that platforms need not mount raw secrets into build containers.
+type SecretStore interface {
+	// Resolve returns the secret values referenced by reference for binding.
+	Resolve(ctx context.Context, binding Binding, reference *url.URL) (map[string]string, error)
+}
+
+// SecretStoreFunc adapts a function to a SecretStore.
+type SecretStoreFunc func(ctx context.Context, binding Binding, reference *url.URL) (map[string]string, error)
+
+// Resolve calls f.
+func (f SecretStoreFunc) Resolve(ctx context.Context, binding Binding, reference *url.URL) (map[string]string, error) {
+	return f(ctx, binding, reference)
+}
+
+// SecretStores maps URI schemes to the SecretStore that resolves references with that scheme.
+type SecretStores map[string]SecretStore
+
+// SecretReference returns the reference to secrets in an external secret manager held by the binding, if any.
+func (b Binding) SecretReference() (string, bool) {
+	s, ok := b.Secret[BindingSecretReference]
+	return s, ok && s != ""
+}
+
+// Resolve returns the binding with the secrets it references merged into its secret, in place of the reference. A
+// binding without a reference is returned unchanged. Secret values held by the binding itself take precedence over
+// resolved ones, so that a platform can override individual values.
+func (s SecretStores) Resolve(ctx context.Context, binding Binding) (Binding, error) {
+	reference, ok := binding.SecretReference()
+	if !ok {
+		return binding, nil
+	}
+
+	u, err := url.Parse(reference)
+	if err != nil {
+		return Binding{}, fmt.Errorf("unable to parse secret reference of binding %s\n%w", binding.Name, err)
+	}
+
+	store, ok := s[u.Scheme]
+	if !ok {
+		return Binding{}, fmt.Errorf("unable to resolve secret reference of binding %s: no secret store for scheme %q", binding.Name, u.Scheme)
+	}
+
+	resolved, err := store.Resolve(ctx, binding, u)
+	if err != nil {
+		return Binding{}, fmt.Errorf("unable to resolve secret reference of binding %s\n%w", binding.Name, err)
+	}
+
+	secret := make(map[string]string, len(resolved)+len(binding.Secret))
+	for k, v := range resolved {
+		secret[k] = v
+	}
+	for k, v := range binding.Secret {
+		if k != BindingSecretReference {
+			secret[k] = v
+		}
+	}
+	binding.Secret = secret
+
+	return binding, nil
+}
+
+// ResolveBinding returns the binding with the secrets it references resolved by the secret stores registered with
+// WithSecretStore. References are resolved on each call, so that secrets are only fetched by the buildpacks that use
+// them, and SecretStores that are expensive to query should cache their results.
+func (b BuildContext) ResolveBinding(binding Binding) (Binding, error) {
+	ctx := b.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return b.secretStores.Resolve(ctx, binding)
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/buildpacks/libcnb/v2/internal"
+)
+
+// SharedStateEnvPrefix is the prefix of the build-time environment variables that locate shared state published by
+// earlier buildpacks.
+const SharedStateEnvPrefix = "LIBCNB_SHARED_STATE_"
+
+// SharedStateLayerPrefix is the prefix of the name of the layer that holds published shared state.
+const SharedStateLayerPrefix = "shared-state-"
+
+// SharedStateEnv returns the name of the build-time environment variable that locates the shared state with the given
+// name.
+func SharedStateEnv(name string) string {
+	return SharedStateEnvPrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// PublishSharedState publishes state for buildpacks that run later in the same build. The state, which must encode to
+// a TOML table, is written to state.toml in a build-only layer and its location is exposed through the
+// SharedStateEnv(name) build environment variable. The state is written with the TOMLWriter configured for the build.
+// The returned layer must be included in the BuildResult for the state to be visible to later buildpacks.
+//
+// For example, a JDK buildpack can publish the location of the JVM it installed:
+//
+//	layer, err := libcnb.PublishSharedState(&context.Layers, "jvm", JVM{Home: jdk.Path, Version: "17.0.8"})
+//
+// and a later buildpack can read it:
+//
+//	var jvm JVM
+//	ok, err := libcnb.ReadSharedState("jvm", &jvm)
+func PublishSharedState(layers *Layers, name string, state interface{}) (Layer, error) {
+	layer, err := layers.Layer(SharedStateLayerPrefix + name)
+	if err != nil {
+		return Layer{}, fmt.Errorf("unable to create shared state layer\n%w", err)
+	}
+
+	layer, err = layer.Reset()
+	if err != nil {
+		return Layer{}, fmt.Errorf("unable to reset shared state layer\n%w", err)
+	}
+
+	writer := layers.tomlWriter
+	if writer == nil {
+		writer = internal.TOMLWriter{}
+	}
+
+	file := filepath.Join(layer.Path, "state.toml")
+	if err := writer.Write(file, state); err != nil {
+		return Layer{}, fmt.Errorf("unable to write shared state %s to %s\n%w", name, file, err)
+	}
+
+	layer.Build = true
+	layer.BuildEnvironment.Override(SharedStateEnv(name), file)
+
+	return layer, nil
+}
+
+// ReadSharedState decodes shared state published by an earlier buildpack into state. It returns false if no state with
+// the given name has been published. It reads the process environment when called; use Layers.ReadSharedState to read
+// the environment a BuildContext was created with.
+func ReadSharedState(name string, state interface{}) (bool, error) {
+	return readSharedState(nil, name, state)
+}
+
+// ReadSharedState behaves like the ReadSharedState function, looking up the shared state in the environment captured
+// by the layers.
+func (l *Layers) ReadSharedState(name string, state interface{}) (bool, error) {
+	return readSharedState(l.environment, name, state)
+}
+
+func readSharedState(environment map[string]string, name string, state interface{}) (bool, error) {
+	file, ok := lookupEnv(environment, SharedStateEnv(name))
+	if !ok {
+		return false, nil
+	}
+
+	if err := decodeTOMLFile(file, state); err != nil {
+		return false, fmt.Errorf("unable to decode shared state %s\n%w", file, err)
+	}
+
+	return true, nil
+}
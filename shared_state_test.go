@@ -0,0 +1,92 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func testSharedState(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layers libcnb.Layers
+	)
+
+	type jvm struct {
+		Home    string `toml:"home"`
+		Version string `toml:"version"`
+	}
+
+	it.Before(func() {
+		layers = libcnb.Layers{Path: t.TempDir()}
+	})
+
+	it("derives environment variable names", func() {
+		Expect(libcnb.SharedStateEnv("jvm")).To(Equal("LIBCNB_SHARED_STATE_JVM"))
+		Expect(libcnb.SharedStateEnv("node-modules.v2")).To(Equal("LIBCNB_SHARED_STATE_NODE_MODULES_V2"))
+	})
+
+	it("publishes state in a build layer", func() {
+		layer, err := libcnb.PublishSharedState(&layers, "jvm", jvm{Home: "/test/home", Version: "17"})
+		Expect(err).NotTo(HaveOccurred())
+
+		file := filepath.Join(layers.Path, "shared-state-jvm", "state.toml")
+		Expect(layer.Name).To(Equal("shared-state-jvm"))
+		Expect(layer.LayerTypes).To(Equal(libcnb.LayerTypes{Build: true}))
+		Expect(layer.BuildEnvironment).To(Equal(libcnb.Environment{"LIBCNB_SHARED_STATE_JVM.override": file}))
+		Expect(file).To(BeARegularFile())
+	})
+
+	it("reads published state", func() {
+		_, err := libcnb.PublishSharedState(&layers, "jvm", jvm{Home: "/test/home", Version: "17"})
+		Expect(err).NotTo(HaveOccurred())
+		t.Setenv("LIBCNB_SHARED_STATE_JVM", filepath.Join(layers.Path, "shared-state-jvm", "state.toml"))
+
+		var actual jvm
+		ok, err := libcnb.ReadSharedState("jvm", &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(actual).To(Equal(jvm{Home: "/test/home", Version: "17"}))
+	})
+
+	it("returns false if state has not been published", func() {
+		Expect(os.Unsetenv("LIBCNB_SHARED_STATE_JVM")).To(Succeed())
+
+		var actual jvm
+		ok, err := libcnb.ReadSharedState("jvm", &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+
+	it("fails if published state cannot be decoded", func() {
+		file := filepath.Join(t.TempDir(), "state.toml")
+		Expect(os.WriteFile(file, []byte("home = "), 0600)).To(Succeed())
+		t.Setenv("LIBCNB_SHARED_STATE_JVM", file)
+
+		var actual jvm
+		_, err := libcnb.ReadSharedState("jvm", &actual)
+		Expect(err).To(MatchError(ContainSubstring("unable to decode shared state")))
+	})
+}
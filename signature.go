@@ -0,0 +1,242 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+const (
+	// SignatureBindingType is the type of the binding that supplies the public key dependency signatures are verified
+	// with.
+	SignatureBindingType = "dependency-signature"
+
+	// SignatureBindingKey is the binding secret containing the PEM-encoded cosign public key.
+	SignatureBindingKey = "cosign.pub"
+
+	// SignatureBindingGPGKey is the binding secret containing the OpenPGP keyring, used when the binding does not
+	// contain SignatureBindingKey.
+	SignatureBindingGPGKey = "gpg.pub"
+
+	// SignatureMetadataKey is the buildpack.toml metadata key containing the PEM-encoded cosign public key or the ASCII
+	// armored OpenPGP keyring.
+	SignatureMetadataKey = "signature-public-key"
+)
+
+//go:generate mockery --name SignatureVerifier --case=underscore
+
+// SignatureVerifier is the interface implemented by a type that verifies the signature of a downloaded dependency.
+type SignatureVerifier interface {
+
+	// Verify is called with the path to a downloaded dependency and the contents of its signature, and returns an error
+	// if the signature is not valid for the dependency.
+	Verify(path string, signature []byte) error
+}
+
+// CosignVerifier verifies signatures created with `cosign sign-blob`, which are base64-encoded signatures of the
+// artifact by an ECDSA, RSA, or Ed25519 key.
+type CosignVerifier struct {
+	// PublicKey is the public key signatures are verified with.
+	PublicKey crypto.PublicKey
+}
+
+// NewCosignVerifier creates a CosignVerifier from a PEM-encoded public key, as written by `cosign generate-key-pair`.
+func NewCosignVerifier(publicKey []byte) (CosignVerifier, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return CosignVerifier{}, fmt.Errorf("unable to decode public key: no PEM block found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return CosignVerifier{}, fmt.Errorf("unable to parse public key\n%w", err)
+	}
+
+	return CosignVerifier{PublicKey: key}, nil
+}
+
+// NewSignatureVerifier creates a SignatureVerifier from the public key in a binding of type SignatureBindingType if
+// there is one, otherwise from the SignatureMetadataKey buildpack metadata. A CosignVerifier is created from a cosign
+// public key, and a GPGVerifier from an OpenPGP keyring. The boolean is false if neither supplies a key.
+func NewSignatureVerifier(buildpack Buildpack, bindings Bindings) (SignatureVerifier, bool, error) {
+	if b := bindings.OfType(SignatureBindingType); len(b) > 0 {
+		if key, ok := b[0].Secret[SignatureBindingKey]; ok {
+			v, err := NewCosignVerifier([]byte(key))
+			return v, err == nil, err
+		}
+		if key, ok := b[0].Secret[SignatureBindingGPGKey]; ok {
+			v, err := NewGPGVerifier([]byte(key))
+			return v, err == nil, err
+		}
+
+		return nil, false, fmt.Errorf("binding %s contains neither %s nor %s", b[0].Name, SignatureBindingKey, SignatureBindingGPGKey)
+	}
+
+	if key, ok := buildpack.Metadata[SignatureMetadataKey].(string); ok {
+		if strings.HasPrefix(strings.TrimSpace(key), armorPrefix+"PUBLIC KEY BLOCK-----") {
+			v, err := NewGPGVerifier([]byte(key))
+			return v, err == nil, err
+		}
+
+		v, err := NewCosignVerifier([]byte(key))
+		return v, err == nil, err
+	}
+
+	return nil, false, nil
+}
+
+// Verify verifies that the base64-encoded signature is a signature of the file at path. For ECDSA and RSA keys the file
+// is streamed through the hash, so it is never held in memory. Ed25519 signs the content itself rather than a digest,
+// so for Ed25519 keys the file is read into memory.
+func (c CosignVerifier) Verify(path string, signature []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("unable to decode signature\n%w", err)
+	}
+
+	switch key := c.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		h := sha256.New()
+		if err := hashFile(h, path); err != nil {
+			return err
+		}
+		if !ecdsa.VerifyASN1(key, h.Sum(nil), sig) {
+			return errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		h := sha256.New()
+		if err := hashFile(h, path); err != nil {
+			return err
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, h.Sum(nil), sig); err != nil {
+			return fmt.Errorf("invalid signature\n%w", err)
+		}
+	case ed25519.PublicKey:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read %s\n%w", path, err)
+		}
+		if !ed25519.Verify(key, content, sig) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", c.PublicKey)
+	}
+
+	return nil
+}
+
+// GPGVerifier verifies detached OpenPGP signatures, as created by `gpg --detach-sign`, either binary or ASCII armored.
+// Signatures are rejected if they have expired, or if the key that made them has been revoked, has expired or is not
+// valid for signing.
+type GPGVerifier struct {
+	keyring openpgp.EntityList
+}
+
+// armorPrefix starts every ASCII armored OpenPGP block.
+const armorPrefix = "-----BEGIN PGP "
+
+// NewGPGVerifier creates a GPGVerifier from an OpenPGP keyring, as written by `gpg --export`, either binary or ASCII
+// armored. Armored keyrings may contain several blocks. Signatures made by the primary key or any of the signing
+// subkeys in the keyring are accepted.
+func NewGPGVerifier(keyring []byte) (GPGVerifier, error) {
+	var entities openpgp.EntityList
+
+	if bytes.Contains(keyring, []byte(armorPrefix)) {
+		blocks := bytes.Split(keyring, []byte(armorPrefix))
+		for _, block := range blocks[1:] {
+			e, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(append([]byte(armorPrefix), block...)))
+			if err != nil {
+				return GPGVerifier{}, fmt.Errorf("unable to read keyring\n%w", err)
+			}
+			entities = append(entities, e...)
+		}
+	} else {
+		e, err := openpgp.ReadKeyRing(bytes.NewReader(keyring))
+		if err != nil {
+			return GPGVerifier{}, fmt.Errorf("unable to read keyring\n%w", err)
+		}
+		entities = e
+	}
+
+	if len(entities) == 0 {
+		return GPGVerifier{}, fmt.Errorf("unable to read keyring: no public keys found")
+	}
+
+	return GPGVerifier{keyring: entities}, nil
+}
+
+// Verify verifies that the detached signature is a signature of the file at path by one of the keys. The file is
+// streamed through the hash, so it is never held in memory.
+func (g GPGVerifier) Verify(path string, signature []byte) error {
+	var sig io.Reader = bytes.NewReader(signature)
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte(armorPrefix)) {
+		block, err := armor.Decode(sig)
+		if err != nil {
+			return fmt.Errorf("unable to read signature\n%w", err)
+		}
+		sig = block.Body
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open %s\n%w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := openpgp.CheckDetachedSignature(g.keyring, f, sig, nil); err != nil {
+		if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+			return fmt.Errorf("signature was made by an unknown key")
+		}
+		return fmt.Errorf("invalid signature\n%w", err)
+	}
+
+	return nil
+}
+
+// hashFile streams the file at path into h.
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open %s\n%w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("unable to read %s\n%w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func testSignature(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path string
+	)
+
+	encode := func(key crypto.PublicKey) []byte {
+		b, err := x509.MarshalPKIXPublicKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b})
+	}
+
+	it.Before(func() {
+		path = filepath.Join(t.TempDir(), "test-artifact")
+		Expect(os.WriteFile(path, []byte("test-content"), 0600)).To(Succeed())
+	})
+
+	context("CosignVerifier", func() {
+		it("verifies an ECDSA signature", func() {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			digest := sha256.Sum256([]byte("test-content"))
+			sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			Expect(err).NotTo(HaveOccurred())
+
+			verifier, err := libcnb.NewCosignVerifier(encode(&key.PublicKey))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, []byte(base64.StdEncoding.EncodeToString(sig)+"\n"))).To(Succeed())
+		})
+
+		it("verifies an Ed25519 signature", func() {
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			sig := ed25519.Sign(private, []byte("test-content"))
+
+			verifier, err := libcnb.NewCosignVerifier(encode(public))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, []byte(base64.StdEncoding.EncodeToString(sig)))).To(Succeed())
+		})
+
+		it("rejects an invalid signature", func() {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			digest := sha256.Sum256([]byte("other-content"))
+			sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			Expect(err).NotTo(HaveOccurred())
+
+			verifier, err := libcnb.NewCosignVerifier(encode(&key.PublicKey))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, []byte(base64.StdEncoding.EncodeToString(sig)))).To(MatchError("invalid signature"))
+		})
+
+		it("returns an error for a malformed public key", func() {
+			_, err := libcnb.NewCosignVerifier([]byte("test-key"))
+			Expect(err).To(MatchError("unable to decode public key: no PEM block found"))
+		})
+	})
+
+	context("NewSignatureVerifier", func() {
+		var key []byte
+
+		it.Before(func() {
+			k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			key = encode(&k.PublicKey)
+		})
+
+		it("returns false without a key", func() {
+			_, ok, err := libcnb.NewSignatureVerifier(libcnb.Buildpack{}, libcnb.Bindings{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		it("uses the key from buildpack metadata", func() {
+			buildpack := libcnb.Buildpack{Metadata: map[string]interface{}{"signature-public-key": string(key)}}
+
+			_, ok, err := libcnb.NewSignatureVerifier(buildpack, libcnb.Bindings{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		it("prefers the key from a binding", func() {
+			buildpack := libcnb.Buildpack{Metadata: map[string]interface{}{"signature-public-key": "test-key"}}
+			bindings := libcnb.Bindings{
+				{Name: "test-binding", Type: "dependency-signature", Secret: map[string]string{"cosign.pub": string(key)}},
+			}
+
+			_, ok, err := libcnb.NewSignatureVerifier(buildpack, bindings)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		it("returns an error when the binding has no key", func() {
+			bindings := libcnb.Bindings{{Name: "test-binding", Type: "dependency-signature", Secret: map[string]string{}}}
+
+			_, _, err := libcnb.NewSignatureVerifier(libcnb.Buildpack{}, bindings)
+			Expect(err).To(MatchError("binding test-binding contains neither cosign.pub nor gpg.pub"))
+		})
+
+		it("uses a GPG keyring from a binding", func() {
+			keyring, err := os.ReadFile(filepath.Join("testdata", "gpg", "rsa.asc"))
+			Expect(err).NotTo(HaveOccurred())
+			bindings := libcnb.Bindings{
+				{Name: "test-binding", Type: "dependency-signature", Secret: map[string]string{"gpg.pub": string(keyring)}},
+			}
+
+			verifier, ok, err := libcnb.NewSignatureVerifier(libcnb.Buildpack{}, bindings)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(verifier).To(BeAssignableToTypeOf(libcnb.GPGVerifier{}))
+		})
+
+		it("uses a GPG keyring from buildpack metadata", func() {
+			keyring, err := os.ReadFile(filepath.Join("testdata", "gpg", "rsa.asc"))
+			Expect(err).NotTo(HaveOccurred())
+			buildpack := libcnb.Buildpack{Metadata: map[string]interface{}{"signature-public-key": string(keyring)}}
+
+			verifier, ok, err := libcnb.NewSignatureVerifier(buildpack, libcnb.Bindings{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(verifier).To(BeAssignableToTypeOf(libcnb.GPGVerifier{}))
+		})
+	})
+
+	context("GPGVerifier", func() {
+		read := func(name string) []byte {
+			b, err := os.ReadFile(filepath.Join("testdata", "gpg", name))
+			Expect(err).NotTo(HaveOccurred())
+			return b
+		}
+
+		it("verifies a binary RSA signature", func() {
+			verifier, err := libcnb.NewGPGVerifier(read("rsa.asc"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, read("rsa.sig"))).To(Succeed())
+		})
+
+		it("verifies an armored Ed25519 signature", func() {
+			verifier, err := libcnb.NewGPGVerifier(read("ed25519.asc"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, read("ed25519.sig.asc"))).To(Succeed())
+		})
+
+		it("verifies an ECDSA signature", func() {
+			verifier, err := libcnb.NewGPGVerifier(read("p256.asc"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, read("p256.sig"))).To(Succeed())
+		})
+
+		it("accepts signatures by any key of the keyring", func() {
+			verifier, err := libcnb.NewGPGVerifier(append(read("rsa.asc"), read("p256.asc")...))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, read("p256.sig"))).To(Succeed())
+		})
+
+		it("rejects a signature of other content", func() {
+			Expect(os.WriteFile(path, []byte("other-content"), 0600)).To(Succeed())
+
+			verifier, err := libcnb.NewGPGVerifier(read("rsa.asc"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, read("rsa.sig"))).To(MatchError(HavePrefix("invalid signature")))
+		})
+
+		it("rejects a signature by another key", func() {
+			verifier, err := libcnb.NewGPGVerifier(read("rsa.asc"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, read("ed25519.sig.asc"))).To(MatchError("signature was made by an unknown key"))
+		})
+
+		it("rejects a signature by a revoked key", func() {
+			verifier, err := libcnb.NewGPGVerifier(read("revoked.asc"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, read("revoked.sig"))).To(MatchError(HavePrefix("invalid signature")))
+		})
+
+		it("rejects a signature by an expired key", func() {
+			verifier, err := libcnb.NewGPGVerifier(read("expired.asc"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(verifier.Verify(path, read("expired.sig"))).To(MatchError(HavePrefix("invalid signature")))
+		})
+
+		it("rejects a modified keyring", func() {
+			keyring := read("ed25519.asc")
+			i := bytes.Index(keyring, []byte("\n\n")) + 40
+			keyring[i] = map[bool]byte{true: 'A', false: 'B'}[keyring[i] != 'A']
+
+			_, err := libcnb.NewGPGVerifier(keyring)
+			Expect(err).To(MatchError(ContainSubstring("unable to read keyring")))
+		})
+
+		it("returns an error for a malformed keyring", func() {
+			_, err := libcnb.NewGPGVerifier([]byte("test-key"))
+			Expect(err).To(MatchError(ContainSubstring("unable to read keyring")))
+		})
+	})
+}
@@ -1,5 +1,5 @@
 /*
- * Copyright 2018-2020 the original author or authors.
+ * Copyright 2018-2024 the original author or authors.
  *
  * Licensed under the Apache License, Version 2.0 (the "License");
  * you may not use this file except in compliance with the License.
@@ -16,9 +16,179 @@
 
 package libcnb
 
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+)
+
+// StoreSchemaVersionKey is the persistent metadata key that records the schema version of the metadata.
+const StoreSchemaVersionKey = "schema-version"
+
+// StoreNamespacesKey is the key of store.toml that lists the buildpack IDs persistent metadata is namespaced under,
+// when namespacing is enabled with WithStoreNamespacing.
+const StoreNamespacesKey = "libcnb-namespaces"
+
+// StoreMigration migrates persistent metadata from the given schema version to the next schema version.
+type StoreMigration func(version int64, metadata map[string]interface{}) (map[string]interface{}, error)
+
 // Store represents the contents of store.toml
 type Store struct {
 
 	// Metadata represents the persistent metadata.
 	Metadata map[string]interface{} `toml:"metadata"`
 }
+
+// Decode decodes the persistent metadata into the value pointed to by v, using the value's TOML tags.
+func (s Store) Decode(v interface{}) error {
+	b := &bytes.Buffer{}
+	if err := toml.NewEncoder(b).Encode(s.Metadata); err != nil {
+		return fmt.Errorf("unable to encode persistent metadata\n%w", err)
+	}
+
+	if _, err := toml.NewDecoder(b).Decode(v); err != nil {
+		return fmt.Errorf("unable to decode persistent metadata\n%w", err)
+	}
+
+	return nil
+}
+
+// Encode replaces the persistent metadata with the value of v, using the value's TOML tags. The schema version of the
+// existing metadata is retained unless v declares its own.
+func (s *Store) Encode(v interface{}) error {
+	b := &bytes.Buffer{}
+	if err := toml.NewEncoder(b).Encode(v); err != nil {
+		return fmt.Errorf("unable to encode persistent metadata\n%w", err)
+	}
+
+	metadata := make(map[string]interface{})
+	if _, err := toml.NewDecoder(b).Decode(&metadata); err != nil {
+		return fmt.Errorf("unable to decode persistent metadata\n%w", err)
+	}
+
+	if version, ok := s.Metadata[StoreSchemaVersionKey]; ok {
+		if _, ok := metadata[StoreSchemaVersionKey]; !ok {
+			metadata[StoreSchemaVersionKey] = version
+		}
+	}
+
+	s.Metadata = metadata
+	return nil
+}
+
+// namespaces returns the buildpack IDs listed under StoreNamespacesKey.
+func (s Store) namespaces() map[string]bool {
+	namespaces := map[string]bool{}
+
+	switch v := s.Metadata[StoreNamespacesKey].(type) {
+	case []string:
+		for _, id := range v {
+			namespaces[id] = true
+		}
+	case []interface{}:
+		for _, id := range v {
+			if id, ok := id.(string); ok {
+				namespaces[id] = true
+			}
+		}
+	}
+
+	return namespaces
+}
+
+// namespace returns the persistent metadata stored under the given buildpack ID. If the ID is not a known namespace,
+// the metadata was written before namespacing was enabled, and the top-level values that are not known namespaces are
+// returned instead, so that they are migrated into the namespace when the metadata is written.
+func (s Store) namespace(id string) map[string]interface{} {
+	namespaces := s.namespaces()
+	if namespaces[id] {
+		m, _ := s.Metadata[id].(map[string]interface{})
+		return m
+	}
+
+	var legacy map[string]interface{}
+	for k, v := range s.Metadata {
+		if k == StoreNamespacesKey || namespaces[k] {
+			continue
+		}
+		if legacy == nil {
+			legacy = make(map[string]interface{})
+		}
+		legacy[k] = v
+	}
+
+	return legacy
+}
+
+// withNamespace returns a Store with the persistent metadata stored under the given buildpack ID, which is added to
+// the known namespaces. The metadata of other known namespaces is retained, while top-level values written before
+// namespacing was enabled are dropped, as they were returned by namespace for migration.
+func (s Store) withNamespace(id string, metadata map[string]interface{}) Store {
+	namespaces := s.namespaces()
+	namespaces[id] = true
+
+	namespaced := make(map[string]interface{})
+	var ids []string
+	for k := range namespaces {
+		ids = append(ids, k)
+		if v, ok := s.Metadata[k]; ok && k != id {
+			namespaced[k] = v
+		}
+	}
+	sort.Strings(ids)
+
+	namespaced[id] = metadata
+	namespaced[StoreNamespacesKey] = ids
+
+	return Store{Metadata: namespaced}
+}
+
+// SchemaVersion returns the schema version of the persistent metadata, or 0 if none has been recorded.
+func (s Store) SchemaVersion() int64 {
+	switch v := s.Metadata[StoreSchemaVersionKey].(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// SetSchemaVersion records the schema version of the persistent metadata.
+func (s *Store) SetSchemaVersion(version int64) {
+	if s.Metadata == nil {
+		s.Metadata = make(map[string]interface{})
+	}
+
+	s.Metadata[StoreSchemaVersionKey] = version
+}
+
+// Migrate brings the persistent metadata up to the target schema version by calling migration once for each version
+// between the recorded schema version and the target. Empty metadata is not migrated, only stamped with the target
+// version. An error is returned if the recorded schema version is newer than the target.
+func (s *Store) Migrate(target int64, migration StoreMigration) error {
+	current := s.SchemaVersion()
+
+	if current > target {
+		return fmt.Errorf("persistent metadata schema version %d is newer than supported version %d", current, target)
+	}
+
+	if len(s.Metadata) == 0 {
+		s.SetSchemaVersion(target)
+		return nil
+	}
+
+	for v := current; v < target; v++ {
+		metadata, err := migration(v, s.Metadata)
+		if err != nil {
+			return fmt.Errorf("unable to migrate persistent metadata from schema version %d\n%w", v, err)
+		}
+		s.Metadata = metadata
+	}
+
+	s.SetSchemaVersion(target)
+	return nil
+}
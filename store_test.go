@@ -0,0 +1,108 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+
+	"github.com/buildpacks/libcnb/v2"
+)
+
+func testStore(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	type metadata struct {
+		Version string   `toml:"version"`
+		Paths   []string `toml:"paths"`
+	}
+
+	it("decodes metadata into a typed value", func() {
+		store := libcnb.Store{Metadata: map[string]interface{}{
+			"version": "1.2.3",
+			"paths":   []interface{}{"alpha", "bravo"},
+		}}
+
+		var m metadata
+		Expect(store.Decode(&m)).To(Succeed())
+		Expect(m).To(Equal(metadata{Version: "1.2.3", Paths: []string{"alpha", "bravo"}}))
+	})
+
+	it("encodes a typed value into metadata", func() {
+		store := libcnb.Store{}
+
+		Expect(store.Encode(metadata{Version: "1.2.3", Paths: []string{"alpha"}})).To(Succeed())
+		Expect(store.Metadata).To(Equal(map[string]interface{}{
+			"version": "1.2.3",
+			"paths":   []interface{}{"alpha"},
+		}))
+	})
+
+	it("retains the schema version when encoding", func() {
+		store := libcnb.Store{}
+		store.SetSchemaVersion(2)
+
+		Expect(store.Encode(metadata{Version: "1.2.3"})).To(Succeed())
+		Expect(store.SchemaVersion()).To(Equal(int64(2)))
+	})
+
+	context("Migrate", func() {
+		it("migrates each schema version in order", func() {
+			store := libcnb.Store{Metadata: map[string]interface{}{"version": "1.2.3"}}
+
+			var versions []int64
+			Expect(store.Migrate(2, func(version int64, m map[string]interface{}) (map[string]interface{}, error) {
+				versions = append(versions, version)
+				m["migrated"] = version
+				return m, nil
+			})).To(Succeed())
+
+			Expect(versions).To(Equal([]int64{0, 1}))
+			Expect(store.SchemaVersion()).To(Equal(int64(2)))
+			Expect(store.Metadata).To(HaveKeyWithValue("migrated", int64(1)))
+		})
+
+		it("stamps empty metadata without migrating", func() {
+			store := libcnb.Store{}
+
+			Expect(store.Migrate(3, func(int64, map[string]interface{}) (map[string]interface{}, error) {
+				return nil, errors.New("unexpected migration")
+			})).To(Succeed())
+
+			Expect(store.SchemaVersion()).To(Equal(int64(3)))
+		})
+
+		it("fails when the recorded schema version is newer than the target", func() {
+			store := libcnb.Store{Metadata: map[string]interface{}{libcnb.StoreSchemaVersionKey: int64(4)}}
+
+			Expect(store.Migrate(3, nil)).To(MatchError("persistent metadata schema version 4 is newer than supported version 3"))
+		})
+
+		it("returns migration errors", func() {
+			store := libcnb.Store{Metadata: map[string]interface{}{"version": "1.2.3"}}
+
+			Expect(store.Migrate(1, func(int64, map[string]interface{}) (map[string]interface{}, error) {
+				return nil, errors.New("test-error")
+			})).To(MatchError("unable to migrate persistent metadata from schema version 0\ntest-error"))
+		})
+	})
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// phaseContext returns the context passed to the build, detect or generate function, which is canceled once the
+// timeout set with WithTimeout elapses.
+func (c Config) phaseContext() (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+type phaseResult[R any] struct {
+	result R
+	err    error
+}
+
+// callWithTimeout calls fn, failing if the timeout set with WithTimeout elapses before it returns. The context of the
+// phase is canceled when the timeout elapses, but fn cannot be stopped, so it keeps running in the background unless it
+// returns once its context is done, and its result is discarded. If ctx is canceled for another reason, such as Build
+// receiving SIGTERM, callWithTimeout waits for fn to return. A panic in fn is converted into an error, whether or not a
+// timeout is set.
+func callWithTimeout[R any](ctx context.Context, config Config, phase Phase, fn func() (R, error)) (R, error) {
+	if config.timeout <= 0 {
+		return callRecovered(phase, fn)
+	}
+
+	result := make(chan phaseResult[R], 1)
+	go func() {
+		r, err := callRecovered(phase, fn)
+		result <- phaseResult[R]{result: r, err: err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.result, r.err
+	case <-ctx.Done():
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r := <-result
+			return r.result, r.err
+		}
+
+		var zero R
+		return zero, fmt.Errorf("%s did not complete within %s\n%w", phase, config.timeout, ctx.Err())
+	}
+}
+
+// callRecovered calls fn, converting a panic into an error.
+func callRecovered[R any](phase Phase, fn func() (R, error)) (result R, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var zero R
+			result, err = zero, fmt.Errorf("%s panicked: %v\n%s", phase, r, debug.Stack())
+		}
+	}()
+
+	return fn()
+}
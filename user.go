@@ -0,0 +1,62 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/buildpacks/libcnb/v2/log"
+)
+
+// checkRootUser logs a warning, or fails the phase if configured to with WithRootUserCheck, when the phase runs as root
+// but the build image expects a non-root user. It returns false if the phase has failed.
+func checkRootUser(config Config, env map[string]string) bool {
+	if !config.rootUserCheck {
+		return true
+	}
+
+	err := rootUserError(env, os.Getuid())
+	if err == nil {
+		return true
+	}
+
+	if config.rootUserCheckFails {
+		config.exitHandler.Error(err)
+		return false
+	}
+
+	log.Warnf(config.logger, "Warning: %s", err)
+	return true
+}
+
+// rootUserError returns an error if uid is root but CNB_USER_ID in env is the ID of another user.
+func rootUserError(env map[string]string, uid int) error {
+	s, ok := env[EnvUserID]
+	if !ok || uid != 0 {
+		return nil
+	}
+
+	expected, err := strconv.Atoi(s)
+	if err != nil || expected == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("running as root, but the build image expects user %d (%s); "+
+		"layers written as root may be unreadable at launch", expected, EnvUserID)
+}
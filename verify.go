@@ -0,0 +1,222 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/buildpacks/libcnb/v2/log"
+)
+
+// VerifyContext contains the inputs to verification checks.
+type VerifyContext struct {
+	// Buildpack is metadata about the buildpack, from buildpack.toml.
+	Buildpack Buildpack
+
+	// Logger is the way to write messages to the end user
+	Logger log.Logger
+}
+
+// Check is a named diagnostic check of a buildpack.
+type Check struct {
+	// Name is the name of the check, used when reporting its outcome.
+	Name string
+
+	// Verify returns an error describing why the buildpack fails the check.
+	Verify func(context VerifyContext) error
+}
+
+// RequireMetadata returns a Check that the buildpack.toml metadata contains each of the keys.
+func RequireMetadata(keys ...string) Check {
+	return Check{
+		Name: fmt.Sprintf("metadata contains %s", strings.Join(keys, ", ")),
+		Verify: func(context VerifyContext) error {
+			var missing []string
+			for _, k := range keys {
+				if _, ok := context.Buildpack.Metadata[k]; !ok {
+					missing = append(missing, k)
+				}
+			}
+
+			if len(missing) > 0 {
+				return fmt.Errorf("missing metadata %s", strings.Join(missing, ", "))
+			}
+			return nil
+		},
+	}
+}
+
+// RequireDependencies returns a Check that the buildpack.toml metadata declares a downloadable dependency with each of
+// the IDs.
+func RequireDependencies(ids ...string) Check {
+	return Check{
+		Name: fmt.Sprintf("dependencies include %s", strings.Join(ids, ", ")),
+		Verify: func(context VerifyContext) error {
+			dependencies, err := context.Buildpack.Dependencies()
+			if err != nil {
+				return err
+			}
+
+			var problems []string
+			for _, id := range ids {
+				found := false
+				for _, d := range dependencies {
+					if d.ID != id {
+						continue
+					}
+					found = true
+
+					if d.URI == "" || d.SHA256 == "" {
+						problems = append(problems, fmt.Sprintf("dependency %s %s must declare uri and sha256", d.ID, d.Version))
+					}
+				}
+
+				if !found {
+					problems = append(problems, fmt.Sprintf("missing dependency %s", id))
+				}
+			}
+
+			if len(problems) > 0 {
+				return errors.New(strings.Join(problems, "\n"))
+			}
+			return nil
+		},
+	}
+}
+
+// RequireExecD returns a Check that each of the exec.d executables is present and executable in the buildpack's bin
+// directory.
+func RequireExecD(names ...string) Check {
+	return Check{
+		Name: fmt.Sprintf("exec.d executables %s", strings.Join(names, ", ")),
+		Verify: func(context VerifyContext) error {
+			var problems []string
+			for _, n := range names {
+				file := filepath.Join(context.Buildpack.Path, "bin", n)
+
+				info, err := os.Stat(file)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("missing exec.d executable %s", file))
+				} else if info.Mode()&0111 == 0 {
+					problems = append(problems, fmt.Sprintf("exec.d executable %s is not executable", file))
+				}
+			}
+
+			if len(problems) > 0 {
+				return errors.New(strings.Join(problems, "\n"))
+			}
+			return nil
+		},
+	}
+}
+
+// Verify loads and validates buildpack.toml and then runs each check, writing a PASS or FAIL line for each to stdout, or
+// the writer set with WithVerifyOutput. All checks are run, and if any fail the exit handler is called with an error
+// listing the failures.
+func Verify(checks []Check, config Config) {
+	var (
+		err  error
+		file string
+		ok   bool
+	)
+	ctx := VerifyContext{Logger: config.contextLogger}
+	env := config.environmentOrProcess()
+
+	if ctx.Buildpack.Path, ok = env[EnvBuildpackDirectory]; !ok {
+		if len(config.arguments) == 0 {
+			config.exitHandler.Error(fmt.Errorf("unable to get CNB_BUILDPACK_DIR, not found"))
+			return
+		}
+		ctx.Buildpack.Path = filepath.Dir(filepath.Dir(config.arguments[0]))
+	}
+	if ctx.Buildpack.Path, err = filepath.Abs(ctx.Buildpack.Path); err != nil {
+		config.exitHandler.Error(fmt.Errorf("unable to get absolute path for %s\n%w", ctx.Buildpack.Path, err))
+		return
+	}
+	config.logger.Debugf("Buildpack Path: %s", ctx.Buildpack.Path)
+
+	file = filepath.Join(ctx.Buildpack.Path, "buildpack.toml")
+	if err = decodeTOMLFile(file, &ctx.Buildpack); err != nil {
+		config.exitHandler.Error(fmt.Errorf("unable to decode buildpack %s\n%w", file, err))
+		return
+	}
+	if config.logger.IsDebugEnabled() {
+		config.logger.Debugf("Buildpack: %+v", ctx.Buildpack)
+	}
+
+	checks = append([]Check{{Name: "buildpack.toml", Verify: verifyBuildpackTOML}}, checks...)
+
+	out := config.verifyOutput
+	if out == nil {
+		out = os.Stdout
+	}
+
+	var failed []string
+	for _, c := range checks {
+		if err := c.Verify(ctx); err != nil {
+			_, _ = fmt.Fprintf(out, "FAIL %s\n  %s\n", c.Name, strings.ReplaceAll(err.Error(), "\n", "\n  "))
+			failed = append(failed, c.Name)
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "PASS %s\n", c.Name)
+	}
+
+	if len(failed) > 0 {
+		config.exitHandler.Error(fmt.Errorf("%d of %d checks failed: %s", len(failed), len(checks), strings.Join(failed, "; ")))
+		return
+	}
+
+	config.exitHandler.Pass()
+}
+
+// VerifyMain is called by the main function of a buildpack's diagnostic binary. It runs Verify with the default
+// configuration.
+func VerifyMain(checks ...Check) {
+	Verify(checks, NewConfig())
+}
+
+func verifyBuildpackTOML(context VerifyContext) error {
+	var problems []string
+
+	if context.Buildpack.Info.ID == "" {
+		problems = append(problems, "buildpack.id must be set")
+	}
+	if context.Buildpack.Info.Version == "" {
+		problems = append(problems, "buildpack.version must be set")
+	}
+
+	if api, err := semver.NewVersion(context.Buildpack.API); err != nil {
+		problems = append(problems, fmt.Sprintf("api %q cannot be parsed", context.Buildpack.API))
+	} else {
+		c, _ := semver.NewConstraint(fmt.Sprintf(">= %s, <= %s", MinSupportedBPVersion, MaxSupportedBPVersion))
+		if !c.Check(api) {
+			problems = append(problems, fmt.Sprintf("api %s is not supported by this version of libcnb, expected >= %s, <= %s",
+				context.Buildpack.API, MinSupportedBPVersion, MaxSupportedBPVersion))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
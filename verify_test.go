@@ -0,0 +1,168 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/buildpacks/libcnb/v2"
+	"github.com/buildpacks/libcnb/v2/log"
+	"github.com/buildpacks/libcnb/v2/mocks"
+)
+
+func testVerify(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		buildpackPath string
+		exitHandler   *mocks.ExitHandler
+		out           *bytes.Buffer
+	)
+
+	it.Before(func() {
+		buildpackPath = t.TempDir()
+		out = &bytes.Buffer{}
+		t.Setenv("CNB_BUILDPACK_DIR", buildpackPath)
+
+		Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"), []byte(`
+api = "0.10"
+
+[buildpack]
+id = "test-id"
+version = "1.1.1"
+
+[metadata]
+test-key = "test-value"
+
+[[metadata.dependencies]]
+id = "test-dependency"
+version = "2.2.2"
+uri = "https://localhost/test-dependency.tgz"
+sha256 = "test-sha256"
+
+[[metadata.dependencies]]
+id = "other-dependency"
+version = "3.3.3"
+`), 0600)).To(Succeed())
+
+		Expect(os.MkdirAll(filepath.Join(buildpackPath, "bin"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(buildpackPath, "bin", "test-execd"), []byte{}, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(buildpackPath, "bin", "other-execd"), []byte{}, 0644)).To(Succeed())
+
+		exitHandler = &mocks.ExitHandler{}
+		exitHandler.On("Error", mock.Anything)
+		exitHandler.On("Pass")
+	})
+
+	verify := func(checks ...libcnb.Check) {
+		libcnb.Verify(checks, libcnb.NewConfig(
+			libcnb.WithExitHandler(exitHandler),
+			libcnb.WithVerifyOutput(out),
+			libcnb.WithLogger(log.NewDiscard())),
+		)
+	}
+
+	it("passes when all checks pass", func() {
+		verify(
+			libcnb.RequireMetadata("test-key"),
+			libcnb.RequireDependencies("test-dependency"),
+			libcnb.RequireExecD("test-execd"),
+		)
+
+		Expect(exitHandler.Calls).To(HaveLen(1))
+		Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+		Expect(out.String()).To(Equal(`PASS buildpack.toml
+PASS metadata contains test-key
+PASS dependencies include test-dependency
+PASS exec.d executables test-execd
+`))
+	})
+
+	it("reports every failed check", func() {
+		verify(
+			libcnb.RequireMetadata("test-key", "dne"),
+			libcnb.RequireDependencies("test-dependency", "other-dependency", "dne"),
+			libcnb.RequireExecD("test-execd", "other-execd"),
+		)
+
+		Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("3 of 4 checks failed: " +
+			"metadata contains test-key, dne; " +
+			"dependencies include test-dependency, other-dependency, dne; " +
+			"exec.d executables test-execd, other-execd"))
+		Expect(out.String()).To(ContainSubstring("PASS buildpack.toml\nFAIL metadata contains test-key, dne\n  missing metadata dne\n"))
+		Expect(out.String()).To(ContainSubstring("FAIL dependencies include test-dependency, other-dependency, dne\n" +
+			"  dependency other-dependency 3.3.3 must declare uri and sha256\n  missing dependency dne\n"))
+	})
+
+	it("validates buildpack.toml", func() {
+		Expect(os.WriteFile(filepath.Join(buildpackPath, "buildpack.toml"), []byte(`api = "0.1"`), 0600)).To(Succeed())
+
+		verify()
+
+		Expect(exitHandler.Calls[0].Arguments.Get(0)).To(MatchError("1 of 1 checks failed: buildpack.toml"))
+	})
+
+	it("locates the buildpack from the command path", func() {
+		Expect(os.Unsetenv("CNB_BUILDPACK_DIR")).To(Succeed())
+
+		libcnb.Verify(nil, libcnb.NewConfig(
+			libcnb.WithArguments([]string{filepath.Join(buildpackPath, "bin", "verify")}),
+			libcnb.WithExitHandler(exitHandler),
+			libcnb.WithVerifyOutput(out),
+			libcnb.WithLogger(log.NewDiscard())),
+		)
+
+		Expect(exitHandler.Calls[0].Method).To(Equal("Pass"))
+	})
+
+	context("checks", func() {
+		var ctx libcnb.VerifyContext
+
+		it.Before(func() {
+			ctx = libcnb.VerifyContext{Buildpack: libcnb.Buildpack{
+				Path: buildpackPath,
+				Metadata: map[string]interface{}{
+					"dependencies": []map[string]interface{}{
+						{"id": "other-dependency", "version": "3.3.3"},
+					},
+				},
+			}}
+		})
+
+		it("describes missing metadata", func() {
+			Expect(libcnb.RequireMetadata("dne").Verify(ctx)).To(MatchError("missing metadata dne"))
+		})
+
+		it("describes missing and incomplete dependencies", func() {
+			Expect(libcnb.RequireDependencies("other-dependency", "dne").Verify(ctx)).To(MatchError(
+				"dependency other-dependency 3.3.3 must declare uri and sha256\nmissing dependency dne"))
+		})
+
+		it("describes missing and non-executable exec.d executables", func() {
+			Expect(libcnb.RequireExecD("other-execd", "dne").Verify(ctx)).To(MatchError(
+				"exec.d executable " + filepath.Join(buildpackPath, "bin", "other-execd") + " is not executable\n" +
+					"missing exec.d executable " + filepath.Join(buildpackPath, "bin", "dne")))
+		})
+	})
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2018-2024 the original author or authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libcnb
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// modulePath is the path of the libcnb module.
+const modulePath = "github.com/buildpacks/libcnb/v2"
+
+// version is the version of libcnb. It can be set when building a buildpack with
+// -ldflags "-X github.com/buildpacks/libcnb/v2.version=<version>", and otherwise is read from the module information
+// embedded in the binary.
+var version string
+
+// Version returns the version of libcnb the buildpack was built with. It is "(devel)" when libcnb is the main module and
+// "unknown" when no module information is embedded in the binary.
+func Version() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	for _, d := range info.Deps {
+		if d.Path != modulePath {
+			continue
+		}
+		if d.Replace != nil && d.Replace.Version != "" {
+			return d.Replace.Version
+		}
+		return d.Version
+	}
+
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+
+	return "unknown"
+}
+
+// UserAgent returns the User-Agent libcnb sends with HTTP requests, such as those made to download dependencies.
+func UserAgent() string {
+	return fmt.Sprintf("libcnb/%s", Version())
+}